@@ -0,0 +1,216 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// Secciones del formato de analystTemplate. Se reconocen por palabra clave
+// y no por el título exacto, porque el modelo a veces lo cambia un poco o
+// lo traduce; el orden importa: el título de los verbatims también dice
+// "topics".
+var analystSectionKeys = []struct {
+	key   string
+	words []string
+}{
+	{"verbatims", []string{"verbatim", "cita", "ejemplo"}},
+	{"summary", []string{"summary", "resumen", "resumo"}},
+	{"pain_points", []string{"pain", "dolor"}},
+	{"actionable", []string{"actionable", "accionable", "acionável"}},
+	{"topics", []string{"topic", "tema", "tópico"}},
+}
+
+var (
+	// viñeta o número al principio de un ítem: "- ", "* ", "• ", "1. ", "2) "
+	bulletMarker = regexp.MustCompile(`^(?:[-*•·–]|\d{1,2}[.)])\s+`)
+	// "2. " en medio de una línea: los temas a veces vienen todos juntos
+	// ("1. Uno (40%) 2. Dos (30%)"), como en el ejemplo del template
+	inlineNumber = regexp.MustCompile(`\s\d{1,2}[.)]\s+`)
+	// el porcentaje de un tema: "(40%)", "40 %", "(12,5%)"
+	topicPct = regexp.MustCompile(`\(?\s*(\d+(?:[.,]\d+)?)\s*%\s*\)?`)
+	quoted   = regexp.MustCompile(`"([^"]+)"|“([^”]+)”|«([^»]+)»`)
+)
+
+// parseAnalystReport arma el AnalystReport de una respuesta con el formato de
+// analystTemplate. Tolera markdown alrededor de los títulos, contenido en la
+// misma línea del título, viñetas o números y temas en una sola línea. nil si
+// no reconoce ninguna sección.
+func parseAnalystReport(text string) *internal.AnalystReport {
+	sections := splitSections(text)
+	if len(sections) == 0 {
+		return nil
+	}
+	return &internal.AnalystReport{
+		Summary:    strings.Join(nonEmptyLines(sections["summary"]), "\n"),
+		PainPoints: listItems(sections["pain_points"]),
+		Actionable: listItems(sections["actionable"]),
+		Topics:     parseTopics(sections["topics"]),
+		Verbatims:  parseVerbatims(sections["verbatims"]),
+	}
+}
+
+// structuredAnalysis devuelve el reporte de text solo si está activado
+// (ANALYST_STRUCTURED) y la respuesta es del modo analyst: los demás
+// templates tienen otras secciones.
+func structuredAnalysis(on bool, mode, text string) *internal.AnalystReport {
+	if !on || mode != "analyst" {
+		return nil
+	}
+	return parseAnalystReport(text)
+}
+
+// splitSections separa el cuerpo de cada sección reconocida, por clave. Las
+// secciones desconocidas se descartan; una repetida se agrega a la primera.
+func splitSections(text string) map[string]string {
+	out := make(map[string]string)
+	current := ""
+	for _, line := range strings.Split(text, "\n") {
+		title, ok := sectionTitle(line)
+		if !ok {
+			if current != "" {
+				out[current] += line + "\n"
+			}
+			continue
+		}
+		title, rest := splitTitle(title)
+		current = analystSectionKey(title)
+		if current == "" {
+			continue
+		}
+		if _, seen := out[current]; !seen {
+			out[current] = ""
+		}
+		if rest != "" {
+			out[current] += rest + "\n"
+		}
+	}
+	return out
+}
+
+// splitTitle separa el título de una sección del contenido que el modelo
+// puso en la misma línea: "Summary: texto", "Summary [texto]" o "Top 3
+// Topics 1. Uno (40%) ...".
+func splitTitle(line string) (title, rest string) {
+	i := strings.IndexAny(line, ":[")
+	if loc := inlineNumber.FindStringIndex(line); loc != nil && (i < 0 || loc[0] < i) {
+		return strings.TrimSpace(line[:loc[0]]), strings.TrimSpace(line[loc[0]:])
+	}
+	if i < 0 {
+		return line, ""
+	}
+	return strings.TrimSpace(line[:i]), strings.Trim(strings.TrimRight(line[i+1:], "]"), "*_ ")
+}
+
+// analystSectionKey devuelve la clave de la sección con ese título; "" si no
+// es ninguna.
+func analystSectionKey(title string) string {
+	title = strings.ToLower(title)
+	for _, s := range analystSectionKeys {
+		for _, w := range s.words {
+			if strings.Contains(title, w) {
+				return s.key
+			}
+		}
+	}
+	return ""
+}
+
+func nonEmptyLines(body string) []string {
+	var out []string
+	for _, line := range strings.Split(body, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// cleanItem quita la viñeta y el markdown de énfasis de un ítem.
+func cleanItem(line string) string {
+	line = strings.TrimSpace(line)
+	line = bulletMarker.ReplaceAllString(line, "")
+	return strings.TrimSpace(strings.ReplaceAll(line, "**", ""))
+}
+
+// listItems devuelve los ítems de una lista con viñetas; cada línea no vacía
+// es un ítem.
+func listItems(body string) []string {
+	var out []string
+	for _, line := range nonEmptyLines(body) {
+		if item := cleanItem(line); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseTopics lee los temas y su porcentaje de menciones, uno por línea o
+// varios numerados en la misma.
+func parseTopics(body string) []internal.ReportTopic {
+	var out []internal.ReportTopic
+	for _, line := range nonEmptyLines(body) {
+		line = bulletMarker.ReplaceAllString(line, "")
+		start := 0
+		for _, loc := range append(inlineNumber.FindAllStringIndex(line, -1), []int{len(line), len(line)}) {
+			part := line[start:loc[0]]
+			start = loc[1]
+			if t, ok := parseTopic(part); ok {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+func parseTopic(s string) (internal.ReportTopic, bool) {
+	s = cleanItem(s)
+	var t internal.ReportTopic
+	if m := topicPct.FindAllStringSubmatchIndex(s, -1); len(m) > 0 {
+		last := m[len(m)-1]
+		if v, err := strconv.ParseFloat(strings.Replace(s[last[2]:last[3]], ",", ".", 1), 64); err == nil {
+			t.Pct = &v
+		}
+		s = s[:last[0]] + s[last[1]:]
+	}
+	t.Name = strings.TrimSpace(strings.Trim(strings.TrimSpace(s), ":-–—"))
+	return t, t.Name != ""
+}
+
+// parseVerbatims agrupa las citas por tema. Un tema es una línea sin
+// comillas (o lo que precede a las comillas en "Tema: "cita""); las citas
+// son el texto entre comillas o, bajo un tema, las viñetas sin comillas.
+func parseVerbatims(body string) []internal.TopicVerbatims {
+	var out []internal.TopicVerbatims
+	for _, line := range nonEmptyLines(body) {
+		bullet := bulletMarker.MatchString(line)
+		item := cleanItem(line)
+		quotes := quoted.FindAllStringSubmatch(item, -1)
+		switch {
+		case len(quotes) > 0:
+			if head := item[:strings.IndexAny(item, "\"“«")]; strings.Trim(head, " :-–—") != "" {
+				out = append(out, internal.TopicVerbatims{Topic: strings.Trim(head, " :-–—")})
+			}
+			if len(out) == 0 {
+				out = append(out, internal.TopicVerbatims{})
+			}
+			for _, q := range quotes {
+				out[len(out)-1].Quotes = append(out[len(out)-1].Quotes, strings.TrimSpace(q[1]+q[2]+q[3]))
+			}
+		case bullet && len(out) > 0 && !strings.HasSuffix(item, ":"):
+			out[len(out)-1].Quotes = append(out[len(out)-1].Quotes, item)
+		default:
+			out = append(out, internal.TopicVerbatims{Topic: strings.TrimSuffix(item, ":")})
+		}
+	}
+	// los temas sin citas no aportan
+	kept := out[:0]
+	for _, v := range out {
+		if len(v.Quotes) > 0 {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func pct(v float64) *float64 { return &v }
+
+func TestParseAnalystReport(t *testing.T) {
+	wellFormed := `--- Summary
+Los clientes se quejan de la velocidad de la app.
+--- Main Pain Points & Needs
+- La app tarda en cargar
+- Los pagos fallan
+--- Actionable Feedback
+1. Optimizar el inicio
+2. Reintentar los pagos
+--- Top 3 Topics and (%) of Mentions
+1. Velocidad (45%)
+2. Pagos (30%)
+3. Soporte (12,5%)
+--- Examples of Verbatim for those main topics
+Velocidad:
+- "tarda una eternidad"
+- "se cuelga al abrir"
+Pagos:
+- "me cobraron dos veces"`
+	want := &internal.AnalystReport{
+		Summary:    "Los clientes se quejan de la velocidad de la app.",
+		PainPoints: []string{"La app tarda en cargar", "Los pagos fallan"},
+		Actionable: []string{"Optimizar el inicio", "Reintentar los pagos"},
+		Topics:     []internal.ReportTopic{{Name: "Velocidad", Pct: pct(45)}, {Name: "Pagos", Pct: pct(30)}, {Name: "Soporte", Pct: pct(12.5)}},
+		Verbatims: []internal.TopicVerbatims{
+			{Topic: "Velocidad", Quotes: []string{"tarda una eternidad", "se cuelga al abrir"}},
+			{Topic: "Pagos", Quotes: []string{"me cobraron dos veces"}},
+		},
+	}
+	if got := parseAnalystReport(wellFormed); !reflect.DeepEqual(got, want) {
+		g, _ := json.MarshalIndent(got, "", "  ")
+		t.Errorf("reporte:\n%s", g)
+	}
+
+	// markdown, contenido en la línea del título, títulos en español y los
+	// temas todos juntos
+	drift := `**--- Resumen:** Los clientes se quejan de la velocidad.
+## --- Puntos de dolor
+* La app tarda en cargar
+--- Feedback accionable
+• Optimizar el inicio
+--- Top 3 Temas 1. Velocidad (45%) 2. Pagos (30 %) 3. Soporte
+--- Ejemplos de citas
+Velocidad: "tarda una eternidad" y “se cuelga al abrir”`
+	want = &internal.AnalystReport{
+		Summary:    "Los clientes se quejan de la velocidad.",
+		PainPoints: []string{"La app tarda en cargar"},
+		Actionable: []string{"Optimizar el inicio"},
+		Topics:     []internal.ReportTopic{{Name: "Velocidad", Pct: pct(45)}, {Name: "Pagos", Pct: pct(30)}, {Name: "Soporte"}},
+		Verbatims:  []internal.TopicVerbatims{{Topic: "Velocidad", Quotes: []string{"tarda una eternidad", "se cuelga al abrir"}}},
+	}
+	if got := parseAnalystReport(drift); !reflect.DeepEqual(got, want) {
+		g, _ := json.MarshalIndent(got, "", "  ")
+		t.Errorf("reporte con variaciones:\n%s", g)
+	}
+
+	if got := parseAnalystReport("Hola, ¿en qué te ayudo?"); got != nil {
+		t.Errorf("sin formato: %+v", got)
+	}
+	if structuredAnalysis(false, "analyst", wellFormed) != nil || structuredAnalysis(true, "plain", wellFormed) != nil {
+		t.Error("structuredAnalysis sin ANALYST_STRUCTURED o fuera del modo analyst")
+	}
+}
+
+func TestSendMessageStructured(t *testing.T) {
+	r := newOllamaRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"message": map[string]string{"role": "assistant", "content": completeReply}, "done": true})
+	}, map[string]string{"ANALYST_STRUCTURED": "true"})
+
+	var res internal.SendMessageResponse
+	decode(t, call(r, "POST", "/api/messages", `{"content":"Hazme un análisis de las encuestas"}`, "X-Session-ID", "s-struct"), &res)
+	if a := res.Analysis; a == nil || a.Summary != "La app es lenta." || len(a.Topics) != 1 || *a.Topics[0].Pct != 60 || res.Reply.Content != completeReply {
+		t.Errorf("analysis = %+v", res.Analysis)
+	}
+	var plain internal.SendMessageResponse
+	decode(t, call(r, "POST", "/api/messages", `{"content":"hola"}`, "X-Session-ID", "s-struct"), &plain)
+	if plain.Analysis != nil {
+		t.Errorf("modo plain con analysis: %+v", plain.Analysis)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+	"github.com/nubank/lola-ia-backend/internal/textnorm"
+)
+
+const (
+	// answerCacheHeader es "hit" cuando la respuesta salió del cache.
+	answerCacheHeader     = "X-Lola-Cache"
+	defaultAnswerCacheTTL = time.Hour
+	defaultAnswerCacheMax = 500
+)
+
+// answer es una respuesta de análisis guardada.
+type answer struct {
+	key     string
+	reply   string
+	sources []string
+	expires time.Time
+	elem    *list.Element
+}
+
+// answerCache guarda las respuestas del modo análisis (o de un template) por
+// consulta y archivos cargados, para no volver a pagar la misma pregunta
+// sobre los mismos datos. Cualquier cambio en los archivos lo vacía.
+type answerCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]*answer
+	order   *list.List // en orden de alta
+	m       *metrics
+}
+
+// newAnswerCache devuelve nil (sin cache) salvo que ANSWER_CACHE=true.
+func newAnswerCache(enabled bool, ttl time.Duration, max int, m *metrics) *answerCache {
+	if !enabled {
+		return nil
+	}
+	fmt.Printf("[messages] cache de respuestas de análisis activado (%d entradas, %s)\n", max, ttl)
+	return &answerCache{ttl: ttl, max: max, entries: make(map[string]*answer), order: list.New(), m: m}
+}
+
+// answerKey resume lo que decide la respuesta: la consulta normalizada
+// (mayúsculas, acentos y espacios no cuentan), el modo, el modelo, el idioma,
+// los filtros, los tags y el nombre y tamaño de cada archivo que puede entrar
+// en el contexto.
+func answerKey(req internal.SendMessageRequest, mode, model string, files []internal.KnowledgeFile) string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = fmt.Sprintf("%s:%d", f.Name, f.Size)
+	}
+	sort.Strings(names)
+	filters, _ := json.Marshal(req.Filters) // las claves de un map salen ordenadas
+	h := sha256.New()
+	for _, part := range []string{
+		strings.Join(strings.Fields(textnorm.Fold(req.Content)), " "),
+		mode, model, req.Language, string(filters),
+		strings.Join(store.NormalizeTags(req.Tags), ","),
+		strings.Join(names, "\n"),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get devuelve la respuesta guardada para key y cuenta el hit o el miss.
+func (c *answerCache) get(key string) (reply string, sources []string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a, found := c.entries[key]
+	if found && time.Now().After(a.expires) {
+		c.remove(a)
+		found = false
+	}
+	if !found {
+		c.m.answerCache.WithLabelValues("miss").Inc()
+		return "", nil, false
+	}
+	c.m.answerCache.WithLabelValues("hit").Inc()
+	return a.reply, a.sources, true
+}
+
+// put guarda reply para key; si el cache está lleno se descarta la más vieja.
+func (c *answerCache) put(key, reply string, sources []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[key]; ok {
+		c.remove(old)
+	}
+	for c.order.Len() >= c.max {
+		c.remove(c.order.Front().Value.(*answer))
+	}
+	a := &answer{key: key, reply: reply, sources: sources, expires: time.Now().Add(c.ttl)}
+	a.elem = c.order.PushBack(a)
+	c.entries[key] = a
+}
+
+// invalidate vacía el cache; se llama cada vez que cambian los archivos.
+func (c *answerCache) invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := len(c.entries); n > 0 {
+		fmt.Printf("[messages] archivos modificados; se descartan %d respuesta(s) del cache\n", n)
+	}
+	clear(c.entries)
+	c.order.Init()
+}
+
+// remove saca a del cache. Requiere c.mu tomado.
+func (c *answerCache) remove(a *answer) {
+	delete(c.entries, a.key)
+	c.order.Remove(a.elem)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+func TestAnswerKey(t *testing.T) {
+	files := []internal.KnowledgeFile{{Name: "a.csv", Size: 10}, {Name: "b.csv", Size: 20}}
+	key := func(content string, files ...internal.KnowledgeFile) string {
+		return answerKey(internal.SendMessageRequest{Content: content}, "analyst", "m", files)
+	}
+	base := key("¿Cuál es el NPS?", files...)
+	if k := key("  ¿cual es el   nps? ", files[1], files[0]); k != base {
+		t.Error("mayúsculas, acentos, espacios u orden de archivos cambiaron la clave")
+	}
+	for name, k := range map[string]string{
+		"otra consulta":   key("¿Cuál es el CSAT?", files...),
+		"otro tamaño":     key("¿Cuál es el NPS?", files[0], internal.KnowledgeFile{Name: "b.csv", Size: 21}),
+		"un archivo más":  key("¿Cuál es el NPS?", append(files, internal.KnowledgeFile{Name: "c.csv"})...),
+		"otro modo":       answerKey(internal.SendMessageRequest{Content: "¿Cuál es el NPS?"}, "nps", "m", files),
+		"otro idioma":     answerKey(internal.SendMessageRequest{Content: "¿Cuál es el NPS?", Language: "en"}, "analyst", "m", files),
+		"con tags":        answerKey(internal.SendMessageRequest{Content: "¿Cuál es el NPS?", Tags: []string{"pix"}}, "analyst", "m", files),
+		"con otro modelo": answerKey(internal.SendMessageRequest{Content: "¿Cuál es el NPS?"}, "analyst", "m2", files),
+	} {
+		if k == base {
+			t.Errorf("%s: misma clave", name)
+		}
+	}
+}
+
+func TestAnswerCacheBounds(t *testing.T) {
+	c := newAnswerCache(true, time.Minute, 2, newMetrics(store.NewMemoryStore()))
+	for i := 0; i < 3; i++ {
+		c.put(fmt.Sprint(i), "r", nil)
+	}
+	if _, _, ok := c.get("0"); ok {
+		t.Error("la más vieja no se descartó")
+	}
+	if reply, _, ok := c.get("2"); !ok || reply != "r" {
+		t.Errorf("get(2) = %q, %v", reply, ok)
+	}
+
+	c = newAnswerCache(true, time.Millisecond, 10, newMetrics(store.NewMemoryStore()))
+	c.put("k", "r", nil)
+	time.Sleep(5 * time.Millisecond)
+	if _, _, ok := c.get("k"); ok || len(c.entries) != 0 {
+		t.Error("una respuesta vencida se devolvió o quedó guardada")
+	}
+	if newAnswerCache(false, time.Minute, 10, nil) != nil {
+		t.Error("sin ANSWER_CACHE debería no haber cache")
+	}
+}
+
+func TestSendMessageAnswerCache(t *testing.T) {
+	var calls atomic.Int32
+	// sin la ventana de duplicados, que la repetida la conteste el cache; sin
+	// revisar el formato, que el stub no arma las secciones
+	r := newCountingRouter(t, &calls, map[string]string{"ANSWER_CACHE": "true", "DEDUP_WINDOW": "1ns", "ANALYST_FORMAT_CHECK": "off"})
+	sid := []string{"X-Session-ID", "s-cache"}
+	ask := func() string {
+		t.Helper()
+		w := call(r, "POST", "/api/messages", `{"content":"Hazme un análisis de las encuestas"}`, sid...)
+		if w.Code != 200 {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		return w.Header().Get(answerCacheHeader)
+	}
+	upload := func(name string) {
+		call(r, "POST", "/api/files", `{"files":[{"name":"`+name+`","text":"id,comentario\n1,lenta\n"}]}`, sid...)
+	}
+	upload("a.csv")
+
+	steps := []struct {
+		name   string
+		before func()
+		hit    bool
+		calls  int32
+	}{
+		{"primera vez", nil, false, 1},
+		{"la misma consulta", nil, true, 1},
+		{"después de un upload", func() { upload("b.csv") }, false, 2},
+		{"otra vez", nil, true, 2},
+		{"después de borrar", func() { call(r, "DELETE", "/api/files/b.csv", "", sid...) }, false, 3},
+		{"otra vez", nil, true, 3},
+	}
+	for _, s := range steps {
+		if s.before != nil {
+			s.before()
+		}
+		if hit := ask() == "hit"; hit != s.hit {
+			t.Errorf("%s: hit = %v, want %v", s.name, hit, s.hit)
+		}
+		if got := calls.Load(); got != s.calls {
+			t.Errorf("%s: %d llamadas al proveedor, want %d", s.name, got, s.calls)
+		}
+	}
+
+	body := call(r, "GET", "/metrics", "").Body.String()
+	for _, want := range []string{`lola_answer_cache_total{result="hit"} 3`, `lola_answer_cache_total{result="miss"} 3`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics sin %q", want)
+		}
+	}
+}
+
+func TestSendMessageAnswerCacheIncomplete(t *testing.T) {
+	// una respuesta a la que le faltan secciones no se guarda
+	var calls atomic.Int32
+	r := newCountingRouter(t, &calls, map[string]string{"ANSWER_CACHE": "true", "DEDUP_WINDOW": "1ns"})
+	for i := 0; i < 2; i++ {
+		w := call(r, "POST", "/api/messages", `{"content":"Hazme un análisis de las encuestas"}`, "X-Session-ID", "s-cache")
+		if w.Header().Get(answerCacheHeader) == "hit" {
+			t.Error("una respuesta incompleta salió del cache")
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d llamadas al proveedor, want 2", n)
+	}
+}
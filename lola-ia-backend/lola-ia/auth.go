@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authNamespaceKey es la clave del gin.Context donde queda el identificador
+// de la API key usada; sessionID lo antepone al ID de sesión.
+const authNamespaceKey = "auth_namespace"
+
+// apiKey es una key válida guardada como hash: así todas se comparan con el
+// mismo largo y el tiempo no revela cuánto coincidió.
+type apiKey struct {
+	hash [32]byte
+	id   string // prefijo del hash, seguro para usar en el store y en logs
+}
+
+// parseAPIKeys separa la lista API_KEYS (separada por comas).
+func parseAPIKeys(v string) []apiKey {
+	var out []apiKey
+	for _, k := range strings.Split(v, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			h := sha256.Sum256([]byte(k))
+			out = append(out, apiKey{hash: h, id: hex.EncodeToString(h[:6])})
+		}
+	}
+	return out
+}
+
+// matchAPIKey devuelve la key que coincide con token. Recorre todas sin
+// cortar antes para que el tiempo no dependa de cuál coincidió.
+func matchAPIKey(keys []apiKey, token string) (apiKey, bool) {
+	h := sha256.Sum256([]byte(token))
+	var (
+		found apiKey
+		ok    bool
+	)
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare(h[:], k.hash[:]) == 1 {
+			found, ok = k, true
+		}
+	}
+	return found, ok
+}
+
+// authMiddleware exige "Authorization: Bearer <key>" con una de keys y
+// responde 401 si falta o no es válida. Las rutas en public no se controlan.
+func authMiddleware(keys []apiKey, public ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(public))
+	for _, p := range public {
+		skip[p] = true
+	}
+	return func(c *gin.Context) {
+		if skip[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || strings.TrimSpace(token) == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="lola-ia"`)
+			c.AbortWithStatusJSON(401, gin.H{"error": "falta el header Authorization: Bearer <api key>"})
+			return
+		}
+		key, ok := matchAPIKey(keys, strings.TrimSpace(token))
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="lola-ia", error="invalid_token"`)
+			c.AbortWithStatusJSON(401, gin.H{"error": "api key inválida"})
+			return
+		}
+		c.Set(authNamespaceKey, key.id)
+		c.Next()
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestAuth(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"API_KEYS": "key-a, key-b,"})
+	cases := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"key válida", "/api/messages", "Bearer key-a", 200},
+		{"otra key válida", "/api/messages", "Bearer key-b", 200},
+		{"key inválida", "/api/messages", "Bearer key-c", 401},
+		{"prefijo de una key", "/api/messages", "Bearer key", 401},
+		{"sin Bearer", "/api/messages", "key-a", 401},
+		{"Bearer vacío", "/api/messages", "Bearer ", 401},
+		{"sin header", "/api/messages", "", 401},
+		{"/health es público", "/health", "", 200},
+	}
+	for _, tc := range cases {
+		var hdr []string
+		if tc.header != "" {
+			hdr = []string{"Authorization", tc.header}
+		}
+		w := call(r, "GET", tc.path, "", hdr...)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want)
+		}
+		if w.Code == 401 && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: 401 sin WWW-Authenticate", tc.name)
+		}
+	}
+}
+
+func TestAuthNamespacesSessions(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"API_KEYS": "key-a,key-b"})
+	send := func(key string) {
+		t.Helper()
+		w := call(r, "POST", "/api/messages", `{"content":"hola"}`, "Authorization", "Bearer "+key, "X-Session-ID", "s1")
+		if w.Code != 200 {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+	history := func(key string) int {
+		t.Helper()
+		var h internal.ChatHistory
+		decode(t, call(r, "GET", "/api/messages", "", "Authorization", "Bearer "+key, "X-Session-ID", "s1"), &h)
+		return len(h.Messages)
+	}
+	send("key-a")
+	// el mismo X-Session-ID con otra key es otra conversación
+	if a, b := history("key-a"), history("key-b"); a != 3 || b != 1 {
+		t.Errorf("key-a: %d mensajes, key-b: %d; want 3 y 1", a, b)
+	}
+}
+
+func TestMatchAPIKey(t *testing.T) {
+	keys := parseAPIKeys(" uno ,dos")
+	if len(keys) != 2 {
+		t.Fatalf("parseAPIKeys: %d keys", len(keys))
+	}
+	if k, ok := matchAPIKey(keys, "dos"); !ok || k.id != keys[1].id {
+		t.Errorf("matchAPIKey(dos) = %+v, %v", k, ok)
+	}
+	if _, ok := matchAPIKey(keys, "tres"); ok {
+		t.Error("matchAPIKey(tres) coincidió")
+	}
+	if keys[0].id == keys[1].id || len(keys[0].id) != 12 {
+		t.Errorf("ids = %q, %q", keys[0].id, keys[1].id)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Un upload JSON con MAX_TOTAL_BYTES de archivos más el escapado entra.
+const defaultMaxRequestBytes = 32 << 20
+
+// bodyLimitMiddleware acota el body de los requests a max bytes
+// (MAX_REQUEST_BYTES) y responde 413 si lo supera, antes de que un handler
+// lo lea entero a memoria. GET, HEAD y OPTIONS no se revisan.
+func bodyLimitMiddleware(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > max {
+			tooLarge(c, max)
+			return
+		}
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		if c.Request.ContentLength < 0 {
+			// chunked: sin largo declarado hay que leerlo para saber si
+			// se pasa; si no, el handler vería un JSON cortado y daría 400
+			b, err := io.ReadAll(body)
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				tooLarge(c, max)
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(400, gin.H{"error": "no se pudo leer el body"})
+				return
+			}
+			body = io.NopCloser(bytes.NewReader(b))
+			c.Request.ContentLength = int64(len(b))
+		}
+		c.Request.Body = body
+		c.Next()
+	}
+}
+
+func tooLarge(c *gin.Context, max int64) {
+	fmt.Printf("[server] body de %s %s rechazado: supera %d bytes\n", c.Request.Method, c.Request.URL.Path, max)
+	// el resto del body no se lee: que el cliente no reuse la conexión
+	c.Header("Connection", "close")
+	c.AbortWithStatusJSON(413, gin.H{"error": fmt.Sprintf("el body supera el máximo de %d bytes", max), "max": max})
+}
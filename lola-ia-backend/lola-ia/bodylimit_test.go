@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"MAX_REQUEST_BYTES": "200"})
+	big := `{"files":[{"name":"a.csv","text":"` + strings.Repeat("x", 500) + `"}]}`
+
+	w := call(r, "POST", "/api/files", big)
+	if w.Code != 413 {
+		t.Fatalf("POST sobre el límite = %d, want 413: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Max int64 `json:"max"`
+	}
+	decode(t, w, &resp)
+	if resp.Max != 200 || w.Header().Get("Connection") != "close" {
+		t.Errorf("max = %d, Connection = %q", resp.Max, w.Header().Get("Connection"))
+	}
+
+	// chunked: sin Content-Length igual se corta
+	req := httptest.NewRequest("POST", "/api/files", io.MultiReader(strings.NewReader(big)))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 413 {
+		t.Errorf("POST chunked sobre el límite = %d, want 413", w.Code)
+	}
+
+	// dentro del límite llega al handler
+	if w := call(r, "POST", "/api/files", `{"files":[{"name":"a.csv","text":"id\n1\n"}]}`); w.Code != 200 {
+		t.Errorf("POST dentro del límite = %d: %s", w.Code, w.Body)
+	}
+	// los GET no se revisan
+	if w := call(r, "GET", "/health", big); w.Code == 413 {
+		t.Errorf("GET con body = 413")
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+const (
+	defaultBreakerWindow   = time.Minute
+	defaultBreakerCooldown = 30 * time.Second
+
+	// degradedReply es lo que ve el usuario mientras el breaker está abierto.
+	degradedReply = "Lola IA no puede consultar al modelo en este momento, así que esta es una respuesta automática. " +
+		"Tu mensaje no se procesó: intenta de nuevo en unos minutos."
+)
+
+// errProviderDown: el breaker está abierto y no se llamó al proveedor.
+var errProviderDown = errors.New("proveedor no disponible por fallas repetidas")
+
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // normal
+	breakerOpen                         // no se llama al proveedor
+	breakerHalfOpen                     // pasó el cooldown: el próximo request prueba
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker es un circuit breaker para el proveedor de chat: después de
+// threshold fallas seguidas dentro de window se abre y durante cooldown no
+// se llama al proveedor. Pasado el cooldown un único request hace de prueba:
+// si sale bien se cierra y si no vuelve a abrirse.
+type breaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int       // fallas seguidas
+	since    time.Time // primera de esas fallas
+	openedAt time.Time
+	probing  bool // hay un request de prueba en curso
+}
+
+// newBreaker devuelve nil (sin breaker) si threshold <= 0.
+func newBreaker(threshold int, window, cooldown time.Duration) *breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	fmt.Printf("[provider] circuit breaker: %d fallas en %s lo abren por %s\n", threshold, window, cooldown)
+	return &breaker{threshold: threshold, window: window, cooldown: cooldown}
+}
+
+// allow indica si se puede llamar al proveedor. Con el breaker abierto y el
+// cooldown cumplido deja pasar un request de prueba: probe es true solo para
+// ese, y el caller lo devuelve en record.
+func (b *breaker) allow() (probe, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		b.state = breakerHalfOpen
+	}
+	switch b.state {
+	case breakerClosed:
+		return false, true
+	case breakerHalfOpen:
+		if b.probing {
+			return false, false
+		}
+		b.probing = true
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// record registra el resultado de una llamada; probe es lo que devolvió
+// allow. Solo la prueba decide si el breaker half-open se cierra o vuelve a
+// abrirse: una llamada anterior que termina durante el half-open cuenta
+// como cualquier otra. Las cancelaciones del cliente no cuentan ni como
+// falla ni como éxito, y tampoco un modelo inexistente (un error de
+// configuración) o un pedido demasiado largo: el proveedor responde.
+func (b *breaker) record(probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		// cancelada, deja lugar a otra prueba
+		b.probing = false
+	}
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, provider.ErrModelNotFound), errors.Is(err, provider.ErrContextLength):
+		return
+	case err == nil:
+		if b.state != breakerClosed {
+			fmt.Printf("[provider] el proveedor respondió; circuit breaker cerrado\n")
+		}
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+	now := time.Now()
+	if probe && b.state == breakerHalfOpen {
+		b.state, b.openedAt = breakerOpen, now
+		fmt.Printf("[provider] falló el request de prueba (%v); circuit breaker abierto otros %s\n", err, b.cooldown)
+		return
+	}
+	if b.failures == 0 || now.Sub(b.since) > b.window {
+		b.failures, b.since = 0, now
+	}
+	b.failures++
+	if b.state == breakerClosed && b.failures >= b.threshold {
+		b.state, b.openedAt = breakerOpen, now
+		fmt.Printf("[provider] %d fallas seguidas (última: %v); circuit breaker abierto por %s\n", b.failures, err, b.cooldown)
+	}
+}
+
+// State devuelve el estado actual; nil (sin breaker) es siempre closed.
+func (b *breaker) State() breakerState {
+	if b == nil {
+		return breakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return breakerHalfOpen
+	}
+	return b.state
+}
+
+// collector expone el estado en lola_provider_breaker_state (0 closed,
+// 1 open, 2 half-open).
+func (b *breaker) collector() prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "lola_provider_breaker_state",
+		Help: "Estado del circuit breaker del proveedor: 0 closed, 1 open, 2 half-open.",
+	}, func() float64 { return float64(b.State()) })
+}
+
+// breakerProvider pasa las llamadas por el breaker: abierto, devuelve
+// errProviderDown sin llamar al proveedor.
+type breakerProvider struct {
+	provider.ChatProvider
+	b *breaker
+}
+
+// With mantiene el mismo breaker en la copia con opts.
+func (p breakerProvider) With(opts provider.CallOptions) provider.ChatProvider {
+	cfg, ok := p.ChatProvider.(provider.Configurable)
+	if !ok {
+		return p
+	}
+	return breakerProvider{ChatProvider: cfg.With(opts), b: p.b}
+}
+
+func (p breakerProvider) Reply(ctx context.Context, history []internal.Message, userInput string) (provider.Result, error) {
+	probe, ok := p.b.allow()
+	if !ok {
+		return provider.Result{}, errProviderDown
+	}
+	res, err := p.ChatProvider.Reply(ctx, history, userInput)
+	p.b.record(probe, err)
+	return res, err
+}
+
+func (p breakerProvider) ReplyStream(ctx context.Context, history []internal.Message, userInput string, out chan<- string) (provider.Result, error) {
+	probe, ok := p.b.allow()
+	if !ok {
+		return provider.Result{}, errProviderDown
+	}
+	res, err := p.ChatProvider.ReplyStream(ctx, history, userInput, out)
+	p.b.record(probe, err)
+	return res, err
+}
+
+// degradedResponse es la respuesta que se da en lugar de un error mientras
+// el breaker está abierto. No se guarda en la sesión: el turno no existió
+// para el modelo y el usuario puede reenviar el mensaje.
+func degradedResponse(model string) internal.SendMessageResponse {
+	return internal.SendMessageResponse{
+		Reply: internal.Message{
+			ID:        uuid.NewString(),
+			Role:      internal.RoleAssistant,
+			Content:   degradedReply,
+			CreatedAt: time.Now(),
+		},
+		Model:    model,
+		Degraded: true,
+	}
+}
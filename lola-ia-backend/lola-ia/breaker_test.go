@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(3, time.Minute, 20*time.Millisecond)
+	fail := errors.New("503")
+	for i := 0; i < 2; i++ {
+		probe, _ := b.allow()
+		b.record(probe, fail)
+	}
+	// una cancelación del cliente no cuenta
+	b.record(false, context.Canceled)
+	// ni un prompt demasiado largo: el proveedor respondió
+	b.record(false, &provider.APIError{StatusCode: 400, Code: "context_length_exceeded"})
+	if s := b.State(); s != breakerClosed {
+		t.Fatalf("con 2 fallas: %s", s)
+	}
+	b.record(false, fail)
+	if _, ok := b.allow(); b.State() != breakerOpen || ok {
+		t.Fatalf("con 3 fallas: %s", b.State())
+	}
+
+	// pasado el cooldown pasa un solo request de prueba
+	time.Sleep(25 * time.Millisecond)
+	if s := b.State(); s != breakerHalfOpen {
+		t.Fatalf("después del cooldown: %s", s)
+	}
+	probe, ok := b.allow()
+	if _, again := b.allow(); !probe || !ok || again {
+		t.Fatal("half-open debería dejar pasar exactamente una prueba")
+	}
+	b.record(probe, fail)
+	if s := b.State(); s != breakerOpen {
+		t.Fatalf("prueba fallida: %s", s)
+	}
+	time.Sleep(25 * time.Millisecond)
+	probe, _ = b.allow()
+	b.record(probe, nil)
+	if _, ok := b.allow(); b.State() != breakerClosed || !ok {
+		t.Fatalf("prueba exitosa: %s", b.State())
+	}
+}
+
+// Una llamada que empezó con el breaker cerrado y termina durante el
+// half-open no es la prueba: no lo vuelve a abrir ni libera el lugar de la
+// prueba en curso.
+func TestBreakerProbeToken(t *testing.T) {
+	b := newBreaker(1, time.Minute, 20*time.Millisecond)
+	_, ok := b.allow() // la llamada lenta
+	if !ok {
+		t.Fatal("cerrado no dejó pasar")
+	}
+	b.record(false, errors.New("503"))
+	time.Sleep(25 * time.Millisecond)
+	probe, ok := b.allow()
+	if !probe || !ok {
+		t.Fatal("half-open no dejó pasar la prueba")
+	}
+	// termina la lenta, fallando, mientras la prueba sigue en curso
+	b.record(false, errors.New("timeout"))
+	if s := b.State(); s != breakerHalfOpen {
+		t.Fatalf("la llamada lenta contó como prueba: %s", s)
+	}
+	if _, ok := b.allow(); ok {
+		t.Fatal("la llamada lenta liberó el lugar de la prueba")
+	}
+	b.record(probe, nil)
+	if s := b.State(); s != breakerClosed {
+		t.Fatalf("prueba exitosa: %s", s)
+	}
+
+	// una prueba cancelada deja lugar a otra
+	b.record(false, errors.New("503"))
+	time.Sleep(25 * time.Millisecond)
+	probe, _ = b.allow()
+	b.record(probe, context.Canceled)
+	if probe, ok := b.allow(); !probe || !ok {
+		t.Error("después de cancelar la prueba no pasó otra")
+	}
+}
+
+func TestBreakerWindow(t *testing.T) {
+	// fallas más separadas que la ventana no se acumulan
+	b := newBreaker(2, 10*time.Millisecond, time.Minute)
+	b.record(false, errors.New("503"))
+	time.Sleep(15 * time.Millisecond)
+	b.record(false, errors.New("503"))
+	if s := b.State(); s != breakerClosed {
+		t.Errorf("estado %s, want closed", s)
+	}
+	if newBreaker(0, time.Minute, time.Minute) != nil || (*breaker)(nil).State() != breakerClosed {
+		t.Error("sin BREAKER_FAILURES debería no haber breaker")
+	}
+}
+
+func TestSendMessageBreaker(t *testing.T) {
+	var down atomic.Bool
+	var calls atomic.Int32
+	down.Store(true)
+	r := newOllamaRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if down.Load() {
+			http.Error(w, "caído", 503)
+			return
+		}
+		w.Write([]byte(`{"message":{"role":"assistant","content":"respuesta"},"done":true}`))
+	}, map[string]string{"BREAKER_FAILURES": "2", "BREAKER_COOLDOWN": "50ms"})
+	n := 0
+	send := func() (int, internal.SendMessageResponse) {
+		t.Helper()
+		n++
+		w := call(r, "POST", "/api/messages", fmt.Sprintf(`{"content":"pregunta %d"}`, n), "X-Session-ID", "s-breaker")
+		var res internal.SendMessageResponse
+		if w.Code == 200 {
+			decode(t, w, &res)
+		}
+		return w.Code, res
+	}
+	breakerMetric := func(want string) {
+		t.Helper()
+		if body := call(r, "GET", "/metrics", "").Body.String(); !strings.Contains(body, "lola_provider_breaker_state "+want) {
+			t.Errorf("/metrics sin lola_provider_breaker_state %s", want)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if code, _ := send(); code != 502 {
+			t.Errorf("falla %d: status %d, want 502", i+1, code)
+		}
+	}
+	breakerMetric("1")
+	// abierto: respuesta automática sin llamar al proveedor
+	code, res := send()
+	if code != 200 || !res.Degraded || res.Reply.Content != degradedReply || calls.Load() != 2 {
+		t.Errorf("abierto: status %d, %+v, %d llamadas", code, res, calls.Load())
+	}
+
+	down.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	breakerMetric("2")
+	if code, res := send(); code != 200 || res.Degraded || res.Reply.Content != "respuesta" {
+		t.Errorf("prueba: status %d, %+v", code, res)
+	}
+	breakerMetric("0")
+}
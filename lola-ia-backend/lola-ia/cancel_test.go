@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestSendMessageClientDisconnect(t *testing.T) {
+	arrived, aborted := make(chan struct{}), make(chan struct{})
+	r := newOllamaRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		// con el cuerpo leído el servidor se entera si el cliente corta
+		io.Copy(io.Discard, r.Body)
+		close(arrived)
+		select {
+		case <-r.Context().Done():
+			close(aborted)
+		case <-time.After(5 * time.Second):
+		}
+	}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-arrived
+		cancel() // el navegador cierra la pestaña
+	}()
+	req := httptest.NewRequest("POST", "/api/messages", strings.NewReader(`{"content":"hola"}`)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Session-ID", "s-cancel")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != statusClientClosed {
+		t.Errorf("status %d, want %d", w.Code, statusClientClosed)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Error("el proveedor no vio cancelarse la request")
+	}
+
+	// no queda una respuesta parcial en la sesión: solo el saludo
+	var h internal.ChatHistory
+	decode(t, call(r, "GET", "/api/messages", "", "X-Session-ID", "s-cancel"), &h)
+	var replies int
+	for _, m := range h.Messages {
+		if m.Role == internal.RoleAssistant {
+			replies++
+		}
+	}
+	if replies != 1 {
+		t.Errorf("%d mensajes del asistente, want solo el saludo: %+v", replies, h.Messages)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// tooLongStub es un Ollama que rechaza por largo los primeros reject
+// pedidos y guarda el largo del último mensaje (el prompt) de cada uno.
+type tooLongStub struct {
+	mu      sync.Mutex
+	reject  int
+	prompts []int
+}
+
+func (s *tooLongStub) handle(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Messages []internal.Message `json:"messages"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	json.Unmarshal(body, &req)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prompts = append(s.prompts, len(req.Messages[len(req.Messages)-1].Content))
+	if len(s.prompts) <= s.reject {
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"prompt is too long: 9123 tokens > 4096 maximum"}`))
+		return
+	}
+	w.Write([]byte(`{"message":{"role":"assistant","content":"respuesta"},"done":true}`))
+}
+
+func (s *tooLongStub) calls() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.prompts...)
+}
+
+// uploadBig sube n CSV que no entran enteros en el presupuesto de archivos.
+func uploadBig(t *testing.T, r http.Handler, n int, hdr ...string) {
+	t.Helper()
+	var req struct {
+		Files []internal.KnowledgeFile `json:"files"`
+	}
+	for i := range n {
+		f := bigCSV(fmt.Sprintf("f%d.csv", i), 1000)
+		req.Files = append(req.Files, internal.KnowledgeFile{Name: f.Name, Text: f.Text})
+	}
+	body, _ := json.Marshal(req)
+	if w := call(r, "POST", "/api/files", string(body), hdr...); w.Code != 200 {
+		t.Fatalf("upload: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestSendMessageContextLengthRetry(t *testing.T) {
+	env := map[string]string{"MAX_CONTEXT_TOKENS": "6000", "MAX_FILE_CONTEXT_TOKENS": "2500"}
+	const analysis = `{"content":"Hazme un análisis de los comentarios"}`
+
+	// rechazado una vez: se reintenta con un prompt más chico
+	stub := &tooLongStub{reject: 1}
+	r := newOllamaRouter(t, stub.handle, env)
+	sid := []string{"X-Session-ID", "s-largo"}
+	uploadBig(t, r, 3, sid...)
+	var res internal.SendMessageResponse
+	w := call(r, "POST", "/api/messages", analysis, sid...)
+	decode(t, w, &res)
+	if w.Code != 200 || res.Reply.Content != "respuesta" {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	prompts := stub.calls()
+	if len(prompts) != 2 || prompts[1] >= prompts[0] {
+		t.Fatalf("prompts = %v, want 2 y el segundo más chico", prompts)
+	}
+	// el presupuesto es la mitad: el reintento lleva a lo sumo ~la mitad de archivos
+	if prompts[1] > prompts[0]*3/4 {
+		t.Errorf("el reintento bajó de %d a %d bytes", prompts[0], prompts[1])
+	}
+	if len(res.Sources) == 0 {
+		t.Error("el reintento sin sources")
+	}
+
+	// rechazado también el reintento: 400 y no más de un reintento
+	stub = &tooLongStub{reject: 2}
+	r = newOllamaRouter(t, stub.handle, env)
+	uploadBig(t, r, 3, sid...)
+	w = call(r, "POST", "/api/messages", analysis, sid...)
+	if w.Code != 400 || !strings.Contains(w.Body.String(), "ventana de contexto") {
+		t.Errorf("status %d, want 400: %s", w.Code, w.Body)
+	}
+	if n := len(stub.calls()); n != 2 {
+		t.Errorf("%d llamadas, want 2", n)
+	}
+
+	// el modo plain no lleva archivos: no hay qué achicar
+	stub = &tooLongStub{reject: 1}
+	r = newOllamaRouter(t, stub.handle, env)
+	w = call(r, "POST", "/api/messages", `{"content":"hola"}`, sid...)
+	if w.Code != 400 || len(stub.calls()) != 1 {
+		t.Errorf("plain: status %d, %d llamadas: %s", w.Code, len(stub.calls()), w.Body)
+	}
+}
+
+// El socket pasa por el mismo reintento que POST /api/messages.
+func TestWSContextLengthRetry(t *testing.T) {
+	stub := &tooLongStub{reject: 1}
+	r := newOllamaRouter(t, stub.handle, map[string]string{"MAX_CONTEXT_TOKENS": "6000", "MAX_FILE_CONTEXT_TOKENS": "2500"})
+	uploadBig(t, r, 3, "X-Session-ID", "s-largo")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	ws := dialWS(t, srv, "s-largo")
+	if err := ws.WriteJSON(internal.SendMessageRequest{Content: "Hazme un análisis de los comentarios"}); err != nil {
+		t.Fatal(err)
+	}
+	var done wsFrame
+	for done.Type == "" {
+		switch f := readFrame(t, ws); f.Type {
+		case "done":
+			done = f
+		case "error":
+			t.Fatalf("frame %+v", f)
+		}
+	}
+	if done.Reply == nil || done.Reply.Reply.Content != "respuesta" || len(done.Reply.Sources) == 0 {
+		t.Errorf("done = %+v", done.Reply)
+	}
+	if prompts := stub.calls(); len(prompts) != 2 || prompts[1] >= prompts[0] {
+		t.Errorf("prompts = %v, want 2 y el segundo más chico", prompts)
+	}
+}
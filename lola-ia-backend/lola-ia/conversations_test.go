@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestConversationTitleEndpoints(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"API_KEYS": "key-a,key-b"})
+	key := []string{"Authorization", "Bearer key-a"}
+	title := func(id string) internal.Conversation {
+		t.Helper()
+		var list internal.ConversationList
+		decode(t, call(r, "GET", "/api/conversations", "", key...), &list)
+		for _, c := range list.Conversations {
+			if c.ID == id {
+				return c
+			}
+		}
+		t.Fatalf("%s no está en la lista: %+v", id, list.Conversations)
+		return internal.Conversation{}
+	}
+	send := func(content string) {
+		t.Helper()
+		if w := call(r, "POST", "/api/messages", `{"content":"`+content+`"}`, append(key, "X-Session-ID", "s1")...); w.Code != 200 {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+
+	send("ventas de mayo por canal")
+	if c := title("s1"); c.Title != "ventas de mayo por canal" || c.CustomTitle {
+		t.Errorf("título automático: %+v", c)
+	}
+
+	w := call(r, "PATCH", "/api/conversations/s1", `{"title":"  Reporte Q2 "}`, key...)
+	var got internal.Conversation
+	decode(t, w, &got)
+	if got.ID != "s1" || got.Title != "Reporte Q2" || !got.CustomTitle {
+		t.Errorf("PATCH = %+v", got)
+	}
+	// el título propio no lo pisa el siguiente mensaje
+	send("y las de junio")
+	if c := title("s1"); c.Title != "Reporte Q2" || !c.CustomTitle {
+		t.Errorf("después de otro mensaje: %+v", c)
+	}
+
+	// la otra key no la ve ni la renombra
+	var other internal.ConversationList
+	decode(t, call(r, "GET", "/api/conversations", "", "Authorization", "Bearer key-b"), &other)
+	if len(other.Conversations) != 0 {
+		t.Errorf("key-b ve %+v", other.Conversations)
+	}
+	if w := call(r, "PATCH", "/api/conversations/s1", `{"title":"x"}`, "Authorization", "Bearer key-b"); w.Code != 404 {
+		t.Errorf("PATCH con otra key: status %d, want 404", w.Code)
+	}
+
+	for _, tc := range []struct {
+		path, body string
+		want       int
+	}{
+		{"/api/conversations/s1", `{}`, 400},
+		{"/api/conversations/s1", `{"title":"` + strings.Repeat("x", maxConversationTitle+1) + `"}`, 400},
+		{"/api/conversations/no-existe", `{"title":"x"}`, 404},
+	} {
+		if w := call(r, "PATCH", tc.path, tc.body, key...); w.Code != tc.want {
+			t.Errorf("PATCH %s %.20s: status %d, want %d", tc.path, tc.body, w.Code, tc.want)
+		}
+	}
+}
+
+// Sin API_KEYS no hay a quién limitar la lista: se rechaza, como /api/sessions.
+func TestConversationsNoAuth(t *testing.T) {
+	r := newTestRouter(t, nil)
+	call(r, "POST", "/api/messages", `{"content":"ventas de mayo"}`, "X-Session-ID", "s1")
+	if w := call(r, "GET", "/api/conversations", ""); w.Code != 403 || strings.Contains(w.Body.String(), "s1") {
+		t.Errorf("GET sin auth: status %d: %s", w.Code, w.Body)
+	}
+	if w := call(r, "PATCH", "/api/conversations/s1", `{"title":"mío"}`); w.Code != 403 {
+		t.Errorf("PATCH sin auth: status %d, want 403", w.Code)
+	}
+}
+
+func TestResetArchivesConversation(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"API_KEYS": "key-a,key-b"})
+	a := []string{"Authorization", "Bearer key-a", "X-Session-ID", "s1"}
+	if w := call(r, "POST", "/api/messages", `{"content":"ventas de mayo"}`, a...); w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	var reset struct {
+		Archived string `json:"archived"`
+	}
+	decode(t, call(r, "POST", "/api/reset", "", a...), &reset)
+	if reset.Archived == "" {
+		t.Fatal("el reset no archivó la conversación")
+	}
+	// la sesión vuelve a empezar con el saludo
+	var h internal.ChatHistory
+	decode(t, call(r, "GET", "/api/messages", "", a...), &h)
+	if len(h.Messages) != 1 || h.Messages[0].Role != internal.RoleAssistant {
+		t.Errorf("después del reset: %+v", h.Messages)
+	}
+
+	var list internal.ArchivedConversationList
+	decode(t, call(r, "GET", "/api/conversations/archived", "", a...), &list)
+	if len(list.Conversations) != 1 || list.Conversations[0].ID != reset.Archived || list.Conversations[0].Title != "ventas de mayo" {
+		t.Errorf("archivadas = %+v", list.Conversations)
+	}
+	var conv internal.ArchivedConversationResponse
+	decode(t, call(r, "GET", "/api/conversations/archived/"+reset.Archived, "", a...), &conv)
+	if !conv.ReadOnly || conv.Conversation.ID != reset.Archived || len(conv.Messages) < 2 || conv.Messages[1].Content != "ventas de mayo" {
+		t.Errorf("archivada = %+v", conv)
+	}
+
+	// otra key no la ve
+	b := []string{"Authorization", "Bearer key-b"}
+	decode(t, call(r, "GET", "/api/conversations/archived", "", b...), &list)
+	if len(list.Conversations) != 0 {
+		t.Errorf("key-b ve %+v", list.Conversations)
+	}
+	if w := call(r, "DELETE", "/api/conversations/archived/"+reset.Archived, "", b...); w.Code != 404 {
+		t.Errorf("DELETE con otra key: status %d, want 404", w.Code)
+	}
+
+	if w := call(r, "DELETE", "/api/conversations/archived/"+reset.Archived, "", a...); w.Code != 200 {
+		t.Errorf("DELETE: status %d", w.Code)
+	}
+	if w := call(r, "GET", "/api/conversations/archived/"+reset.Archived, "", a...); w.Code != 404 {
+		t.Errorf("después del DELETE: status %d, want 404", w.Code)
+	}
+
+	// ?hard=true no archiva
+	call(r, "POST", "/api/messages", `{"content":"otra"}`, a...)
+	if w := call(r, "POST", "/api/reset?hard=true", "", a...); strings.Contains(w.Body.String(), "archived") {
+		t.Errorf("reset hard archivó: %s", w.Body)
+	}
+	decode(t, call(r, "GET", "/api/conversations/archived", "", a...), &list)
+	if len(list.Conversations) != 0 {
+		t.Errorf("archivadas después del reset hard: %+v", list.Conversations)
+	}
+}
+
+func TestArchivedConversationsNoAuth(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s1"}
+	call(r, "POST", "/api/messages", `{"content":"ventas de mayo"}`, sid...)
+	var reset struct {
+		Archived string `json:"archived"`
+	}
+	decode(t, call(r, "POST", "/api/reset", "", sid...), &reset)
+	if reset.Archived == "" {
+		t.Fatal("el reset no archivó la conversación")
+	}
+	for _, tc := range []struct{ method, path string }{
+		{"GET", "/api/conversations/archived"},
+		{"GET", "/api/conversations/archived/" + reset.Archived},
+		{"DELETE", "/api/conversations/archived/" + reset.Archived},
+	} {
+		if w := call(r, tc.method, tc.path, "", sid...); w.Code != 403 || strings.Contains(w.Body.String(), "ventas de mayo") {
+			t.Errorf("%s %s sin auth: status %d: %s", tc.method, tc.path, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultAllowedOrigins = "http://localhost:5173"
+
+// parseOrigins separa la lista ALLOWED_ORIGINS (separada por comas).
+func parseOrigins(v string) []string {
+	var out []string
+	for _, o := range strings.Split(v, ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// originAllowed compara origin con la lista; admite comodín de subdominio,
+// p.ej. "https://*.vercel.app".
+func originAllowed(origin string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == origin {
+			return true
+		}
+		if scheme, host, ok := strings.Cut(a, "://*."); ok {
+			if strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, "."+host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// corsMethods son los métodos que usa la API.
+const corsMethods = "GET, POST, PATCH, DELETE, OPTIONS"
+
+// corsMiddleware responde CORS según los orígenes permitidos. Con "*" se
+// permite cualquier origen pero sin credenciales (así lo exige el navegador);
+// si no, se devuelve el Origin del request solo cuando está en la lista.
+func corsMiddleware(allowed []string) gin.HandlerFunc {
+	wildcard := false
+	for _, a := range allowed {
+		if a == "*" {
+			wildcard = true
+		}
+	}
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		origin := c.GetHeader("Origin")
+		switch {
+		case wildcard:
+			h.Set("Access-Control-Allow-Origin", "*")
+		case origin != "" && originAllowed(origin, allowed):
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+			h.Add("Vary", "Origin")
+		}
+		h.Set("Access-Control-Allow-Headers", "Content-Type, Authorization, ngrok-skip-browser-warning, X-Session-ID, Idempotency-Key")
+		h.Set("Access-Control-Expose-Headers", "X-Session-ID, Retry-After, Content-Disposition, X-Lola-Mode, X-Lola-Prompt-Bytes, Idempotent-Replayed, X-Lola-Cache")
+		// explícitos: con credenciales el navegador toma "*" como un método
+		// llamado así y rechaza el preflight de PATCH y DELETE
+		h.Set("Access-Control-Allow-Methods", corsMethods)
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(204)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func corsRequest(allowed []string, method, origin string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(corsMiddleware(allowed))
+	r.GET("/api/x", func(c *gin.Context) { c.Status(200) })
+	req := httptest.NewRequest(method, "/api/x", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if method == http.MethodOptions {
+		req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestParseOrigins(t *testing.T) {
+	got := parseOrigins(" http://localhost:5173/ ,, https://*.vercel.app")
+	if len(got) != 2 || got[0] != "http://localhost:5173" || got[1] != "https://*.vercel.app" {
+		t.Errorf("parseOrigins = %q", got)
+	}
+}
+
+func TestCORSOrigins(t *testing.T) {
+	allowed := parseOrigins("http://localhost:5173,https://*.vercel.app")
+	cases := []struct {
+		origin string
+		allow  bool
+	}{
+		{"http://localhost:5173", true},
+		{"https://lola.vercel.app", true},
+		{"https://evil.com", false},
+		{"http://lola.vercel.app", false}, // otro esquema
+		{"https://vercel.app.evil.com", false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		w := corsRequest(allowed, http.MethodGet, tc.origin)
+		got := w.Header().Get("Access-Control-Allow-Origin")
+		switch {
+		case tc.allow && got != tc.origin:
+			t.Errorf("%q: Allow-Origin = %q, want el origin", tc.origin, got)
+		case tc.allow && w.Header().Get("Access-Control-Allow-Credentials") != "true":
+			t.Errorf("%q: sin Allow-Credentials", tc.origin)
+		case !tc.allow && got != "":
+			t.Errorf("%q: Allow-Origin = %q, want vacío", tc.origin, got)
+		}
+		if w.Code != 200 {
+			t.Errorf("%q: status %d", tc.origin, w.Code)
+		}
+	}
+}
+
+func TestCORSWildcardWithoutCredentials(t *testing.T) {
+	w := corsRequest([]string{"*"}, http.MethodGet, "https://cualquiera.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Allow-Origin = %q, want *", got)
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("con * no se permiten credenciales")
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	w := corsRequest([]string{"http://localhost:5173"}, http.MethodOptions, "http://localhost:5173")
+	if w.Code != 204 {
+		t.Errorf("preflight: status %d, want 204", w.Code)
+	}
+	// con credenciales "*" no vale como comodín: los métodos van explícitos
+	methods := w.Header().Get("Access-Control-Allow-Methods")
+	for _, m := range []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"} {
+		if !containsToken(methods, m) {
+			t.Errorf("Allow-Methods = %q, falta %s", methods, m)
+		}
+	}
+	if containsToken(methods, "*") {
+		t.Errorf("Allow-Methods = %q con credenciales", methods)
+	}
+}
+
+// containsToken busca tok en una lista separada por comas.
+func containsToken(list, tok string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if strings.TrimSpace(v) == tok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+const defaultDedupWindow = 2 * time.Second
+
+// inflight registra las consultas (sesión + contenido) cuya respuesta
+// todavía se está generando, para que un duplicado pueda esperarla en vez de
+// volver a llamar al proveedor. El turno se guarda recién al terminar, así
+// que mientras tanto el store no sabe nada de la consulta.
+type inflight struct {
+	mu      sync.Mutex
+	pending map[string]chan struct{}
+}
+
+func newInflight() *inflight {
+	return &inflight{pending: make(map[string]chan struct{})}
+}
+
+func inflightKey(sid, content string) string { return sid + "\x00" + content }
+
+// begin marca la consulta como en curso y devuelve la función que la da por
+// terminada (después de guardar el turno). Si ya hay una igual en curso no
+// registra nada y devuelve su canal, que se cierra cuando termina: la
+// revisión y el registro van bajo el mismo lock, así de dos consultas
+// idénticas simultáneas solo una llega al proveedor.
+func (f *inflight) begin(sid, content string) (done func(), busy <-chan struct{}) {
+	key := inflightKey(sid, content)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ch, ok := f.pending[key]; ok {
+		return nil, ch
+	}
+	ch := make(chan struct{})
+	f.pending[key] = ch
+	return func() {
+		f.mu.Lock()
+		delete(f.pending, key)
+		f.mu.Unlock()
+		close(ch)
+	}, nil
+}
+
+// duplicateReply detecta un doble envío: content es idéntico al último
+// mensaje del usuario y llegó dentro de window. Si el primero sigue en curso
+// espera su respuesta y la devuelve. Un mismo texto enviado más tarde no se
+// considera duplicado. Si no es un duplicado la consulta queda registrada
+// como en curso y done (que nunca es nil) la da por terminada.
+func duplicateReply(ctx context.Context, mem store.Store, fl *inflight, sid, content string, window time.Duration) (reply internal.Message, dup bool, done func()) {
+	arrived := time.Now()
+	for {
+		done, busy := fl.begin(sid, content)
+		if busy == nil {
+			// el primero pudo haber terminado justo antes de que llegáramos
+			if reply, ok := recentReply(mem, sid, content, arrived, window); ok {
+				done()
+				return reply, true, func() {}
+			}
+			return internal.Message{}, false, done
+		}
+		select {
+		case <-busy:
+		case <-ctx.Done():
+			// el cliente se fue: el caller falla enseguida con ctx
+			return internal.Message{}, false, func() {}
+		}
+		if reply, ok := recentReply(mem, sid, content, arrived, window); ok {
+			return reply, true, func() {}
+		}
+		// el primero falló o se canceló: este request se procesa normalmente
+		// (salvo que otro duplicado se haya adelantado; entonces se lo espera)
+	}
+}
+
+// recentReply devuelve la respuesta al último mensaje del usuario si es
+// content y llegó dentro de window antes de arrived.
+func recentReply(mem store.Store, sid, content string, arrived time.Time, window time.Duration) (internal.Message, bool) {
+	last, ok := mem.LastUserMessage(sid)
+	if !ok || last.Content != content || arrived.Sub(last.CreatedAt) > window {
+		return internal.Message{}, false
+	}
+	// la respuesta, si la hubo, es el mensaje siguiente al del usuario
+	recent, _ := mem.RangeForSession(sid, time.Time{}, 2)
+	for i, m := range recent {
+		if m.ID == last.ID && i+1 < len(recent) && recent[i+1].Role == internal.RoleAssistant {
+			return recent[i+1], true
+		}
+	}
+	return internal.Message{}, false
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+func TestSendMessageDuplicate(t *testing.T) {
+	for _, tc := range []struct {
+		window string
+		dup    bool
+	}{
+		{"1m", true},
+		{"1ms", false}, // la misma pregunta un rato después se responde de nuevo
+	} {
+		r := newTestRouter(t, map[string]string{"DEDUP_WINDOW": tc.window})
+		send := func() internal.Message {
+			t.Helper()
+			w := call(r, "POST", "/api/messages", `{"content":"¿cuántas ventas hubo?"}`, "X-Session-ID", "s-dedup")
+			if w.Code != 200 {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var res internal.SendMessageResponse
+			decode(t, w, &res)
+			return res.Reply
+		}
+		first := send()
+		time.Sleep(5 * time.Millisecond)
+		second := send()
+		if dup := second.ID == first.ID; dup != tc.dup {
+			t.Errorf("DEDUP_WINDOW=%s: duplicado = %v, want %v", tc.window, dup, tc.dup)
+		}
+		var h internal.ChatHistory
+		decode(t, call(r, "GET", "/api/messages", "", "X-Session-ID", "s-dedup"), &h)
+		want := 5 // saludo y dos turnos
+		if tc.dup {
+			want = 3
+		}
+		if len(h.Messages) != want {
+			t.Errorf("DEDUP_WINDOW=%s: %d mensajes guardados, want %d", tc.window, len(h.Messages), want)
+		}
+	}
+}
+
+// sendOnce hace lo que POST /api/messages con un doble envío: si no es un
+// duplicado "llama al proveedor" (calls) y guarda el turno.
+func sendOnce(mem store.Store, fl *inflight, calls *atomic.Int32, sid, content string) internal.Message {
+	reply, dup, done := duplicateReply(context.Background(), mem, fl, sid, content, time.Minute)
+	if dup {
+		return reply
+	}
+	defer done()
+	calls.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	saved := mem.AppendBatchForSession(sid,
+		internal.Message{Role: internal.RoleUser, Content: content, CreatedAt: time.Now()},
+		internal.Message{Role: internal.RoleAssistant, Content: "respuesta", CreatedAt: time.Now()},
+	)
+	return saved[1]
+}
+
+func TestDuplicateReplyConcurrent(t *testing.T) {
+	mem := store.NewMemoryStore()
+	mem.TouchSession("s1")
+	fl := newInflight()
+	var calls atomic.Int32
+	const n = 20
+	replies := make([]internal.Message, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			replies[i] = sendOnce(mem, fl, &calls, "s1", "¿cuántas ventas hubo?")
+		}(i)
+	}
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("el proveedor se llamó %d veces, want 1", got)
+	}
+	for i, r := range replies {
+		if r.ID != replies[0].ID {
+			t.Errorf("respuesta %d = %s, want %s", i, r.ID, replies[0].ID)
+		}
+	}
+	if msgs := mem.AllForSession("s1"); len(msgs) != 2 {
+		t.Errorf("%d mensajes guardados, want 2", len(msgs))
+	}
+}
+
+func TestDuplicateReplyOutsideWindow(t *testing.T) {
+	mem := store.NewMemoryStore()
+	mem.TouchSession("s1")
+	fl := newInflight()
+	mem.AppendBatchForSession("s1",
+		internal.Message{Role: internal.RoleUser, Content: "hola", CreatedAt: time.Now().Add(-time.Hour)},
+		internal.Message{Role: internal.RoleAssistant, Content: "respuesta", CreatedAt: time.Now().Add(-time.Hour)},
+	)
+	_, dup, done := duplicateReply(context.Background(), mem, fl, "s1", "hola", time.Second)
+	if dup {
+		t.Fatal("un texto repetido fuera de la ventana no es un duplicado")
+	}
+	// quedó registrada: otra igual la espera
+	if d, busy := fl.begin("s1", "hola"); d != nil || busy == nil {
+		t.Error("la consulta no quedó en curso")
+	}
+	done()
+	if d, busy := fl.begin("s1", "hola"); d == nil || busy != nil {
+		t.Error("done no la dio por terminada")
+	}
+}
+
+func TestDuplicateReplyAfterFailure(t *testing.T) {
+	mem := store.NewMemoryStore()
+	mem.TouchSession("s1")
+	fl := newInflight()
+	_, _, first := duplicateReply(context.Background(), mem, fl, "s1", "hola", time.Minute)
+	result := make(chan bool)
+	go func() {
+		_, dup, done := duplicateReply(context.Background(), mem, fl, "s1", "hola", time.Minute)
+		done()
+		result <- dup
+	}()
+	// el primero falla sin guardar nada: el segundo se procesa normalmente
+	time.Sleep(10 * time.Millisecond)
+	first()
+	if <-result {
+		t.Error("sin respuesta guardada el segundo no es un duplicado")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestSendMessageDryRun(t *testing.T) {
+	var calls atomic.Int32
+	r := newCountingRouter(t, &calls, nil)
+	sid := []string{"X-Session-ID", "s-dry"}
+	call(r, "POST", "/api/files", `{"files":[{"name":"nps.csv","text":"id,comentario\n1,la app es lenta\n"}]}`, sid...)
+
+	w := call(r, "POST", "/api/messages?dry_run=true", `{"content":"Hazme un análisis de las encuestas"}`, sid...)
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	// el largo del prompt va en un header solo con DEBUG_PROMPTS, como en el envío normal
+	if h := w.Header().Get(promptBytesHeader); h != "" {
+		t.Errorf("%s = %q sin DEBUG_PROMPTS", promptBytesHeader, h)
+	}
+	var res internal.DryRunResponse
+	decode(t, w, &res)
+	if res.Mode != "analyst" || !strings.Contains(res.Prompt, "1,la app es lenta") || !strings.Contains(res.Prompt, "Hazme un análisis") {
+		t.Errorf("dry run = %+v", res)
+	}
+	if len(res.Sources) != 1 || res.Sources[0] != "nps.csv" || res.Stored != nil {
+		t.Errorf("sources = %v, stored = %v", res.Sources, res.Stored)
+	}
+
+	// con store_message se guarda solo el mensaje del usuario
+	w = call(r, "POST", "/api/messages?dry_run=true&store_message=true", `{"content":"hola"}`, sid...)
+	res = internal.DryRunResponse{}
+	decode(t, w, &res)
+	if res.Stored == nil || res.Stored.Content != "hola" || res.Mode != "plain" {
+		t.Errorf("store_message: %+v", res)
+	}
+
+	if n := calls.Load(); n != 0 {
+		t.Errorf("el proveedor se llamó %d veces en un dry run", n)
+	}
+	var h internal.ChatHistory
+	decode(t, call(r, "GET", "/api/messages", "", sid...), &h)
+	if len(h.Messages) != 2 || h.Messages[1].Role != internal.RoleUser {
+		t.Errorf("historial = %+v, want el saludo y el mensaje guardado", h.Messages)
+	}
+}
+
+func TestSendMessageDryRunDebugHeader(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"DEBUG_PROMPTS": "true"})
+	w := call(r, "POST", "/api/messages?dry_run=true", `{"content":"hola"}`)
+	var res internal.DryRunResponse
+	decode(t, w, &res)
+	if h := w.Header().Get(promptBytesHeader); h != strconv.Itoa(len(res.Prompt)) {
+		t.Errorf("%s = %q, want %d", promptBytesHeader, h, len(res.Prompt))
+	}
+}
+
+// Un mensaje guardado con store_message queda último en el historial; al
+// enviarlo de verdad el proveedor tiene que recibirlo una sola vez.
+func TestSendMessageAfterStoredDryRun(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent []internal.Message
+	)
+	r := newOllamaRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []internal.Message `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		sent = req.Messages
+		mu.Unlock()
+		w.Write([]byte(`{"message":{"role":"assistant","content":"respuesta"},"done":true}`))
+	}, nil)
+	sid := []string{"X-Session-ID", "s-dry"}
+	call(r, "POST", "/api/messages?dry_run=true&store_message=true", `{"content":"hola"}`, sid...)
+	if w := call(r, "POST", "/api/messages", `{"content":"hola"}`, sid...); w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	n := 0
+	for _, m := range sent {
+		if m.Role == internal.RoleUser && m.Content == "hola" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("la consulta llegó %d veces al proveedor: %+v", n, sent)
+	}
+}
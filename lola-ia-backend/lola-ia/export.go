@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+// roleLabels son los títulos de cada rol en el export Markdown.
+var roleLabels = map[internal.Role]string{
+	internal.RoleUser:      "Usuario",
+	internal.RoleAssistant: "Lola IA",
+	internal.RoleSystem:    "Sistema",
+}
+
+// renderMarkdown arma el transcript en Markdown. El contenido de cada mensaje
+// va tal cual: las respuestas del modo analista ya vienen en Markdown y así
+// se conservan sus secciones y tablas.
+func renderMarkdown(msgs []internal.Message, exportedAt time.Time) string {
+	var b strings.Builder
+	b.WriteString("# Conversación con Lola IA\n\n")
+	fmt.Fprintf(&b, "_Exportada el %s_\n\n", exportedAt.Format(time.RFC3339))
+	if len(msgs) == 0 {
+		b.WriteString("_(sin mensajes)_\n")
+		return b.String()
+	}
+	for i, m := range msgs {
+		if i > 0 {
+			b.WriteString("\n---\n\n")
+		}
+		label := roleLabels[m.Role]
+		if label == "" {
+			label = string(m.Role)
+		}
+		fmt.Fprintf(&b, "### %s · %s\n\n", label, m.CreatedAt.Format(time.RFC3339))
+		b.WriteString(strings.TrimRight(m.Content, "\n"))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// writeExport responde msgs como archivo descargable en format ("md" o "json").
+// Devuelve false si el formato no es válido.
+func writeExport(c *gin.Context, msgs []internal.Message, format string) bool {
+	now := time.Now()
+	name := "lola-chat-" + now.Format("20060102-150405")
+	var (
+		body        []byte
+		contentType string
+	)
+	switch format {
+	case "md", "markdown":
+		name += ".md"
+		contentType = "text/markdown; charset=utf-8"
+		body = []byte(renderMarkdown(msgs, now))
+	case "json":
+		name += ".json"
+		contentType = "application/json; charset=utf-8"
+		body, _ = json.MarshalIndent(internal.ChatHistory{Messages: msgs}, "", "  ")
+	default:
+		return false
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	c.Data(200, contentType, body)
+	return true
+}
+
+// importClockSkew es cuánto pueden adelantarse las fechas de un import al
+// reloj del servidor (el export puede venir de otra máquina).
+const importClockSkew = 5 * time.Minute
+
+// validateImport revisa los mensajes de un export JSON antes de importarlos:
+// al menos uno, con rol conocido, contenido, fecha (en orden cronológico y no
+// en el futuro) e IDs sin repetir; sin ID se les asigna uno al guardarlos.
+func validateImport(msgs []internal.Message, now time.Time) error {
+	if len(msgs) == 0 {
+		return errors.New("messages requerido")
+	}
+	ids := make(map[string]bool, len(msgs))
+	for i, m := range msgs {
+		// posición desde 1, como se ve en el archivo
+		n := i + 1
+		if _, ok := roleLabels[m.Role]; !ok {
+			return fmt.Errorf("mensaje %d: role inválido %q", n, m.Role)
+		}
+		if strings.TrimSpace(m.Content) == "" {
+			return fmt.Errorf("mensaje %d: content vacío", n)
+		}
+		switch {
+		case m.CreatedAt.IsZero():
+			return fmt.Errorf("mensaje %d: created_at requerido", n)
+		case m.CreatedAt.After(now.Add(importClockSkew)):
+			return fmt.Errorf("mensaje %d: created_at en el futuro", n)
+		case i > 0 && m.CreatedAt.Before(msgs[i-1].CreatedAt):
+			return fmt.Errorf("mensaje %d: created_at anterior al del mensaje %d", n, n-1)
+		}
+		if m.ID != "" {
+			if ids[m.ID] {
+				return fmt.Errorf("mensaje %d: id repetido %s", n, m.ID)
+			}
+			ids[m.ID] = true
+		}
+	}
+	return nil
+}
+
+// withoutSystem devuelve msgs sin los mensajes de sistema: en un import
+// reemplazarían a SYSTEM_PERSONA en cada consulta (el proveedor no antepone
+// el prompt configurado si el historial trae uno propio).
+func withoutSystem(msgs []internal.Message) []internal.Message {
+	out := make([]internal.Message, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Role != internal.RoleSystem {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// fileContentTypes es el Content-Type de la descarga de cada formato.
+var fileContentTypes = map[string]string{
+	tabular.FormatCSV:  "text/csv; charset=utf-8",
+	tabular.FormatTSV:  "text/tab-separated-values; charset=utf-8",
+	tabular.FormatJSON: "application/json; charset=utf-8",
+}
+
+// writeFileDownload responde el contenido de f tal como se subió, como
+// archivo descargable con su nombre original.
+func writeFileDownload(c *gin.Context, f internal.KnowledgeFile) {
+	contentType, ok := fileContentTypes[f.Format]
+	if !ok {
+		contentType = "text/plain; charset=utf-8"
+	}
+	// FormatMediaType codifica (RFC 2231) los nombres con comillas o no ASCII
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": f.Name})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", disposition)
+	c.Header("Content-Length", strconv.Itoa(len(f.Text)))
+	c.Data(200, contentType, []byte(f.Text))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestSessionFileIsolation(t *testing.T) {
+	dir := t.TempDir()
+	writeSeed(t, dir, "seed.csv", "id,comentario\n1,semilla\n")
+	r := newTestRouter(t, map[string]string{"SEED_CSV_DIR": dir})
+	a := []string{"X-Session-ID", "s-a"}
+	b := []string{"X-Session-ID", "s-b"}
+	list := func(hdr []string) (names []string, readOnly map[string]bool) {
+		t.Helper()
+		var res struct {
+			Files []internal.KnowledgeFile `json:"files"`
+		}
+		decode(t, call(r, "GET", "/api/files", "", hdr...), &res)
+		readOnly = make(map[string]bool)
+		for _, f := range res.Files {
+			names = append(names, f.Name)
+			readOnly[f.Name] = f.ReadOnly
+		}
+		return names, readOnly
+	}
+
+	if w := call(r, "POST", "/api/files", `{"files":[{"name":"a.csv","text":"id,comentario\n2,solo de A\n"}]}`, a...); w.Code != 200 {
+		t.Fatalf("upload: status %d: %s", w.Code, w.Body)
+	}
+	if names, ro := list(a); !slices.Equal(names, []string{"seed.csv", "a.csv"}) || !ro["seed.csv"] || ro["a.csv"] {
+		t.Errorf("A ve %v (read-only %v)", names, ro)
+	}
+	if names, ro := list(b); !slices.Equal(names, []string{"seed.csv"}) || !ro["seed.csv"] {
+		t.Errorf("B ve %v (read-only %v)", names, ro)
+	}
+
+	// el contexto de B no lleva el archivo de A
+	var res internal.DryRunResponse
+	decode(t, call(r, "POST", "/api/messages?dry_run=true", `{"content":"Hazme un análisis de los comentarios"}`, b...), &res)
+	if !slices.Equal(res.Sources, []string{"seed.csv"}) {
+		t.Errorf("sources de B = %v", res.Sources)
+	}
+	decode(t, call(r, "POST", "/api/messages?dry_run=true", `{"content":"Hazme un análisis de los comentarios"}`, a...), &res)
+	if len(res.Sources) != 2 {
+		t.Errorf("sources de A = %v", res.Sources)
+	}
+
+	// B no puede borrar el de A ni el seed
+	if w := call(r, "DELETE", "/api/files/seed.csv", "", b...); w.Code != 403 {
+		t.Errorf("borrar el seed: status %d, want 403", w.Code)
+	}
+	call(r, "DELETE", "/api/files/a.csv", "", b...)
+	if names, _ := list(a); !slices.Contains(names, "a.csv") {
+		t.Errorf("B borró el archivo de A: %v", names)
+	}
+	call(r, "DELETE", "/api/files/a.csv", "", a...)
+	if names, _ := list(a); !slices.Equal(names, []string{"seed.csv"}) {
+		t.Errorf("A después de borrar: %v", names)
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/pii"
+	"github.com/nubank/lola-ia-backend/internal/store"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+// Defaults de presupuesto (≈ los 20KB por archivo / 80KB totales de antes)
+const (
+	defaultMaxContextTokens = 20000
+	defaultMaxFileTokens    = 5000
+)
+
+// Estrategias de recorte de un archivo que no entra (CONTEXT_TRUNCATION).
+const (
+	truncationHead  = "head"  // el principio del archivo
+	truncationTail  = "tail"  // el final, sin el encabezado
+	truncationSmart = "smart" // el encabezado y las últimas filas
+)
+
+// filesContextConfig controla cuánto de los archivos cargados ve el modelo.
+type filesContextConfig struct {
+	MaxContextTokens int // presupuesto total, encabezados incluidos
+	MaxFileTokens    int // tope por archivo
+	// CountTokens estima los tokens de un texto; nil usa estimateTokens.
+	CountTokens func(s string) int
+	// RedactPII enmascara emails, teléfonos y tarjetas antes de armar el contexto.
+	RedactPII bool
+	// Truncation es la estrategia de recorte; vacío es truncationHead.
+	Truncation string
+}
+
+// parseTruncation valida CONTEXT_TRUNCATION; vacío es truncationHead.
+func parseTruncation(v string) (string, error) {
+	switch s := strings.ToLower(strings.TrimSpace(v)); s {
+	case "":
+		return truncationHead, nil
+	case truncationHead, truncationTail, truncationSmart:
+		return s, nil
+	default:
+		return "", fmt.Errorf("CONTEXT_TRUNCATION desconocido: %q (opciones: %s, %s, %s)", v, truncationHead, truncationTail, truncationSmart)
+	}
+}
+
+// estimateTokens aproxima tokens como bytes/4 (redondeando hacia arriba).
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// buildFilesContext returns a compact context string about files (the uploaded
+// ones, or those with the requested tags). Files are ranked by relevance to userQuery so the most useful ones get the
+// budget first; the output stays within cfg's token budget. filters, if any,
+// narrow each file to the matching rows before it is rendered. sources lists,
+// in context order, the files whose content made it in (fully or partially).
+func buildFilesContext(files []internal.KnowledgeFile, userQuery string, cfg filesContextConfig, filters tabular.Filters) (ctx string, sources []string) {
+	if len(files) == 0 {
+		return "", nil
+	}
+	notes := make(map[string]string)
+	if len(filters) > 0 {
+		for i, f := range files {
+			if f.Parsed == nil {
+				continue
+			}
+			if t, ok := filters.Apply(f.Parsed); ok {
+				note := fmt.Sprintf("  Filtrado: %d de %d filas", len(t.Rows), len(f.Parsed.Rows))
+				if f.Format != tabular.FormatCSV {
+					note += " (como CSV)"
+				}
+				notes[f.Name] = note + "\n"
+				files[i].Parsed = t
+				files[i].Text = tabular.CSVText(t)
+				files[i].Delimiter = ","
+			}
+		}
+	}
+	rankFiles(files, userQuery)
+	count := cfg.CountTokens
+	if count == nil {
+		count = estimateTokens
+	}
+
+	var b strings.Builder
+	used := 0
+	write := func(s string) {
+		b.WriteString(s)
+		used += count(s)
+	}
+	write("[Contexto de archivos CSV cargados]\n")
+	write("Puedes usar estos datos para responder si el usuario los menciona o pide análisis.\n")
+
+	const (
+		contentLabel = "Contenido (parcial):\n\n"
+		contentEnd   = "\n\n"
+	)
+	var full, partial, skipped int
+	for _, f := range files {
+		// encabezado por archivo con un resumen del esquema
+		head := fileContextHeader(f) + notes[f.Name]
+		if used+count(head) > cfg.MaxContextTokens {
+			skipped++
+			continue
+		}
+		write(head)
+
+		// contenido (enmascarado y después truncado al presupuesto que queda)
+		text := f.Text
+		if cfg.RedactPII {
+			text = redactFile(f.Name, text)
+		}
+		room := min(cfg.MaxFileTokens, cfg.MaxContextTokens-used-count(contentLabel)-count(contentEnd))
+		txt, cut := truncateFile(f, text, room, count, cfg.Truncation)
+		if txt == "" {
+			skipped++
+			continue
+		}
+		write(contentLabel)
+		write(txt)
+		write(contentEnd)
+		sources = append(sources, f.Name)
+		if cut {
+			partial++
+		} else {
+			full++
+		}
+	}
+	fmt.Printf("[context] %d archivo(s) completos, %d parciales, %d omitidos (~%d/%d tokens)\n",
+		full, partial, skipped, used, cfg.MaxContextTokens)
+	return b.String(), sources
+}
+
+// fileKeys devuelve el nombre en el store (ver store.FileScope.Key) de cada
+// archivo de files, con el nombre que ve la sesión.
+func fileKeys(kb store.FileScope, files []internal.KnowledgeFile) map[string]string {
+	out := make(map[string]string, len(files))
+	for _, f := range files {
+		out[kb.Key(f)] = f.Name
+	}
+	return out
+}
+
+// redactFile enmascara los datos personales de text y loguea cuántos había.
+func redactFile(name, text string) string {
+	out, n := pii.Redact(text)
+	if n.Total() > 0 {
+		fmt.Printf("[context] %s: %d valor(es) enmascarados (%d emails, %d teléfonos, %d tarjetas)\n",
+			name, n.Total(), n.Emails, n.Phones, n.Cards)
+	}
+	return out
+}
+
+func fileContextHeader(f internal.KnowledgeFile) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "- %s (%s, %d bytes)\n", f.Name, strings.ToUpper(f.Format), f.Size)
+	if f.Parsed != nil {
+		fmt.Fprintf(&b, "  Columnas (%d): %s\n", len(f.Parsed.Headers), strings.Join(f.Parsed.Headers, ", "))
+		// el contenido trae los encabezados originales
+		if len(f.RenamedHeaders) > 0 {
+			renames := make([]string, len(f.RenamedHeaders))
+			for i, r := range f.RenamedHeaders {
+				renames[i] = fmt.Sprintf("%q = %s", r.Original, r.Name)
+			}
+			fmt.Fprintf(&b, "  Encabezados en el archivo: %s\n", strings.Join(renames, ", "))
+		}
+		// el contenido va tal cual: el modelo tiene que saber cómo separarlo
+		if f.Delimiter != "" && f.Delimiter != "," {
+			fmt.Fprintf(&b, "  Separador: %q\n", f.Delimiter)
+		}
+		fmt.Fprintf(&b, "  Filas: %d\n", len(f.Parsed.Rows))
+	} else if f.ParseError != "" {
+		fmt.Fprintf(&b, "  (no se pudo parsear como %s: %s)\n", strings.ToUpper(f.Format), f.ParseError)
+	}
+	return b.String()
+}
+
+// truncateFile recorta text (el contenido de f) a maxTokens con la
+// estrategia dada (ver truncationHead). Nunca deja una fila a medias y marca
+// lo omitido: sin el marcador el modelo no sabe que faltan datos y puede dar
+// totales sobre una parte. cut indica si hubo recorte. Los JSON se recortan
+// siempre por el principio: el final de un JSON no se puede leer solo.
+func truncateFile(f internal.KnowledgeFile, text string, maxTokens int, count func(string) int, strategy string) (txt string, cut bool) {
+	if count(text) <= maxTokens {
+		return text, false
+	}
+	switch {
+	case f.Format == tabular.FormatJSON:
+	case strategy == truncationTail:
+		return truncateTail(f, text, maxTokens, count)
+	case strategy == truncationSmart:
+		if txt, ok := truncateSmart(f, text, maxTokens, count); ok {
+			return txt, true
+		}
+		// sin parsear no se sabe dónde termina el encabezado
+		return truncateTail(f, text, maxTokens, count)
+	}
+	return truncateHead(f, text, maxTokens, count)
+}
+
+// truncateHead se queda con el principio de text, cortado en el último fin
+// de línea, y el marcador al final.
+func truncateHead(f internal.KnowledgeFile, text string, maxTokens int, count func(string) int) (txt string, cut bool) {
+	total := -1
+	if f.Parsed != nil {
+		total = len(f.Parsed.Rows)
+	}
+	// lugar para el marcador más largo posible
+	txt = truncateToTokens(text, maxTokens-count("\n"+truncationMarker(len(text), total, total, false)), count)
+	if f.Format != tabular.FormatJSON {
+		if i := strings.LastIndexByte(txt, '\n'); i >= 0 {
+			txt = txt[:i+1]
+		}
+	}
+	if txt == "" {
+		return "", true
+	}
+	// filas mostradas: solo se puede contar si el recorte parsea (un JSON
+	// cortado no)
+	shown := -1
+	if total >= 0 && f.Format != tabular.FormatJSON {
+		if t, err := tabular.Parse(f.Format, txt); err == nil {
+			shown = len(t.Rows)
+		}
+	}
+	omitted := len(text) - len(txt)
+	if !strings.HasSuffix(txt, "\n") {
+		txt += "\n"
+	}
+	return txt + truncationMarker(omitted, shown, total, false), true
+}
+
+// truncateTail se queda con el final de text desde el primer fin de línea
+// (sin el encabezado), con el marcador al principio.
+func truncateTail(f internal.KnowledgeFile, text string, maxTokens int, count func(string) int) (txt string, cut bool) {
+	total := -1
+	if f.Parsed != nil {
+		total = len(f.Parsed.Rows)
+	}
+	txt = tailToTokens(text, maxTokens-count(truncationMarker(len(text), total, total, true)+"\n"), count)
+	// empieza a mitad de una línea: se descarta hasta el próximo fin de línea
+	if start := len(text) - len(txt); start > 0 && text[start-1] != '\n' {
+		i := strings.IndexByte(txt, '\n')
+		if i < 0 {
+			return "", true
+		}
+		txt = txt[i+1:]
+	}
+	if strings.TrimSpace(txt) == "" {
+		return "", true
+	}
+	// las filas se cuentan parseando el recorte con el encabezado del archivo
+	shown := -1
+	if head, _, ok := strings.Cut(text, "\n"); ok && total >= 0 {
+		if t, _, err := parseContent(f, head+"\n"+txt); err == nil {
+			shown = len(t.Rows)
+		}
+	}
+	return truncationMarker(len(text)-len(txt), shown, total, true) + "\n" + txt, true
+}
+
+// truncateSmart deja el encabezado y las últimas filas que entran, con el
+// marcador entre ambos. Parsea text (ya enmascarado) para no partir filas con
+// saltos de línea entre comillas; ok es false si no parsea.
+func truncateSmart(f internal.KnowledgeFile, text string, maxTokens int, count func(string) int) (txt string, ok bool) {
+	t, comma, err := parseContent(f, text)
+	if err != nil {
+		return "", false
+	}
+	total := len(t.Rows)
+	head := tabular.CSVRows([][]string{t.Headers}, comma)
+	room := maxTokens - count(head) - count(truncationMarker(len(text), total, total, true)+"\n")
+	// búsqueda binaria de cuántas filas del final entran
+	lo, hi := 0, total
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if count(tabular.CSVRows(t.Rows[total-mid:], comma)) <= room {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	if lo == 0 {
+		return "", true
+	}
+	body := tabular.CSVRows(t.Rows[total-lo:], comma)
+	omitted := max(len(text)-len(head)-len(body), 0)
+	return head + truncationMarker(omitted, lo, total, true) + "\n" + body, true
+}
+
+// parseContent parsea text, una parte del contenido de f, con el separador
+// de f: un CSV puede ir con ';' o '|', y los filtrados pasan a CSV con ','.
+func parseContent(f internal.KnowledgeFile, text string) (*internal.Table, rune, error) {
+	if f.Delimiter == "" && f.Format == tabular.FormatTSV {
+		t, err := tabular.ParseTSV(text)
+		return t, '\t', err
+	}
+	comma := ','
+	if f.Delimiter != "" {
+		comma, _ = utf8.DecodeRuneInString(f.Delimiter)
+	}
+	t, err := tabular.ParseDelimited(text, comma)
+	return t, comma, err
+}
+
+// truncationMarker describe lo que quedó afuera de un archivo recortado;
+// shown o total en -1 son desconocidos. last indica que se muestran las
+// últimas filas.
+func truncationMarker(omitted, shown, total int, last bool) string {
+	switch {
+	case shown >= 0 && total >= 0 && last:
+		return fmt.Sprintf("[... %d bytes omitidos; se muestran las últimas %d de %d filas ...]", omitted, shown, total)
+	case shown >= 0 && total >= 0:
+		return fmt.Sprintf("[... %d bytes omitidos; se muestran %d de %d filas ...]", omitted, shown, total)
+	case total >= 0:
+		return fmt.Sprintf("[... %d bytes omitidos; el archivo tiene %d filas ...]", omitted, total)
+	default:
+		return fmt.Sprintf("[... %d bytes omitidos ...]", omitted)
+	}
+}
+
+// truncateToTokens devuelve el prefijo más largo de s que entra en maxTokens,
+// sin cortar runas UTF-8 por la mitad.
+func truncateToTokens(s string, maxTokens int, count func(string) int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	if count(s) <= maxTokens {
+		return s
+	}
+	// búsqueda binaria del corte: el contador puede ser cualquier tokenizer
+	lo, hi := 0, len(s)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if count(s[:mid]) <= maxTokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	// evitar cortar runas UTF-8 por la mitad
+	for lo > 0 && lo < len(s) && !utf8.RuneStart(s[lo]) {
+		lo--
+	}
+	return s[:lo]
+}
+
+// tailToTokens devuelve el sufijo más largo de s que entra en maxTokens,
+// sin cortar runas UTF-8 por la mitad.
+func tailToTokens(s string, maxTokens int, count func(string) int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	if count(s) <= maxTokens {
+		return s
+	}
+	lo, hi := 0, len(s)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if count(s[mid:]) <= maxTokens {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	for lo < len(s) && !utf8.RuneStart(s[lo]) {
+		lo++
+	}
+	return s[lo:]
+}
+
+// Palabras muy comunes que no aportan a la relevancia.
+var rankStopwords = map[string]bool{
+	"los": true, "las": true, "del": true, "que": true, "por": true, "para": true,
+	"con": true, "una": true, "uno": true, "cual": true, "son": true, "como": true,
+	"the": true, "and": true, "for": true, "what": true, "are": true, "from": true,
+	"with": true, "this": true, "that": true,
+}
+
+// queryTerms separa q en palabras en minúscula de 3+ letras sin stopwords.
+func queryTerms(q string) []string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	out := words[:0]
+	for _, w := range words {
+		if utf8.RuneCountInString(w) >= 3 && !rankStopwords[w] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// fileScore puntúa la coincidencia entre los términos de la consulta y el
+// archivo: un término en el nombre o en las columnas vale más que uno que
+// solo aparece en el contenido.
+func fileScore(f internal.KnowledgeFile, terms []string) int {
+	if len(terms) == 0 {
+		return 0
+	}
+	schema := make(map[string]bool)
+	for _, w := range queryTerms(f.Name) {
+		schema[w] = true
+	}
+	if f.Parsed != nil {
+		for _, h := range f.Parsed.Headers {
+			for _, w := range queryTerms(h) {
+				schema[w] = true
+			}
+		}
+	}
+	text := strings.ToLower(f.Text)
+	score := 0
+	for _, t := range terms {
+		switch {
+		case schema[t]:
+			score += 3
+		case strings.Contains(text, t):
+			score++
+		}
+	}
+	return score
+}
+
+// rankFiles ordena files de más a menos relevante para la consulta; los
+// empates se resuelven por nombre para que el resultado sea determinista.
+func rankFiles(files []internal.KnowledgeFile, query string) {
+	terms := queryTerms(query)
+	scores := make(map[string]int, len(files))
+	for _, f := range files {
+		scores[f.Name] = fileScore(f, terms)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		si, sj := scores[files[i].Name], scores[files[j].Name]
+		if si != sj {
+			return si > sj
+		}
+		return files[i].Name < files[j].Name
+	})
+}
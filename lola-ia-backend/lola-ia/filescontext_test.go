@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+// csvFile arma un KnowledgeFile ya parseado, como queda al subirlo.
+func csvFile(name, text string) internal.KnowledgeFile {
+	f := internal.KnowledgeFile{Name: name, Size: len(text), Text: text}
+	tabular.Annotate(&f, tabular.AnnotateOptions{})
+	return f
+}
+
+func TestFileContextHeaderSchema(t *testing.T) {
+	h := fileContextHeader(csvFile("nps.csv", "id,comentario,nps\r\n1,\"lento, caro\",3\r\n2,ok,9\r\n"))
+	for _, want := range []string{"nps.csv (CSV", "Columnas (3): id, comentario, nps", "Filas: 2"} {
+		if !strings.Contains(h, want) {
+			t.Errorf("encabezado sin %q:\n%s", want, h)
+		}
+	}
+
+	h = fileContextHeader(csvFile("nps.json", `[{"id":1,"nps":9}]`))
+	if !strings.Contains(h, "nps.json (JSON") || !strings.Contains(h, "Columnas (2): id, nps") {
+		t.Errorf("encabezado de un JSON:\n%s", h)
+	}
+
+	h = fileContextHeader(csvFile("roto.csv", "a,b\n1,\"sin cerrar\n"))
+	if !strings.Contains(h, "no se pudo parsear como CSV") {
+		t.Errorf("encabezado de un CSV roto:\n%s", h)
+	}
+}
+
+// bigCSV arma un CSV de rows filas con texto multibyte, para que un recorte
+// mal hecho parta una runa.
+func bigCSV(name string, rows int) internal.KnowledgeFile {
+	var b strings.Builder
+	b.WriteString("id,comentario,región\n")
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&b, "%d,\"la app tardó demasiado, ¿qué pasó? ñandú %d\",São Paulo\n", i, i)
+	}
+	return csvFile(name, b.String())
+}
+
+func TestBuildFilesContextBudget(t *testing.T) {
+	files := []internal.KnowledgeFile{bigCSV("a.csv", 5000), bigCSV("b.csv", 5000), bigCSV("c.csv", 200)}
+	for _, cfg := range []filesContextConfig{
+		{MaxContextTokens: 2000, MaxFileTokens: 1000},
+		{MaxContextTokens: 8000, MaxFileTokens: 5000},
+		{MaxContextTokens: 300, MaxFileTokens: 5000},
+	} {
+		ctx, sources := buildFilesContext(append([]internal.KnowledgeFile(nil), files...), "", cfg, nil)
+		if n := estimateTokens(ctx); n > cfg.MaxContextTokens {
+			t.Errorf("%+v: %d tokens, más que el presupuesto", cfg, n)
+		}
+		if !utf8.ValidString(ctx) {
+			t.Errorf("%+v: el recorte partió una runa", cfg)
+		}
+		if len(sources) == 0 && cfg.MaxContextTokens >= 2000 {
+			t.Errorf("%+v: no entró ningún archivo", cfg)
+		}
+	}
+}
+
+func TestBuildFilesContextFits(t *testing.T) {
+	// si todo entra no se recorta nada
+	f := csvFile("nps.csv", "id,nps\n1,9\n2,3\n")
+	ctx, sources := buildFilesContext([]internal.KnowledgeFile{f}, "", filesContextConfig{MaxContextTokens: 1000, MaxFileTokens: 1000}, nil)
+	if !strings.Contains(ctx, f.Text) || len(sources) != 1 {
+		t.Errorf("contexto = %q, sources = %v", ctx, sources)
+	}
+}
+
+func TestRankFilesByColumn(t *testing.T) {
+	files := []internal.KnowledgeFile{
+		csvFile("a_ventas.csv", "fecha,monto\n2024-01-01,10\n"),
+		csvFile("b_soporte.csv", "ticket,canal\n1,chat\n"),
+		csvFile("c_encuesta.csv", "id,nps,comentario\n1,9,bien\n"),
+	}
+	rankFiles(files, "¿Cuál es el NPS promedio?")
+	if files[0].Name != "c_encuesta.csv" {
+		t.Errorf("primero %s, want c_encuesta.csv", files[0].Name)
+	}
+
+	// sin coincidencias queda el orden por nombre
+	rankFiles(files, "hola")
+	for i, want := range []string{"a_ventas.csv", "b_soporte.csv", "c_encuesta.csv"} {
+		if files[i].Name != want {
+			t.Errorf("files[%d] = %s, want %s", i, files[i].Name, want)
+		}
+	}
+}
+
+func TestBuildFilesContextRelevantFirst(t *testing.T) {
+	// con presupuesto para un solo archivo entra el que tiene la columna
+	files := []internal.KnowledgeFile{bigCSV("a.csv", 2000), csvFile("z.csv", "id,canal\n1,chat\n")}
+	_, sources := buildFilesContext(files, "¿qué canal se usa más?", filesContextConfig{MaxContextTokens: 200, MaxFileTokens: 200}, nil)
+	if len(sources) == 0 || sources[0] != "z.csv" {
+		t.Errorf("sources = %v, want z.csv primero", sources)
+	}
+}
+
+func TestBuildFilesContextFilters(t *testing.T) {
+	files := []internal.KnowledgeFile{
+		csvFile("nps.csv", "id,canal,fecha\n1,app,2024-04-30\n2,chat,2024-05-10\n3,app,2024-05-20\n"),
+		csvFile("otros.csv", "id,comentario\n1,sin canal\n"),
+	}
+	filters, err := tabular.CompileFilters(map[string]internal.RowFilter{
+		"canal": {Eq: "app"},
+		"fecha": {From: "2024-05-01"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, _ := buildFilesContext(files, "", filesContextConfig{MaxContextTokens: 1000, MaxFileTokens: 1000}, filters)
+	for _, want := range []string{"Filtrado: 1 de 3 filas", "3,app,2024-05-20", "1,sin canal"} {
+		if !strings.Contains(ctx, want) {
+			t.Errorf("contexto sin %q:\n%s", want, ctx)
+		}
+	}
+	for _, gone := range []string{"2024-04-30", "2,chat"} {
+		if strings.Contains(ctx, gone) {
+			t.Errorf("contexto con la fila filtrada %q", gone)
+		}
+	}
+	// otros.csv no tiene las columnas: queda entero y sin nota
+	if strings.Count(ctx, "Filtrado:") != 1 {
+		t.Errorf("notas de filtro:\n%s", ctx)
+	}
+}
+
+func TestBuildFilesContextRedactPII(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("id,email,comentario,tarjeta\n")
+	for i := 0; i < 400; i++ {
+		fmt.Fprintf(&b, "%d,cliente%d@banco.com,\"¿por qué tardó? ñandú\",4111 1111 1111 1111\n", i, i)
+	}
+	f := csvFile("clientes.csv", b.String())
+	for _, cfg := range []filesContextConfig{
+		{MaxContextTokens: 100000, MaxFileTokens: 100000, RedactPII: true},
+		{MaxContextTokens: 1000, MaxFileTokens: 800, RedactPII: true}, // con recorte
+	} {
+		ctx, _ := buildFilesContext([]internal.KnowledgeFile{f}, "", cfg, nil)
+		if strings.Contains(ctx, "@banco.com") || strings.Contains(ctx, "4111 1111") {
+			t.Errorf("%+v: quedaron datos personales", cfg)
+		}
+		if !strings.Contains(ctx, "[EMAIL]") || !strings.Contains(ctx, "[TARJETA]") {
+			t.Errorf("%+v: sin marcadores", cfg)
+		}
+		if n := estimateTokens(ctx); n > cfg.MaxContextTokens || !utf8.ValidString(ctx) {
+			t.Errorf("%+v: %d tokens, UTF-8 válido = %v", cfg, n, utf8.ValidString(ctx))
+		}
+	}
+	// sin REDACT_PII el texto va tal cual
+	ctx, _ := buildFilesContext([]internal.KnowledgeFile{f}, "", filesContextConfig{MaxContextTokens: 100000, MaxFileTokens: 100000}, nil)
+	if !strings.Contains(ctx, "cliente1@banco.com") {
+		t.Error("sin REDACT_PII se enmascaró igual")
+	}
+}
+
+func TestBuildFilesContextSources(t *testing.T) {
+	files := func() []internal.KnowledgeFile {
+		return []internal.KnowledgeFile{bigCSV("a.csv", 500), csvFile("z.csv", "id,canal\n1,chat\n"), csvFile("b.csv", "id,monto\n1,77\n")}
+	}
+	cases := []struct {
+		budget int
+		want   []string
+	}{
+		{100, []string{"z.csv"}},                     // solo entra el relevante
+		{20000, []string{"z.csv", "a.csv", "b.csv"}}, // entran todos
+	}
+	for _, tc := range cases {
+		ctx, sources := buildFilesContext(files(), "¿qué canal se usa más?", filesContextConfig{MaxContextTokens: tc.budget, MaxFileTokens: 20000}, nil)
+		if !slices.Equal(sources, tc.want) {
+			t.Errorf("presupuesto %d: sources = %v, want %v", tc.budget, sources, tc.want)
+		}
+		if in := strings.Contains(ctx, "1,77"); in != slices.Contains(sources, "b.csv") {
+			t.Errorf("presupuesto %d: b.csv en el contexto = %v, en sources = %v", tc.budget, in, sources)
+		}
+	}
+}
+
+func TestSendMessageSources(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"MAX_CONTEXT_TOKENS": "100"})
+	sid := []string{"X-Session-ID", "s-sources"}
+	body, _ := json.Marshal(internal.UploadFilesRequest{Files: []internal.KnowledgeFile{
+		bigCSV("a.csv", 2000), {Name: "z.csv", Text: "id,canal\n1,chat\n"},
+	}})
+	call(r, "POST", "/api/files", string(body), sid...)
+
+	var res internal.SendMessageResponse
+	decode(t, call(r, "POST", "/api/messages", `{"content":"Analiza qué canal se usa más en las encuestas"}`, sid...), &res)
+	if !slices.Equal(res.Sources, []string{"z.csv"}) {
+		t.Errorf("sources = %v, want [z.csv]", res.Sources)
+	}
+}
+
+func TestBuildFilesContextTruncationMarker(t *testing.T) {
+	cfg := filesContextConfig{MaxContextTokens: 2000, MaxFileTokens: 1000}
+
+	// sin recorte no hay marcador
+	ctx, _ := buildFilesContext([]internal.KnowledgeFile{bigCSV("chico.csv", 5)}, "", cfg, nil)
+	if strings.Contains(ctx, "bytes omitidos") {
+		t.Errorf("marcador sin recorte:\n%s", ctx)
+	}
+
+	// recortado: las filas mostradas son las que quedaron en el contexto
+	f := bigCSV("grande.csv", 500)
+	ctx, _ = buildFilesContext([]internal.KnowledgeFile{f}, "", cfg, nil)
+	var omitted, shown, total int
+	i := strings.Index(ctx, "[... ")
+	if i < 0 {
+		t.Fatalf("recortado sin marcador:\n%s", ctx)
+	}
+	if _, err := fmt.Sscanf(ctx[i:], "[... %d bytes omitidos; se muestran %d de %d filas ...]", &omitted, &shown, &total); err != nil {
+		t.Fatalf("marcador %q: %v", ctx[i:], err)
+	}
+	if total != 500 || shown <= 0 || shown >= total || omitted <= 0 {
+		t.Errorf("omitted = %d, shown = %d, total = %d", omitted, shown, total)
+	}
+	if n := strings.Count(ctx[:i], "São Paulo\n"); n != shown {
+		t.Errorf("el contexto tiene %d filas, el marcador dice %d", n, shown)
+	}
+
+	// un texto sin estructura solo informa los bytes
+	plain := internal.KnowledgeFile{Name: "notas.txt", Text: strings.Repeat("una línea de notas sueltas\n", 2000)}
+	ctx, _ = buildFilesContext([]internal.KnowledgeFile{plain}, "", cfg, nil)
+	if !strings.Contains(ctx, " bytes omitidos ...]") || strings.Contains(ctx, "filas ...]") {
+		t.Errorf("marcador de un texto:\n%s", ctx[max(len(ctx)-200, 0):])
+	}
+}
+
+func TestTruncationMarker(t *testing.T) {
+	for _, tc := range []struct {
+		omitted, shown, total int
+		last                  bool
+		want                  string
+	}{
+		{10, 3, 8, false, "[... 10 bytes omitidos; se muestran 3 de 8 filas ...]"},
+		{10, 3, 8, true, "[... 10 bytes omitidos; se muestran las últimas 3 de 8 filas ...]"},
+		{10, -1, 8, false, "[... 10 bytes omitidos; el archivo tiene 8 filas ...]"},
+		{10, -1, -1, false, "[... 10 bytes omitidos ...]"},
+	} {
+		if got := truncationMarker(tc.omitted, tc.shown, tc.total, tc.last); got != tc.want {
+			t.Errorf("truncationMarker(%d, %d, %d, %v) = %q, want %q", tc.omitted, tc.shown, tc.total, tc.last, got, tc.want)
+		}
+	}
+}
+
+func TestFileContextHeaderDelimiter(t *testing.T) {
+	comma := fileContextHeader(csvFile("nps.csv", "id,comentario,nps\n1,ok,9\n"))
+	semi := fileContextHeader(csvFile("nps.csv", "id;comentario;nps\n1;ok;9\n"))
+	want := "Columnas (3): id, comentario, nps"
+	if !strings.Contains(comma, want) || !strings.Contains(semi, want) {
+		t.Errorf("encabezados:\n%s\n%s", comma, semi)
+	}
+}
+
+func TestTruncateFileStrategies(t *testing.T) {
+	f := bigCSV("serie.csv", 500)
+	header := "id,comentario,región\n"
+	first, last := "\n0,\"", "\n499,\""
+	for _, tc := range []struct {
+		strategy    string
+		header      bool // el recorte empieza con el encabezado
+		first, last bool // tiene la primera / la última fila
+		markerFirst bool
+	}{
+		{truncationHead, true, true, false, false},
+		{"", true, true, false, false},
+		{truncationTail, false, false, true, true},
+		{truncationSmart, true, false, true, false},
+	} {
+		txt, cut := truncateFile(f, f.Text, 1000, estimateTokens, tc.strategy)
+		if !cut {
+			t.Fatalf("%q: sin recorte", tc.strategy)
+		}
+		if n := estimateTokens(txt); n > 1000 {
+			t.Errorf("%q: %d tokens, tope 1000", tc.strategy, n)
+		}
+		if got := strings.HasPrefix(txt, header); got != tc.header {
+			t.Errorf("%q: empieza con el encabezado = %v, want %v", tc.strategy, got, tc.header)
+		}
+		if got := strings.Contains(txt, first); got != tc.first {
+			t.Errorf("%q: tiene la primera fila = %v, want %v", tc.strategy, got, tc.first)
+		}
+		if got := strings.Contains(txt, last); got != tc.last {
+			t.Errorf("%q: tiene la última fila = %v, want %v", tc.strategy, got, tc.last)
+		}
+		if got := strings.HasPrefix(txt, "[... "); got != tc.markerFirst {
+			t.Errorf("%q: marcador al principio = %v, want %v", tc.strategy, got, tc.markerFirst)
+		}
+		// el marcador cuenta las filas que quedaron
+		i := strings.Index(txt, "[... ")
+		if i < 0 {
+			t.Fatalf("%q: sin marcador:\n%s", tc.strategy, txt)
+		}
+		var omitted, shown, total int
+		format := "[... %d bytes omitidos; se muestran %d de %d filas ...]"
+		if tc.last {
+			format = "[... %d bytes omitidos; se muestran las últimas %d de %d filas ...]"
+		}
+		if _, err := fmt.Sscanf(txt[i:], format, &omitted, &shown, &total); err != nil {
+			t.Fatalf("%q: marcador %q: %v", tc.strategy, txt[i:], err)
+		}
+		if n := strings.Count(txt, "São Paulo\n"); total != 500 || n != shown {
+			t.Errorf("%q: el recorte tiene %d filas, el marcador dice %d de %d", tc.strategy, n, shown, total)
+		}
+	}
+}
+
+func TestTruncateSmartQuotedNewlines(t *testing.T) {
+	// las filas con saltos de línea entre comillas no se parten
+	var b strings.Builder
+	b.WriteString("fecha,comentario\n")
+	for i := range 300 {
+		fmt.Fprintf(&b, "2024-01-%03d,\"primera línea\nsegunda línea %d\"\n", i, i)
+	}
+	f := csvFile("notas.csv", b.String())
+	txt, cut := truncateFile(f, f.Text, 300, estimateTokens, truncationSmart)
+	if !cut || !strings.HasPrefix(txt, "fecha,comentario\n") {
+		t.Fatalf("recorte smart:\n%s", txt)
+	}
+	_, body, _ := strings.Cut(txt, "...]\n")
+	tab, err := tabular.ParseDelimited("fecha,comentario\n"+body, ',')
+	if err != nil {
+		t.Fatalf("el recorte no parsea: %v\n%s", err, body)
+	}
+	if n := len(tab.Rows); n == 0 || tab.Rows[n-1][1] != "primera línea\nsegunda línea 299" {
+		t.Errorf("filas = %v", tab.Rows)
+	}
+}
+
+func TestParseTruncation(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		err      bool
+	}{
+		{"", truncationHead, false},
+		{"head", truncationHead, false},
+		{" Tail ", truncationTail, false},
+		{"SMART", truncationSmart, false},
+		{"middle", "", true},
+	} {
+		got, err := parseTruncation(tc.in)
+		if got != tc.want || (err != nil) != tc.err {
+			t.Errorf("parseTruncation(%q) = %q, %v", tc.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+// Modos de ANALYST_FORMAT_CHECK: qué hacer con una respuesta de análisis a la
+// que le faltan secciones del formato.
+const (
+	formatCheckOff   = "off"   // no se revisa
+	formatCheckFlag  = "flag"  // se marca con format_incomplete
+	formatCheckRetry = "retry" // se pide una vez más y, si sigue incompleta, se marca
+)
+
+// formatChecker revisa que las respuestas de análisis traigan todas las
+// secciones ("--- Summary", ...) del template con el que se armó el prompt,
+// para los parsers que dependen del formato fijo.
+type formatChecker struct {
+	mode     string
+	sections map[string][]string // por nombre de template
+}
+
+// newFormatChecker devuelve nil (sin revisión) con mode "off"; un mode
+// desconocido se trata como "flag".
+func newFormatChecker(mode string, templates promptTemplates) *formatChecker {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case formatCheckOff:
+		return nil
+	case "":
+		mode = formatCheckFlag
+	case formatCheckFlag, formatCheckRetry:
+	default:
+		fmt.Printf("[prompt] ANALYST_FORMAT_CHECK=%s desconocido; se usa %s\n", mode, formatCheckFlag)
+		mode = formatCheckFlag
+	}
+	f := &formatChecker{mode: mode, sections: make(map[string][]string, len(templates))}
+	for name, tmpl := range templates {
+		if s := templateSections(tmpl); len(s) > 0 {
+			f.sections[name] = s
+		}
+	}
+	return f
+}
+
+// templateSections devuelve los títulos de las secciones del formato de
+// tmpl, en orden: "--- Summary [Provide ...]" es "Summary".
+func templateSections(tmpl string) []string {
+	var out []string
+	for _, line := range strings.Split(tmpl, "\n") {
+		title, ok := sectionTitle(line)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(title, "["); i >= 0 {
+			title = strings.TrimSpace(title[:i])
+		}
+		if title != "" {
+			out = append(out, title)
+		}
+	}
+	return out
+}
+
+// sectionTitle devuelve lo que sigue a "---" en una línea de sección; los
+// modelos a veces la envuelven en markdown ("**--- Summary**", "## --- ...").
+func sectionTitle(line string) (string, bool) {
+	line = strings.TrimLeft(strings.TrimSpace(line), "#*_ ")
+	rest, ok := strings.CutPrefix(line, "---")
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSpace(strings.Trim(rest, "*_ ")), true
+}
+
+// missingSections devuelve las secciones de want que no encabezan ninguna
+// línea de text (sin distinguir mayúsculas).
+func missingSections(text string, want []string) []string {
+	var found []string
+	for _, line := range strings.Split(text, "\n") {
+		if title, ok := sectionTitle(line); ok {
+			found = append(found, strings.ToLower(title))
+		}
+	}
+	var missing []string
+	for _, s := range want {
+		hit := false
+		for _, f := range found {
+			hit = hit || strings.HasPrefix(f, strings.ToLower(s))
+		}
+		if !hit {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// checkMode devuelve el modo configurado; "off" sin revisión.
+func (f *formatChecker) checkMode() string {
+	if f == nil {
+		return formatCheckOff
+	}
+	return f.mode
+}
+
+// missing devuelve las secciones que le faltan a text, una respuesta del
+// modo mode; nil si está completa o el modo no tiene formato (p.ej. plain).
+func (f *formatChecker) missing(mode, text string) []string {
+	if f == nil {
+		return nil
+	}
+	return missingSections(text, f.sections[mode])
+}
+
+// check revisa res y, en modo "retry", vuelve a pedir la respuesta una vez
+// con una instrucción que nombra las secciones faltantes. Devuelve la
+// respuesta final (con el consumo de ambas llamadas) y las secciones que le
+// siguen faltando. Si el reintento falla se queda con la primera respuesta.
+func (f *formatChecker) check(ctx context.Context, chat provider.ChatProvider, history []internal.Message, prompt, mode string, res provider.Result) (provider.Result, []string) {
+	missing := f.missing(mode, res.Text)
+	if len(missing) == 0 || f.mode != formatCheckRetry {
+		return res, missing
+	}
+	fmt.Printf("[prompt] faltan secciones en la respuesta (%s): %s; se pide de nuevo\n", mode, strings.Join(missing, ", "))
+	retryHistory := append(append([]internal.Message(nil), history...),
+		internal.Message{Role: internal.RoleUser, Content: prompt},
+		internal.Message{Role: internal.RoleAssistant, Content: res.Text},
+	)
+	retry, err := chat.Reply(ctx, retryHistory, correctionPrompt(f.sections[mode], missing))
+	if err != nil {
+		fmt.Printf("[prompt] error en el reintento por formato: %v\n", err)
+		return res, missing
+	}
+	retry.Usage = addUsage(res.Usage, retry.Usage)
+	return retry, f.missing(mode, retry.Text)
+}
+
+// correctionPrompt pide reescribir la respuesta anterior con todas las
+// secciones.
+func correctionPrompt(sections, missing []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Your previous answer is missing these required sections: %s.\n", strings.Join(missing, ", "))
+	b.WriteString("Rewrite the complete answer using exactly the required format, with every section header in this order and nothing outside of them:\n")
+	for _, s := range sections {
+		fmt.Fprintf(&b, "--- %s\n", s)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// addUsage suma dos consumos; nil si ninguno se informó.
+func addUsage(a, b *internal.Usage) *internal.Usage {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+	return &internal.Usage{
+		InputTokens:  a.InputTokens + b.InputTokens,
+		OutputTokens: a.OutputTokens + b.OutputTokens,
+		TotalTokens:  a.TotalTokens + b.TotalTokens,
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// analystSections son las secciones del template por defecto.
+var analystSections = []string{"Summary", "Main Pain Points & Needs", "Actionable Feedback",
+	"Top 3 Topics and (%) of Mentions", "Examples of Verbatim for those main topics"}
+
+const (
+	completeReply = "--- Summary\nLa app es lenta.\n--- Main Pain Points & Needs\n- Demoras\n--- Actionable Feedback\n- Optimizar\n" +
+		"--- Top 3 Topics and (%) of Mentions\n1. Velocidad (60%)\n--- Examples of Verbatim for those main topics\nVelocidad: \"tarda mucho\""
+	incompleteReply = "--- Summary\nLa app es lenta.\n--- Actionable Feedback\n- Optimizar"
+)
+
+func TestTemplateSections(t *testing.T) {
+	if got := templateSections(analystTemplate); !slices.Equal(got, analystSections) {
+		t.Errorf("templateSections = %q", got)
+	}
+}
+
+func TestMissingSections(t *testing.T) {
+	drift := "**--- Summary**\nx\n## --- main pain points & needs\nx\n--- Actionable Feedback:\nx\n" +
+		"--- TOP 3 TOPICS AND (%) OF MENTIONS\nx\n__--- Examples of Verbatim for those main topics__\nx"
+	for _, tc := range []struct {
+		name, text string
+		want       []string
+	}{
+		{"completa", completeReply, nil},
+		{"con markdown y mayúsculas", drift, nil},
+		{"incompleta", incompleteReply, []string{"Main Pain Points & Needs", "Top 3 Topics and (%) of Mentions", "Examples of Verbatim for those main topics"}},
+		{"sin formato", "Hola, ¿en qué te ayudo?", analystSections},
+	} {
+		if got := missingSections(tc.text, analystSections); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: missingSections = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSendMessageFormatCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		mode    string
+		replies []string
+		calls   int
+		missing int
+	}{
+		{"flag completa", "flag", []string{completeReply}, 1, 0},
+		{"flag incompleta", "flag", []string{incompleteReply}, 1, 3},
+		{"retry completa", "retry", []string{completeReply}, 1, 0},
+		{"retry arreglada", "retry", []string{incompleteReply, completeReply}, 2, 0},
+		{"retry sigue incompleta", "retry", []string{incompleteReply, incompleteReply}, 2, 3},
+		{"off", "off", []string{incompleteReply}, 1, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				prompts []string
+			)
+			r := newOllamaRouter(t, func(w http.ResponseWriter, r *http.Request) {
+				var p struct {
+					Messages []internal.Message `json:"messages"`
+				}
+				json.NewDecoder(r.Body).Decode(&p)
+				mu.Lock()
+				prompts = append(prompts, p.Messages[len(p.Messages)-1].Content)
+				reply := tc.replies[min(len(prompts), len(tc.replies))-1]
+				mu.Unlock()
+				json.NewEncoder(w).Encode(map[string]any{"message": map[string]string{"role": "assistant", "content": reply}, "done": true})
+			}, map[string]string{"ANALYST_FORMAT_CHECK": tc.mode})
+
+			w := call(r, "POST", "/api/messages", `{"content":"Hazme un análisis de las encuestas"}`, "X-Session-ID", "s-format")
+			var res internal.SendMessageResponse
+			decode(t, w, &res)
+			mu.Lock()
+			defer mu.Unlock()
+			if len(prompts) != tc.calls {
+				t.Errorf("%d llamadas, want %d", len(prompts), tc.calls)
+			}
+			if res.FormatIncomplete != (tc.missing > 0) || len(res.MissingSections) != tc.missing {
+				t.Errorf("format_incomplete = %v, missing = %q", res.FormatIncomplete, res.MissingSections)
+			}
+			if res.Reply.Content != tc.replies[tc.calls-1] {
+				t.Errorf("respuesta = %q", res.Reply.Content)
+			}
+			if tc.calls > 1 && !strings.Contains(prompts[1], "missing these required sections: Main Pain Points & Needs") {
+				t.Errorf("reintento sin la corrección:\n%s", prompts[1])
+			}
+		})
+	}
+}
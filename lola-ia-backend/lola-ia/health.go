@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+const (
+	// readyCacheTTL evita pegarle al proveedor en cada sondeo del balanceador
+	readyCacheTTL = 10 * time.Second
+	readyTimeout  = 5 * time.Second
+)
+
+// readiness verifica la conectividad con el proveedor y cachea el resultado.
+type readiness struct {
+	chat provider.ChatProvider
+	ping provider.Pinger // nil si el provider no lo soporta (mock)
+	// breaker, si hay (BREAKER_FAILURES), se informa en la respuesta
+	breaker *breaker
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// newReadiness recibe el provider sin envolver, para poder detectar Pinger.
+func newReadiness(chat provider.ChatProvider) *readiness {
+	p, _ := chat.(provider.Pinger)
+	return &readiness{chat: chat, ping: p}
+}
+
+// check devuelve el último resultado si tiene menos de readyCacheTTL; si no,
+// vuelve a consultar. El mutex hace que sondeos simultáneos esperen una sola
+// consulta en vez de lanzar una cada uno.
+func (r *readiness) check(ctx context.Context) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ping == nil {
+		return time.Now(), nil
+	}
+	if time.Since(r.checked) < readyCacheTTL {
+		return r.checked, r.err
+	}
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	r.err = r.ping.Ping(ctx)
+	r.checked = time.Now()
+	return r.checked, r.err
+}
+
+// handler responde 200 si el proveedor está disponible y 503 si no.
+func (r *readiness) handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		at, err := r.check(c.Request.Context())
+		body := gin.H{
+			"status":     "ok",
+			"model":      r.chat.Model(),
+			"checked_at": at.Format(time.RFC3339),
+		}
+		if r.breaker != nil {
+			body["breaker"] = r.breaker.State().String()
+		}
+		if err != nil {
+			body["status"] = "degraded"
+			body["error"] = err.Error()
+			c.JSON(503, body)
+			return
+		}
+		c.JSON(200, body)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+// stubPinger es un provider mock con Ping configurable que cuenta las consultas.
+type stubPinger struct {
+	provider.MockProvider
+	err   error
+	calls *atomic.Int32
+}
+
+func (p stubPinger) Ping(context.Context) error {
+	p.calls.Add(1)
+	return p.err
+}
+
+func ready(t *testing.T, r *readiness) (int, map[string]any) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/health/ready", nil)
+	r.handler()(c)
+	var body map[string]any
+	decode(t, w, &body)
+	return w.Code, body
+}
+
+func TestReadinessHealthy(t *testing.T) {
+	var calls atomic.Int32
+	r := newReadiness(stubPinger{calls: &calls})
+	for i := 0; i < 3; i++ {
+		if code, body := ready(t, r); code != 200 || body["status"] != "ok" {
+			t.Fatalf("status %d: %v", code, body)
+		}
+	}
+	// el resultado se cachea: una sola consulta al proveedor
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Ping llamado %d veces, want 1", n)
+	}
+}
+
+func TestReadinessDegraded(t *testing.T) {
+	var calls atomic.Int32
+	r := newReadiness(stubPinger{err: errors.New("401 invalid api key"), calls: &calls})
+	code, body := ready(t, r)
+	if code != 503 || body["status"] != "degraded" || body["error"] != "401 invalid api key" {
+		t.Errorf("status %d: %v", code, body)
+	}
+}
+
+func TestReadinessWithoutPinger(t *testing.T) {
+	// el mock no sabe hacer ping: se considera listo
+	if code, _ := ready(t, newReadiness(provider.MockProvider{})); code != 200 {
+		t.Errorf("status %d", code)
+	}
+}
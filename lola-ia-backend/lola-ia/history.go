@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+// historyHead cuenta los mensajes fijos del comienzo de msgs: los de sistema
+// (la persona) y el saludo del asistente. El recorte y el resumen los
+// conservan siempre.
+func historyHead(msgs []internal.Message) int {
+	n := 0
+	for n < len(msgs) && msgs[n].Role == internal.RoleSystem {
+		n++
+	}
+	if n < len(msgs) && msgs[n].Role == internal.RoleAssistant {
+		n++
+	}
+	return n
+}
+
+// trimHistory devuelve los últimos max mensajes de msgs, conservando la
+// persona y el saludo inicial si los hay. max <= 0 no recorta. No modifica
+// msgs: el store sigue teniendo el historial completo.
+func trimHistory(msgs []internal.Message, max int) []internal.Message {
+	if max <= 0 || len(msgs) <= max {
+		return msgs
+	}
+	head := historyHead(msgs)
+	if head+max >= len(msgs) {
+		return msgs
+	}
+	out := make([]internal.Message, 0, head+max)
+	out = append(out, msgs[:head]...)
+	return append(out, msgs[len(msgs)-max:]...)
+}
+
+const (
+	defaultSummaryAfter = 30
+	defaultSummaryKeep  = 10
+	// summaryCacheMax acota las sesiones con resumen guardado.
+	summaryCacheMax = 1000
+	summaryPrefix   = "[Resumen de la conversación anterior]\n"
+)
+
+// summarizer resume los mensajes viejos de una sesión en un único mensaje
+// sintético para el prompt; el store sigue con el historial completo. El
+// resumen se guarda y solo se rehace cuando vuelven a juntarse más de after
+// mensajes sin resumir.
+type summarizer struct {
+	chat  provider.ChatProvider
+	after int // mensajes sin resumir que disparan un resumen
+	keep  int // mensajes recientes que quedan siempre textuales
+
+	mu    sync.Mutex
+	cache map[string]summary
+}
+
+// summary resume los mensajes de la sesión hasta upTo (ID) inclusive.
+type summary struct {
+	upTo string
+	text string
+}
+
+// newSummarizer devuelve nil salvo que HISTORY_SUMMARY=true. Con
+// HISTORY_SUMMARY_AFTER y HISTORY_SUMMARY_KEEP se ajusta cuándo resumir y
+// cuántos mensajes recientes se mandan textuales.
+func newSummarizer(chat provider.ChatProvider) *summarizer {
+	if on, _ := strconv.ParseBool(os.Getenv("HISTORY_SUMMARY")); !on {
+		return nil
+	}
+	s := &summarizer{
+		chat:  chat,
+		after: envInt("HISTORY_SUMMARY_AFTER", defaultSummaryAfter),
+		keep:  envInt("HISTORY_SUMMARY_KEEP", defaultSummaryKeep),
+		cache: make(map[string]summary),
+	}
+	if s.keep >= s.after {
+		s.keep = s.after / 2
+	}
+	return s
+}
+
+// collapse devuelve la persona y el saludo (si los hay), el resumen de lo
+// viejo y los mensajes que todavía no entraron en el resumen. Si el
+// proveedor falla al resumir, devuelve msgs sin cambios.
+func (s *summarizer) collapse(ctx context.Context, sid string, msgs []internal.Message) []internal.Message {
+	n := historyHead(msgs)
+	head, body := msgs[:n], msgs[n:]
+
+	s.mu.Lock()
+	prev, ok := s.cache[sid]
+	s.mu.Unlock()
+	rest := body
+	if ok {
+		i := slices.IndexFunc(body, func(m internal.Message) bool { return m.ID == prev.upTo })
+		if i < 0 {
+			// se deshizo o borró lo resumido: se empieza de nuevo
+			ok, prev = false, summary{}
+		} else {
+			rest = body[i+1:]
+		}
+	}
+
+	if len(rest) > s.after {
+		old := rest[:len(rest)-s.keep]
+		text, err := s.summarize(ctx, prev.text, old)
+		if err != nil {
+			fmt.Printf("[summary] error resumiendo la sesión %s: %v\n", sid, err)
+			return msgs
+		}
+		prev, ok = summary{upTo: old[len(old)-1].ID, text: text}, true
+		rest = rest[len(old):]
+		s.store(sid, prev)
+		fmt.Printf("[summary] sesión %s: %d mensajes resumidos\n", sid, len(old))
+	}
+	if !ok {
+		return msgs
+	}
+	out := make([]internal.Message, 0, len(head)+1+len(rest))
+	out = append(out, head...)
+	out = append(out, internal.Message{Role: internal.RoleAssistant, Content: summaryPrefix + prev.text})
+	return append(out, rest...)
+}
+
+func (s *summarizer) store(sid string, sum summary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.cache[sid]; !ok && len(s.cache) >= summaryCacheMax {
+		// sin orden de uso: se descarta cualquiera, se rehace si vuelve
+		for k := range s.cache {
+			delete(s.cache, k)
+			break
+		}
+	}
+	s.cache[sid] = sum
+}
+
+// summarize pide al proveedor un resumen de msgs que incorpore prev.
+func (s *summarizer) summarize(ctx context.Context, prev string, msgs []internal.Message) (string, error) {
+	var b strings.Builder
+	b.WriteString("Resume la siguiente conversación entre un usuario y Lola IA en un párrafo breve, ")
+	b.WriteString("conservando datos, cifras, archivos mencionados y decisiones. Responde solo con el resumen.\n\n")
+	if prev != "" {
+		fmt.Fprintf(&b, "Resumen previo:\n%s\n\n", prev)
+	}
+	b.WriteString("Conversación:\n")
+	for _, m := range msgs {
+		fmt.Fprintf(&b, "%s: %s\n", roleLabels[m.Role], m.Content)
+	}
+	res, err := s.chat.Reply(ctx, nil, b.String())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(res.Text), nil
+}
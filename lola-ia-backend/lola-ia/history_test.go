@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+// roleMsgs arma un historial con los roles y contenidos dados como "rol:texto".
+func roleMsgs(specs ...string) []internal.Message {
+	out := make([]internal.Message, len(specs))
+	for i, s := range specs {
+		var role, content string
+		fmt.Sscanf(s, "%1s:%s", &role, &content)
+		out[i] = internal.Message{
+			ID:      fmt.Sprint(i),
+			Role:    map[string]internal.Role{"s": internal.RoleSystem, "a": internal.RoleAssistant, "u": internal.RoleUser}[role],
+			Content: content,
+		}
+	}
+	return out
+}
+
+func TestTrimHistory(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []internal.Message
+		max  int
+		want []string
+	}{
+		{"sin tope", roleMsgs("a:hola", "u:p1", "a:r1"), 0, []string{"hola", "p1", "r1"}},
+		{"entra", roleMsgs("a:hola", "u:p1", "a:r1"), 3, []string{"hola", "p1", "r1"}},
+		{"conserva el saludo", roleMsgs("a:hola", "u:p1", "a:r1", "u:p2", "a:r2"), 2, []string{"hola", "p2", "r2"}},
+		{"conserva la persona", roleMsgs("s:persona", "a:hola", "u:p1", "a:r1", "u:p2"), 1, []string{"persona", "hola", "p2"}},
+		{"sin saludo", roleMsgs("u:p1", "a:r1", "u:p2"), 1, []string{"p2"}},
+		{"el tope cubre todo menos la cabecera", roleMsgs("a:hola", "u:p1", "a:r1"), 2, []string{"hola", "p1", "r1"}},
+	}
+	for _, tc := range cases {
+		in := slices.Clone(tc.in)
+		got := trimHistory(in, tc.max)
+		var contents []string
+		for _, m := range got {
+			contents = append(contents, m.Content)
+		}
+		if !slices.Equal(contents, tc.want) {
+			t.Errorf("%s: %v, want %v", tc.name, contents, tc.want)
+		}
+		if !slices.Equal(in, tc.in) {
+			t.Errorf("%s: trimHistory modificó el historial", tc.name)
+		}
+	}
+}
+
+func TestSendMessageTrimsHistory(t *testing.T) {
+	var last []map[string]string
+	r := newOllamaRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		var p struct{ Messages []map[string]string }
+		json.NewDecoder(r.Body).Decode(&p)
+		last = p.Messages
+		w.Write([]byte(`{"message":{"role":"assistant","content":"respuesta"},"done":true}`))
+	}, map[string]string{"MAX_HISTORY_MESSAGES": "2"})
+	sid := []string{"X-Session-ID", "s-trim"}
+	for _, q := range []string{"p1", "p2", "p3"} {
+		if w := call(r, "POST", "/api/messages", `{"content":"`+q+`"}`, sid...); w.Code != 200 {
+			t.Fatalf("%s: status %d: %s", q, w.Code, w.Body)
+		}
+	}
+
+	// el proveedor recibe el saludo, los últimos 2 mensajes y la pregunta
+	var sent []string
+	for _, m := range last {
+		if m["role"] != "system" {
+			sent = append(sent, m["role"]+":"+m["content"])
+		}
+	}
+	want := []string{"assistant:" + greetingForTest(t, r), "user:p2", "assistant:respuesta", "user:p3"}
+	if !slices.Equal(sent, want) {
+		t.Errorf("al proveedor: %q, want %q", sent, want)
+	}
+	// el store conserva todo: saludo y tres turnos
+	var h internal.ChatHistory
+	decode(t, call(r, "GET", "/api/messages", "", sid...), &h)
+	if len(h.Messages) != 7 {
+		t.Errorf("%d mensajes guardados, want 7", len(h.Messages))
+	}
+}
+
+// greetingForTest es el saludo con el que r arranca una sesión.
+func greetingForTest(t *testing.T, r http.Handler) string {
+	t.Helper()
+	var h internal.ChatHistory
+	decode(t, call(r, "GET", "/api/messages", "", "X-Session-ID", "s-saludo"), &h)
+	if len(h.Messages) != 1 {
+		t.Fatalf("sesión nueva con %d mensajes", len(h.Messages))
+	}
+	return h.Messages[0].Content
+}
+
+// summaryStub es un provider que a todo responde con un resumen fijo (o err)
+// y guarda los prompts que recibió.
+type summaryStub struct {
+	provider.ChatProvider
+	err     error
+	prompts []string
+}
+
+func (s *summaryStub) Reply(_ context.Context, _ []internal.Message, input string) (provider.Result, error) {
+	s.prompts = append(s.prompts, input)
+	return provider.Result{Text: " el usuario preguntó por p1 y p2 "}, s.err
+}
+
+func TestSummarizerCollapse(t *testing.T) {
+	stub := &summaryStub{}
+	s := &summarizer{chat: stub, after: 4, keep: 2, cache: make(map[string]summary)}
+	ctx := context.Background()
+
+	short := roleMsgs("a:hola", "u:p1", "a:r1", "u:p2")
+	if got := s.collapse(ctx, "s1", short); !slices.Equal(got, short) || len(stub.prompts) != 0 {
+		t.Fatalf("bajo el umbral: %d mensajes, %d resúmenes", len(got), len(stub.prompts))
+	}
+
+	long := roleMsgs("a:hola", "u:p1", "a:r1", "u:p2", "a:r2", "u:p3", "a:r3")
+	got := s.collapse(ctx, "s1", long)
+	// saludo, resumen y los últimos keep textuales
+	if len(got) != 4 || got[0].Content != "hola" || got[2].Content != "p3" || got[3].Content != "r3" {
+		t.Fatalf("collapse = %+v", got)
+	}
+	if got[1].Role != internal.RoleAssistant || got[1].Content != summaryPrefix+"el usuario preguntó por p1 y p2" {
+		t.Errorf("mensaje de resumen = %+v", got[1])
+	}
+	if len(stub.prompts) != 1 || !strings.Contains(stub.prompts[0], "Usuario: p1\nLola IA: r1\n") || strings.Contains(stub.prompts[0], "p3") {
+		t.Errorf("prompt del resumen = %q", stub.prompts)
+	}
+
+	// con un mensaje más se reusa el resumen guardado
+	longer := append(slices.Clone(long), roleMsgs("u:p4")[0])
+	longer[len(longer)-1].ID = "nuevo"
+	got = s.collapse(ctx, "s1", longer)
+	if len(stub.prompts) != 1 || len(got) != 5 || got[4].Content != "p4" {
+		t.Errorf("con el resumen guardado: %d resúmenes, %d mensajes", len(stub.prompts), len(got))
+	}
+	if !slices.Equal(s.collapse(ctx, "s1", long)[1:2], got[1:2]) {
+		t.Error("el resumen cambió sin mensajes nuevos")
+	}
+}
+
+func TestSummarizerCollapseError(t *testing.T) {
+	s := &summarizer{chat: &summaryStub{err: errors.New("caído")}, after: 2, keep: 1, cache: make(map[string]summary)}
+	long := roleMsgs("a:hola", "u:p1", "a:r1", "u:p2")
+	if got := s.collapse(context.Background(), "s1", long); !slices.Equal(got, long) {
+		t.Errorf("si el resumen falla va el historial completo: %+v", got)
+	}
+}
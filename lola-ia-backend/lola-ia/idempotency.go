@@ -0,0 +1,117 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+const (
+	idempotencyHeader         = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	defaultIdempotencyTTL     = 10 * time.Minute
+	defaultIdempotencyMaxKeys = 10000
+)
+
+// errIdempotencyMismatch: la key ya se usó con otro contenido.
+var errIdempotencyMismatch = errors.New("Idempotency-Key ya usada con otro contenido")
+
+// idemEntry es el resultado de un request con Idempotency-Key. done se
+// cierra cuando termina; resp queda en nil si falló.
+type idemEntry struct {
+	key     string
+	body    string
+	done    chan struct{}
+	resp    *internal.SendMessageResponse
+	expires time.Time // zero mientras está en curso
+	elem    *list.Element
+}
+
+// idempotencyCache guarda las respuestas por key durante ttl, con a lo sumo
+// max keys (se descartan las más viejas).
+type idempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]*idemEntry
+	order   *list.List // keys en orden de alta
+}
+
+func newIdempotencyCache(ttl time.Duration, max int) *idempotencyCache {
+	return &idempotencyCache{ttl: ttl, max: max, entries: make(map[string]*idemEntry), order: list.New()}
+}
+
+// begin registra key para body. owner es true si este request debe
+// procesarlo; si no, la entrada es la de un request anterior (ver wait).
+func (c *idempotencyCache) begin(key, body string) (e *idemEntry, owner bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if e, ok := c.entries[key]; ok {
+		if e.expires.IsZero() || now.Before(e.expires) {
+			if e.body != body {
+				return nil, false, errIdempotencyMismatch
+			}
+			return e, false, nil
+		}
+		c.remove(e)
+	}
+	// primero las vencidas (están al frente salvo las que siguen en curso)
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		old := el.Value.(*idemEntry)
+		if !old.expires.IsZero() && now.After(old.expires) {
+			c.remove(old)
+		}
+		el = next
+	}
+	for c.order.Len() >= c.max {
+		c.remove(c.order.Front().Value.(*idemEntry))
+	}
+	e = &idemEntry{key: key, body: body, done: make(chan struct{})}
+	e.elem = c.order.PushBack(e)
+	c.entries[key] = e
+	return e, true, nil
+}
+
+// finish cierra e con resp. Sin respuesta (error o cancelación) la key se
+// libera para que el reintento se procese de nuevo.
+func (c *idempotencyCache) finish(e *idemEntry, resp *internal.SendMessageResponse) {
+	c.mu.Lock()
+	if resp == nil {
+		if c.entries[e.key] == e {
+			c.remove(e)
+		}
+	} else {
+		e.resp = resp
+		e.expires = time.Now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+	close(e.done)
+}
+
+// wait espera a que termine e y devuelve su respuesta; false si el request
+// original falló o se canceló ctx.
+func (c *idempotencyCache) wait(ctx context.Context, e *idemEntry) (internal.SendMessageResponse, bool) {
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return internal.SendMessageResponse{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e.resp == nil {
+		return internal.SendMessageResponse{}, false
+	}
+	return *e.resp, true
+}
+
+// remove saca e del cache. Requiere c.mu tomado.
+func (c *idempotencyCache) remove(e *idemEntry) {
+	delete(c.entries, e.key)
+	c.order.Remove(e.elem)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestSendMessageIdempotencyKey(t *testing.T) {
+	var calls atomic.Int32
+	// sin la ventana de duplicados: que el reintento lo frene la key
+	r := newCountingRouter(t, &calls, map[string]string{"DEDUP_WINDOW": "1ns"})
+	send := func(sid, key, content string) *httptest.ResponseRecorder {
+		return call(r, "POST", "/api/messages", `{"content":"`+content+`"}`, "X-Session-ID", sid, idempotencyHeader, key)
+	}
+
+	w1, w2 := send("s1", "k1", "hola"), send("s1", "k1", "hola")
+	if w1.Code != 200 || w2.Code != 200 {
+		t.Fatalf("status %d y %d", w1.Code, w2.Code)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("el proveedor se llamó %d veces, want 1", n)
+	}
+	if w1.Header().Get(idempotencyReplayedHeader) != "" || w2.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Errorf("%s = %q y %q", idempotencyReplayedHeader, w1.Header().Get(idempotencyReplayedHeader), w2.Header().Get(idempotencyReplayedHeader))
+	}
+	var r1, r2 internal.SendMessageResponse
+	decode(t, w1, &r1)
+	decode(t, w2, &r2)
+	if r1.Reply.ID == "" || r1.Reply.ID != r2.Reply.ID {
+		t.Errorf("reply = %s y %s, want la misma", r1.Reply.ID, r2.Reply.ID)
+	}
+
+	if w := send("s1", "k1", "otra cosa"); w.Code != 422 {
+		t.Errorf("misma key con otro contenido: status %d, want 422", w.Code)
+	}
+	// otra key u otra sesión se procesan
+	send("s1", "k2", "hola")
+	send("s2", "k1", "hola")
+	if n := calls.Load(); n != 3 {
+		t.Errorf("el proveedor se llamó %d veces, want 3", n)
+	}
+}
+
+func TestIdempotencyCacheConcurrent(t *testing.T) {
+	c := newIdempotencyCache(time.Minute, 10)
+	var owners atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e, owner, err := c.begin("s1\x00k", "hola")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if owner {
+				owners.Add(1)
+				time.Sleep(10 * time.Millisecond)
+				c.finish(e, &internal.SendMessageResponse{Model: "m"})
+				return
+			}
+			if resp, ok := c.wait(context.Background(), e); !ok || resp.Model != "m" {
+				t.Errorf("wait = %+v, %v", resp, ok)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := owners.Load(); n != 1 {
+		t.Errorf("%d requests procesaron la key, want 1", n)
+	}
+}
+
+func TestIdempotencyCacheBounds(t *testing.T) {
+	c := newIdempotencyCache(time.Minute, 2)
+	for i := 0; i < 3; i++ {
+		e, _, _ := c.begin(fmt.Sprint(i), "hola")
+		c.finish(e, &internal.SendMessageResponse{})
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("%d keys, want 2", len(c.entries))
+	}
+	if _, owner, _ := c.begin("0", "hola"); !owner {
+		t.Error("la key más vieja no se descartó")
+	}
+
+	// vencida la TTL la key se procesa de nuevo
+	c = newIdempotencyCache(time.Millisecond, 10)
+	e, _, _ := c.begin("k", "hola")
+	c.finish(e, &internal.SendMessageResponse{})
+	time.Sleep(5 * time.Millisecond)
+	if _, owner, err := c.begin("k", "otra cosa"); !owner || err != nil {
+		t.Errorf("key vencida: owner = %v, err = %v", owner, err)
+	}
+
+	// si el original falla la key queda libre para el reintento
+	e, _, _ = c.begin("f", "hola")
+	c.finish(e, nil)
+	if _, owner, _ := c.begin("f", "hola"); !owner {
+		t.Error("una key fallida no se liberó")
+	}
+}
@@ -0,0 +1,130 @@
+// Package charset detecta la codificación de los archivos subidos y los pasa
+// a UTF-8. Los exports de Excel y de algunos sistemas internos llegan en
+// Windows-1252 o UTF-16, y sin esto los acentos quedan como "AnÃ¡lisis".
+package charset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Codificaciones que devuelve Decode.
+const (
+	UTF8        = "utf-8"
+	UTF16LE     = "utf-16le"
+	UTF16BE     = "utf-16be"
+	Windows1252 = "windows-1252"
+)
+
+// ErrUndecodable: el contenido no es texto en ninguna de las codificaciones
+// soportadas (suele ser un archivo binario, p.ej. un .xlsx renombrado).
+var ErrUndecodable = errors.New("no se pudo detectar la codificación del archivo; guárdelo como UTF-8 y vuelva a subirlo")
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// Decode devuelve b como texto UTF-8 y la codificación en la que venía.
+// Primero mira el BOM; sin BOM, distingue UTF-16 por los bytes en cero que
+// deja el texto latino, acepta UTF-8 válido tal cual y si no lo lee como
+// Windows-1252 (que incluye a Latin-1 en los caracteres imprimibles). El BOM
+// no queda en el texto.
+func Decode(b []byte) (text, enc string, err error) {
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		b = b[len(bomUTF8):]
+		if !utf8.Valid(b) {
+			return "", "", ErrUndecodable
+		}
+		return string(b), UTF8, nil
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return decodeUTF16(b[len(bomUTF16LE):], binary.LittleEndian, UTF16LE)
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return decodeUTF16(b[len(bomUTF16BE):], binary.BigEndian, UTF16BE)
+	}
+	if order, enc, ok := sniffUTF16(b); ok {
+		return decodeUTF16(b, order, enc)
+	}
+	if utf8.Valid(b) {
+		return string(b), UTF8, nil
+	}
+	out, err := charmap.Windows1252.NewDecoder().Bytes(b)
+	if err != nil || !printable(out) {
+		return "", "", ErrUndecodable
+	}
+	return string(out), Windows1252, nil
+}
+
+// sniffUTF16 reconoce UTF-16 sin BOM: en texto latino casi todos los
+// caracteres tienen un byte en cero, siempre del mismo lado.
+func sniffUTF16(b []byte) (binary.ByteOrder, string, bool) {
+	if len(b) < 2 || len(b)%2 != 0 {
+		return nil, "", false
+	}
+	var even, odd int
+	for i := 0; i < len(b); i += 2 {
+		if b[i] == 0 {
+			even++
+		}
+		if b[i+1] == 0 {
+			odd++
+		}
+	}
+	units := len(b) / 2
+	switch {
+	case odd*10 >= units*9 && even*10 < units:
+		return binary.LittleEndian, UTF16LE, true
+	case even*10 >= units*9 && odd*10 < units:
+		return binary.BigEndian, UTF16BE, true
+	}
+	return nil, "", false
+}
+
+// decodeUTF16 decodifica b (ya sin BOM) y falla si quedó un byte suelto o un
+// surrogate sin su par.
+func decodeUTF16(b []byte, order binary.ByteOrder, enc string) (string, string, error) {
+	if len(b)%2 != 0 {
+		return "", "", ErrUndecodable
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = order.Uint16(b[2*i:])
+	}
+	for i := 0; i < len(units); i++ {
+		switch u := units[i]; {
+		case u >= 0xD800 && u < 0xDC00:
+			if i+1 == len(units) || units[i+1] < 0xDC00 || units[i+1] > 0xDFFF {
+				return "", "", ErrUndecodable
+			}
+			i++
+		case u >= 0xDC00 && u <= 0xDFFF:
+			return "", "", ErrUndecodable
+		}
+	}
+	out := []byte(string(utf16.Decode(units)))
+	if !printable(out) {
+		return "", "", ErrUndecodable
+	}
+	return string(out), enc, nil
+}
+
+// printable descarta lo que no es texto: caracteres de control salvo los
+// de fin de línea y tabulación, y U+FFFD, que es lo que deja Windows-1252
+// en sus posiciones sin asignar (0x81, 0x8D...).
+func printable(b []byte) bool {
+	for _, r := range string(b) {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+		case r < 0x20 || r == 0x7F || (r >= 0x80 && r <= 0x9F) || r == utf8.RuneError:
+			return false
+		}
+	}
+	return true
+}
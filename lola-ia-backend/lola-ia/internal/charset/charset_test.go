@@ -0,0 +1,57 @@
+package charset
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"unicode/utf16"
+)
+
+const sample = "id,comentario\nçñ,\"Análisis: la app tardó 5€\"\n"
+
+// utf16Bytes codifica s en UTF-16 con order, con bom adelante.
+func utf16Bytes(s string, order binary.AppendByteOrder, bom []byte) []byte {
+	out := append([]byte(nil), bom...)
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = order.AppendUint16(out, u)
+	}
+	return out
+}
+
+func TestDecode(t *testing.T) {
+	// "Análisis ñandú 5€" en Windows-1252
+	cp1252 := []byte("id,comentario\n\xe7\xf1,\"An\xe1lisis: la app tard\xf3 5\x80\"\n")
+	cases := []struct {
+		name string
+		in   []byte
+		enc  string
+	}{
+		{"utf-8", []byte(sample), UTF8},
+		{"utf-8 con BOM", append(append([]byte(nil), bomUTF8...), sample...), UTF8},
+		{"utf-16le con BOM", utf16Bytes(sample, binary.LittleEndian, bomUTF16LE), UTF16LE},
+		{"utf-16be con BOM", utf16Bytes(sample, binary.BigEndian, bomUTF16BE), UTF16BE},
+		{"utf-16le sin BOM", utf16Bytes(sample, binary.LittleEndian, nil), UTF16LE},
+		{"windows-1252", cp1252, Windows1252},
+	}
+	for _, tc := range cases {
+		text, enc, err := Decode(tc.in)
+		if err != nil || text != sample || enc != tc.enc {
+			t.Errorf("%s: %q, %s, %v; want %s", tc.name, text, enc, err, tc.enc)
+		}
+	}
+}
+
+func TestDecodeUndecodable(t *testing.T) {
+	cases := map[string][]byte{
+		"binario":                   []byte("PK\x03\x04\x00\x00\x81\x8d\x8f\x90\x9d"),
+		"utf-8 con BOM inválido":    append(append([]byte(nil), bomUTF8...), 0xff, 0xfe, 0xfd),
+		"utf-16 con byte suelto":    append(utf16Bytes("id", binary.LittleEndian, bomUTF16LE), 'x'),
+		"surrogate sin par":         append(utf16Bytes("id", binary.LittleEndian, bomUTF16LE), 0x00, 0xd8, 'a', 0x00),
+		"controles en windows-1252": []byte("id\x01\x02\xe1\n"),
+	}
+	for name, in := range cases {
+		if _, _, err := Decode(in); !errors.Is(err, ErrUndecodable) {
+			t.Errorf("%s: err = %v, want ErrUndecodable", name, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Package classify decide si un mensaje pide análisis sobre los datos cargados
+// (modo analista) o es charla casual.
+package classify
+
+import (
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal/textnorm"
+)
+
+// Keyword es una señal de que el mensaje pide análisis. Las señales fuertes
+// pesan más que las genéricas ("datos", "%") que también aparecen en charla.
+type Keyword struct {
+	Text   string
+	Weight float64
+}
+
+// Pesos de referencia para DefaultKeywords.
+const (
+	Strong = 1.0
+	Medium = 0.5
+	Weak   = 0.25
+)
+
+// DefaultThreshold es el puntaje mínimo para activar el modo analista: una
+// señal fuerte, dos medias o una media y dos débiles.
+const DefaultThreshold = 1.0
+
+// DefaultKeywords son las señales por defecto. Se evitan solapamientos
+// ("tema" ya cubre "temas") para no contar dos veces la misma palabra.
+var DefaultKeywords = []Keyword{
+	{"pain points", Strong}, {"puntos de dolor", Strong}, {"top 3", Strong}, {"top3", Strong},
+	{"verbatim", Strong}, {"insights", Strong}, {"análisis", Strong}, {"analysis", Strong},
+	{"analiza", Strong}, {"tendencias", Strong}, {"trends", Strong},
+
+	{"resumen", Medium}, {"summary", Medium}, {"porcentaje", Medium}, {"frecuencia", Medium},
+	{"quejas", Medium}, {"necesidades", Medium}, {"needs", Medium}, {"encuesta", Medium},
+	{"surveys", Medium}, {"feedback", Medium}, {"menciones", Medium}, {"cluster", Medium},
+	{"citas", Medium}, {"quotes", Medium}, {"topics", Medium}, {"csv", Medium},
+
+	{"tema", Weak}, {"datos", Weak}, {"data", Weak}, {"%", Weak}, {"social", Weak},
+}
+
+// Classifier puntúa consultas sumando el peso de cada keyword presente, sin
+// distinguir mayúsculas ni acentos ("analisis" equivale a "análisis").
+type Classifier struct {
+	keywords  []Keyword // Text ya normalizado con textnorm.Fold
+	threshold float64
+}
+
+// New crea un Classifier que activa el modo analista cuando el puntaje llega
+// a threshold. Las keywords repetidas tras normalizar se quedan con el mayor peso.
+func New(keywords []Keyword, threshold float64) *Classifier {
+	c := &Classifier{keywords: make([]Keyword, 0, len(keywords)), threshold: threshold}
+	idx := make(map[string]int, len(keywords))
+	for _, kw := range keywords {
+		text := textnorm.Fold(strings.TrimSpace(kw.Text))
+		if text == "" || kw.Weight <= 0 {
+			continue
+		}
+		if i, ok := idx[text]; ok {
+			c.keywords[i].Weight = max(c.keywords[i].Weight, kw.Weight)
+			continue
+		}
+		idx[text] = len(c.keywords)
+		c.keywords = append(c.keywords, Keyword{Text: text, Weight: kw.Weight})
+	}
+	return c
+}
+
+// Threshold devuelve el puntaje mínimo que activa el modo analista.
+func (c *Classifier) Threshold() float64 { return c.threshold }
+
+// Default usa DefaultKeywords y DefaultThreshold.
+var Default = New(DefaultKeywords, DefaultThreshold)
+
+// Score suma el peso de las keywords que aparecen en q (cada una cuenta una vez).
+func (c *Classifier) Score(q string) float64 {
+	q = textnorm.Fold(q)
+	score := 0.0
+	for _, kw := range c.keywords {
+		if strings.Contains(q, kw.Text) {
+			score += kw.Weight
+		}
+	}
+	return score
+}
+
+// Analyst indica si q pide análisis/insights en vez de charla casual.
+func (c *Classifier) Analyst(q string) bool {
+	return c.Score(q) >= c.threshold
+}
+
+// Analyst clasifica q con el Classifier por defecto.
+func Analyst(q string) bool { return Default.Analyst(q) }
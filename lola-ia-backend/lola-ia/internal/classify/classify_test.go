@@ -0,0 +1,87 @@
+package classify
+
+import "testing"
+
+func TestAnalyst(t *testing.T) {
+	cases := []struct {
+		q    string
+		want bool
+	}{
+		{"¿Cuáles son los pain points más comunes?", true},
+		{"Hazme un análisis de las encuestas", true},
+		{"hazme un analisis de las encuestas", true},
+		{"ANÁLISIS por favor", true},
+		{"Analiza el feedback de los clientes", true},
+		{"What are the main trends in this data?", true},
+		{"Give me the top 3 insights", true},
+		{"Dame verbatims de clientes molestos", true},
+		{"Hola", false},
+		{"hi, how are you?", false},
+		{"buenos días, ¿cómo estás?", false},
+		{"gracias!", false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		if got := Analyst(tc.q); got != tc.want {
+			t.Errorf("Analyst(%q) = %v, want %v", tc.q, got, tc.want)
+		}
+	}
+}
+
+func TestCustomKeywords(t *testing.T) {
+	c := New([]Keyword{{"Reclamos", Strong}, {"  ", Strong}, {"nada", 0}}, DefaultThreshold)
+	if !c.Analyst("muéstrame los RECLAMOS") {
+		t.Error("keyword propia no detectada")
+	}
+	if c.Analyst("pain points") {
+		t.Error("las keywords por defecto no deberían aplicar")
+	}
+	if c.Analyst("nada") {
+		t.Error("una keyword con peso 0 no debería contar")
+	}
+}
+
+func TestWeightedScore(t *testing.T) {
+	cases := []struct {
+		q    string
+		want bool
+	}{
+		// una señal débil sola no alcanza
+		{"¿tienes datos de mi saldo?", false},
+		{"el 50% de mi sueldo", false},
+		{"send me the data", false},
+		// una fuerte sí
+		{"dame los top 3 pain points", true},
+		// dos medias o una media y dos débiles también
+		{"resumen de las quejas", true},
+		{"un resumen de los datos, con %", true},
+	}
+	for _, tc := range cases {
+		if got := Analyst(tc.q); got != tc.want {
+			t.Errorf("Analyst(%q) = %v (puntaje %.2f), want %v", tc.q, got, Default.Score(tc.q), tc.want)
+		}
+	}
+}
+
+func TestScoreCountsEachKeywordOnce(t *testing.T) {
+	if s := Default.Score("datos datos datos datos"); s != Weak {
+		t.Errorf("Score = %v, want %v", s, Weak)
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	strict := New(DefaultKeywords, 2)
+	if strict.Analyst("dame los pain points") {
+		t.Error("con umbral 2 una sola señal fuerte no debería alcanzar")
+	}
+	if !strict.Analyst("top 3 pain points") {
+		t.Error("dos señales fuertes deberían alcanzar el umbral 2")
+	}
+	loose := New(DefaultKeywords, Weak)
+	if !loose.Analyst("¿tienes datos de mi saldo?") {
+		t.Error("con umbral bajo una señal débil debería alcanzar")
+	}
+	if strict.Threshold() != 2 {
+		t.Errorf("Threshold = %v", strict.Threshold())
+	}
+}
@@ -0,0 +1,139 @@
+// Package pii enmascara datos personales (emails, teléfonos y números de
+// tarjeta) en el texto de los archivos antes de mandarlo al proveedor.
+package pii
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Marcadores que reemplazan a cada valor encontrado.
+const (
+	EmailMask = "[EMAIL]"
+	PhoneMask = "[TELEFONO]"
+	CardMask  = "[TARJETA]"
+)
+
+// Counts es la cantidad de valores enmascarados de cada tipo.
+type Counts struct {
+	Emails int
+	Phones int
+	Cards  int
+}
+
+// Total suma todos los valores enmascarados.
+func (c Counts) Total() int { return c.Emails + c.Phones + c.Cards }
+
+var (
+	emailRe = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+
+	// numberRe encuentra secuencias de dígitos agrupados ("+52 (55) 1234-5678",
+	// "4111 1111 1111 1111"); después se decide si son tarjeta, teléfono o nada.
+	numberRe = regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?\(?\d{1,4}\)?(?:[ .\-]?\d{2,})+`)
+
+	// fechas y montos con decimales también son "números agrupados"
+	dateRe    = regexp.MustCompile(`\d{4}[\-./]\d{2}[\-./]\d{2}|\d{2}[\-./]\d{2}[\-./]\d{4}`)
+	decimalRe = regexp.MustCompile(`^\d+[.,]\d{1,2}$`)
+)
+
+// Redact devuelve s con los emails, teléfonos y números de tarjeta (los que
+// pasan el dígito verificador de Luhn) reemplazados por su marcador. Solo
+// toca texto ASCII, así que el resultado sigue siendo UTF-8 válido si s lo era.
+func Redact(s string) (string, Counts) {
+	var n Counts
+	s = emailRe.ReplaceAllStringFunc(s, func(string) string {
+		n.Emails++
+		return EmailMask
+	})
+
+	matches := numberRe.FindAllStringIndex(s, -1)
+	if len(matches) == 0 {
+		return s, n
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if !bounded(s, start, end) {
+			continue
+		}
+		mask := classify(s[start:end])
+		if mask == "" {
+			continue
+		}
+		switch mask {
+		case CardMask:
+			n.Cards++
+		case PhoneMask:
+			n.Phones++
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(mask)
+		last = end
+	}
+	if last == 0 {
+		return s, n
+	}
+	b.WriteString(s[last:])
+	return b.String(), n
+}
+
+// classify devuelve el marcador para el número v, o "" si no parece dato
+// personal (fechas, montos, ids cortos).
+func classify(v string) string {
+	if dateRe.MatchString(v) || decimalRe.MatchString(v) {
+		return ""
+	}
+	digits := make([]byte, 0, len(v))
+	for i := 0; i < len(v); i++ {
+		if v[i] >= '0' && v[i] <= '9' {
+			digits = append(digits, v[i])
+		}
+	}
+	switch {
+	case len(digits) >= 13 && len(digits) <= 19 && luhn(digits):
+		return CardMask
+	case len(digits) >= 8 && len(digits) <= 15:
+		return PhoneMask
+	}
+	return ""
+}
+
+// bounded indica si s[start:end] es un valor suelto y no parte de una
+// palabra o código más largo ("ID12345678", "12345678abc").
+func bounded(s string, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(s[:start])
+		if r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+	}
+	if end < len(s) {
+		r, _ := utf8.DecodeRuneInString(s[end:])
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// luhn verifica el dígito de control de un número de tarjeta.
+func luhn(digits []byte) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
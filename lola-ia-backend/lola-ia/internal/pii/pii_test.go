@@ -0,0 +1,49 @@
+package pii
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRedact(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+		n    Counts
+	}{
+		{"escribir a ana.perez+nps@ejemplo.com.mx o a J_R@x.io", "escribir a [EMAIL] o a [EMAIL]", Counts{Emails: 2}},
+		{"tarjeta 4111 1111 1111 1111, ñandú", "tarjeta [TARJETA], ñandú", Counts{Cards: 1}},
+		{"4111-1111-1111-1111", "[TARJETA]", Counts{Cards: 1}},
+		{"celular +52 (55) 1234-5678", "celular [TELEFONO]", Counts{Phones: 1}},
+		{"tel 11 4567-8901", "tel [TELEFONO]", Counts{Phones: 1}},
+		// no son datos personales
+		{"fecha 2024-05-01, monto 1234.50", "fecha 2024-05-01, monto 1234.50", Counts{}},
+		{"pedido ID12345678 y 12345678abc", "pedido ID12345678 y 12345678abc", Counts{}},
+		{"nps 9, id 42", "nps 9, id 42", Counts{}},
+	}
+	for _, tc := range cases {
+		got, n := Redact(tc.in)
+		if got != tc.want || n != tc.n {
+			t.Errorf("Redact(%q) = %q, %+v; want %q, %+v", tc.in, got, n, tc.want, tc.n)
+		}
+	}
+}
+
+func TestRedactCSV(t *testing.T) {
+	csv := "id,email,comentario,tarjeta\n" +
+		"1,cliente@banco.com,\"la app tardó, ¿qué pasó?\",5500 0000 0000 0004\n" +
+		"2,otro@correo.com.ar,\"llamen al 11 4567-8901\",\n"
+	got, n := Redact(csv)
+	if n.Emails != 2 || n.Cards != 1 || n.Phones != 1 || n.Total() != 4 {
+		t.Errorf("counts = %+v", n)
+	}
+	for _, leaked := range []string{"cliente@banco.com", "otro@correo", "5500 0000", "4567-8901"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("quedó %q:\n%s", leaked, got)
+		}
+	}
+	if !utf8.ValidString(got) || !strings.Contains(got, "¿qué pasó?") || strings.Count(got, "\n") != 3 {
+		t.Errorf("CSV dañado:\n%s", got)
+	}
+}
@@ -0,0 +1,264 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+const (
+	anthropicURL     = "https://api.anthropic.com/v1/messages"
+	anthropicVersion = "2023-06-01"
+	// La API de Messages exige max_tokens; usamos este si no se configura.
+	anthropicDefaultMaxTokens = 4096
+)
+
+type AnthropicProvider struct {
+	apiKey string
+	model  string
+	cfg    ProviderConfig
+	client *http.Client
+	stream *http.Client // sin Timeout (ver doStream)
+}
+
+// NewAnthropicProvider crea el provider de Claude (API de Messages).
+func NewAnthropicProvider(model string, cfg ProviderConfig) (*AnthropicProvider, error) {
+	key := os.Getenv("ANTHROPIC_API_KEY")
+	if key == "" {
+		return nil, errors.New("ANTHROPIC_API_KEY vacío")
+	}
+	if model == "" {
+		model = DefaultModel("anthropic")
+	}
+	return &AnthropicProvider{
+		apiKey: key,
+		model:  model,
+		cfg:    cfg,
+		client: cfg.httpClient(60 * time.Second),
+		stream: cfg.streamClient(),
+	}, nil
+}
+
+func (p *AnthropicProvider) Model() string { return p.model }
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicPayload struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	TopP        *float64           `json:"top_p,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+func (p *AnthropicProvider) newPayload(history []internal.Message, userInput string) anthropicPayload {
+	/*
+		POST https://api.anthropic.com/v1/messages
+		{
+		  "model": "...",
+		  "system": "Eres Lola IA...",
+		  "max_tokens": 1024,
+		  "messages": [
+		    {"role":"user","content":"..."},
+		    {"role":"assistant","content":"..."},
+		    ...
+		  ]
+		}
+		El system va aparte (incluye los mensajes de sistema del historial) y
+		los turnos deben empezar por "user" y alternarse.
+	*/
+	history = withoutInput(history, userInput)
+	payload := anthropicPayload{
+		Model:       p.model,
+		System:      p.cfg.systemFor(history),
+		Messages:    make([]anthropicMessage, 0, len(history)+1),
+		MaxTokens:   anthropicDefaultMaxTokens,
+		Temperature: p.cfg.Temperature,
+		TopP:        p.cfg.TopP,
+	}
+	if p.cfg.MaxOutputTokens != nil {
+		payload.MaxTokens = *p.cfg.MaxOutputTokens
+	}
+
+	add := func(role, content string) {
+		// el saludo inicial del asistente no puede abrir la conversación
+		if len(payload.Messages) == 0 && role != "user" {
+			return
+		}
+		// turnos consecutivos del mismo rol se unen en uno
+		if n := len(payload.Messages); n > 0 && payload.Messages[n-1].Role == role {
+			payload.Messages[n-1].Content += "\n\n" + content
+			return
+		}
+		payload.Messages = append(payload.Messages, anthropicMessage{Role: role, Content: content})
+	}
+	for _, m := range history {
+		switch m.Role {
+		case internal.RoleUser:
+			add("user", m.Content)
+		case internal.RoleAssistant:
+			add("assistant", m.Content)
+		}
+	}
+	// Último input del usuario
+	add("user", userInput)
+	return payload
+}
+
+func (p *AnthropicProvider) do(ctx context.Context, payload anthropicPayload) (*http.Response, error) {
+	b, _ := json.Marshal(payload)
+
+	newReq := func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, anthropicURL, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("x-api-key", p.apiKey)
+		req.Header.Set("anthropic-version", anthropicVersion)
+		req.Header.Set("Content-Type", "application/json")
+		if payload.Stream {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		return req, nil
+	}
+	var (
+		resp *http.Response
+		err  error
+	)
+	if payload.Stream {
+		resp, err = doStream(ctx, p.stream, p.cfg, newReq)
+	} else {
+		resp, err = doWithRetry(ctx, p.client, p.cfg.maxRetries(), newReq)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, apiError(resp, "anthropic")
+	}
+	return resp, nil
+}
+
+func (p *AnthropicProvider) Reply(ctx context.Context, history []internal.Message, userInput string) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.retryCeiling())
+	defer cancel()
+	resp, err := p.do(ctx, p.newPayload(history, userInput))
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Result{}, err
+	}
+
+	var b strings.Builder
+	for _, c := range out.Content {
+		if c.Type == "text" {
+			b.WriteString(c.Text)
+		}
+	}
+	if b.Len() == 0 {
+		return Result{}, errors.New("respuesta vacía de Anthropic")
+	}
+	return Result{Text: b.String(), Usage: newUsage(out.Usage.InputTokens, out.Usage.OutputTokens)}, nil
+}
+
+func (p *AnthropicProvider) ReplyStream(ctx context.Context, history []internal.Message, userInput string, out chan<- string) (Result, error) {
+	payload := p.newPayload(history, userInput)
+	payload.Stream = true
+	resp, err := p.do(ctx, payload)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	/*
+		event: message_start
+		data: {"type":"message_start","message":{"usage":{"input_tokens":25,"output_tokens":1}}}
+		event: content_block_delta
+		data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hola"}}
+		...
+		event: message_delta
+		data: {"type":"message_delta","usage":{"output_tokens":15}}
+		event: message_stop
+		data: {"type":"message_stop"}
+	*/
+	var (
+		text            strings.Builder
+		inTokens, outTk int
+	)
+	err = readSSE(resp.Body, func(data string) (bool, error) {
+		var event struct {
+			Type  string `json:"type"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+			Message struct {
+				Usage struct {
+					InputTokens int `json:"input_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return false, err
+		}
+		switch event.Type {
+		case "message_start":
+			inTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				text.WriteString(event.Delta.Text)
+				out <- event.Delta.Text
+			}
+		case "message_delta":
+			outTk = event.Usage.OutputTokens
+		case "message_stop":
+			return false, nil
+		case "error":
+			if event.Error.Message != "" {
+				return false, errors.New(event.Error.Message)
+			}
+			return false, errors.New("anthropic error")
+		}
+		return true, nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	if text.Len() == 0 {
+		return Result{}, errors.New("respuesta vacía de Anthropic")
+	}
+	return Result{Text: text.String(), Usage: newUsage(inTokens, outTk)}, nil
+}
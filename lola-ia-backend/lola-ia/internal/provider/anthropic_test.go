@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func newTestAnthropic(t *testing.T, srv *httptest.Server) *AnthropicProvider {
+	t.Helper()
+	t.Setenv("ANTHROPIC_API_KEY", "k")
+	p, err := NewAnthropicProvider("claude-test", testConfig(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAnthropicReply(t *testing.T) {
+	var got anthropicPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "k" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("request: %s %v", r.URL.Path, r.Header)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"content":[{"type":"text","text":"Hola, "},{"type":"text","text":"¿qué tal?"}],"usage":{"input_tokens":12,"output_tokens":4}}`))
+	}))
+	defer srv.Close()
+
+	history := []internal.Message{
+		{Role: internal.RoleAssistant, Content: "¡Hola! Soy Lola"},
+		{Role: internal.RoleSystem, Content: "Sé breve."},
+		{Role: internal.RoleUser, Content: "primera"},
+		{Role: internal.RoleAssistant, Content: "respuesta"},
+	}
+	res, err := newTestAnthropic(t, srv).Reply(context.Background(), history, "segunda")
+	if err != nil {
+		t.Fatalf("Reply: %v", err)
+	}
+	if res.Text != "Hola, ¿qué tal?" || res.Usage == nil || res.Usage.TotalTokens != 16 {
+		t.Errorf("res = %+v, usage = %+v", res, res.Usage)
+	}
+
+	// el system va aparte y los turnos empiezan por user
+	if got.System != "Sé breve." || got.Model != "claude-test" || got.MaxTokens != anthropicDefaultMaxTokens {
+		t.Errorf("payload = %+v", got)
+	}
+	want := []anthropicMessage{{"user", "primera"}, {"assistant", "respuesta"}, {"user", "segunda"}}
+	if len(got.Messages) != len(want) {
+		t.Fatalf("messages = %+v", got.Messages)
+	}
+	for i := range want {
+		if got.Messages[i] != want[i] {
+			t.Errorf("messages[%d] = %+v, want %+v", i, got.Messages[i], want[i])
+		}
+	}
+}
+
+func TestAnthropicReplyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: too large"}}`))
+	}))
+	defer srv.Close()
+
+	_, err := newTestAnthropic(t, srv).Reply(context.Background(), nil, "hola")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != 400 || apiErr.Message != "max_tokens: too large" {
+		t.Errorf("err = %+v", apiErr)
+	}
+}
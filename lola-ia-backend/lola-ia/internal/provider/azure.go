@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+const defaultAzureOpenAIAPIVersion = "2024-10-21"
+
+// AzureOpenAIProvider usa un deployment de Azure OpenAI. La API es la de Chat
+// Completions de OpenAI, pero la URL es la del recurso y el deployment, la
+// versión va en la query (api-version) y la key en el header api-key.
+type AzureOpenAIProvider struct {
+	chat       *OpenAIProvider // en estilo chat, apuntando al deployment
+	endpoint   string
+	apiVersion string
+}
+
+// NewAzureOpenAIProvider crea el provider para deployment (el nombre del
+// deployment hace de modelo) con AZURE_OPENAI_ENDPOINT
+// (https://<recurso>.openai.azure.com), AZURE_OPENAI_KEY y
+// AZURE_OPENAI_API_VERSION (default 2024-10-21).
+func NewAzureOpenAIProvider(deployment string, cfg ProviderConfig) (*AzureOpenAIProvider, error) {
+	endpoint := strings.TrimRight(strings.TrimSpace(os.Getenv("AZURE_OPENAI_ENDPOINT")), "/")
+	key := os.Getenv("AZURE_OPENAI_KEY")
+	switch {
+	case endpoint == "":
+		return nil, errors.New("AZURE_OPENAI_ENDPOINT vacío")
+	case key == "":
+		return nil, errors.New("AZURE_OPENAI_KEY vacío")
+	case deployment == "":
+		return nil, errors.New("AZURE_OPENAI_DEPLOYMENT vacío")
+	}
+	if u, err := url.Parse(endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("AZURE_OPENAI_ENDPOINT inválido: %q", endpoint)
+	}
+	version := strings.TrimSpace(os.Getenv("AZURE_OPENAI_API_VERSION"))
+	if version == "" {
+		version = defaultAzureOpenAIAPIVersion
+	}
+	p := &AzureOpenAIProvider{endpoint: endpoint, apiVersion: version}
+	p.chat = &OpenAIProvider{
+		apiKey:    key,
+		model:     deployment,
+		style:     OpenAIStyleChat,
+		cfg:       cfg,
+		client:    cfg.httpClient(60 * time.Second),
+		stream:    cfg.streamClient(),
+		chatURL:   p.chatURL(deployment),
+		keyHeader: "api-key",
+		vendor:    "azure openai",
+	}
+	return p, nil
+}
+
+// chatURL es la URL de Chat Completions del deployment.
+func (p *AzureOpenAIProvider) chatURL(deployment string) string {
+	return p.endpoint + "/openai/deployments/" + url.PathEscape(deployment) +
+		"/chat/completions?api-version=" + url.QueryEscape(p.apiVersion)
+}
+
+// Model devuelve el nombre del deployment.
+func (p *AzureOpenAIProvider) Model() string { return p.chat.model }
+
+func (p *AzureOpenAIProvider) Reply(ctx context.Context, history []internal.Message, userInput string) (Result, error) {
+	return p.chat.Reply(ctx, history, userInput)
+}
+
+func (p *AzureOpenAIProvider) ReplyStream(ctx context.Context, history []internal.Message, userInput string, out chan<- string) (Result, error) {
+	return p.chat.ReplyStream(ctx, history, userInput, out)
+}
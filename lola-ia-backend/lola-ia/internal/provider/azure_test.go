@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func newTestAzure(t *testing.T, srv *httptest.Server, version string) *AzureOpenAIProvider {
+	t.Helper()
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "https://lola.openai.azure.com/")
+	t.Setenv("AZURE_OPENAI_KEY", "az-key")
+	t.Setenv("AZURE_OPENAI_API_VERSION", version)
+	p, err := NewAzureOpenAIProvider("lola gpt", testConfig(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAzureOpenAIReply(t *testing.T) {
+	for _, tc := range []struct{ version, want string }{
+		{"", defaultAzureOpenAIAPIVersion},
+		{"2025-01-01-preview", "2025-01-01-preview"},
+	} {
+		var got openAIChatPayload
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.EscapedPath() != "/openai/deployments/lola%20gpt/chat/completions" {
+				t.Errorf("path = %s", r.URL.EscapedPath())
+			}
+			if v := r.URL.Query().Get("api-version"); v != tc.want {
+				t.Errorf("api-version = %q, want %q", v, tc.want)
+			}
+			if r.Header.Get("api-key") != "az-key" || r.Header.Get("Authorization") != "" {
+				t.Errorf("headers: api-key %q, Authorization %q", r.Header.Get("api-key"), r.Header.Get("Authorization"))
+			}
+			json.NewDecoder(r.Body).Decode(&got)
+			w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hola desde Azure"}}],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`))
+		}))
+		p := newTestAzure(t, srv, tc.version)
+		res, err := p.Reply(context.Background(), []internal.Message{{Role: internal.RoleAssistant, Content: "¡Hola!"}}, "¿estás?")
+		srv.Close()
+		if err != nil || res.Text != "hola desde Azure" || res.Usage == nil || res.Usage.TotalTokens != 10 {
+			t.Fatalf("res = %+v, err = %v", res, err)
+		}
+		if p.Model() != "lola gpt" || got.Model != "lola gpt" || len(got.Messages) != 3 || got.Messages[2].Content != "¿estás?" {
+			t.Errorf("payload = %+v", got)
+		}
+	}
+}
+
+func TestAzureOpenAIErrors(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		body   string
+		check  func(error) bool
+	}{
+		{404, `{"error":{"code":"DeploymentNotFound","message":"The API deployment for this resource does not exist."}}`,
+			func(err error) bool { return errors.Is(err, ErrModelNotFound) }},
+		{401, `{"error":{"code":"401","message":"Access denied due to invalid subscription key."}}`,
+			func(err error) bool {
+				var apiErr *APIError
+				return errors.As(err, &apiErr) && apiErr.StatusCode == 401
+			}},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+			w.Write([]byte(tc.body))
+		}))
+		_, err := newTestAzure(t, srv, "").Reply(context.Background(), nil, "hola")
+		srv.Close()
+		if !tc.check(err) {
+			t.Errorf("%d: err = %v", tc.status, err)
+		}
+	}
+}
+
+func TestNewAzureOpenAIProviderConfig(t *testing.T) {
+	cases := []struct {
+		name, endpoint, key, deployment string
+	}{
+		{"sin endpoint", "", "k", "d"},
+		{"sin key", "https://lola.openai.azure.com", "", "d"},
+		{"sin deployment", "https://lola.openai.azure.com", "k", ""},
+		{"endpoint sin esquema", "lola.openai.azure.com", "k", "d"},
+	}
+	for _, tc := range cases {
+		t.Setenv("AZURE_OPENAI_ENDPOINT", tc.endpoint)
+		t.Setenv("AZURE_OPENAI_KEY", tc.key)
+		if _, err := NewAzureOpenAIProvider(tc.deployment, ProviderConfig{}); err == nil {
+			t.Errorf("%s: sin error", tc.name)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOpenAIReplyCancelMidFlight(t *testing.T) {
+	aborted := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// con el cuerpo leído el servidor se entera si el cliente corta
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			close(aborted)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_API_STYLE", "")
+	p, err := NewOpenAIProvider("m", testConfig(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = p.Reply(ctx, nil, "hola")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("tardó %v en cancelar", d)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Error("el servidor no vio cancelarse la request")
+	}
+}
+
+func TestMockCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := (MockProvider{}).Reply(ctx, nil, "hola"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Reply: err = %v", err)
+	}
+
+	// ReplyStream corta entre palabras
+	ctx, cancel = context.WithCancel(context.Background())
+	out := make(chan string)
+	done := make(chan error)
+	go func() {
+		_, err := MockProvider{}.ReplyStream(ctx, nil, "una respuesta con varias palabras", out)
+		done <- err
+	}()
+	<-out
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ReplyStream: err = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("ReplyStream no cortó al cancelar")
+	}
+}
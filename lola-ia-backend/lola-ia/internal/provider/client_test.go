@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOpenAIInjectedClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// con el cuerpo leído el servidor se entera si el cliente corta
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_API_STYLE", "")
+	cfg := testConfig(t, srv)
+	cfg.HTTPClient.Timeout = 50 * time.Millisecond
+	p, err := NewOpenAIProvider("m", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = p.Reply(context.Background(), nil, "hola")
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("err = %v, want un timeout", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("tardó %v: no se usó el cliente inyectado", d)
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	t.Setenv("OPENAI_TIMEOUT", "5s")
+	c := ConfigFromEnv("OPENAI").httpClient(time.Minute)
+	if c.Timeout != 5*time.Second || c.Transport != sharedTransport {
+		t.Errorf("con OPENAI_TIMEOUT: timeout %v, transport %T", c.Timeout, c.Transport)
+	}
+	t.Setenv("OPENAI_TIMEOUT", "pronto")
+	if c := ConfigFromEnv("OPENAI").httpClient(time.Minute); c.Timeout != time.Minute {
+		t.Errorf("OPENAI_TIMEOUT inválido: timeout %v, want el default", c.Timeout)
+	}
+	injected := &http.Client{}
+	if c := (ProviderConfig{HTTPClient: injected, Timeout: time.Second}).httpClient(time.Minute); c != injected {
+		t.Error("no se usó el cliente inyectado")
+	}
+	// HTTPS_PROXY y un pool más grande que el default (2 por host)
+	if sharedTransport.Proxy == nil || sharedTransport.MaxIdleConnsPerHost <= 2 {
+		t.Errorf("sharedTransport: proxy %v, MaxIdleConnsPerHost %d", sharedTransport.Proxy != nil, sharedTransport.MaxIdleConnsPerHost)
+	}
+}
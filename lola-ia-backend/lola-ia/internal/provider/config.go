@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// ProviderConfig agrupa los ajustes de generación comunes a todos los providers.
+// Los campos puntero en nil significan "no enviar": se usa el default del proveedor.
+type ProviderConfig struct {
+	SystemPrompt    string
+	Temperature     *float64
+	TopP            *float64
+	MaxOutputTokens *int
+
+	// MaxRetries es la cantidad de reintentos ante 429/5xx o errores de red
+	// (nil = defaultMaxRetries). RetryCeiling acota la duración total de la
+	// llamada incluyendo reintentos (0 = defaultRetryCeiling).
+	MaxRetries   *int
+	RetryCeiling time.Duration
+
+	// Timeout acota cada request HTTP al proveedor (0 = el default de cada
+	// provider); en streaming, en cambio, es el tope sin recibir datos (ver
+	// doStream), así una respuesta larga no se corta a la mitad. HTTPClient, si no es nil, reemplaza al cliente propio (y
+	// entonces Timeout se ignora); sirve para tests o transports especiales.
+	Timeout    time.Duration
+	HTTPClient *http.Client
+
+	// IOLog, si no es nil, registra cada request al proveedor y su
+	// respuesta (ConfigFromEnv lo activa con LOG_PROVIDER_IO=true).
+	IOLog *IOLogger
+}
+
+// ConfigFromEnv lee la configuración de variables con el prefijo dado,
+// p.ej. prefix "OPENAI" lee OPENAI_SYSTEM_PROMPT, OPENAI_TEMPERATURE,
+// OPENAI_TOP_P, OPENAI_MAX_TOKENS, OPENAI_MAX_RETRIES, OPENAI_RETRY_CEILING
+// y OPENAI_TIMEOUT (duraciones, p.ej. "90s"). Los valores inválidos se ignoran.
+// LOG_PROVIDER_IO no lleva prefijo: vale para todos (ver ioLogFromEnv).
+func ConfigFromEnv(prefix string) ProviderConfig {
+	cfg := ProviderConfig{SystemPrompt: os.Getenv(prefix + "_SYSTEM_PROMPT"), IOLog: ioLogFromEnv()}
+	if v, err := strconv.ParseFloat(os.Getenv(prefix+"_TEMPERATURE"), 64); err == nil && v >= 0 && v <= 2 {
+		cfg.Temperature = &v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv(prefix+"_TOP_P"), 64); err == nil && v > 0 && v <= 1 {
+		cfg.TopP = &v
+	}
+	if v, err := strconv.Atoi(os.Getenv(prefix + "_MAX_TOKENS")); err == nil && v > 0 {
+		cfg.MaxOutputTokens = &v
+	}
+	if v, err := strconv.Atoi(os.Getenv(prefix + "_MAX_RETRIES")); err == nil && v >= 0 {
+		cfg.MaxRetries = &v
+	}
+	if v, err := time.ParseDuration(os.Getenv(prefix + "_RETRY_CEILING")); err == nil && v > 0 {
+		cfg.RetryCeiling = v
+	}
+	if v, err := time.ParseDuration(os.Getenv(prefix + "_TIMEOUT")); err == nil && v > 0 {
+		cfg.Timeout = v
+	}
+	return cfg
+}
+
+func (c ProviderConfig) systemPrompt() string {
+	if c.SystemPrompt == "" {
+		return DefaultSystemPrompt
+	}
+	return c.SystemPrompt
+}
+
+// systemFor devuelve los mensajes de sistema de history unidos, o el prompt
+// del sistema configurado si no hay ninguno. Lo usan los proveedores que
+// reciben el system aparte de los turnos (Anthropic, Gemini).
+func (c ProviderConfig) systemFor(history []internal.Message) string {
+	var parts []string
+	for _, m := range history {
+		if m.Role == internal.RoleSystem {
+			parts = append(parts, m.Content)
+		}
+	}
+	if len(parts) == 0 {
+		return c.systemPrompt()
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// hasSystemTurn indica si history trae mensajes de sistema propios; en ese
+// caso no se antepone el prompt del sistema configurado.
+func hasSystemTurn(history []internal.Message) bool {
+	return slices.ContainsFunc(history, func(m internal.Message) bool { return m.Role == internal.RoleSystem })
+}
+
+// withoutInput quita el último mensaje de history si es la misma consulta
+// userInput: si ya estaba guardada (p.ej. con ?dry_run=true&store_message=true
+// antes del envío real) llegaría dos veces, porque cada provider la agrega
+// al final del payload.
+func withoutInput(history []internal.Message, userInput string) []internal.Message {
+	if n := len(history); n > 0 && history[n-1].Role == internal.RoleUser && history[n-1].Content == userInput {
+		return history[:n-1]
+	}
+	return history
+}
+
+func (c ProviderConfig) maxRetries() int {
+	if c.MaxRetries == nil {
+		return defaultMaxRetries
+	}
+	return *c.MaxRetries
+}
+
+func (c ProviderConfig) retryCeiling() time.Duration {
+	if c.RetryCeiling <= 0 {
+		return defaultRetryCeiling
+	}
+	return c.RetryCeiling
+}
+
+// httpClient devuelve cfg.HTTPClient o un cliente con cfg.Timeout (o
+// defaultTimeout) sobre el transport compartido. Con IOLog, el transport
+// queda envuelto por el logger.
+func (c ProviderConfig) httpClient(defaultTimeout time.Duration) *http.Client {
+	if c.HTTPClient != nil {
+		if c.IOLog == nil {
+			return c.HTTPClient
+		}
+		client := *c.HTTPClient
+		client.Transport = c.IOLog.Transport(client.Transport)
+		return &client
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	var transport http.RoundTripper = sharedTransport
+	if c.IOLog != nil {
+		transport = c.IOLog.Transport(transport)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// sharedTransport lo usan todos los providers: respeta HTTPS_PROXY/NO_PROXY y
+// mantiene más conexiones ociosas por host que el default (2), que con
+// varias consultas en paralelo obliga a abrir TLS de nuevo en cada una.
+var sharedTransport = &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   20,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
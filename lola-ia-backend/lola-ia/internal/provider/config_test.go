@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// payloadFields marshalea el payload de OpenAI armado con cfg y lo devuelve
+// como mapa para ver qué campos se mandan.
+func payloadFields(t *testing.T, cfg ProviderConfig) map[string]any {
+	t.Helper()
+	t.Setenv("OPENAI_API_KEY", "test")
+	p, err := NewOpenAIProvider("gpt-test", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(p.newPayload(nil, "hola"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestOpenAIPayloadGenerationFields(t *testing.T) {
+	cases := []struct {
+		name string
+		env  map[string]string
+		want map[string]any // nil = el campo no debe estar
+	}{
+		{
+			name: "sin configurar",
+			want: map[string]any{"temperature": nil, "top_p": nil, "max_output_tokens": nil},
+		},
+		{
+			name: "todos",
+			env:  map[string]string{"OPENAI_TEMPERATURE": "0.2", "OPENAI_TOP_P": "0.9", "OPENAI_MAX_TOKENS": "256"},
+			want: map[string]any{"temperature": 0.2, "top_p": 0.9, "max_output_tokens": 256.0},
+		},
+		{
+			// 0 es un valor válido y se manda: omitempty solo omite el puntero nil
+			name: "temperatura cero",
+			env:  map[string]string{"OPENAI_TEMPERATURE": "0"},
+			want: map[string]any{"temperature": 0.0, "top_p": nil, "max_output_tokens": nil},
+		},
+		{
+			name: "inválidos",
+			env:  map[string]string{"OPENAI_TEMPERATURE": "tibio", "OPENAI_TOP_P": "1.5", "OPENAI_MAX_TOKENS": "-3"},
+			want: map[string]any{"temperature": nil, "top_p": nil, "max_output_tokens": nil},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, k := range []string{"OPENAI_TEMPERATURE", "OPENAI_TOP_P", "OPENAI_MAX_TOKENS"} {
+				t.Setenv(k, tc.env[k])
+			}
+			got := payloadFields(t, ConfigFromEnv("OPENAI"))
+			for field, want := range tc.want {
+				v, ok := got[field]
+				switch {
+				case want == nil && ok:
+					t.Errorf("%s = %v, no debería estar en el payload", field, v)
+				case want != nil && v != want:
+					t.Errorf("%s = %v, want %v", field, v, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAISystemPrompt(t *testing.T) {
+	for _, tc := range []struct{ env, want string }{
+		{"", DefaultSystemPrompt},
+		{"Respondé en inglés.", "Respondé en inglés."},
+	} {
+		t.Setenv("OPENAI_SYSTEM_PROMPT", tc.env)
+		input := payloadFields(t, ConfigFromEnv("OPENAI"))["input"].([]any)
+		first := input[0].(map[string]any)
+		if first["role"] != "system" || first["content"] != tc.want {
+			t.Errorf("OPENAI_SYSTEM_PROMPT=%q: primer item = %v, want system %q", tc.env, first, tc.want)
+		}
+	}
+}
+
+func TestWithoutInput(t *testing.T) {
+	hello := internal.Message{Role: internal.RoleAssistant, Content: "¡Hola!"}
+	input := internal.Message{Role: internal.RoleUser, Content: "¿qué temas aparecen?"}
+	cases := []struct {
+		name    string
+		history []internal.Message
+		want    int
+	}{
+		{"vacío", nil, 0},
+		{"ya guardado por el handler", []internal.Message{hello, input}, 1},
+		{"otra consulta al final", []internal.Message{hello, {Role: internal.RoleUser, Content: "otra"}}, 2},
+		{"misma consulta pero del asistente", []internal.Message{{Role: internal.RoleAssistant, Content: input.Content}}, 1},
+		{"la misma consulta antes", []internal.Message{input, hello}, 2},
+	}
+	for _, tc := range cases {
+		if got := withoutInput(tc.history, input.Content); len(got) != tc.want {
+			t.Errorf("%s: %d mensajes, want %d", tc.name, len(got), tc.want)
+		}
+	}
+}
+
+func TestProvidersSendInputOnce(t *testing.T) {
+	const input = "¿cuáles son los motivos de queja?"
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(400)
+	}))
+	defer srv.Close()
+	for _, k := range []string{"OPENAI_API_KEY", "ANTHROPIC_API_KEY", "GEMINI_API_KEY"} {
+		t.Setenv(k, "k")
+	}
+	t.Setenv("OLLAMA_HOST", "http://ollama")
+	providers := map[string]func(cfg ProviderConfig) (ChatProvider, error){
+		"openai":    func(cfg ProviderConfig) (ChatProvider, error) { return NewOpenAIProvider("", cfg) },
+		"anthropic": func(cfg ProviderConfig) (ChatProvider, error) { return NewAnthropicProvider("", cfg) },
+		"gemini":    func(cfg ProviderConfig) (ChatProvider, error) { return NewGeminiProvider("", cfg) },
+		"ollama":    func(cfg ProviderConfig) (ChatProvider, error) { return NewOllamaProvider("", cfg) },
+	}
+	histories := map[string][]internal.Message{
+		"vacío":           nil,
+		"con la consulta": {{Role: internal.RoleAssistant, Content: "¡Hola!"}, {Role: internal.RoleUser, Content: input}},
+	}
+	for name, newProvider := range providers {
+		p, err := newProvider(testConfig(t, srv))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for hname, history := range histories {
+			body = nil
+			p.Reply(context.Background(), history, input)
+			if n := strings.Count(string(body), input); n != 1 {
+				t.Errorf("%s, historial %s: la consulta va %d veces:\n%s", name, hname, n, body)
+			}
+		}
+	}
+}
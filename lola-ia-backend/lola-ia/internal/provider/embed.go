@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Embedder lo implementan los providers que pueden calcular embeddings.
+// Devuelve un vector por texto, en el mismo orden.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+const (
+	openAIDefaultEmbeddingModel = "text-embedding-3-small"
+	// la API admite más, pero lotes chicos reintentan más barato
+	openAIEmbedBatch = 100
+)
+
+func (p *OpenAIProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.retryCeiling())
+	defer cancel()
+	out := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += openAIEmbedBatch {
+		batch := texts[start:min(start+openAIEmbedBatch, len(texts))]
+		vecs, err := p.embedBatch(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vecs...)
+	}
+	return out, nil
+}
+
+func (p *OpenAIProvider) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	/*
+		POST https://api.openai.com/v1/embeddings
+		{"model": "text-embedding-3-small", "input": ["...", "..."]}
+	*/
+	b, _ := json.Marshal(map[string]any{"model": p.embedModel, "input": texts})
+	resp, err := doWithRetry(ctx, p.client, p.cfg.maxRetries(), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx,
+			http.MethodPost, "https://api.openai.com/v1/embeddings", bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, apiError(resp, "openai")
+	}
+
+	var out struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if len(out.Data) != len(texts) {
+		return nil, fmt.Errorf("openai devolvió %d embeddings para %d textos", len(out.Data), len(texts))
+	}
+	vecs := make([][]float32, len(texts))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(vecs) {
+			return nil, fmt.Errorf("índice de embedding fuera de rango: %d", d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	return vecs, nil
+}
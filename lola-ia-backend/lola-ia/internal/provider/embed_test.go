@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIEmbed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("path %s", r.URL.Path)
+		}
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != openAIDefaultEmbeddingModel || len(req.Input) != 2 {
+			t.Errorf("request = %+v", req)
+		}
+		// la API puede devolver los vectores en otro orden: manda index
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_EMBEDDING_MODEL", "")
+	p, err := NewOpenAIProvider("m", testConfig(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vecs, err := p.Embed(context.Background(), []string{"uno", "dos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vecs) != 2 || vecs[0][0] != 1 || vecs[1][1] != 1 {
+		t.Errorf("vecs = %v", vecs)
+	}
+}
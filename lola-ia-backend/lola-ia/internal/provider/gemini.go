@@ -0,0 +1,251 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+const geminiBaseURL = "https://generativelanguage.googleapis.com/v1beta/models/"
+
+// GeminiProvider habla con la API de Gemini (generateContent).
+type GeminiProvider struct {
+	apiKey string
+	model  string
+	cfg    ProviderConfig
+	client *http.Client
+	stream *http.Client // sin Timeout (ver doStream)
+}
+
+// NewGeminiProvider crea el provider de Google Gemini usando GEMINI_API_KEY.
+func NewGeminiProvider(model string, cfg ProviderConfig) (*GeminiProvider, error) {
+	key := os.Getenv("GEMINI_API_KEY")
+	if key == "" {
+		return nil, errors.New("GEMINI_API_KEY vacío")
+	}
+	if model == "" {
+		model = DefaultModel("gemini")
+	}
+	return &GeminiProvider{
+		apiKey: key,
+		model:  model,
+		cfg:    cfg,
+		client: cfg.httpClient(60 * time.Second),
+		stream: cfg.streamClient(),
+	}, nil
+}
+
+func (p *GeminiProvider) Model() string { return p.model }
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	MaxOutputTokens *int     `json:"maxOutputTokens,omitempty"`
+}
+
+type geminiPayload struct {
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent         `json:"contents"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+func (p *GeminiProvider) newPayload(history []internal.Message, userInput string) geminiPayload {
+	/*
+		POST .../v1beta/models/{model}:generateContent
+		{
+		  "systemInstruction": {"parts": [{"text": "Eres Lola IA..."}]},
+		  "contents": [
+		    {"role":"user","parts":[{"text":"..."}]},
+		    {"role":"model","parts":[{"text":"..."}]}
+		  ]
+		}
+		Como en Anthropic, la conversación empieza por "user", los roles se
+		alternan y los mensajes de sistema del historial van en systemInstruction.
+	*/
+	history = withoutInput(history, userInput)
+	payload := geminiPayload{
+		SystemInstruction: &geminiContent{Parts: []geminiPart{{Text: p.cfg.systemFor(history)}}},
+		Contents:          make([]geminiContent, 0, len(history)+1),
+	}
+	if p.cfg.Temperature != nil || p.cfg.TopP != nil || p.cfg.MaxOutputTokens != nil {
+		payload.GenerationConfig = &geminiGenerationConfig{
+			Temperature:     p.cfg.Temperature,
+			TopP:            p.cfg.TopP,
+			MaxOutputTokens: p.cfg.MaxOutputTokens,
+		}
+	}
+
+	add := func(role, text string) {
+		// el saludo inicial del asistente no puede abrir la conversación
+		if len(payload.Contents) == 0 && role != "user" {
+			return
+		}
+		// turnos consecutivos del mismo rol se unen en uno
+		if n := len(payload.Contents); n > 0 && payload.Contents[n-1].Role == role {
+			payload.Contents[n-1].Parts[0].Text += "\n\n" + text
+			return
+		}
+		payload.Contents = append(payload.Contents, geminiContent{Role: role, Parts: []geminiPart{{Text: text}}})
+	}
+	for _, m := range history {
+		switch m.Role {
+		case internal.RoleUser:
+			add("user", m.Content)
+		case internal.RoleAssistant:
+			add("model", m.Content)
+		}
+	}
+	// Último input del usuario
+	add("user", userInput)
+	return payload
+}
+
+func (p *GeminiProvider) do(ctx context.Context, method string, payload geminiPayload, stream bool) (*http.Response, error) {
+	b, _ := json.Marshal(payload)
+	u := geminiBaseURL + url.PathEscape(p.model) + ":" + method
+
+	newReq := func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("x-goog-api-key", p.apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+	var (
+		resp *http.Response
+		err  error
+	)
+	if stream {
+		resp, err = doStream(ctx, p.stream, p.cfg, newReq)
+	} else {
+		resp, err = doWithRetry(ctx, p.client, p.cfg.maxRetries(), newReq)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// los errores vienen como {"error":{"code":400,"message":"...","status":"..."}}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, apiError(resp, "gemini")
+	}
+	return resp, nil
+}
+
+// geminiResponse es la respuesta de generateContent (y cada evento del stream).
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// text devuelve el texto del primer candidato, o un error si Gemini bloqueó
+// el prompt o la respuesta por sus filtros de seguridad.
+func (r geminiResponse) text() (string, error) {
+	if reason := r.PromptFeedback.BlockReason; reason != "" {
+		return "", errors.New("mensaje bloqueado por Gemini (" + reason + ")")
+	}
+	if len(r.Candidates) == 0 {
+		return "", nil
+	}
+	c := r.Candidates[0]
+	switch c.FinishReason {
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "", errors.New("respuesta bloqueada por Gemini (" + c.FinishReason + ")")
+	}
+	var b strings.Builder
+	for _, part := range c.Content.Parts {
+		b.WriteString(part.Text)
+	}
+	return b.String(), nil
+}
+
+func (p *GeminiProvider) Reply(ctx context.Context, history []internal.Message, userInput string) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.retryCeiling())
+	defer cancel()
+	resp, err := p.do(ctx, "generateContent", p.newPayload(history, userInput), false)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	var out geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Result{}, err
+	}
+	text, err := out.text()
+	if err != nil {
+		return Result{}, err
+	}
+	if text == "" {
+		return Result{}, errors.New("respuesta vacía de Gemini")
+	}
+	u := out.UsageMetadata
+	return Result{Text: text, Usage: newUsage(u.PromptTokenCount, u.CandidatesTokenCount)}, nil
+}
+
+func (p *GeminiProvider) ReplyStream(ctx context.Context, history []internal.Message, userInput string, out chan<- string) (Result, error) {
+	resp, err := p.do(ctx, "streamGenerateContent?alt=sse", p.newPayload(history, userInput), true)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	// cada evento es un geminiResponse parcial; el uso acumulado viene en el último
+	var (
+		text     strings.Builder
+		in, outT int
+	)
+	err = readSSE(resp.Body, func(data string) (bool, error) {
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, err
+		}
+		delta, err := chunk.text()
+		if err != nil {
+			return false, err
+		}
+		if delta != "" {
+			text.WriteString(delta)
+			out <- delta
+		}
+		if u := chunk.UsageMetadata; u.PromptTokenCount > 0 {
+			in, outT = u.PromptTokenCount, u.CandidatesTokenCount
+		}
+		return true, nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	if text.Len() == 0 {
+		return Result{}, errors.New("respuesta vacía de Gemini")
+	}
+	return Result{Text: text.String(), Usage: newUsage(in, outT)}, nil
+}
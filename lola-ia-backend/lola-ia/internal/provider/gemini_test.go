@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func newTestGemini(t *testing.T, srv *httptest.Server) *GeminiProvider {
+	t.Helper()
+	t.Setenv("GEMINI_API_KEY", "k")
+	p, err := NewGeminiProvider("gemini-test", testConfig(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// geminiServer responde body a generateContent y guarda el payload recibido.
+func geminiServer(t *testing.T, status int, body string, got *geminiPayload) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-test:generateContent" || r.Header.Get("x-goog-api-key") != "k" {
+			t.Errorf("request: %s %v", r.URL.Path, r.Header)
+		}
+		if got != nil {
+			json.NewDecoder(r.Body).Decode(got)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGeminiReply(t *testing.T) {
+	var got geminiPayload
+	srv := geminiServer(t, 200, `{
+		"candidates":[{"content":{"role":"model","parts":[{"text":"Hola, "},{"text":"¿qué tal?"}]},"finishReason":"STOP"}],
+		"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":4}}`, &got)
+
+	history := []internal.Message{
+		{Role: internal.RoleAssistant, Content: "¡Hola!"},
+		{Role: internal.RoleUser, Content: "primera"},
+		{Role: internal.RoleAssistant, Content: "respuesta"},
+	}
+	res, err := newTestGemini(t, srv).Reply(context.Background(), history, "segunda")
+	if err != nil {
+		t.Fatalf("Reply: %v", err)
+	}
+	if res.Text != "Hola, ¿qué tal?" || res.Usage == nil || res.Usage.TotalTokens != 14 {
+		t.Errorf("res = %+v, usage = %+v", res, res.Usage)
+	}
+
+	if got.SystemInstruction == nil || got.SystemInstruction.Parts[0].Text != DefaultSystemPrompt {
+		t.Errorf("systemInstruction = %+v", got.SystemInstruction)
+	}
+	var roles []string
+	for _, c := range got.Contents {
+		roles = append(roles, c.Role+":"+c.Parts[0].Text)
+	}
+	if s := strings.Join(roles, "|"); s != "user:primera|model:respuesta|user:segunda" {
+		t.Errorf("contents = %s", s)
+	}
+}
+
+func TestGeminiSafetyBlock(t *testing.T) {
+	cases := map[string]string{
+		"prompt":    `{"promptFeedback":{"blockReason":"SAFETY"}}`,
+		"respuesta": `{"candidates":[{"content":{"parts":[]},"finishReason":"SAFETY"}]}`,
+	}
+	for name, body := range cases {
+		_, err := newTestGemini(t, geminiServer(t, 200, body, nil)).Reply(context.Background(), nil, "hola")
+		if err == nil || !strings.Contains(err.Error(), "bloquead") || !strings.Contains(err.Error(), "SAFETY") {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestGeminiReplyError(t *testing.T) {
+	srv := geminiServer(t, 400, `{"error":{"code":400,"message":"API key not valid.","status":"INVALID_ARGUMENT"}}`, nil)
+	_, err := newTestGemini(t, srv).Reply(context.Background(), nil, "hola")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 || apiErr.Message != "API key not valid." {
+		t.Errorf("err = %#v", err)
+	}
+}
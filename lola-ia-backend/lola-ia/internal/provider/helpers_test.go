@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// redirect manda todas las requests a target, sea cual sea la URL del
+// proveedor: así se prueban los providers contra un httptest.Server.
+type redirect struct {
+	target *url.URL
+}
+
+func (r redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = r.target.Scheme, r.target.Host
+	req.Host = r.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// testConfig es una ProviderConfig que habla con srv, sin reintentos.
+func testConfig(t *testing.T, srv *httptest.Server) ProviderConfig {
+	t.Helper()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retries := 0
+	return ProviderConfig{HTTPClient: &http.Client{Transport: redirect{u}}, MaxRetries: &retries}
+}
+
+// collect corre ReplyStream y devuelve los fragmentos recibidos.
+func collect(t *testing.T, p ChatProvider, history []internal.Message, input string) ([]string, Result, error) {
+	t.Helper()
+	out := make(chan string)
+	done := make(chan []string)
+	go func() {
+		var chunks []string
+		for c := range out {
+			chunks = append(chunks, c)
+		}
+		done <- chunks
+	}()
+	res, err := p.ReplyStream(context.Background(), history, input, out)
+	close(out)
+	return <-done, res, err
+}
+
+// sseWriter escribe eventos SSE y los manda en el momento.
+func sseWriter(w http.ResponseWriter) func(event, data string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(200)
+	return func(event, data string) {
+		var b strings.Builder
+		if event != "" {
+			b.WriteString("event: " + event + "\n")
+		}
+		b.WriteString("data: " + data + "\n\n")
+		w.Write([]byte(b.String()))
+		w.(http.Flusher).Flush()
+	}
+}
@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrModelNotFound: la API no conoce el modelo pedido (p.ej. un typo en
+// OPENAI_MODEL o ALLOWED_MODELS). Un *APIError así lo cumple con errors.Is.
+var ErrModelNotFound = errors.New("modelo no encontrado")
+
+// ErrContextLength: el pedido (historial más prompt) no entra en la ventana
+// de contexto del modelo. Un *APIError así lo cumple con errors.Is.
+var ErrContextLength = errors.New("el pedido excede la ventana de contexto del modelo")
+
+// Textos con los que las APIs sin código informan un pedido demasiado largo
+// (Anthropic: "prompt is too long", Gemini: "input token count ... exceeds").
+var contextLengthHints = []string{"context length", "context_length", "context window", "prompt is too long", "too many tokens", "exceeds the maximum number of tokens"}
+
+// APIError es una respuesta de error (status >= 400) de la API del proveedor.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Code es el código de error de la API, si manda uno como texto
+	// (p.ej. "model_not_found" en OpenAI, "DeploymentNotFound" en Azure).
+	Code string
+}
+
+func (e *APIError) Error() string { return e.Message }
+
+// Is reconoce ErrModelNotFound: por el código, o un 404 que nombra el
+// modelo (Anthropic, Gemini y Ollama no mandan código). Y ErrContextLength:
+// por el código o un 400/413 con uno de contextLengthHints.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrModelNotFound:
+		return e.isModelNotFound()
+	case ErrContextLength:
+		return e.isContextLength()
+	}
+	return false
+}
+
+func (e *APIError) isModelNotFound() bool {
+	switch e.Code {
+	case "model_not_found", "DeploymentNotFound":
+		return true
+	}
+	return e.StatusCode == http.StatusNotFound && strings.Contains(strings.ToLower(e.Message), "model")
+}
+
+func (e *APIError) isContextLength() bool {
+	if e.Code == "context_length_exceeded" {
+		return true
+	}
+	if e.StatusCode != http.StatusBadRequest && e.StatusCode != http.StatusRequestEntityTooLarge {
+		return false
+	}
+	msg := strings.ToLower(e.Message)
+	for _, h := range contextLengthHints {
+		if strings.Contains(msg, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiError convierte el cuerpo de error de la API en un *APIError.
+// OpenAI y Anthropic comparten la forma {"error":{"message":"..."}}.
+func apiError(resp *http.Response, vendor string) error {
+	var e struct {
+		Error struct {
+			Message string          `json:"message"`
+			Code    json.RawMessage `json:"code"` // Gemini manda el status numérico
+		} `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&e)
+	var code string
+	json.Unmarshal(e.Error.Code, &code)
+	if e.Error.Message != "" {
+		return &APIError{StatusCode: resp.StatusCode, Message: e.Error.Message, Code: code}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: vendor + " error: " + resp.Status, Code: code}
+}
+
+// readSSE lee eventos Server-Sent Events de r y llama a fn con el data de cada
+// evento completo (las líneas data: múltiples se unen con \n). Las lecturas
+// parciales se acumulan hasta ver la línea vacía que cierra el evento.
+// fn devuelve false para dejar de leer.
+func readSSE(r io.Reader, fn func(data string) (bool, error)) error {
+	br := bufio.NewReader(r)
+	var data []string
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		eof := err == io.EOF
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			// fin de evento
+			if len(data) > 0 {
+				more, ferr := fn(strings.Join(data, "\n"))
+				data = data[:0]
+				if ferr != nil {
+					return ferr
+				}
+				if !more {
+					return nil
+				}
+			}
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		default:
+			// event:, id:, retry: y comentarios (":") no los necesitamos
+		}
+
+		if eof {
+			if len(data) > 0 {
+				_, ferr := fn(strings.Join(data, "\n"))
+				return ferr
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultIOLogMaxBytes = 16 << 10
+
+// Headers y parámetros de query con credenciales: nunca salen en el log.
+var (
+	secretHeaders = []string{"Authorization", "Api-Key", "X-Api-Key", "X-Goog-Api-Key", "Proxy-Authorization"}
+	secretParams  = []string{"key", "api_key"}
+)
+
+// IOLogger escribe los requests al proveedor y sus respuestas tal cual (con
+// las credenciales tapadas) para depurar lo que el modelo recibió y devolvió.
+// Los cuerpos más largos que maxBytes se cortan.
+type IOLogger struct {
+	mu       sync.Mutex
+	w        io.Writer
+	maxBytes int
+	seq      atomic.Int64
+}
+
+// NewIOLogger devuelve un logger que escribe en w; maxBytes <= 0 usa el
+// default (16 KiB por cuerpo).
+func NewIOLogger(w io.Writer, maxBytes int) *IOLogger {
+	if maxBytes <= 0 {
+		maxBytes = defaultIOLogMaxBytes
+	}
+	return &IOLogger{w: w, maxBytes: maxBytes}
+}
+
+var (
+	envIOLogOnce sync.Once
+	envIOLog     *IOLogger
+)
+
+// ioLogFromEnv devuelve el logger de LOG_PROVIDER_IO=true, compartido por
+// todos los providers: escribe en LOG_PROVIDER_IO_FILE (o stdout) y corta
+// los cuerpos en LOG_PROVIDER_IO_MAX_BYTES. nil si está apagado.
+func ioLogFromEnv() *IOLogger {
+	envIOLogOnce.Do(func() {
+		if on, _ := strconv.ParseBool(os.Getenv("LOG_PROVIDER_IO")); !on {
+			return
+		}
+		var w io.Writer = os.Stdout
+		if path := os.Getenv("LOG_PROVIDER_IO_FILE"); path != "" {
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+			if err != nil {
+				fmt.Printf("[provider] LOG_PROVIDER_IO_FILE: %v; se usa stdout\n", err)
+			} else {
+				w = f
+			}
+		}
+		maxBytes, _ := strconv.Atoi(os.Getenv("LOG_PROVIDER_IO_MAX_BYTES"))
+		envIOLog = NewIOLogger(w, maxBytes)
+		fmt.Printf("[provider] LOG_PROVIDER_IO activo: se registran los requests y respuestas del proveedor\n")
+	})
+	return envIOLog
+}
+
+// Transport devuelve un RoundTripper que registra cada request y respuesta
+// que pasa por next (http.DefaultTransport si es nil).
+func (l *IOLogger) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return ioLogTransport{log: l, next: next}
+}
+
+type ioLogTransport struct {
+	log  *IOLogger
+	next http.RoundTripper
+}
+
+func (t ioLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := t.log.seq.Add(1)
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+		// un RoundTripper no debe modificar el request que recibe
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+	t.log.write(fmt.Sprintf("--> #%d %s %s", id, req.Method, redactURL(req.URL)), req.Header, body, len(body))
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.log.write(fmt.Sprintf("<-- #%d error (%s): %v", id, time.Since(start).Round(time.Millisecond), err), nil, nil, 0)
+		return nil, err
+	}
+	// la respuesta se registra cuando el provider termina de leerla, así
+	// los streams salen completos y en un solo bloque
+	head := fmt.Sprintf("<-- #%d %s (%s)", id, resp.Status, time.Since(start).Round(time.Millisecond))
+	resp.Body = &ioLogBody{ReadCloser: resp.Body, log: t.log, head: head, header: resp.Header}
+	return resp, nil
+}
+
+// ioLogBody guarda hasta maxBytes de lo leído y lo registra al cerrarse.
+type ioLogBody struct {
+	io.ReadCloser
+	log    *IOLogger
+	head   string
+	header http.Header
+	buf    bytes.Buffer
+	n      int
+	once   sync.Once
+}
+
+func (b *ioLogBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if keep := min(n, b.log.maxBytes-b.buf.Len()); keep > 0 {
+		b.buf.Write(p[:keep])
+	}
+	b.n += n
+	return n, err
+}
+
+func (b *ioLogBody) Close() error {
+	b.once.Do(func() { b.log.write(b.head, b.header, b.buf.Bytes(), b.n) })
+	return b.ReadCloser.Close()
+}
+
+// write registra un bloque: la línea de título, los headers (sin
+// credenciales) y el cuerpo, cortado si total supera maxBytes.
+func (l *IOLogger) write(head string, header http.Header, body []byte, total int) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[provider-io] %s %s\n", time.Now().Format(time.RFC3339), head)
+	for _, k := range sortedKeys(header) {
+		for _, v := range header[k] {
+			if isSecretHeader(k) {
+				v = "[REDACTED]"
+			}
+			fmt.Fprintf(&sb, "%s: %s\n", k, v)
+		}
+	}
+	if len(body) > l.maxBytes {
+		body = body[:l.maxBytes]
+	}
+	if len(body) > 0 {
+		sb.Write(body)
+		if !bytes.HasSuffix(body, []byte("\n")) {
+			sb.WriteByte('\n')
+		}
+	}
+	if total > len(body) {
+		fmt.Fprintf(&sb, "... (cortado: %d de %d bytes)\n", len(body), total)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, sb.String())
+}
+
+func isSecretHeader(k string) bool {
+	for _, s := range secretHeaders {
+		if strings.EqualFold(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(h http.Header) []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// redactURL tapa las credenciales que viajan en la query (p.ej. ?key=).
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	redacted := false
+	for _, p := range secretParams {
+		if q.Has(p) {
+			q.Set(p, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.Redacted()
+	}
+	c := *u
+	c.RawQuery = q.Encode()
+	return c.Redacted()
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// MockResponse es una respuesta fija del mock: si el input contiene
+// Contains (tal cual, distinguiendo mayúsculas) se responde Reply.
+type MockResponse struct {
+	Contains string `json:"contains"`
+	Reply    string `json:"reply"`
+}
+
+// LoadMockResponses lee de path un JSON como
+// [{"contains": "ventas", "reply": "..."}].
+func LoadMockResponses(path string) ([]MockResponse, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rs []MockResponse
+	if err := json.Unmarshal(b, &rs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, r := range rs {
+		if r.Contains == "" {
+			return nil, fmt.Errorf("%s: la respuesta %d no tiene contains", path, i)
+		}
+	}
+	return rs, nil
+}
+
+// mockText decide la respuesta del mock: primero las respuestas fijas (en
+// orden), después una respuesta con las secciones del formato si el input
+// trae uno (el modo analista) y si no el eco del input.
+func (m MockProvider) mockText(history []internal.Message, userInput string) string {
+	for _, r := range m.Responses {
+		if strings.Contains(userInput, r.Contains) {
+			return r.Reply
+		}
+	}
+	if text, err := formattedReply(userInput); err == nil {
+		return text
+	}
+	// Respuesta simple para desarrollo offline; incluye el prompt del sistema
+	// que se habría usado (el del historial si lo hay) para poder verificarlo.
+	return "Entendido. (mock, system: \"" + m.Config.systemFor(history) + "\") Me pediste: \"" + userInput + "\""
+}
+
+// formattedReply arma una respuesta que respeta el bloque "Format:" de un
+// template: una sección por cada línea "--- Título [instrucciones]", con
+// viñetas o porcentajes si las instrucciones los piden.
+func formattedReply(prompt string) (string, error) {
+	_, format, ok := strings.Cut(prompt, "\nFormat:\n")
+	if !ok {
+		return "", errors.New("sin formato")
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(format, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "--- ") {
+			continue
+		}
+		title, instr, _ := strings.Cut(strings.TrimPrefix(line, "--- "), " [")
+		title = strings.TrimSpace(title)
+		fmt.Fprintf(&b, "--- %s\n", title)
+		switch {
+		case strings.Contains(title, "%"):
+			b.WriteString("1. Tema uno (50%) 2. Tema dos (30%) 3. Tema tres (20%)\n")
+		case strings.Contains(strings.ToLower(instr), "bullet"):
+			b.WriteString("- (mock) primer punto\n- (mock) segundo punto\n")
+		default:
+			fmt.Fprintf(&b, "(mock) %s de ejemplo.\n", title)
+		}
+	}
+	if b.Len() == 0 {
+		return "", errors.New("sin secciones")
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
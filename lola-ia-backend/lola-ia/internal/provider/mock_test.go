@@ -0,0 +1,87 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMockEchoesSystemPrompt(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  ProviderConfig
+		want string
+	}{
+		{"default", ProviderConfig{}, DefaultSystemPrompt},
+		{"configurado", ProviderConfig{SystemPrompt: "Sos un analista formal."}, "Sos un analista formal."},
+	}
+	for _, tc := range cases {
+		res, err := MockProvider{Config: tc.cfg}.Reply(context.Background(), nil, "hola")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(res.Text, `system: "`+tc.want+`"`) {
+			t.Errorf("%s: %q no menciona el prompt %q", tc.name, res.Text, tc.want)
+		}
+	}
+}
+
+func TestMockResponses(t *testing.T) {
+	m := MockProvider{Responses: []MockResponse{
+		{Contains: "ventas", Reply: "fija de ventas"},
+		{Contains: "ventas de mayo", Reply: "nunca: gana la anterior"},
+		{Contains: "Format:", Reply: "fija antes que el formato"},
+	}}
+	format := "Analizá.\nFormat:\n--- Summary [un resumen]\n--- Pain Points [using bullet points]\n--- Top 3 Topics and (%) of Mentions [...]"
+	cases := []struct {
+		name  string
+		m     MockProvider
+		input string
+		want  string
+		exact bool
+	}{
+		{"fija", m, "ventas de mayo", "fija de ventas", true},
+		{"distingue mayúsculas", m, "Ventas", "Entendido.", false},
+		{"fija antes que el formato", m, format, "fija antes que el formato", true},
+		{"formato", MockProvider{}, format, "--- Summary\n(mock) Summary de ejemplo.\n--- Pain Points\n- (mock) primer punto\n- (mock) segundo punto\n--- Top 3 Topics and (%) of Mentions\n1. Tema uno (50%) 2. Tema dos (30%) 3. Tema tres (20%)", true},
+		{"formato sin secciones", MockProvider{}, "x\nFormat:\nnada", "Entendido.", false},
+		{"eco", m, "hola", `Me pediste: "hola"`, false},
+	}
+	for _, tc := range cases {
+		res, err := tc.m.Reply(context.Background(), nil, tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.exact && res.Text != tc.want {
+			t.Errorf("%s: %q, want %q", tc.name, res.Text, tc.want)
+		} else if !tc.exact && !strings.Contains(res.Text, tc.want) {
+			t.Errorf("%s: %q no contiene %q", tc.name, res.Text, tc.want)
+		}
+	}
+}
+
+func TestLoadMockResponses(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	rs, err := LoadMockResponses(write("ok.json", `[{"contains":"ventas","reply":"r1"},{"contains":"nps","reply":"r2"}]`))
+	if err != nil || len(rs) != 2 || rs[1] != (MockResponse{Contains: "nps", Reply: "r2"}) {
+		t.Errorf("LoadMockResponses = %+v, %v", rs, err)
+	}
+	for _, p := range []string{
+		write("roto.json", `[{"contains":`),
+		write("sin-contains.json", `[{"reply":"r"}]`),
+		filepath.Join(dir, "no-existe.json"),
+	} {
+		if _, err := LoadMockResponses(p); err == nil {
+			t.Errorf("%s: sin error", filepath.Base(p))
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"os"
+	"strings"
+)
+
+// defaultModel es el modelo que usa un provider cuando no se configura uno,
+// y la variable con la que se configura.
+type defaultModel struct {
+	env   string
+	model string
+}
+
+// defaultModels registra, por nombre de provider (el de PROVIDER), su modelo
+// por defecto: los constructores y main lo toman de acá. Azure no está: el
+// deployment no tiene default y AZURE_OPENAI_DEPLOYMENT es obligatorio.
+var defaultModels = map[string]defaultModel{
+	"openai":    {"OPENAI_MODEL", "gpt-4.1-mini"},
+	"anthropic": {"ANTHROPIC_MODEL", "claude-3-5-haiku-latest"},
+	"gemini":    {"GEMINI_MODEL", "gemini-2.0-flash"},
+	"ollama":    {"OLLAMA_MODEL", "llama3.1"},
+	"mock":      {"MOCK_MODEL", "mock-lola-ia"},
+}
+
+// DefaultModel devuelve el modelo por defecto del provider name; "" si no
+// tiene uno registrado.
+func DefaultModel(name string) string {
+	return defaultModels[strings.ToLower(name)].model
+}
+
+// ModelFromEnv devuelve el modelo del provider name: el de su variable
+// (OPENAI_MODEL, ANTHROPIC_MODEL...) si está, si no DefaultModel.
+func ModelFromEnv(name string) string {
+	d := defaultModels[strings.ToLower(name)]
+	if d.env != "" {
+		if m := strings.TrimSpace(os.Getenv(d.env)); m != "" {
+			return m
+		}
+	}
+	return d.model
+}
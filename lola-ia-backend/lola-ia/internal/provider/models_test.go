@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDefaultModels(t *testing.T) {
+	for name, d := range defaultModels {
+		if d.model == "" || d.env == "" {
+			t.Errorf("%s: default %q, variable %q", name, d.model, d.env)
+		}
+		if got := DefaultModel(name); got != d.model {
+			t.Errorf("DefaultModel(%q) = %q, want %q", name, got, d.model)
+		}
+	}
+	if got := DefaultModel("OpenAI"); got != defaultModels["openai"].model {
+		t.Errorf("DefaultModel(OpenAI) = %q", got)
+	}
+	if got := DefaultModel("azure"); got != "" {
+		t.Errorf("DefaultModel(azure) = %q, want vacío", got)
+	}
+}
+
+func TestModelFromEnv(t *testing.T) {
+	t.Setenv("OPENAI_MODEL", " gpt-4o ")
+	t.Setenv("ANTHROPIC_MODEL", "")
+	for _, tc := range []struct{ name, want string }{
+		{"openai", "gpt-4o"},
+		{"OPENAI", "gpt-4o"},
+		{"anthropic", DefaultModel("anthropic")},
+		{"desconocido", ""},
+	} {
+		if got := ModelFromEnv(tc.name); got != tc.want {
+			t.Errorf("ModelFromEnv(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestConstructorsUseDefaultModel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	for _, k := range []string{"OPENAI_API_KEY", "ANTHROPIC_API_KEY", "GEMINI_API_KEY"} {
+		t.Setenv(k, "k")
+	}
+	t.Setenv("OLLAMA_HOST", "http://ollama")
+	providers := map[string]func(cfg ProviderConfig) (ChatProvider, error){
+		"openai":    func(cfg ProviderConfig) (ChatProvider, error) { return NewOpenAIProvider("", cfg) },
+		"anthropic": func(cfg ProviderConfig) (ChatProvider, error) { return NewAnthropicProvider("", cfg) },
+		"gemini":    func(cfg ProviderConfig) (ChatProvider, error) { return NewGeminiProvider("", cfg) },
+		"ollama":    func(cfg ProviderConfig) (ChatProvider, error) { return NewOllamaProvider("", cfg) },
+		"mock":      func(ProviderConfig) (ChatProvider, error) { return MockProvider{}, nil },
+	}
+	for name, newProvider := range providers {
+		p, err := newProvider(testConfig(t, srv))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := p.Model(); got != DefaultModel(name) {
+			t.Errorf("%s: Model() = %q, want %q", name, got, DefaultModel(name))
+		}
+	}
+	if len(providers) != len(defaultModels) {
+		t.Errorf("%d providers probados, %d registrados", len(providers), len(defaultModels))
+	}
+}
@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+)
+
+// Moderator lo implementan los providers con un endpoint de moderación.
+type Moderator interface {
+	Moderate(ctx context.Context, text string) (Moderation, error)
+}
+
+// Moderation es el veredicto sobre un texto; Categories son las categorías
+// marcadas (p.ej. "harassment"), ordenadas.
+type Moderation struct {
+	Flagged    bool
+	Categories []string
+}
+
+const openAIModerationModel = "omni-moderation-latest"
+
+func (p *OpenAIProvider) Moderate(ctx context.Context, text string) (Moderation, error) {
+	/*
+		POST https://api.openai.com/v1/moderations
+		{"model": "omni-moderation-latest", "input": "..."}
+	*/
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.retryCeiling())
+	defer cancel()
+	b, _ := json.Marshal(map[string]any{"model": openAIModerationModel, "input": text})
+	resp, err := doWithRetry(ctx, p.client, p.cfg.maxRetries(), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx,
+			http.MethodPost, "https://api.openai.com/v1/moderations", bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return Moderation{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return Moderation{}, apiError(resp, "openai")
+	}
+
+	var out struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Moderation{}, err
+	}
+	if len(out.Results) == 0 {
+		return Moderation{}, errors.New("openai no devolvió resultado de moderación")
+	}
+	r := out.Results[0]
+	m := Moderation{Flagged: r.Flagged}
+	for cat, on := range r.Categories {
+		if on {
+			m.Categories = append(m.Categories, cat)
+		}
+	}
+	sort.Strings(m.Categories)
+	return m, nil
+}
@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestOpenAIModerate(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     int
+		body       string
+		flagged    bool
+		categories []string
+		wantErr    bool
+	}{
+		{"limpio", 200, `{"results":[{"flagged":false,"categories":{"harassment":false}}]}`, false, nil, false},
+		{"marcado", 200, `{"results":[{"flagged":true,"categories":{"violence":true,"harassment":true,"sexual":false}}]}`, true, []string{"harassment", "violence"}, false},
+		{"sin resultados", 200, `{"results":[]}`, false, nil, true},
+		{"error de la API", 500, `{"error":{"message":"caído"}}`, false, nil, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/moderations" {
+					t.Errorf("path = %s", r.URL.Path)
+				}
+				json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			t.Setenv("OPENAI_API_KEY", "k")
+			p, err := NewOpenAIProvider("m", testConfig(t, srv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := p.Moderate(context.Background(), "texto")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v", err)
+			}
+			if m.Flagged != tc.flagged || !slices.Equal(m.Categories, tc.categories) {
+				t.Errorf("Moderate = %+v", m)
+			}
+			if got["input"] != "texto" || got["model"] != openAIModerationModel {
+				t.Errorf("payload = %v", got)
+			}
+		})
+	}
+}
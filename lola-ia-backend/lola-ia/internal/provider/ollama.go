@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+const ollamaDefaultHost = "http://localhost:11434"
+
+// OllamaProvider habla con un servidor Ollama local (sin API key), útil para
+// desarrollo sin red.
+type OllamaProvider struct {
+	host   string
+	model  string
+	cfg    ProviderConfig
+	client *http.Client
+}
+
+// NewOllamaProvider crea el provider usando OLLAMA_HOST (default localhost:11434).
+func NewOllamaProvider(model string, cfg ProviderConfig) (*OllamaProvider, error) {
+	host := strings.TrimRight(os.Getenv("OLLAMA_HOST"), "/")
+	if host == "" {
+		host = ollamaDefaultHost
+	}
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+	if model == "" {
+		model = DefaultModel("ollama")
+	}
+	return &OllamaProvider{
+		host:  host,
+		model: model,
+		cfg:   cfg,
+		// los modelos locales pueden tardar bastante más que una API
+		client: cfg.httpClient(5 * time.Minute),
+	}, nil
+}
+
+func (p *OllamaProvider) Model() string { return p.model }
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  *int     `json:"num_predict,omitempty"`
+}
+
+type ollamaPayload struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+}
+
+func (p *OllamaProvider) newPayload(history []internal.Message, userInput string) ollamaPayload {
+	/*
+		POST {OLLAMA_HOST}/api/chat
+		{
+		  "model": "llama3.1",
+		  "stream": false,
+		  "messages": [
+		    {"role":"system","content":"Eres Lola IA..."},
+		    {"role":"assistant","content":"..."},
+		    {"role":"user","content":"..."}
+		  ]
+		}
+	*/
+	history = withoutInput(history, userInput)
+	payload := ollamaPayload{
+		Model:    p.model,
+		Messages: make([]ollamaMessage, 0, len(history)+2),
+	}
+	if p.cfg.Temperature != nil || p.cfg.TopP != nil || p.cfg.MaxOutputTokens != nil {
+		payload.Options = &ollamaOptions{
+			Temperature: p.cfg.Temperature,
+			TopP:        p.cfg.TopP,
+			NumPredict:  p.cfg.MaxOutputTokens,
+		}
+	}
+
+	// como en OpenAI: los mensajes de sistema guardados reemplazan al configurado
+	if !hasSystemTurn(history) {
+		payload.Messages = append(payload.Messages, ollamaMessage{Role: "system", Content: p.cfg.systemPrompt()})
+	}
+	for _, m := range history {
+		payload.Messages = append(payload.Messages, ollamaMessage{Role: string(m.Role), Content: m.Content})
+	}
+	// Último input del usuario
+	payload.Messages = append(payload.Messages, ollamaMessage{Role: "user", Content: userInput})
+	return payload
+}
+
+func (p *OllamaProvider) Reply(ctx context.Context, history []internal.Message, userInput string) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.retryCeiling())
+	defer cancel()
+
+	b, _ := json.Marshal(p.newPayload(history, userInput))
+	resp, err := doWithRetry(ctx, p.client, p.cfg.maxRetries(), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.host+"/api/chat", bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	// Ollama devuelve los errores como {"error":"..."} (string, no objeto)
+	var out struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		PromptEvalCount int    `json:"prompt_eval_count"`
+		EvalCount       int    `json:"eval_count"`
+		Error           string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil && resp.StatusCode < 400 {
+		return Result{}, err
+	}
+	if resp.StatusCode >= 400 {
+		if out.Error != "" {
+			return Result{}, &APIError{StatusCode: resp.StatusCode, Message: out.Error}
+		}
+		return Result{}, &APIError{StatusCode: resp.StatusCode, Message: "ollama error: " + resp.Status}
+	}
+	if out.Message.Content == "" {
+		return Result{}, errors.New("respuesta vacía de Ollama")
+	}
+	return Result{Text: out.Message.Content, Usage: newUsage(out.PromptEvalCount, out.EvalCount)}, nil
+}
+
+// ReplyStream todavía no usa el streaming de Ollama: envía la respuesta
+// completa como un único fragmento.
+func (p *OllamaProvider) ReplyStream(ctx context.Context, history []internal.Message, userInput string, out chan<- string) (Result, error) {
+	res, err := p.Reply(ctx, history, userInput)
+	if err != nil {
+		return Result{}, err
+	}
+	out <- res.Text
+	return res, nil
+}
@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func newTestOllama(t *testing.T, srv *httptest.Server) *OllamaProvider {
+	t.Helper()
+	// OLLAMA_HOST apunta directo al servidor: no hace falta redirect
+	t.Setenv("OLLAMA_HOST", srv.URL+"/")
+	retries := 0
+	p, err := NewOllamaProvider("", ProviderConfig{MaxRetries: &retries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestOllamaReply(t *testing.T) {
+	var got ollamaPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/chat" {
+			t.Errorf("request: %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"message":{"role":"assistant","content":"hola desde llama"},"done":true,"prompt_eval_count":20,"eval_count":5}`))
+	}))
+	defer srv.Close()
+
+	p := newTestOllama(t, srv)
+	history := []internal.Message{{Role: internal.RoleAssistant, Content: "¡Hola!"}}
+	res, err := p.Reply(context.Background(), history, "¿estás?")
+	if err != nil {
+		t.Fatalf("Reply: %v", err)
+	}
+	if res.Text != "hola desde llama" || res.Usage == nil || res.Usage.TotalTokens != 25 {
+		t.Errorf("res = %+v, usage = %+v", res, res.Usage)
+	}
+
+	if got.Model != DefaultModel("ollama") || got.Stream || got.Options != nil {
+		t.Errorf("payload = %+v", got)
+	}
+	want := []ollamaMessage{{"system", DefaultSystemPrompt}, {"assistant", "¡Hola!"}, {"user", "¿estás?"}}
+	if len(got.Messages) != len(want) {
+		t.Fatalf("messages = %+v", got.Messages)
+	}
+	for i := range want {
+		if got.Messages[i] != want[i] {
+			t.Errorf("messages[%d] = %+v, want %+v", i, got.Messages[i], want[i])
+		}
+	}
+}
+
+func TestOllamaReplyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"model \"llama3.1\" not found, try pulling it first"}`))
+	}))
+	defer srv.Close()
+
+	_, err := newTestOllama(t, srv).Reply(context.Background(), nil, "hola")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 || apiErr.Message != `model "llama3.1" not found, try pulling it first` {
+		t.Errorf("err = %#v", err)
+	}
+}
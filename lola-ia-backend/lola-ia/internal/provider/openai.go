@@ -5,37 +5,126 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/nubank/lola-ia-backend/internal"
 )
 
+// Estilos de la API de OpenAI (OPENAI_API_STYLE).
+const (
+	OpenAIStyleResponses = "responses" // POST /v1/responses (default)
+	OpenAIStyleChat      = "chat"      // POST /v1/chat/completions
+)
+
 type OpenAIProvider struct {
-	apiKey string
-	model  string
-	client *http.Client
+	apiKey     string
+	model      string
+	embedModel string
+	style      string // OpenAIStyleResponses u OpenAIStyleChat
+	cfg        ProviderConfig
+	client     *http.Client
+	stream     *http.Client  // sin Timeout (ver doStream)
+	tools      *ToolRegistry // nil = sin tool calling
+
+	// chatURL, keyHeader y vendor son los de api.openai.com salvo para
+	// Azure (ver NewAzureOpenAIProvider).
+	chatURL   string
+	keyHeader string // "" = Authorization: Bearer
+	vendor    string // prefijo de los errores de la API
 }
 
-func NewOpenAIProvider(model string) (*OpenAIProvider, error) {
+// NewOpenAIProvider crea el provider de OpenAI. Si cfg.SystemPrompt está vacío
+// se usa DefaultSystemPrompt. El modelo de embeddings sale de
+// OPENAI_EMBEDDING_MODEL (default text-embedding-3-small) y la API a usar de
+// OPENAI_API_STYLE: "responses" (default) o "chat" para Chat Completions.
+func NewOpenAIProvider(model string, cfg ProviderConfig) (*OpenAIProvider, error) {
 	key := os.Getenv("OPENAI_API_KEY")
 	if key == "" {
 		return nil, errors.New("OPENAI_API_KEY vacío")
 	}
+	style := strings.ToLower(strings.TrimSpace(os.Getenv("OPENAI_API_STYLE")))
+	switch style {
+	case "":
+		style = OpenAIStyleResponses
+	case OpenAIStyleResponses, OpenAIStyleChat:
+	default:
+		return nil, fmt.Errorf("OPENAI_API_STYLE inválido: %q (responses o chat)", style)
+	}
 	if model == "" {
-		model = "gpt-4.1-mini"
+		model = DefaultModel("openai")
+	}
+	embedModel := os.Getenv("OPENAI_EMBEDDING_MODEL")
+	if embedModel == "" {
+		embedModel = openAIDefaultEmbeddingModel
 	}
 	return &OpenAIProvider{
-		apiKey: key,
-		model:  model,
-		client: &http.Client{Timeout: 60 * time.Second},
+		apiKey:     key,
+		model:      model,
+		embedModel: embedModel,
+		style:      style,
+		cfg:        cfg,
+		client:     cfg.httpClient(60 * time.Second),
+		stream:     cfg.streamClient(),
+		chatURL:    openAIChatURL,
+		vendor:     "openai",
 	}, nil
 }
 
 func (p *OpenAIProvider) Model() string { return p.model }
 
-func (p *OpenAIProvider) Reply(history []internal.Message, userInput string) (string, error) {
+const (
+	openAIResponsesURL = "https://api.openai.com/v1/responses"
+	openAIChatURL      = "https://api.openai.com/v1/chat/completions"
+)
+
+// openAIItem es un elemento de "input": un mensaje (Role/Content), una
+// llamada a tool que hizo el modelo (Type "function_call") o su resultado
+// (Type "function_call_output").
+type openAIItem struct {
+	Type      string `json:"type,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Content   string `json:"content,omitempty"`
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+type openAITool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+type openAIPayload struct {
+	Model           string       `json:"model"`
+	Input           []openAIItem `json:"input"`
+	Tools           []openAITool `json:"tools,omitempty"`
+	Temperature     *float64     `json:"temperature,omitempty"`
+	TopP            *float64     `json:"top_p,omitempty"`
+	MaxOutputTokens *int         `json:"max_output_tokens,omitempty"`
+	Stream          bool         `json:"stream,omitempty"`
+}
+
+// openAIOutput es un elemento de "output" de la respuesta: un mensaje con
+// bloques de texto, una llamada a tool, un resumen de razonamiento, etc.
+type openAIOutput struct {
+	Type    string `json:"type"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+func (p *OpenAIProvider) newPayload(history []internal.Message, userInput string) openAIPayload {
 	/*
 		Usamos la API de Responses:
 		POST https://api.openai.com/v1/responses
@@ -50,78 +139,290 @@ func (p *OpenAIProvider) Reply(history []internal.Message, userInput string) (st
 		  ]
 		}
 	*/
-
-	type item struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
-	}
-	payload := struct {
-		Model string `json:"model"`
-		Input []item `json:"input"`
-	}{
-		Model: p.model,
-		Input: make([]item, 0, len(history)+2),
+	history = withoutInput(history, userInput)
+	payload := openAIPayload{
+		Model:           p.model,
+		Input:           make([]openAIItem, 0, len(history)+2),
+		Temperature:     p.cfg.Temperature,
+		TopP:            p.cfg.TopP,
+		MaxOutputTokens: p.cfg.MaxOutputTokens,
 	}
 
-	// Prompt del sistema mínimo
-	payload.Input = append(payload.Input, item{
-		Role:    "system",
-		Content: "Eres Lola IA, un asistente breve y claro.",
-	})
+	// Prompt del sistema, salvo que el historial traiga sus propios mensajes
+	// de sistema: esos van en su lugar dentro de la conversación
+	if !hasSystemTurn(history) {
+		payload.Input = append(payload.Input, openAIItem{
+			Role:    "system",
+			Content: p.cfg.systemPrompt(),
+		})
+	}
 
 	for _, m := range history {
-		payload.Input = append(payload.Input, item{
+		payload.Input = append(payload.Input, openAIItem{
 			Role:    string(m.Role),
 			Content: m.Content,
 		})
 	}
 
 	// Último input del usuario
-	payload.Input = append(payload.Input, item{
+	payload.Input = append(payload.Input, openAIItem{
 		Role:    "user",
 		Content: userInput,
 	})
 
-	b, _ := json.Marshal(payload)
+	for _, t := range p.tools.List() {
+		payload.Tools = append(payload.Tools, openAITool{
+			Type:        "function",
+			Name:        t.Name(),
+			Description: t.Description(),
+			Parameters:  t.Parameters(),
+		})
+	}
+	return payload
+}
+
+// runTools ejecuta las llamadas a tools que pidió el modelo y agrega a input
+// cada llamada seguida de su resultado, para mandarlos en la próxima vuelta.
+func (p *OpenAIProvider) runTools(ctx context.Context, input []openAIItem, calls []openAIOutput) []openAIItem {
+	for _, c := range calls {
+		out := p.tools.call(ctx, c.Name, json.RawMessage(c.Arguments))
+		input = append(input,
+			openAIItem{Type: "function_call", CallID: c.CallID, Name: c.Name, Arguments: c.Arguments},
+			openAIItem{Type: "function_call_output", CallID: c.CallID, Output: out},
+		)
+	}
+	return input
+}
 
-	req, _ := http.NewRequestWithContext(context.Background(),
-		http.MethodPost, "https://api.openai.com/v1/responses", bytes.NewReader(b))
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+// do envía payload a url (/v1/responses o p.chatURL, con reintentos) y
+// devuelve la respuesta cuando el status es < 400.
+func (p *OpenAIProvider) do(ctx context.Context, url string, payload any, stream bool) (*http.Response, error) {
+	b, _ := json.Marshal(payload)
 
-	resp, err := p.client.Do(req)
+	newReq := func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		if p.keyHeader != "" {
+			req.Header.Set(p.keyHeader, p.apiKey)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+p.apiKey)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if stream {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		return req, nil
+	}
+	var (
+		resp *http.Response
+		err  error
+	)
+	if stream {
+		resp, err = doStream(ctx, p.stream, p.cfg, newReq)
+	} else {
+		resp, err = doWithRetry(ctx, p.client, p.cfg.maxRetries(), newReq)
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		var e struct {
-			Error struct {
-				Message string `json:"message"`
-			} `json:"error"`
+		defer resp.Body.Close()
+		return nil, apiError(resp, p.vendor)
+	}
+	return resp, nil
+}
+
+// openAIUsage es el bloque "usage" de la API de Responses.
+type openAIUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+func (u *openAIUsage) usage() *internal.Usage {
+	if u == nil {
+		return nil
+	}
+	return &internal.Usage{InputTokens: u.InputTokens, OutputTokens: u.OutputTokens, TotalTokens: u.TotalTokens}
+}
+
+func (p *OpenAIProvider) Reply(ctx context.Context, history []internal.Message, userInput string) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.retryCeiling())
+	defer cancel()
+	payload := p.newPayload(history, userInput)
+	if p.style == OpenAIStyleChat {
+		return p.chatReply(ctx, newChatPayload(payload))
+	}
+	var usage *internal.Usage
+	// Con tools el modelo puede pedir llamadas en vez de contestar: se
+	// ejecutan, se le mandan los resultados y se vuelve a preguntar.
+	for round := 0; ; round++ {
+		out, err := p.replyOnce(ctx, payload)
+		if err != nil {
+			return Result{}, err
+		}
+		usage = addUsage(usage, out.Usage.usage())
+
+		var calls []openAIOutput
+		for _, o := range out.Output {
+			if o.Type == "function_call" {
+				calls = append(calls, o)
+			}
+		}
+		if len(calls) > 0 {
+			if round == maxToolRounds {
+				return Result{}, errors.New("openai: demasiadas llamadas a tools sin respuesta")
+			}
+			payload.Input = p.runTools(ctx, payload.Input, calls)
+			continue
+		}
+
+		if text := outputText(out.Output); text != "" {
+			return Result{Text: text, Usage: usage}, nil
+		}
+		return Result{}, errors.New("respuesta vacía de OpenAI")
+	}
+}
+
+// outputText une, en orden, todos los bloques de texto de los mensajes de
+// output: una respuesta larga puede venir en varios bloques o varios
+// mensajes. Los bloques de un mensaje se concatenan tal cual y los mensajes
+// se separan con una línea en blanco; lo que no es texto (razonamiento,
+// llamadas a tools, refusals) se ignora.
+func outputText(output []openAIOutput) string {
+	var parts []string
+	for _, o := range output {
+		if o.Type != "" && o.Type != "message" {
+			continue
+		}
+		var b strings.Builder
+		for _, c := range o.Content {
+			if c.Type == "" || c.Type == "output_text" {
+				b.WriteString(c.Text)
+			}
 		}
-		json.NewDecoder(resp.Body).Decode(&e)
-		if e.Error.Message != "" {
-			return "", errors.New(e.Error.Message)
+		if b.Len() > 0 {
+			parts = append(parts, b.String())
 		}
-		return "", errors.New("openai error: " + resp.Status)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+type openAIResponse struct {
+	Output []openAIOutput `json:"output"`
+	Usage  *openAIUsage   `json:"usage"`
+}
+
+func (p *OpenAIProvider) replyOnce(ctx context.Context, payload openAIPayload) (openAIResponse, error) {
+	resp, err := p.do(ctx, openAIResponsesURL, payload, false)
+	if err != nil {
+		return openAIResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var out openAIResponse
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	return out, err
+}
+
+func (p *OpenAIProvider) ReplyStream(ctx context.Context, history []internal.Message, userInput string, out chan<- string) (Result, error) {
+	payload := p.newPayload(history, userInput)
+	payload.Stream = true
+	// sin tope total: cada vuelta lo acota doStream
+	if p.style == OpenAIStyleChat {
+		return p.chatReplyStream(ctx, newChatPayload(payload), out)
 	}
 
-	var out struct {
-		Output []struct {
-			Content []struct {
-				Text string `json:"text"`
-			} `json:"content"`
-		} `json:"output"`
+	var res Result
+	var text strings.Builder
+	// igual que en Reply: cada vuelta con llamadas a tools se vuelve a pedir
+	// la respuesta con los resultados; el texto de todas las vueltas se streamea
+	for round := 0; ; round++ {
+		calls, usage, err := p.streamOnce(ctx, payload, &text, out)
+		if err != nil {
+			return Result{}, err
+		}
+		res.Usage = addUsage(res.Usage, usage)
+		if len(calls) == 0 {
+			break
+		}
+		if round == maxToolRounds {
+			return Result{}, errors.New("openai: demasiadas llamadas a tools sin respuesta")
+		}
+		payload.Input = p.runTools(ctx, payload.Input, calls)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", err
+	if text.Len() == 0 {
+		return Result{}, errors.New("respuesta vacía de OpenAI")
 	}
+	res.Text = text.String()
+	return res, nil
+}
 
-	// Tomamos el primer bloque de texto
-	if len(out.Output) > 0 && len(out.Output[0].Content) > 0 {
-		return out.Output[0].Content[0].Text, nil
+// streamOnce hace una llamada con streaming: manda los deltas de texto a out
+// (y los acumula en text) y devuelve las llamadas a tools que pidió el modelo.
+func (p *OpenAIProvider) streamOnce(ctx context.Context, payload openAIPayload, text *strings.Builder, out chan<- string) ([]openAIOutput, *internal.Usage, error) {
+	resp, err := p.do(ctx, openAIResponsesURL, payload, true)
+	if err != nil {
+		return nil, nil, err
 	}
-	return "", errors.New("respuesta vacía de OpenAI")
+	defer resp.Body.Close()
+
+	/*
+		Con "stream": true la API responde eventos SSE:
+		event: response.output_text.delta
+		data: {"type":"response.output_text.delta","delta":"Hola"}
+
+		Un evento puede traer varias líneas data: y termina con una línea vacía.
+		El uso de tokens llega en response.completed y cada llamada a tool
+		completa en response.output_item.done.
+	*/
+	var calls []openAIOutput
+	var usage *internal.Usage
+	err = readSSE(resp.Body, func(data string) (bool, error) {
+		if data == "[DONE]" {
+			return false, nil
+		}
+		var event struct {
+			Type     string       `json:"type"`
+			Delta    string       `json:"delta"`
+			Message  string       `json:"message"`
+			Item     openAIOutput `json:"item"`
+			Response struct {
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+				Usage *openAIUsage `json:"usage"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return false, err
+		}
+		if event.Message == "" {
+			event.Message = event.Response.Error.Message
+		}
+		switch event.Type {
+		case "response.output_text.delta":
+			if event.Delta != "" {
+				text.WriteString(event.Delta)
+				out <- event.Delta
+			}
+		case "response.output_item.done":
+			if event.Item.Type == "function_call" {
+				calls = append(calls, event.Item)
+			}
+		case "response.completed":
+			usage = event.Response.Usage.usage()
+			return false, nil
+		case "response.failed", "error":
+			if event.Message != "" {
+				return false, errors.New(event.Message)
+			}
+			return false, errors.New("openai error: " + event.Type)
+		}
+		return true, nil
+	})
+	return calls, usage, err
 }
@@ -0,0 +1,268 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// Chat Completions (OPENAI_API_STYLE=chat): mismo provider y mismas tools
+// que con Responses, pero con "messages" y "choices" en vez de input/output.
+
+type openAIChatToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIChatMessage struct {
+	Role       string               `json:"role"`
+	Content    string               `json:"content"`
+	ToolCalls  []openAIChatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string               `json:"tool_call_id,omitempty"`
+}
+
+type openAIChatTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Parameters  json.RawMessage `json:"parameters"`
+	} `json:"function"`
+}
+
+type openAIChatPayload struct {
+	Model               string               `json:"model"`
+	Messages            []openAIChatMessage  `json:"messages"`
+	Tools               []openAIChatTool     `json:"tools,omitempty"`
+	Temperature         *float64             `json:"temperature,omitempty"`
+	TopP                *float64             `json:"top_p,omitempty"`
+	MaxCompletionTokens *int                 `json:"max_completion_tokens,omitempty"`
+	Stream              bool                 `json:"stream,omitempty"`
+	StreamOptions       *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIChatUsage es el bloque "usage" de Chat Completions.
+type openAIChatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *openAIChatUsage) usage() *internal.Usage {
+	if u == nil {
+		return nil
+	}
+	return &internal.Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+}
+
+// newChatPayload pasa el payload de Responses (ya armado por newPayload, con
+// el prompt del sistema y el historial) al formato de Chat Completions.
+func newChatPayload(r openAIPayload) openAIChatPayload {
+	/*
+		POST https://api.openai.com/v1/chat/completions
+		{
+		  "model": "...",
+		  "messages": [
+		    {"role":"system","content":"You are Lola IA..."},
+		    {"role":"user","content":"..."}
+		  ]
+		}
+	*/
+	payload := openAIChatPayload{
+		Model:               r.Model,
+		Messages:            make([]openAIChatMessage, 0, len(r.Input)),
+		Temperature:         r.Temperature,
+		TopP:                r.TopP,
+		MaxCompletionTokens: r.MaxOutputTokens,
+		Stream:              r.Stream,
+	}
+	for _, it := range r.Input {
+		payload.Messages = append(payload.Messages, openAIChatMessage{Role: it.Role, Content: it.Content})
+	}
+	for _, t := range r.Tools {
+		var ct openAIChatTool
+		ct.Type = "function"
+		ct.Function.Name = t.Name
+		ct.Function.Description = t.Description
+		ct.Function.Parameters = t.Parameters
+		payload.Tools = append(payload.Tools, ct)
+	}
+	if r.Stream {
+		// sin esto el stream no trae el consumo de tokens
+		payload.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	return payload
+}
+
+// runChatTools ejecuta las llamadas a tools del mensaje del asistente y
+// agrega a messages ese mensaje seguido de un mensaje "tool" por resultado.
+func (p *OpenAIProvider) runChatTools(ctx context.Context, messages []openAIChatMessage, assistant openAIChatMessage) []openAIChatMessage {
+	messages = append(messages, assistant)
+	for _, c := range assistant.ToolCalls {
+		out := p.tools.call(ctx, c.Function.Name, json.RawMessage(c.Function.Arguments))
+		messages = append(messages, openAIChatMessage{Role: "tool", Content: out, ToolCallID: c.ID})
+	}
+	return messages
+}
+
+func (p *OpenAIProvider) chatReply(ctx context.Context, payload openAIChatPayload) (Result, error) {
+	var usage *internal.Usage
+	for round := 0; ; round++ {
+		resp, err := p.do(ctx, p.chatURL, payload, false)
+		if err != nil {
+			return Result{}, err
+		}
+		var out struct {
+			Choices []struct {
+				Message openAIChatMessage `json:"message"`
+			} `json:"choices"`
+			Usage *openAIChatUsage `json:"usage"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if err != nil {
+			return Result{}, err
+		}
+		usage = addUsage(usage, out.Usage.usage())
+		if len(out.Choices) == 0 {
+			return Result{}, errors.New("respuesta vacía de OpenAI")
+		}
+
+		msg := out.Choices[0].Message
+		if len(msg.ToolCalls) > 0 {
+			if round == maxToolRounds {
+				return Result{}, errors.New("openai: demasiadas llamadas a tools sin respuesta")
+			}
+			payload.Messages = p.runChatTools(ctx, payload.Messages, msg)
+			continue
+		}
+		if msg.Content == "" {
+			return Result{}, errors.New("respuesta vacía de OpenAI")
+		}
+		return Result{Text: msg.Content, Usage: usage}, nil
+	}
+}
+
+func (p *OpenAIProvider) chatReplyStream(ctx context.Context, payload openAIChatPayload, out chan<- string) (Result, error) {
+	var res Result
+	var text strings.Builder
+	for round := 0; ; round++ {
+		assistant, usage, err := p.chatStreamOnce(ctx, payload, &text, out)
+		if err != nil {
+			return Result{}, err
+		}
+		res.Usage = addUsage(res.Usage, usage)
+		if len(assistant.ToolCalls) == 0 {
+			break
+		}
+		if round == maxToolRounds {
+			return Result{}, errors.New("openai: demasiadas llamadas a tools sin respuesta")
+		}
+		payload.Messages = p.runChatTools(ctx, payload.Messages, assistant)
+	}
+	if text.Len() == 0 {
+		return Result{}, errors.New("respuesta vacía de OpenAI")
+	}
+	res.Text = text.String()
+	return res, nil
+}
+
+// chatStreamOnce hace una llamada con streaming: manda los deltas de texto a
+// out (y los acumula en text) y devuelve el mensaje del asistente armado con
+// los fragmentos, con sus llamadas a tools si las hubo.
+func (p *OpenAIProvider) chatStreamOnce(ctx context.Context, payload openAIChatPayload, text *strings.Builder, out chan<- string) (openAIChatMessage, *internal.Usage, error) {
+	resp, err := p.do(ctx, p.chatURL, payload, true)
+	if err != nil {
+		return openAIChatMessage{}, nil, err
+	}
+	defer resp.Body.Close()
+
+	/*
+		data: {"choices":[{"index":0,"delta":{"content":"Hola"}}]}
+		...
+		data: {"choices":[],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}
+		data: [DONE]
+
+		Las llamadas a tools llegan por partes en delta.tool_calls: el primer
+		fragmento de cada una trae id y nombre, los siguientes (con el mismo
+		index) van completando los argumentos.
+	*/
+	assistant := openAIChatMessage{Role: "assistant"}
+	calls := make(map[int]*openAIChatToolCall)
+	var content strings.Builder
+	var usage *internal.Usage
+	err = readSSE(resp.Body, func(data string) (bool, error) {
+		if data == "[DONE]" {
+			return false, nil
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content   string `json:"content"`
+					ToolCalls []struct {
+						Index int `json:"index"`
+						openAIChatToolCall
+					} `json:"tool_calls"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *openAIChatUsage `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, err
+		}
+		if chunk.Error != nil {
+			return false, errors.New(chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.usage()
+		}
+		for _, ch := range chunk.Choices {
+			if d := ch.Delta.Content; d != "" {
+				content.WriteString(d)
+				text.WriteString(d)
+				out <- d
+			}
+			for _, tc := range ch.Delta.ToolCalls {
+				c, ok := calls[tc.Index]
+				if !ok {
+					c = &openAIChatToolCall{Type: "function"}
+					calls[tc.Index] = c
+				}
+				if tc.ID != "" {
+					c.ID = tc.ID
+				}
+				c.Function.Name += tc.Function.Name
+				c.Function.Arguments += tc.Function.Arguments
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return openAIChatMessage{}, nil, err
+	}
+	idx := make([]int, 0, len(calls))
+	for i := range calls {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	for _, i := range idx {
+		assistant.ToolCalls = append(assistant.ToolCalls, *calls[i])
+	}
+	assistant.Content = content.String()
+	return assistant, usage, nil
+}
@@ -0,0 +1,235 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestOpenAISystemTurns(t *testing.T) {
+	cases := []struct {
+		name    string
+		history []internal.Message
+		want    []openAIItem
+	}{
+		{
+			"sin system: el configurado adelante",
+			[]internal.Message{{Role: internal.RoleAssistant, Content: "¡Hola!"}},
+			[]openAIItem{{Role: "system", Content: DefaultSystemPrompt}, {Role: "assistant", Content: "¡Hola!"}, {Role: "user", Content: "¿y?"}},
+		},
+		{
+			"system guardado: en su lugar y sin el configurado",
+			[]internal.Message{
+				{Role: internal.RoleSystem, Content: "Sos Lola, analista."},
+				{Role: internal.RoleAssistant, Content: "¡Hola!"},
+				{Role: internal.RoleUser, Content: "primera"},
+				{Role: internal.RoleAssistant, Content: "respuesta"},
+				{Role: internal.RoleSystem, Content: "Ahora respondé en inglés."},
+			},
+			[]openAIItem{
+				{Role: "system", Content: "Sos Lola, analista."},
+				{Role: "assistant", Content: "¡Hola!"},
+				{Role: "user", Content: "primera"},
+				{Role: "assistant", Content: "respuesta"},
+				{Role: "system", Content: "Ahora respondé en inglés."},
+				{Role: "user", Content: "¿y?"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		var got []openAIPayload
+		srv := toolServer(t, &got)
+		if _, err := newToolOpenAI(t, srv).Reply(context.Background(), tc.history, "¿y?"); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		srv.Close()
+		if len(got) != 1 || len(got[0].Input) != len(tc.want) {
+			t.Fatalf("%s: payload = %+v", tc.name, got)
+		}
+		for i, item := range got[0].Input {
+			if item != tc.want[i] {
+				t.Errorf("%s: input[%d] = %+v, want %+v", tc.name, i, item, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestOpenAIMultiBlockOutput(t *testing.T) {
+	cases := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			"varios bloques y mensajes",
+			`[{"type":"reasoning","summary":[{"type":"summary_text","text":"pienso"}]},
+			  {"type":"message","content":[
+				{"type":"output_text","text":"--- Summary\nLa app es lenta. "},
+				{"type":"refusal","refusal":"no"},
+				{"type":"output_text","text":"Sobre todo al cargar."}]},
+			  {"type":"message","content":[{"type":"output_text","text":"--- Actionable Feedback\n- cachear"}]}]`,
+			"--- Summary\nLa app es lenta. Sobre todo al cargar.\n\n--- Actionable Feedback\n- cachear",
+		},
+		{"sin texto", `[{"type":"reasoning"},{"type":"message","content":[{"type":"refusal","refusal":"no"}]}]`, ""},
+	}
+	for _, tc := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"output":` + tc.output + `}`))
+		}))
+		res, err := newToolOpenAI(t, srv).Reply(context.Background(), nil, "hola")
+		srv.Close()
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%s: sin error, texto %q", tc.name, res.Text)
+			}
+			continue
+		}
+		if err != nil || res.Text != tc.want {
+			t.Errorf("%s: %q, %v; want %q", tc.name, res.Text, err, tc.want)
+		}
+	}
+}
+
+// newStyleOpenAI es el provider de OpenAI con OPENAI_API_STYLE=style,
+// hablando con srv.
+func newStyleOpenAI(t *testing.T, srv *httptest.Server, style string) *OpenAIProvider {
+	t.Helper()
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_API_STYLE", style)
+	p, err := NewOpenAIProvider("m", testConfig(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestOpenAIStyles(t *testing.T) {
+	history := []internal.Message{{Role: internal.RoleAssistant, Content: "¡Hola!"}}
+	cases := []struct {
+		style, path string
+		reply       string
+	}{
+		{"", "/v1/responses",
+			`{"output":[{"type":"message","content":[{"type":"output_text","text":"respuesta"}]}],"usage":{"input_tokens":9,"output_tokens":2,"total_tokens":11}}`},
+		{"responses", "/v1/responses",
+			`{"output":[{"type":"message","content":[{"type":"output_text","text":"respuesta"}]}],"usage":{"input_tokens":9,"output_tokens":2,"total_tokens":11}}`},
+		{"Chat", "/v1/chat/completions",
+			`{"choices":[{"index":0,"message":{"role":"assistant","content":"respuesta"}}],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`},
+	}
+	for _, tc := range cases {
+		var body map[string]json.RawMessage
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != tc.path || r.Header.Get("Authorization") != "Bearer k" {
+				t.Errorf("%q: %s %s", tc.style, r.URL.Path, r.Header.Get("Authorization"))
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			w.Write([]byte(tc.reply))
+		}))
+		res, err := newStyleOpenAI(t, srv, tc.style).Reply(context.Background(), history, "¿y?")
+		srv.Close()
+		if err != nil || res.Text != "respuesta" || res.Usage == nil || *res.Usage != (internal.Usage{InputTokens: 9, OutputTokens: 2, TotalTokens: 11}) {
+			t.Errorf("%q: res = %+v, usage = %+v, err = %v", tc.style, res, res.Usage, err)
+			continue
+		}
+
+		// los turnos van en "messages" (chat) o en "input" (responses)
+		field, other := "input", "messages"
+		if tc.path == "/v1/chat/completions" {
+			field, other = other, field
+		}
+		var turns []struct{ Role, Content string }
+		json.Unmarshal(body[field], &turns)
+		got := make([]string, len(turns))
+		for i, m := range turns {
+			got[i] = m.Role + ":" + m.Content
+		}
+		want := []string{"system:" + DefaultSystemPrompt, "assistant:¡Hola!", "user:¿y?"}
+		if !slices.Equal(got, want) || body[other] != nil {
+			t.Errorf("%q: %s = %q, want %q (y sin %s)", tc.style, field, got, want, other)
+		}
+	}
+}
+
+func TestOpenAIStyleInvalid(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_API_STYLE", "completions")
+	if _, err := NewOpenAIProvider("m", ProviderConfig{}); err == nil {
+		t.Error("OPENAI_API_STYLE inválido sin error")
+	}
+}
+
+func TestOpenAIChatStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p openAIChatPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		if r.URL.Path != "/v1/chat/completions" || !p.Stream || p.StreamOptions == nil || !p.StreamOptions.IncludeUsage {
+			t.Errorf("request: %s %+v", r.URL.Path, p)
+		}
+		send := sseWriter(w)
+		send("", `{"choices":[{"index":0,"delta":{"content":"Hola, "}}]}`)
+		send("", `{"choices":[{"index":0,"delta":{"content":"¿qué tal?"}}]}`)
+		send("", `{"choices":[],"usage":{"prompt_tokens":9,"completion_tokens":4,"total_tokens":13}}`)
+		send("", `[DONE]`)
+	}))
+	defer srv.Close()
+
+	chunks, res, err := collect(t, newStyleOpenAI(t, srv, "chat"), nil, "hola")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(chunks, []string{"Hola, ", "¿qué tal?"}) || res.Text != "Hola, ¿qué tal?" || res.Usage == nil || res.Usage.TotalTokens != 13 {
+		t.Errorf("chunks = %q, res = %+v", chunks, res)
+	}
+}
+
+func TestOpenAIChatErrors(t *testing.T) {
+	for _, reply := range []string{
+		`{"choices":[]}`,
+		`{"choices":[{"message":{"role":"assistant","content":""}}]}`,
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(reply))
+		}))
+		if _, err := newStyleOpenAI(t, srv, "chat").Reply(context.Background(), nil, "hola"); err == nil {
+			t.Errorf("%s: sin error", reply)
+		}
+		srv.Close()
+	}
+}
+
+func TestOpenAIChatToolCall(t *testing.T) {
+	var got []openAIChatPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p openAIChatPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		got = append(got, p)
+		if len(got) == 1 {
+			w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"","tool_calls":[{"id":"c1","type":"function","function":{"name":"sum","arguments":"{\"a\":2,\"b\":3}"}}]}}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"son 5"}}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`))
+	}))
+	defer srv.Close()
+	var calls int
+	p := newStyleOpenAI(t, srv, "chat")
+	p.SetTools(NewToolRegistry(sumTool{&calls}))
+
+	res, err := p.Reply(context.Background(), nil, "¿2+3?")
+	if err != nil || res.Text != "son 5" || calls != 1 || res.Usage.TotalTokens != 24 {
+		t.Fatalf("res = %+v, calls = %d, err = %v", res, calls, err)
+	}
+	if len(got) != 2 || len(got[0].Tools) != 1 || got[0].Tools[0].Function.Name != "sum" {
+		t.Fatalf("payloads = %+v", got)
+	}
+	// la segunda vuelta trae el pedido del modelo y el resultado de la tool
+	msgs := got[1].Messages
+	call, result := msgs[len(msgs)-2], msgs[len(msgs)-1]
+	if len(call.ToolCalls) != 1 || call.ToolCalls[0].ID != "c1" || result.Role != "tool" || result.ToolCallID != "c1" || result.Content != `{"sum":5}` {
+		t.Errorf("mensajes = %+v", msgs)
+	}
+}
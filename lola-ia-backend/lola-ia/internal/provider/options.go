@@ -0,0 +1,72 @@
+package provider
+
+// CallOptions son ajustes para una llamada puntual; los campos vacíos dejan
+// la configuración del provider como está.
+type CallOptions struct {
+	Model       string
+	Temperature *float64
+}
+
+// Configurable lo implementan los providers que admiten CallOptions. With
+// devuelve una copia con los ajustes aplicados; el original no cambia.
+type Configurable interface {
+	With(opts CallOptions) ChatProvider
+}
+
+func (o CallOptions) apply(model *string, cfg *ProviderConfig) {
+	if o.Model != "" {
+		*model = o.Model
+	}
+	if o.Temperature != nil {
+		t := *o.Temperature
+		cfg.Temperature = &t
+	}
+}
+
+func (p *OpenAIProvider) With(o CallOptions) ChatProvider {
+	cp := *p
+	o.apply(&cp.model, &cp.cfg)
+	return &cp
+}
+
+// With con Model cambia de deployment.
+func (p *AzureOpenAIProvider) With(o CallOptions) ChatProvider {
+	cp := *p
+	cp.chat = p.chat.With(o).(*OpenAIProvider)
+	cp.chat.chatURL = cp.chatURL(cp.chat.model)
+	return &cp
+}
+
+func (p *AnthropicProvider) With(o CallOptions) ChatProvider {
+	cp := *p
+	o.apply(&cp.model, &cp.cfg)
+	return &cp
+}
+
+func (p *GeminiProvider) With(o CallOptions) ChatProvider {
+	cp := *p
+	o.apply(&cp.model, &cp.cfg)
+	return &cp
+}
+
+func (p *OllamaProvider) With(o CallOptions) ChatProvider {
+	cp := *p
+	o.apply(&cp.model, &cp.cfg)
+	return &cp
+}
+
+func (m MockProvider) With(o CallOptions) ChatProvider {
+	model := m.Model()
+	o.apply(&model, &m.Config)
+	m.ModelName = model
+	return m
+}
+
+var (
+	_ Configurable = (*OpenAIProvider)(nil)
+	_ Configurable = (*AzureOpenAIProvider)(nil)
+	_ Configurable = (*AnthropicProvider)(nil)
+	_ Configurable = (*GeminiProvider)(nil)
+	_ Configurable = (*OllamaProvider)(nil)
+	_ Configurable = MockProvider{}
+)
@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Pinger lo implementan los providers que pueden verificar, sin generar
+// texto, que la API responde y que la credencial y el modelo son válidos.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ping hace un GET a u (sin reintentos: el caller lo repite solo) y
+// devuelve *APIError si el status es >= 400.
+func ping(ctx context.Context, client *http.Client, u, vendor string, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return apiError(resp, vendor)
+	}
+	return nil
+}
+
+// Ping consulta el modelo configurado en /v1/models.
+func (p *OpenAIProvider) Ping(ctx context.Context) error {
+	return ping(ctx, p.client, "https://api.openai.com/v1/models/"+url.PathEscape(p.model), "openai",
+		http.Header{"Authorization": {"Bearer " + p.apiKey}})
+}
+
+// Ping consulta el modelo configurado en /v1/models.
+func (p *AnthropicProvider) Ping(ctx context.Context) error {
+	return ping(ctx, p.client, "https://api.anthropic.com/v1/models/"+url.PathEscape(p.model), "anthropic",
+		http.Header{"X-Api-Key": {p.apiKey}, "Anthropic-Version": {anthropicVersion}})
+}
+
+// Ping consulta el modelo configurado en /v1beta/models.
+func (p *GeminiProvider) Ping(ctx context.Context) error {
+	return ping(ctx, p.client, geminiBaseURL+url.PathEscape(p.model), "gemini",
+		http.Header{"X-Goog-Api-Key": {p.apiKey}})
+}
+
+// Ping verifica que el servidor de Ollama responda.
+func (p *OllamaProvider) Ping(ctx context.Context) error {
+	return ping(ctx, p.client, p.host+"/api/version", "ollama", nil)
+}
@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// modelsServer es un /v1/models que solo conoce los modelos dados.
+func modelsServer(t *testing.T, known ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range known {
+			if r.URL.Path == "/v1/models/"+m {
+				w.Write([]byte(`{"id":"` + m + `","object":"model"}`))
+				return
+			}
+		}
+		w.WriteHeader(404)
+		w.Write([]byte(`{"error":{"message":"The model does not exist or you do not have access to it.","type":"invalid_request_error","code":"model_not_found"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenAIPing(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "k")
+	srv := modelsServer(t, "gpt-4o-mini")
+	for _, tc := range []struct {
+		model   string
+		missing bool
+	}{
+		{"gpt-4o-mini", false},
+		{"gpt-4o-mnii", true},
+	} {
+		p, err := NewOpenAIProvider(tc.model, testConfig(t, srv))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = p.Ping(context.Background())
+		if got := errors.Is(err, ErrModelNotFound); got != tc.missing || (!tc.missing && err != nil) {
+			t.Errorf("%s: err = %v", tc.model, err)
+		}
+	}
+}
+
+func TestAPIErrorModelNotFound(t *testing.T) {
+	for _, tc := range []struct {
+		err  APIError
+		want bool
+	}{
+		{APIError{StatusCode: 404, Code: "model_not_found"}, true},
+		{APIError{StatusCode: 404, Code: "DeploymentNotFound"}, true},
+		{APIError{StatusCode: 400, Code: "model_not_found"}, true},
+		{APIError{StatusCode: 404, Message: "model 'llama9' not found"}, true},
+		{APIError{StatusCode: 404, Message: "not found"}, false},
+		{APIError{StatusCode: 400, Message: "invalid model parameter"}, false},
+		{APIError{StatusCode: 500, Message: "model overloaded"}, false},
+	} {
+		if got := errors.Is(&tc.err, ErrModelNotFound); got != tc.want {
+			t.Errorf("%+v: errors.Is = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestAPIErrorContextLength(t *testing.T) {
+	for _, tc := range []struct {
+		err  APIError
+		want bool
+	}{
+		{APIError{StatusCode: 400, Code: "context_length_exceeded", Message: "This model's maximum context length is 8192 tokens"}, true},
+		{APIError{StatusCode: 400, Message: "prompt is too long: 210000 tokens > 200000 maximum"}, true},
+		{APIError{StatusCode: 400, Message: "The input token count (1200000) exceeds the maximum number of tokens allowed (1048576)."}, true},
+		{APIError{StatusCode: 413, Message: "Request exceeds the context window"}, true},
+		{APIError{StatusCode: 400, Message: "invalid temperature"}, false},
+		// un 5xx que menciona el contexto no es del pedido
+		{APIError{StatusCode: 500, Message: "context length service unavailable"}, false},
+	} {
+		if got := errors.Is(&tc.err, ErrContextLength); got != tc.want {
+			t.Errorf("%+v: errors.Is = %v, want %v", tc.err, got, tc.want)
+		}
+		if errors.Is(&tc.err, ErrModelNotFound) {
+			t.Errorf("%+v: errors.Is(ErrModelNotFound) = true", tc.err)
+		}
+	}
+}
@@ -1,18 +1,92 @@
 package provider
 
-import "github.com/nubank/lola-ia-backend/internal"
+import (
+	"context"
+	"strings"
+	"time"
 
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// DefaultSystemPrompt es el prompt del sistema cuando no se configura otro.
+const DefaultSystemPrompt = "Eres Lola IA, un asistente breve y claro."
+
+// Result es la respuesta de un provider: el texto completo y, si el
+// proveedor lo informa, el consumo de tokens.
+type Result struct {
+	Text  string
+	Usage *internal.Usage
+}
+
+// Los métodos reciben el contexto del request: si el cliente se desconecta
+// la llamada al proveedor se cancela.
 type ChatProvider interface {
 	Model() string
-	Reply(history []internal.Message, userInput string) (string, error)
+	Reply(ctx context.Context, history []internal.Message, userInput string) (Result, error)
+	// ReplyStream envía la respuesta por fragmentos a out a medida que llega
+	// y al final devuelve el Result con el texto ya armado.
+	// No cierra out: eso queda en manos de quien llama.
+	ReplyStream(ctx context.Context, history []internal.Message, userInput string, out chan<- string) (Result, error)
+}
+
+// newUsage arma un Usage calculando el total.
+func newUsage(in, out int) *internal.Usage {
+	return &internal.Usage{InputTokens: in, OutputTokens: out, TotalTokens: in + out}
 }
 
 // Fallback provider (mock) que responde sin API externa.
-type MockProvider struct{}
+type MockProvider struct {
+	Config ProviderConfig
+	// ModelName es lo que informa Model(); vacío = DefaultModel("mock").
+	ModelName string
+	// Responses son respuestas fijas por substring del input; sin
+	// coincidencias se responde con el eco (ver mockText).
+	Responses []MockResponse
+}
+
+func (m MockProvider) Model() string {
+	if m.ModelName == "" {
+		return DefaultModel("mock")
+	}
+	return m.ModelName
+}
 
-func (m MockProvider) Model() string { return "mock-lola-ia" }
+func (m MockProvider) Reply(ctx context.Context, history []internal.Message, userInput string) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	history = withoutInput(history, userInput)
+	text := m.mockText(history, userInput)
+
+	// Uso estimado (~4 bytes por token) para poder probar el reporte de costos
+	in := len(userInput)
+	if !hasSystemTurn(history) {
+		in += len(m.Config.systemPrompt())
+	}
+	for _, h := range history {
+		in += len(h.Content)
+	}
+	return Result{Text: text, Usage: newUsage((in+3)/4, (len(text)+3)/4)}, nil
+}
 
-func (m MockProvider) Reply(history []internal.Message, userInput string) (string, error) {
-	// Respuesta simple para desarrollo offline
-	return "Entendido. (mock) Me pediste: \"" + userInput + "\"", nil
+func (m MockProvider) ReplyStream(ctx context.Context, history []internal.Message, userInput string, out chan<- string) (Result, error) {
+	res, err := m.Reply(ctx, history, userInput)
+	if err != nil {
+		return Result{}, err
+	}
+	// Emitimos palabra por palabra para simular tokens
+	words := strings.SplitAfter(res.Text, " ")
+	for _, w := range words {
+		select {
+		case out <- w:
+		case <-ctx.Done():
+			return Result{}, ctx.Err()
+		}
+		select {
+		case <-time.After(30 * time.Millisecond):
+		case <-ctx.Done():
+			return Result{}, ctx.Err()
+		}
+	}
+	return res, nil
 }
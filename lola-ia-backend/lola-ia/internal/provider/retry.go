@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxRetries   = 3
+	defaultRetryCeiling = 2 * time.Minute
+	retryBaseDelay      = 500 * time.Millisecond
+	retryMaxDelay       = 10 * time.Second
+)
+
+// retryableStatus indica si vale la pena reintentar ante este status HTTP.
+// Los 4xx (salvo 429) fallan de inmediato.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// doWithRetry ejecuta la request construida por newReq, reintentando hasta
+// maxRetries veces ante errores de red o status reintentables, con backoff
+// exponencial + jitter y respetando Retry-After. Devuelve la última respuesta
+// aunque sea un error HTTP para que el caller pueda leer el cuerpo.
+// Todo el ciclo queda acotado por ctx.
+func doWithRetry(ctx context.Context, client *http.Client, maxRetries int, newReq func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newReq(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if attempt >= maxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		wait := backoff(attempt)
+		if resp != nil {
+			if ra, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = ra
+			}
+			// descartamos el cuerpo para reutilizar la conexión
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if dl, ok := ctx.Deadline(); ok && time.Until(dl) < wait {
+			// no alcanza el tiempo para otro intento
+			if resp != nil {
+				return nil, context.DeadlineExceeded
+			}
+			return nil, err
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// backoff devuelve la espera para el intento n (0-based): entre la mitad y el
+// total de base*2^n (jitter), acotada a retryMaxDelay.
+func backoff(n int) time.Duration {
+	d := retryBaseDelay << n
+	if d <= 0 || d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter interpreta el header Retry-After (segundos o fecha HTTP).
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer contesta con statuses en orden (el último se repite) y cuenta
+// las llamadas. Los errores piden Retry-After: 0 para no esperar el backoff.
+func flakyServer(t *testing.T, calls *atomic.Int32, statuses ...int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		if status != 200 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":{"message":"falla"}}`))
+			return
+		}
+		w.Write([]byte(`{"output":[{"type":"message","content":[{"type":"output_text","text":"listo"}]}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newRetryingOpenAI(t *testing.T, srv *httptest.Server, retries int, ceiling time.Duration) *OpenAIProvider {
+	t.Helper()
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_API_STYLE", "")
+	cfg := testConfig(t, srv)
+	cfg.MaxRetries = &retries
+	cfg.RetryCeiling = ceiling
+	p, err := NewOpenAIProvider("m", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestOpenAIRetriesRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	srv := flakyServer(t, &calls, 429, 429, 200)
+	res, err := newRetryingOpenAI(t, srv, 3, 0).Reply(context.Background(), nil, "hola")
+	if err != nil {
+		t.Fatalf("Reply: %v", err)
+	}
+	if res.Text != "listo" {
+		t.Errorf("text = %q", res.Text)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("llamadas = %d, want 3", n)
+	}
+}
+
+func TestOpenAIRetryGivesUp(t *testing.T) {
+	var calls atomic.Int32
+	srv := flakyServer(t, &calls, 503)
+	if _, err := newRetryingOpenAI(t, srv, 2, 0).Reply(context.Background(), nil, "hola"); err == nil {
+		t.Fatal("Reply debería fallar")
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("llamadas = %d, want 3 (1 + 2 reintentos)", n)
+	}
+}
+
+func TestOpenAIClientErrorFailsFast(t *testing.T) {
+	var calls atomic.Int32
+	srv := flakyServer(t, &calls, 400)
+	if _, err := newRetryingOpenAI(t, srv, 3, 0).Reply(context.Background(), nil, "hola"); err == nil {
+		t.Fatal("Reply debería fallar")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("llamadas = %d, want 1", n)
+	}
+}
+
+func TestRetryRespectsCeiling(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	_, err := newRetryingOpenAI(t, srv, 3, 200*time.Millisecond).Reply(context.Background(), nil, "hola")
+	if err == nil {
+		t.Fatal("Reply debería fallar")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("tardó %v: no respetó RetryCeiling", d)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("llamadas = %d, want 1: Retry-After no entra en el tope", n)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	cases := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"pronto", 0, false},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0, true}, // fecha pasada
+	}
+	for _, tc := range cases {
+		got, ok := retryAfter(tc.in)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestBackoffBounds(t *testing.T) {
+	if d := backoff(0); d < retryBaseDelay/2 || d > retryBaseDelay {
+		t.Errorf("backoff(0) = %v, fuera de [%v, %v]", d, retryBaseDelay/2, retryBaseDelay)
+	}
+	// con n grande el corrimiento desborda: igual queda acotado
+	for _, n := range []int{5, 30, 63, 100} {
+		if d := backoff(n); d < retryMaxDelay/2 || d > retryMaxDelay {
+			t.Errorf("backoff(%d) = %v, fuera de [%v, %v]", n, d, retryMaxDelay/2, retryMaxDelay)
+		}
+	}
+}
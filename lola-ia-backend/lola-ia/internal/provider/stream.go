@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// defaultStreamIdleTimeout es cuánto puede pasar sin que llegue nada de un
+// stream si no se configuró <PREFIX>_TIMEOUT.
+const defaultStreamIdleTimeout = 60 * time.Second
+
+// errStreamIdle: el proveedor dejó de mandar fragmentos a mitad del stream.
+var errStreamIdle = errors.New("el proveedor dejó de responder a mitad del stream")
+
+// streamClient es httpClient sin Timeout: http.Client.Timeout incluye la
+// lectura del cuerpo y cortaría a la mitad cualquier respuesta en streaming
+// más larga que él. Los streams se acotan en doStream.
+func (c ProviderConfig) streamClient() *http.Client {
+	client := *c.httpClient(0)
+	client.Timeout = 0
+	return &client
+}
+
+// streamIdleTimeout es el tope entre fragmentos de un stream: cfg.Timeout o
+// defaultStreamIdleTimeout.
+func (c ProviderConfig) streamIdleTimeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return defaultStreamIdleTimeout
+}
+
+// doStream es doWithRetry para una respuesta en streaming. retryCeiling
+// acota solo la espera de la respuesta (reintentos incluidos); desde que
+// llegan los headers el stream puede durar lo que haga falta y se corta
+// únicamente si pasa streamIdleTimeout sin datos (con errStreamIdle).
+// Cerrar el cuerpo libera el contexto.
+func doStream(ctx context.Context, client *http.Client, cfg ProviderConfig, newReq func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	ceiling := time.AfterFunc(cfg.retryCeiling(), func() { cancel(context.DeadlineExceeded) })
+	resp, err := doWithRetry(ctx, client, cfg.maxRetries(), newReq)
+	if !ceiling.Stop() && err == nil {
+		// el tope venció justo cuando llegaba la respuesta
+		resp.Body.Close()
+		err = context.DeadlineExceeded
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	idle := cfg.streamIdleTimeout()
+	resp.Body = &idleBody{
+		ReadCloser: resp.Body,
+		ctx:        ctx,
+		cancel:     cancel,
+		idle:       idle,
+		timer:      time.AfterFunc(idle, func() { cancel(errStreamIdle) }),
+	}
+	return resp, nil
+}
+
+// idleBody cancela el request si pasa idle sin que llegue nada.
+type idleBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	idle   time.Duration
+	timer  *time.Timer
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.idle)
+	}
+	if err != nil && errors.Is(context.Cause(b.ctx), errStreamIdle) {
+		err = errStreamIdle
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	b.cancel(nil)
+	return b.ReadCloser.Close()
+}
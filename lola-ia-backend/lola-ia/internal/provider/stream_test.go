@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStreamingOpenAI(t *testing.T, srv *httptest.Server, timeout time.Duration) *OpenAIProvider {
+	t.Helper()
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_API_STYLE", "")
+	cfg := testConfig(t, srv)
+	cfg.Timeout = timeout
+	// como el cliente propio: Timeout cubre el request entero
+	cfg.HTTPClient.Timeout = timeout
+	p, err := NewOpenAIProvider("m", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestOpenAIStreamOutlivesClientTimeout(t *testing.T) {
+	// 5 fragmentos cada 60ms: más que el Timeout en total, pero nunca
+	// 150ms sin datos
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		send := sseWriter(w)
+		for _, d := range []string{"a", "b", "c", "d", "e"} {
+			time.Sleep(60 * time.Millisecond)
+			send("response.output_text.delta", `{"type":"response.output_text.delta","delta":"`+d+`"}`)
+		}
+		send("response.completed", `{"type":"response.completed","response":{"usage":{"input_tokens":1,"output_tokens":5,"total_tokens":6}}}`)
+	}))
+	defer srv.Close()
+
+	chunks, res, err := collect(t, newStreamingOpenAI(t, srv, 150*time.Millisecond), nil, "hola")
+	if err != nil {
+		t.Fatalf("ReplyStream: %v", err)
+	}
+	if res.Text != "abcde" || strings.Join(chunks, "") != "abcde" {
+		t.Errorf("text = %q, chunks = %q", res.Text, chunks)
+	}
+}
+
+func TestOpenAIStreamIdleTimeout(t *testing.T) {
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		send := sseWriter(w)
+		send("response.output_text.delta", `{"type":"response.output_text.delta","delta":"a"}`)
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer srv.Close()
+	defer close(stop)
+
+	start := time.Now()
+	_, _, err := collect(t, newStreamingOpenAI(t, srv, 100*time.Millisecond), nil, "hola")
+	if !errors.Is(err, errStreamIdle) {
+		t.Fatalf("err = %v, want errStreamIdle", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("tardó %v en cortar", d)
+	}
+}
+
+func TestAnthropicStreamOutlivesClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		send := sseWriter(w)
+		send("message_start", `{"type":"message_start","message":{"usage":{"input_tokens":3}}}`)
+		for _, d := range []string{"a", "b", "c", "d"} {
+			time.Sleep(60 * time.Millisecond)
+			send("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"`+d+`"}}`)
+		}
+		send("message_stop", `{"type":"message_stop"}`)
+	}))
+	defer srv.Close()
+	t.Setenv("ANTHROPIC_API_KEY", "k")
+	cfg := testConfig(t, srv)
+	cfg.Timeout, cfg.HTTPClient.Timeout = 150*time.Millisecond, 150*time.Millisecond
+	p, err := NewAnthropicProvider("m", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, res, err := collect(t, p, nil, "hola")
+	if err != nil || res.Text != "abcd" {
+		t.Fatalf("ReplyStream = %q, %v", res.Text, err)
+	}
+}
+
+func TestStreamClientHasNoTimeout(t *testing.T) {
+	cfg := ProviderConfig{Timeout: time.Second, HTTPClient: &http.Client{Timeout: time.Second}}
+	if c := cfg.streamClient(); c.Timeout != 0 {
+		t.Errorf("streamClient().Timeout = %v, want 0", c.Timeout)
+	}
+	if cfg.HTTPClient.Timeout != time.Second {
+		t.Error("streamClient modificó cfg.HTTPClient")
+	}
+	if c := (ProviderConfig{Timeout: time.Second}).streamClient(); c.Timeout != 0 {
+		t.Errorf("streamClient().Timeout = %v, want 0", c.Timeout)
+	}
+}
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// maxToolRounds acota las idas y vueltas modelo → tool → modelo de una
+// respuesta, por si el modelo se queda pidiendo tools sin contestar.
+const maxToolRounds = 5
+
+// Tool es una función que el modelo puede pedir ejecutar. Parameters es el
+// JSON Schema de los argumentos; Call recibe los argumentos tal como los
+// mandó el modelo y devuelve el resultado como texto (normalmente JSON).
+type Tool interface {
+	Name() string
+	Description() string
+	Parameters() json.RawMessage
+	Call(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// ToolStatus avisa que el modelo pidió ejecutar una tool, antes de que corra.
+type ToolStatus struct {
+	Tool string          `json:"tool"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// String es el texto para mostrar: "ejecutando: count_rows_where {...}".
+func (s ToolStatus) String() string {
+	if len(s.Args) == 0 {
+		return "ejecutando: " + s.Tool
+	}
+	return "ejecutando: " + s.Tool + " " + string(s.Args)
+}
+
+type toolStatusKey struct{}
+
+// WithToolStatus hace que las tools que se ejecuten durante una respuesta
+// pedida con ctx avisen por status antes de correr. El envío espera a que
+// alguien lea el canal (o a que se cancele ctx): status refleja el progreso
+// real de la vuelta de tools.
+func WithToolStatus(ctx context.Context, status chan<- ToolStatus) context.Context {
+	return context.WithValue(ctx, toolStatusKey{}, status)
+}
+
+// notifyTool avisa por el canal de WithToolStatus, si ctx lo tiene.
+func notifyTool(ctx context.Context, name string, args json.RawMessage) {
+	status, ok := ctx.Value(toolStatusKey{}).(chan<- ToolStatus)
+	if !ok {
+		return
+	}
+	select {
+	case status <- ToolStatus{Tool: name, Args: args}:
+	case <-ctx.Done():
+	}
+}
+
+// ToolRegistry guarda las tools disponibles por nombre, en orden de registro.
+type ToolRegistry struct {
+	tools map[string]Tool
+	order []string
+}
+
+// NewToolRegistry crea un registry con tools.
+func NewToolRegistry(tools ...Tool) *ToolRegistry {
+	r := &ToolRegistry{tools: make(map[string]Tool)}
+	for _, t := range tools {
+		r.Register(t)
+	}
+	return r
+}
+
+// Register agrega t; una tool con el mismo nombre reemplaza a la anterior.
+func (r *ToolRegistry) Register(t Tool) {
+	if _, ok := r.tools[t.Name()]; !ok {
+		r.order = append(r.order, t.Name())
+	}
+	r.tools[t.Name()] = t
+}
+
+// List devuelve las tools en orden de registro.
+func (r *ToolRegistry) List() []Tool {
+	if r == nil {
+		return nil
+	}
+	out := make([]Tool, len(r.order))
+	for i, name := range r.order {
+		out[i] = r.tools[name]
+	}
+	return out
+}
+
+// call ejecuta la tool name. Los errores (tool desconocida, argumentos
+// inválidos) se devuelven como resultado para que el modelo pueda corregirse
+// en vez de cortar la respuesta.
+func (r *ToolRegistry) call(ctx context.Context, name string, args json.RawMessage) string {
+	notifyTool(ctx, name, args)
+	t, ok := r.tools[name]
+	if !ok {
+		b, _ := json.Marshal(map[string]string{"error": "tool desconocida: " + name})
+		return string(b)
+	}
+	out, err := t.Call(ctx, args)
+	if err != nil {
+		fmt.Printf("[provider] tool %s: %v\n", name, err)
+		b, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return string(b)
+	}
+	fmt.Printf("[provider] tool %s ejecutada\n", name)
+	return out
+}
+
+// addUsage suma el consumo de las varias vueltas de una respuesta con tools.
+func addUsage(a, b *internal.Usage) *internal.Usage {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return &internal.Usage{
+		InputTokens:  a.InputTokens + b.InputTokens,
+		OutputTokens: a.OutputTokens + b.OutputTokens,
+		TotalTokens:  a.TotalTokens + b.TotalTokens,
+	}
+}
+
+// ToolCaller lo implementan los providers que soportan tool calling.
+type ToolCaller interface {
+	SetTools(r *ToolRegistry)
+}
+
+func (p *OpenAIProvider) SetTools(r *ToolRegistry) { p.tools = r }
+
+func (p *AzureOpenAIProvider) SetTools(r *ToolRegistry) { p.chat.SetTools(r) }
+
+var (
+	_ ToolCaller = (*OpenAIProvider)(nil)
+	_ ToolCaller = (*AzureOpenAIProvider)(nil)
+)
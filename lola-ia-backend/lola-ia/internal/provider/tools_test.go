@@ -0,0 +1,159 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sumTool suma a y b; con a negativo falla.
+type sumTool struct{ calls *int }
+
+func (sumTool) Name() string        { return "sum" }
+func (sumTool) Description() string { return "Suma dos números" }
+func (sumTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{"type":"object","properties":{"a":{"type":"number"},"b":{"type":"number"}}}`)
+}
+
+func (t sumTool) Call(_ context.Context, args json.RawMessage) (string, error) {
+	*t.calls++
+	var in struct{ A, B int }
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.A < 0 {
+		return "", errors.New("a negativo")
+	}
+	b, _ := json.Marshal(map[string]int{"sum": in.A + in.B})
+	return string(b), nil
+}
+
+// toolServer responde con una llamada a tool por cada elemento de calls
+// (en vueltas sucesivas) y después con la respuesta final. Guarda los
+// payloads recibidos en got.
+func toolServer(t *testing.T, got *[]openAIPayload, calls ...string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p openAIPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		*got = append(*got, p)
+		usage := `"usage":{"input_tokens":10,"output_tokens":2,"total_tokens":12}`
+		if n := len(*got); n <= len(calls) {
+			w.Write([]byte(`{"output":[{"type":"function_call","call_id":"c` + strconv.Itoa(n) + `","name":"` + calls[n-1] + `","arguments":"{\"a\":2,\"b\":3}"}],` + usage + `}`))
+			return
+		}
+		w.Write([]byte(`{"output":[{"type":"message","content":[{"type":"output_text","text":"son 5"}]}],` + usage + `}`))
+	}))
+}
+
+func newToolOpenAI(t *testing.T, srv *httptest.Server, tools ...Tool) *OpenAIProvider {
+	t.Helper()
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_API_STYLE", "")
+	p, err := NewOpenAIProvider("m", testConfig(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetTools(NewToolRegistry(tools...))
+	return p
+}
+
+func TestOpenAIToolCall(t *testing.T) {
+	var got []openAIPayload
+	srv := toolServer(t, &got, "sum")
+	defer srv.Close()
+	var calls int
+	p := newToolOpenAI(t, srv, sumTool{&calls})
+
+	res, err := p.Reply(context.Background(), nil, "¿cuánto es 2+3?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Text != "son 5" || calls != 1 || len(got) != 2 {
+		t.Fatalf("text = %q, %d llamadas a la tool, %d requests", res.Text, calls, len(got))
+	}
+	if len(got[0].Tools) != 1 || got[0].Tools[0].Name != "sum" || got[0].Tools[0].Type != "function" {
+		t.Errorf("tools = %+v", got[0].Tools)
+	}
+	// la segunda vuelta lleva la llamada y su resultado
+	in := got[1].Input
+	call, out := in[len(in)-2], in[len(in)-1]
+	if call.Type != "function_call" || call.CallID != "c1" || out.Type != "function_call_output" || out.CallID != "c1" || out.Output != `{"sum":5}` {
+		t.Errorf("input = %+v", in[len(in)-2:])
+	}
+	if res.Usage == nil || res.Usage.TotalTokens != 24 {
+		t.Errorf("usage = %+v, want la suma de las dos vueltas", res.Usage)
+	}
+}
+
+func TestOpenAIToolErrors(t *testing.T) {
+	// una tool desconocida vuelve al modelo como error, no corta la respuesta
+	var got []openAIPayload
+	srv := toolServer(t, &got, "resta")
+	defer srv.Close()
+	var calls int
+	res, err := newToolOpenAI(t, srv, sumTool{&calls}).Reply(context.Background(), nil, "hola")
+	if err != nil || res.Text != "son 5" {
+		t.Fatalf("Reply = %q, %v", res.Text, err)
+	}
+	if out := got[1].Input[len(got[1].Input)-1].Output; !strings.Contains(out, "tool desconocida: resta") {
+		t.Errorf("output = %q", out)
+	}
+
+	// sin respuesta después de maxToolRounds vueltas
+	got = nil
+	loop := make([]string, maxToolRounds+1)
+	for i := range loop {
+		loop[i] = "sum"
+	}
+	srv2 := toolServer(t, &got, loop...)
+	defer srv2.Close()
+	if _, err := newToolOpenAI(t, srv2, sumTool{&calls}).Reply(context.Background(), nil, "hola"); err == nil {
+		t.Error("Reply no falló con demasiadas vueltas de tools")
+	}
+}
+
+func TestToolStatus(t *testing.T) {
+	var got []openAIPayload
+	srv := toolServer(t, &got, "sum", "resta")
+	defer srv.Close()
+	var calls int
+	p := newToolOpenAI(t, srv, sumTool{&calls})
+
+	// el canal sin buffer: cada tool espera a que se lea su aviso
+	status := make(chan ToolStatus)
+	var seen []ToolStatus
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for s := range status {
+			seen = append(seen, s)
+		}
+	}()
+	res, err := p.Reply(WithToolStatus(context.Background(), status), nil, "¿cuánto es 2+3?")
+	close(status)
+	<-done
+	if err != nil || res.Text != "son 5" {
+		t.Fatalf("Reply = %q, %v", res.Text, err)
+	}
+	// también las desconocidas: el modelo las pidió
+	if len(seen) != 2 || seen[0].Tool != "sum" || seen[1].Tool != "resta" {
+		t.Fatalf("status = %+v", seen)
+	}
+	if s := seen[0].String(); s != `ejecutando: sum {"a":2,"b":3}` {
+		t.Errorf("String() = %q", s)
+	}
+	if s := (ToolStatus{Tool: "sum"}).String(); s != "ejecutando: sum" {
+		t.Errorf("String() sin args = %q", s)
+	}
+
+	// con el contexto cancelado el aviso no bloquea
+	ctx, cancel := context.WithCancel(WithToolStatus(context.Background(), make(chan ToolStatus)))
+	cancel()
+	notifyTool(ctx, "sum", nil)
+}
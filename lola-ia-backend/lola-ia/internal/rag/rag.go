@@ -0,0 +1,110 @@
+// Package rag parte los CSV cargados en fragmentos de filas y los ordena por
+// similitud de embeddings con la consulta del usuario.
+package rag
+
+import (
+	"encoding/csv"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// maxChunkBytes acota el texto de un fragmento (filas muy anchas) para no
+// pasarse del límite de entrada del modelo de embeddings.
+const maxChunkBytes = 16000
+
+// Chunk es un grupo de filas consecutivas de un archivo, con su embedding.
+// FromRow y ToRow son 1-based e inclusivos (sin contar el encabezado).
+type Chunk struct {
+	File    string
+	FromRow int
+	ToRow   int
+	Text    string
+	Vector  []float32
+}
+
+// ChunkFile parte las filas de f en grupos de rowsPerChunk. Cada fragmento
+// repite el encabezado para que tenga sentido por sí solo. Devuelve nil si
+// f no se pudo parsear.
+func ChunkFile(f internal.KnowledgeFile, rowsPerChunk int) []Chunk {
+	if f.Parsed == nil || rowsPerChunk <= 0 {
+		return nil
+	}
+	rows := f.Parsed.Rows
+	chunks := make([]Chunk, 0, (len(rows)+rowsPerChunk-1)/rowsPerChunk)
+	for from := 0; from < len(rows); from += rowsPerChunk {
+		to := min(from+rowsPerChunk, len(rows))
+		chunks = append(chunks, Chunk{
+			File:    f.Name,
+			FromRow: from + 1,
+			ToRow:   to,
+			Text:    csvText(f.Parsed.Headers, rows[from:to]),
+		})
+	}
+	return chunks
+}
+
+func csvText(headers []string, rows [][]string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(headers)
+	w.WriteAll(rows) // WriteAll hace Flush
+	s := b.String()
+	if len(s) > maxChunkBytes {
+		cut := maxChunkBytes
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut]
+	}
+	return s
+}
+
+// Cosine devuelve la similitud coseno entre a y b, o 0 si tienen distinto
+// largo o alguno es el vector nulo.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// TopK devuelve los k fragmentos más parecidos a query, del más al menos
+// similar. Los fragmentos sin vector o con similitud menor a minScore se
+// ignoran (minScore <= 0: sin mínimo).
+func TopK(query []float32, chunks []Chunk, k int, minScore float64) []Chunk {
+	type scored struct {
+		c     Chunk
+		score float64
+	}
+	all := make([]scored, 0, len(chunks))
+	for _, c := range chunks {
+		if len(c.Vector) == 0 {
+			continue
+		}
+		score := Cosine(query, c.Vector)
+		if minScore > 0 && score < minScore {
+			continue
+		}
+		all = append(all, scored{c, score})
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].score > all[j].score })
+	out := make([]Chunk, 0, min(k, len(all)))
+	for _, s := range all[:min(k, len(all))] {
+		out = append(out, s.c)
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package rag
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestCosine(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"iguales", []float32{1, 2, 3}, []float32{1, 2, 3}, 1},
+		{"misma dirección", []float32{1, 2, 3}, []float32{2, 4, 6}, 1},
+		{"ortogonales", []float32{1, 0}, []float32{0, 1}, 0},
+		{"opuestos", []float32{1, -1}, []float32{-1, 1}, -1},
+		{"45 grados", []float32{1, 0}, []float32{1, 1}, 1 / math.Sqrt2},
+		{"vector nulo", []float32{0, 0}, []float32{1, 1}, 0},
+		{"distinto largo", []float32{1, 2}, []float32{1, 2, 3}, 0},
+		{"vacíos", nil, nil, 0},
+	}
+	for _, tc := range cases {
+		if got := Cosine(tc.a, tc.b); math.Abs(got-tc.want) > 1e-6 {
+			t.Errorf("%s: Cosine = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTopK(t *testing.T) {
+	chunks := []Chunk{
+		{File: "lejos", Vector: []float32{0, 1}},
+		{File: "cerca", Vector: []float32{1, 0.1}},
+		{File: "sin vector"},
+		{File: "medio", Vector: []float32{1, 1}},
+	}
+	q := []float32{1, 0}
+	names := func(cs []Chunk) string {
+		var out []string
+		for _, c := range cs {
+			out = append(out, c.File)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := names(TopK(q, chunks, 2, 0)); got != "cerca,medio" {
+		t.Errorf("TopK k=2 = %s", got)
+	}
+	if got := names(TopK(q, chunks, 10, 0)); got != "cerca,medio,lejos" {
+		t.Errorf("TopK k=10 = %s", got)
+	}
+	if got := names(TopK(q, chunks, 10, 0.8)); got != "cerca" {
+		t.Errorf("TopK minScore=0.8 = %s", got)
+	}
+	if got := TopK(q, nil, 3, 0); len(got) != 0 {
+		t.Errorf("sin fragmentos: %v", got)
+	}
+}
+
+func TestChunkFile(t *testing.T) {
+	f := internal.KnowledgeFile{Name: "a.csv", Parsed: &internal.Table{
+		Headers: []string{"id", "txt"},
+		Rows:    [][]string{{"1", "a"}, {"2", "b, c"}, {"3", "d"}},
+	}}
+	chunks := ChunkFile(f, 2)
+	if len(chunks) != 2 {
+		t.Fatalf("%d fragmentos, want 2", len(chunks))
+	}
+	if c := chunks[0]; c.FromRow != 1 || c.ToRow != 2 || c.Text != "id,txt\n1,a\n2,\"b, c\"\n" {
+		t.Errorf("fragmento 0 = %+v", c)
+	}
+	// cada fragmento repite el encabezado
+	if c := chunks[1]; c.FromRow != 3 || c.ToRow != 3 || c.Text != "id,txt\n3,d\n" {
+		t.Errorf("fragmento 1 = %+v", c)
+	}
+	if ChunkFile(internal.KnowledgeFile{Name: "roto.csv"}, 2) != nil {
+		t.Error("un archivo sin parsear no debería dar fragmentos")
+	}
+}
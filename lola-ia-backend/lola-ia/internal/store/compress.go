@@ -0,0 +1,80 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+// compressMinBytes es el tamaño desde el cual MemoryStore guarda el texto de
+// un archivo comprimido. Los CSV son muy repetitivos y gzip suele reducirlos
+// 5-10x; por debajo de esto no compensa descomprimir en cada lectura.
+const compressMinBytes = 64 << 10
+
+// storedFile es un archivo tal como lo guarda MemoryStore. Los grandes
+// quedan en gz, sin Text ni Parsed, y se reconstruyen en file().
+type storedFile struct {
+	internal.KnowledgeFile
+	gz []byte
+}
+
+// newStoredFile anota f con opts y, si es grande, lo comprime. Si gzip
+// falla se guarda tal cual.
+func newStoredFile(f internal.KnowledgeFile, opts tabular.AnnotateOptions) storedFile {
+	tabular.Annotate(&f, opts)
+	if len(f.Text) < compressMinBytes {
+		return storedFile{KnowledgeFile: f}
+	}
+	gz, err := compressText(f.Text)
+	if err != nil {
+		return storedFile{KnowledgeFile: f}
+	}
+	f.Text, f.Parsed = "", nil
+	return storedFile{KnowledgeFile: f, gz: gz}
+}
+
+// file devuelve el archivo completo, descomprimiendo y volviendo a parsear
+// el texto con opts si estaba comprimido.
+func (sf storedFile) file(opts tabular.AnnotateOptions) internal.KnowledgeFile {
+	f := sf.KnowledgeFile
+	if sf.gz == nil {
+		return f
+	}
+	text, err := decompressText(sf.gz)
+	if err != nil {
+		f.ParseError = "no se pudo descomprimir: " + err.Error()
+		return f
+	}
+	f.Text = text
+	tabular.Annotate(&f, opts)
+	return f
+}
+
+func compressText(s string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, s); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressText(b []byte) (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	var sb strings.Builder
+	if _, err := io.Copy(&sb, zr); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
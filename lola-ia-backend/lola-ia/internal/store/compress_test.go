@@ -0,0 +1,83 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+// surveyCSV arma un CSV de encuestas de unos n bytes, repetitivo como los
+// reales.
+func surveyCSV(n int) string {
+	var sb strings.Builder
+	sb.WriteString("id,canal,nps,comentario\n")
+	for i := 0; sb.Len() < n; i++ {
+		fmt.Fprintf(&sb, "%d,%s,%d,\"la app anda lenta, \"\"tarda\"\" en cargar ñ\"\n", i, []string{"app", "chat", "encuesta"}[i%3], i%11)
+	}
+	return sb.String()
+}
+
+func TestStoredFileRoundTrip(t *testing.T) {
+	for _, n := range []int{100, compressMinBytes - 1, compressMinBytes, 1 << 20} {
+		text := surveyCSV(n)
+		f := internal.KnowledgeFile{Name: "nps.csv", Text: text, Size: len(text), Tags: []string{"nps"}}
+		sf := newStoredFile(f, tabular.AnnotateOptions{})
+		if compressed := sf.gz != nil; compressed != (len(text) >= compressMinBytes) {
+			t.Errorf("%d bytes: comprimido = %v", len(text), compressed)
+		}
+		if sf.gz != nil && (sf.Text != "" || sf.Parsed != nil) {
+			t.Errorf("%d bytes: comprimido pero guarda el texto", len(text))
+		}
+		if sf.Size != len(text) {
+			t.Errorf("%d bytes: Size = %d", len(text), sf.Size)
+		}
+
+		// el mismo archivo anotado sin comprimir
+		want := f
+		tabular.Annotate(&want, tabular.AnnotateOptions{})
+		if got := sf.file(tabular.AnnotateOptions{}); !reflect.DeepEqual(got, want) {
+			t.Errorf("%d bytes: el archivo no sobrevivió la compresión", len(text))
+		}
+	}
+}
+
+func TestMemoryStoreCompressedFiles(t *testing.T) {
+	s := NewMemoryStore()
+	text := surveyCSV(1 << 20)
+	if _, err := s.AddFiles([]internal.KnowledgeFile{{Name: "grande.csv", Text: text, Size: len(text)}}); err != nil {
+		t.Fatal(err)
+	}
+	if gz := s.knowledge[0].gz; gz == nil || len(gz) > len(text)/5 {
+		t.Errorf("comprimido: %d de %d bytes", len(gz), len(text))
+	}
+	f, ok := s.GetFile("grande.csv")
+	if !ok || f.Text != text || f.Size != len(text) || f.Parsed == nil || len(f.Parsed.Rows) == 0 {
+		t.Errorf("GetFile: ok = %v, %d bytes, Size %d", ok, len(f.Text), f.Size)
+	}
+	if files := s.ListFiles(); len(files) != 1 || files[0].Text != text {
+		t.Error("ListFiles no devolvió el texto original")
+	}
+}
+
+func BenchmarkStoredFile(b *testing.B) {
+	text := surveyCSV(4 << 20)
+	f := internal.KnowledgeFile{Name: "nps.csv", Text: text, Size: len(text)}
+	var sf storedFile
+	b.Run("compress", func(b *testing.B) {
+		b.SetBytes(int64(len(text)))
+		for i := 0; i < b.N; i++ {
+			sf = newStoredFile(f, tabular.AnnotateOptions{})
+		}
+		b.ReportMetric(float64(len(text))/float64(len(sf.gz)), "ratio")
+	})
+	b.Run("file", func(b *testing.B) {
+		b.SetBytes(int64(len(text)))
+		for i := 0; i < b.N; i++ {
+			sf.file(tabular.AnnotateOptions{})
+		}
+	})
+}
@@ -0,0 +1,24 @@
+package store
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxTitleRunes es el largo máximo del título automático.
+const maxTitleRunes = 60
+
+// autoTitle arma el título de una conversación con su primer mensaje del
+// usuario: una sola línea, cortada en un límite de palabra si es larga.
+func autoTitle(firstUserMessage string) string {
+	t := strings.Join(strings.Fields(firstUserMessage), " ")
+	if utf8.RuneCountInString(t) <= maxTitleRunes {
+		return t
+	}
+	r := []rune(t)[:maxTitleRunes]
+	cut := string(r)
+	if i := strings.LastIndexByte(cut, ' '); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " .,;:") + "…"
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestAutoTitle(t *testing.T) {
+	long := "¿Cuáles son los principales motivos de queja de los clientes de tarjeta de crédito en el último trimestre?"
+	cases := []struct{ in, want string }{
+		{"¿Qué opinan de la app?", "¿Qué opinan de la app?"},
+		{"  varias\nlíneas\t y   espacios ", "varias líneas y espacios"},
+		{long, "¿Cuáles son los principales motivos de queja de los…"},
+		{strings.Repeat("ñ", 100), strings.Repeat("ñ", maxTitleRunes) + "…"}, // sin espacios: se corta en la runa
+	}
+	for _, tc := range cases {
+		got := autoTitle(tc.in)
+		if got != tc.want {
+			t.Errorf("autoTitle(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+		if !utf8.ValidString(got) || utf8.RuneCountInString(got) > maxTitleRunes+1 {
+			t.Errorf("autoTitle(%q) = %q: largo o UTF-8 inválido", tc.in, got)
+		}
+	}
+}
+
+func TestConversationTitles(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		title := func(id string) (internal.Conversation, bool) {
+			for _, c := range s.Conversations("") {
+				if c.ID == id {
+					return c, true
+				}
+			}
+			return internal.Conversation{}, false
+		}
+		s.TouchSession("s1")
+		s.AppendForSession("s1", internal.Message{Role: internal.RoleAssistant, Content: "¡Hola!", CreatedAt: at(0)})
+		if _, ok := title("s1"); ok {
+			t.Error("solo con el saludo no aparece en la lista")
+		}
+
+		s.AppendForSession("s1", internal.Message{Role: internal.RoleUser, Content: "ventas de mayo", CreatedAt: at(1)})
+		s.AppendForSession("s1", internal.Message{Role: internal.RoleUser, Content: "y de junio", CreatedAt: at(2)})
+		if c, ok := title("s1"); !ok || c.Title != "ventas de mayo" || c.CustomTitle || c.Messages != 3 {
+			t.Errorf("título automático: %+v", c)
+		}
+
+		if !s.SetTitle("s1", "Reporte Q2") {
+			t.Fatal("SetTitle = false")
+		}
+		s.AppendForSession("s1", internal.Message{Role: internal.RoleUser, Content: "otra", CreatedAt: at(3)})
+		if c, _ := title("s1"); c.Title != "Reporte Q2" || !c.CustomTitle {
+			t.Errorf("el título propio no se mantuvo: %+v", c)
+		}
+		// vacío vuelve al automático
+		s.SetTitle("s1", "")
+		if c, _ := title("s1"); c.Title != "ventas de mayo" || c.CustomTitle {
+			t.Errorf("sin título propio: %+v", c)
+		}
+		if s.SetTitle("no-existe", "x") {
+			t.Error("SetTitle de una sesión inexistente")
+		}
+	})
+}
+
+func TestArchiveSession(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		s.TouchSession("k1:s1")
+		s.AppendForSession("k1:s1", internal.Message{Role: internal.RoleAssistant, Content: "¡Hola!", CreatedAt: at(0)})
+		if _, ok := s.ArchiveSession("k1:s1", "k1:a0"); ok {
+			t.Error("solo con el saludo no hay nada que archivar")
+		}
+
+		s.AppendForSession("k1:s1", internal.Message{Role: internal.RoleUser, Content: "ventas de mayo", CreatedAt: at(1)})
+		a, ok := s.ArchiveSession("k1:s1", "k1:a1")
+		if !ok || a.ID != "k1:a1" || a.Title != "ventas de mayo" || a.Messages != 2 || a.ArchivedAt.IsZero() {
+			t.Fatalf("ArchiveSession = %+v, %v", a, ok)
+		}
+		if msgs := s.AllForSession("k1:s1"); len(msgs) != 0 {
+			t.Errorf("la sesión no quedó vacía: %v", contents(msgs))
+		}
+		conv, msgs, ok := s.ArchivedMessages("k1:a1")
+		if !ok || conv.ID != "k1:a1" || !slices.Equal(contents(msgs), []string{"¡Hola!", "ventas de mayo"}) {
+			t.Errorf("ArchivedMessages = %+v, %v, %v", conv, contents(msgs), ok)
+		}
+
+		// la sesión sigue y se puede volver a archivar
+		s.AppendForSession("k1:s1", internal.Message{Role: internal.RoleUser, Content: "y de junio", CreatedAt: at(2)})
+		s.ArchiveSession("k1:s1", "k1:a2")
+		s.TouchSession("k2:s1")
+		s.AppendForSession("k2:s1", internal.Message{Role: internal.RoleUser, Content: "otra key", CreatedAt: at(3)})
+		s.ArchiveSession("k2:s1", "k2:a1")
+
+		var ids []string
+		for _, a := range s.ArchivedConversations("k1:") {
+			ids = append(ids, a.ID)
+		}
+		if len(ids) != 2 || !slices.Contains(ids, "k1:a1") || !slices.Contains(ids, "k1:a2") {
+			t.Errorf("archivadas de k1 = %v", ids)
+		}
+
+		if !s.DeleteArchived("k1:a1") || s.DeleteArchived("k1:a1") {
+			t.Error("DeleteArchived no borra una sola vez")
+		}
+		if _, _, ok := s.ArchivedMessages("k1:a1"); ok {
+			t.Error("la archivada borrada sigue")
+		}
+		if len(s.ArchivedConversations("")) != 2 {
+			t.Errorf("quedan %d archivadas, want 2", len(s.ArchivedConversations("")))
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// ByteLimits acota el tamaño de la knowledge base que ve cada sesión: sus
+// archivos propios más los compartidos (ver FileScope). Cero significa sin
+// límite.
+type ByteLimits struct {
+	MaxFileBytes  int
+	MaxTotalBytes int
+}
+
+// LimitError indica qué archivo hizo que se superara un límite de ByteLimits.
+type LimitError struct {
+	File  string
+	Size  int
+	Limit int
+	// Total es true si se superó el total acumulado y no el de un archivo.
+	Total bool
+}
+
+func (e *LimitError) Error() string {
+	if e.Total {
+		return fmt.Sprintf("%s excede el total permitido de %d bytes (quedaría en %d)", e.File, e.Limit, e.Size)
+	}
+	return fmt.Sprintf("%s pesa %d bytes y el máximo por archivo es %d", e.File, e.Size, e.Limit)
+}
+
+// check valida incoming contra los límites, teniendo en cuenta que un
+// archivo con el mismo nombre que uno existente lo reemplaza. De existing
+// (todo el Store) solo cuenta lo que ve el scope de incoming.
+func (l ByteLimits) check(existing, incoming []internal.KnowledgeFile) error {
+	if len(incoming) == 0 {
+		return nil
+	}
+	prefix := scopePrefix(incoming[0].Name)
+	sizes := make(map[string]int, len(existing)+len(incoming))
+	total := 0
+	for _, f := range visibleIn(existing, prefix) {
+		sizes[f.Name] = f.Size
+		total += f.Size
+	}
+	for _, f := range incoming {
+		if l.MaxFileBytes > 0 && f.Size > l.MaxFileBytes {
+			return &LimitError{File: f.Name, Size: f.Size, Limit: l.MaxFileBytes}
+		}
+		name := strings.TrimPrefix(f.Name, prefix)
+		total += f.Size - sizes[name]
+		sizes[name] = f.Size
+		if l.MaxTotalBytes > 0 && total > l.MaxTotalBytes {
+			return &LimitError{File: f.Name, Size: total, Limit: l.MaxTotalBytes, Total: true}
+		}
+	}
+	return nil
+}
+
+// scopePrefix es el prefijo de sesión de name (tal como está en el Store),
+// o vacío si es un archivo compartido.
+func scopePrefix(name string) string {
+	if !isSessionFile(name) {
+		return ""
+	}
+	return name[:strings.IndexByte(name, '/')+1]
+}
+
+// visibleIn deja de files (todo el Store) los que ve el scope de prefix,
+// con el nombre sin prefijo: los propios y los compartidos que no tapa uno
+// propio, como FileScope.ListFiles; con prefix vacío, solo los
+// compartidos. Así una sesión no gasta el cupo de las demás.
+func visibleIn(files []internal.KnowledgeFile, prefix string) []internal.KnowledgeFile {
+	own := make(map[string]bool)
+	for _, f := range files {
+		if prefix != "" && strings.HasPrefix(f.Name, prefix) {
+			own[f.Name[len(prefix):]] = true
+		}
+	}
+	var out []internal.KnowledgeFile
+	for _, f := range files {
+		switch {
+		case prefix != "" && strings.HasPrefix(f.Name, prefix):
+			f.Name = f.Name[len(prefix):]
+			out = append(out, f)
+		case !isSessionFile(f.Name) && !own[f.Name]:
+			out = append(out, f)
+		}
+	}
+	return out
+}
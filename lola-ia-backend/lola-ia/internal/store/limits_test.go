@@ -0,0 +1,95 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func sized(name string, n int) internal.KnowledgeFile {
+	text := "a\n" + strings.Repeat("x\n", (n-2)/2)
+	return internal.KnowledgeFile{Name: name, Text: text, Size: len(text)}
+}
+
+func TestAddFilesFileLimit(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		s.SetByteLimits(ByteLimits{MaxFileBytes: 100})
+		if _, err := s.AddFiles([]internal.KnowledgeFile{sized("chico.csv", 100)}); err != nil {
+			t.Fatalf("al límite: %v", err)
+		}
+		_, err := s.AddFiles([]internal.KnowledgeFile{sized("otro.csv", 10), sized("grande.csv", 200)})
+		var le *LimitError
+		if !errors.As(err, &le) || le.File != "grande.csv" || le.Total || le.Limit != 100 {
+			t.Fatalf("err = %v", err)
+		}
+		// no se agrega ninguno del lote
+		if n := s.FileCount(); n != 1 {
+			t.Errorf("%d archivos, want 1", n)
+		}
+	})
+}
+
+func TestAddFilesTotalLimit(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		s.SetByteLimits(ByteLimits{MaxTotalBytes: 250})
+		if _, err := s.AddFiles([]internal.KnowledgeFile{sized("a.csv", 100), sized("b.csv", 100)}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := s.AddFiles([]internal.KnowledgeFile{sized("c.csv", 100)})
+		var le *LimitError
+		if !errors.As(err, &le) || le.File != "c.csv" || !le.Total || le.Size != 300 {
+			t.Fatalf("acumulado: err = %v", err)
+		}
+		// reemplazar uno por otro del mismo tamaño no suma
+		if _, err := s.AddFiles([]internal.KnowledgeFile{sized("a.csv", 100)}); err != nil {
+			t.Errorf("reemplazo: %v", err)
+		}
+		if n := s.FileCount(); n != 2 {
+			t.Errorf("%d archivos, want 2", n)
+		}
+	})
+}
+
+func TestSessionFilesLimitErrorName(t *testing.T) {
+	s := NewMemoryStore()
+	s.SetByteLimits(ByteLimits{MaxFileBytes: 10})
+	_, err := SessionFiles(s, "s1").AddFiles([]internal.KnowledgeFile{sized("grande.csv", 50)})
+	var le *LimitError
+	// el error nombra el archivo como lo ve la sesión, sin el prefijo
+	if !errors.As(err, &le) || le.File != "grande.csv" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// Los límites son por sesión: una que llena su cupo no bloquea a las demás.
+// Los compartidos cuentan para todas.
+func TestSessionFilesTotalLimit(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		s.SetByteLimits(ByteLimits{MaxTotalBytes: 250})
+		if _, err := SharedFiles(s).AddFiles([]internal.KnowledgeFile{sized("seed.csv", 50)}); err != nil {
+			t.Fatal(err)
+		}
+		a, b := SessionFiles(s, "sesion-a"), SessionFiles(s, "sesion-b")
+		if _, err := a.AddFiles([]internal.KnowledgeFile{sized("a1.csv", 100), sized("a2.csv", 100)}); err != nil {
+			t.Fatalf("A: %v", err)
+		}
+		_, err := a.AddFiles([]internal.KnowledgeFile{sized("a3.csv", 100)})
+		var le *LimitError
+		if !errors.As(err, &le) || le.File != "a3.csv" || le.Size != 350 {
+			t.Fatalf("A sobre el cupo: err = %v", err)
+		}
+		if _, err := b.AddFiles([]internal.KnowledgeFile{sized("b1.csv", 100), sized("b2.csv", 100)}); err != nil {
+			t.Errorf("B con A llena: %v", err)
+		}
+		// un propio que tapa al compartido lo reemplaza en la cuenta
+		if _, err := b.AddFiles([]internal.KnowledgeFile{sized("seed.csv", 50)}); err != nil {
+			t.Errorf("B tapando el compartido: %v", err)
+		}
+		// el espacio compartido no cuenta los archivos de las sesiones
+		if _, err := SharedFiles(s).AddFiles([]internal.KnowledgeFile{sized("otro.csv", 200)}); err != nil {
+			t.Errorf("compartido: %v", err)
+		}
+	})
+}
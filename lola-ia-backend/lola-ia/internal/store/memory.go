@@ -1,75 +1,549 @@
 package store
 
 import (
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/rag"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
 )
 
+type session struct {
+	messages []internal.Message
+	lastSeen time.Time
+	created  time.Time
+	updated  time.Time // último mensaje agregado
+	title    string    // título propio; vacío = automático
+}
+
 type MemoryStore struct {
 	mu        sync.Mutex
-	messages  []internal.Message
-	knowledge []internal.KnowledgeFile
+	sessions  map[string]*session
+	knowledge []storedFile // los grandes van comprimidos (ver storedFile)
+	limits    ByteLimits
+	annotate  tabular.AnnotateOptions
+	// chunks son los fragmentos con embeddings de cada archivo (ver SetChunks)
+	chunks map[string][]rag.Chunk
+	undo   undoStacks
+	// archived son las conversaciones archivadas por ArchiveSession; no
+	// vencen con EvictIdle
+	archived map[string]*archivedSession
+	// usage es el consumo por sesión; sobrevive al reset y a EvictIdle
+	usage map[string]*internal.SessionUsage
+}
+
+type archivedSession struct {
+	conv     internal.ArchivedConversation
+	messages []internal.Message
 }
 
 func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{messages: make([]internal.Message, 0, 64)}
+	return &MemoryStore{
+		sessions: make(map[string]*session),
+		chunks:   make(map[string][]rag.Chunk),
+		archived: make(map[string]*archivedSession),
+		usage:    make(map[string]*internal.SessionUsage),
+	}
+}
+
+// get devuelve la sesión id, creándola si no existe. Requiere s.mu tomado.
+func (s *MemoryStore) get(id string) (*session, bool) {
+	sess, ok := s.sessions[id]
+	if !ok {
+		sess = &session{messages: make([]internal.Message, 0, 64), created: time.Now()}
+		s.sessions[id] = sess
+	}
+	sess.lastSeen = time.Now()
+	return sess, !ok
+}
+
+func (s *MemoryStore) TouchSession(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, created := s.get(id)
+	return created
+}
+
+func (s *MemoryStore) SessionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+func (s *MemoryStore) Sessions(prefix string) []internal.SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]internal.SessionInfo, 0)
+	for id, sess := range s.sessions {
+		if strings.HasPrefix(id, prefix) {
+			out = append(out, internal.SessionInfo{
+				ID:           id,
+				Messages:     len(sess.messages),
+				CreatedAt:    sess.created,
+				LastActivity: sess.lastSeen,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].LastActivity.Equal(out[j].LastActivity) {
+			return out[i].LastActivity.After(out[j].LastActivity)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
 }
 
-func (s *MemoryStore) All() []internal.Message {
+func (s *MemoryStore) DeleteSession(id string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	cp := make([]internal.Message, len(s.messages))
-	copy(cp, s.messages)
+	if _, ok := s.sessions[id]; !ok {
+		return false
+	}
+	delete(s.sessions, id)
+	s.undo.clear(id)
+	s.removeSessionFiles([]string{sessionFilePrefix(id)})
+	return true
+}
+
+func (s *MemoryStore) AllForSession(id string) []internal.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, _ := s.get(id)
+	cp := make([]internal.Message, len(sess.messages))
+	copy(cp, sess.messages)
 	return cp
 }
 
-func (s *MemoryStore) Append(msg internal.Message) {
+func (s *MemoryStore) RangeForSession(id string, before time.Time, limit int) ([]internal.Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, _ := s.get(id)
+	msgs := sess.messages
+	// los mensajes se agregan en orden, así que se puede buscar por fecha
+	end := len(msgs)
+	if !before.IsZero() {
+		end = sort.Search(len(msgs), func(i int) bool { return !msgs[i].CreatedAt.Before(before) })
+	}
+	start := max(end-limit, 0)
+	cp := make([]internal.Message, end-start)
+	copy(cp, msgs[start:end])
+	return cp, start > 0
+}
+
+func (s *MemoryStore) AppendForSession(id string, msg internal.Message) internal.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, _ := s.get(id)
+	if msg.ID == "" {
+		msg.ID = uuid.NewString()
+	}
+	sess.messages = append(sess.messages, msg)
+	sess.updated = time.Now()
+	s.undo.clear(id)
+	return msg
+}
+
+func (s *MemoryStore) AppendBatchForSession(id string, msgs ...internal.Message) []internal.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, _ := s.get(id)
+	out := make([]internal.Message, len(msgs))
+	for i, msg := range msgs {
+		if msg.ID == "" {
+			msg.ID = uuid.NewString()
+		}
+		out[i] = msg
+	}
+	sess.messages = append(sess.messages, out...)
+	sess.updated = time.Now()
+	s.undo.clear(id)
+	return out
+}
+
+func (s *MemoryStore) GetMessage(sessionID, msgID string) (internal.Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, _ := s.get(sessionID)
+	for _, m := range sess.messages {
+		if m.ID == msgID {
+			return m, true
+		}
+	}
+	return internal.Message{}, false
+}
+
+func (s *MemoryStore) RemoveMessage(sessionID, msgID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, _ := s.get(sessionID)
+	for i, m := range sess.messages {
+		if m.ID == msgID {
+			sess.messages = slices.Delete(sess.messages, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) LastUserMessage(sessionID string) (internal.Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, _ := s.get(sessionID)
+	for i := len(sess.messages) - 1; i >= 0; i-- {
+		if sess.messages[i].Role == internal.RoleUser {
+			return sess.messages[i], true
+		}
+	}
+	return internal.Message{}, false
+}
+
+func (s *MemoryStore) ResetForSession(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, _ := s.get(id)
+	sess.messages = sess.messages[:0]
+	s.undo.clear(id)
+}
+
+func (s *MemoryStore) UndoTurn(sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, _ := s.get(sessionID)
+	i := lastTurn(sess.messages)
+	if i < 0 {
+		return false
+	}
+	s.undo.push(sessionID, slices.Clone(sess.messages[i:]))
+	sess.messages = sess.messages[:i]
+	return true
+}
+
+func (s *MemoryStore) RedoTurn(sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	turn, ok := s.undo.pop(sessionID)
+	if !ok {
+		return false
+	}
+	sess, _ := s.get(sessionID)
+	sess.messages = append(sess.messages, turn...)
+	return true
+}
+
+func (s *MemoryStore) Conversations(prefix string) []internal.Conversation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]internal.Conversation, 0)
+	for id, sess := range s.sessions {
+		if !strings.HasPrefix(id, prefix) {
+			continue
+		}
+		if c, ok := conversation(id, sess); ok {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].UpdatedAt.Equal(out[j].UpdatedAt) {
+			return out[i].UpdatedAt.After(out[j].UpdatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// conversation resume la sesión id; false si todavía no tiene mensajes del
+// usuario ni título propio.
+func conversation(id string, sess *session) (internal.Conversation, bool) {
+	c := internal.Conversation{
+		ID:          id,
+		Title:       sess.title,
+		CustomTitle: sess.title != "",
+		Messages:    len(sess.messages),
+		CreatedAt:   sess.created,
+		UpdatedAt:   sess.updated,
+	}
+	if c.UpdatedAt.IsZero() {
+		c.UpdatedAt = c.CreatedAt
+	}
+	if !c.CustomTitle {
+		i := slices.IndexFunc(sess.messages, func(m internal.Message) bool { return m.Role == internal.RoleUser })
+		if i < 0 {
+			return c, false
+		}
+		c.Title = autoTitle(sess.messages[i].Content)
+	}
+	return c, true
+}
+
+func (s *MemoryStore) ArchiveSession(id, archiveID string) (internal.ArchivedConversation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, _ := s.get(id)
+	c, ok := conversation(id, sess)
+	if !ok {
+		return internal.ArchivedConversation{}, false
+	}
+	c.ID = archiveID
+	a := &archivedSession{
+		conv:     internal.ArchivedConversation{Conversation: c, ArchivedAt: time.Now()},
+		messages: slices.Clone(sess.messages),
+	}
+	s.archived[archiveID] = a
+	// la sesión sigue (mismo ID) pero como una conversación nueva
+	sess.messages = sess.messages[:0]
+	sess.title = ""
+	sess.created, sess.updated = a.conv.ArchivedAt, time.Time{}
+	s.undo.clear(id)
+	return a.conv, true
+}
+
+func (s *MemoryStore) ArchivedConversations(prefix string) []internal.ArchivedConversation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]internal.ArchivedConversation, 0)
+	for id, a := range s.archived {
+		if strings.HasPrefix(id, prefix) {
+			out = append(out, a.conv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].ArchivedAt.Equal(out[j].ArchivedAt) {
+			return out[i].ArchivedAt.After(out[j].ArchivedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func (s *MemoryStore) ArchivedMessages(archiveID string) (internal.ArchivedConversation, []internal.Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.archived[archiveID]
+	if !ok {
+		return internal.ArchivedConversation{}, nil, false
+	}
+	return a.conv, slices.Clone(a.messages), true
+}
+
+func (s *MemoryStore) DeleteArchived(archiveID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.archived[archiveID]; !ok {
+		return false
+	}
+	delete(s.archived, archiveID)
+	return true
+}
+
+func (s *MemoryStore) SetTitle(sessionID, title string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.messages = append(s.messages, msg)
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return false
+	}
+	sess.title = title
+	return true
 }
 
-func (s *MemoryStore) Reset() {
+func (s *MemoryStore) SearchForSession(id, query string, limit int) ([]internal.SearchHit, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.messages = s.messages[:0]
+	sess, _ := s.get(id)
+	return searchMessages(sess.messages, query, limit)
+}
+
+func (s *MemoryStore) AddUsage(id string, u internal.Usage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	su, ok := s.usage[id]
+	if !ok {
+		su = &internal.SessionUsage{SessionID: id}
+		s.usage[id] = su
+	}
+	su.InputTokens += u.InputTokens
+	su.OutputTokens += u.OutputTokens
+	su.TotalTokens += u.TotalTokens
+	su.Replies++
+	su.UpdatedAt = time.Now()
 }
 
-func SeedAssistantHello(s *MemoryStore, text string) {
-	s.Append(internal.Message{
-		Role:      internal.RoleAssistant,
-		Content:   text,
-		CreatedAt: time.Now(),
+func (s *MemoryStore) UsageBySession(prefix string) []internal.SessionUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]internal.SessionUsage, 0)
+	for id, su := range s.usage {
+		if strings.HasPrefix(id, prefix) {
+			out = append(out, *su)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].TotalTokens != out[j].TotalTokens {
+			return out[i].TotalTokens > out[j].TotalTokens
+		}
+		return out[i].SessionID < out[j].SessionID
 	})
+	return out
+}
+
+func (s *MemoryStore) ClearUsage(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id := range s.usage {
+		if strings.HasPrefix(id, prefix) {
+			delete(s.usage, id)
+			n++
+		}
+	}
+	return n
 }
 
-func (s *MemoryStore) AddFiles(files []internal.KnowledgeFile) int {
+// EvictIdle borra las sesiones sin actividad hace más de ttl, con sus
+// archivos propios (ver FileScope), y devuelve cuántas se eliminaron.
+func (s *MemoryStore) EvictIdle(ttl time.Duration) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	cutoff := time.Now().Add(-ttl)
+	n := 0
+	var prefixes []string
+	for id, sess := range s.sessions {
+		if sess.lastSeen.Before(cutoff) {
+			delete(s.sessions, id)
+			s.undo.clear(id)
+			prefixes = append(prefixes, sessionFilePrefix(id))
+			n++
+		}
+	}
+	// los archivos propios de la sesión se van con ella
+	if len(prefixes) > 0 {
+		s.removeSessionFiles(prefixes)
+	}
+	return n
+}
+
+// removeSessionFiles borra los archivos (y sus chunks) cuyo nombre empieza
+// con alguno de prefixes. Requiere s.mu tomado.
+func (s *MemoryStore) removeSessionFiles(prefixes []string) {
+	out := s.knowledge[:0]
+	for _, f := range s.knowledge {
+		if slices.ContainsFunc(prefixes, func(p string) bool { return strings.HasPrefix(f.Name, p) }) {
+			delete(s.chunks, f.Name)
+			continue
+		}
+		out = append(out, f)
+	}
+	s.knowledge = out
+}
+
+// SeedSession agrega el comienzo de una sesión nueva o reiniciada: el
+// mensaje de sistema y el saludo del asistente, cada uno si no está vacío.
+func SeedSession(s Store, sessionID, system, hello string) {
+	now := time.Now()
+	msgs := make([]internal.Message, 0, 2)
+	if system != "" {
+		msgs = append(msgs, internal.Message{Role: internal.RoleSystem, Content: system, CreatedAt: now})
+	}
+	if hello != "" {
+		msgs = append(msgs, internal.Message{Role: internal.RoleAssistant, Content: hello, CreatedAt: now})
+	}
+	if len(msgs) > 0 {
+		s.AppendBatchForSession(sessionID, msgs...)
+	}
+}
+
+func (s *MemoryStore) SetByteLimits(l ByteLimits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = l
+}
+
+func (s *MemoryStore) SetAnnotateOptions(o tabular.AnnotateOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.annotate = o
+}
+
+func (s *MemoryStore) AddFiles(files []internal.KnowledgeFile) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing := make([]internal.KnowledgeFile, len(s.knowledge))
+	for i, sf := range s.knowledge {
+		existing[i] = sf.KnowledgeFile
+	}
+	if err := s.limits.check(existing, files); err != nil {
+		return len(s.knowledge), err
+	}
 	// simple de-dup por nombre: el nuevo reemplaza
 	nameToIdx := make(map[string]int)
 	for i, f := range s.knowledge {
 		nameToIdx[f.Name] = i
 	}
 	for _, f := range files {
+		f.Tags = NormalizeTags(f.Tags)
+		sf := newStoredFile(f, s.annotate)
+		// el contenido cambió: los embeddings anteriores ya no sirven
+		delete(s.chunks, f.Name)
 		if idx, ok := nameToIdx[f.Name]; ok {
-			s.knowledge[idx] = f
+			s.knowledge[idx] = sf
 		} else {
-			s.knowledge = append(s.knowledge, f)
+			s.knowledge = append(s.knowledge, sf)
 			nameToIdx[f.Name] = len(s.knowledge) - 1
 		}
 	}
-	return len(s.knowledge)
+	return len(s.knowledge), nil
 }
 
 func (s *MemoryStore) ListFiles() []internal.KnowledgeFile {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	cp := make([]internal.KnowledgeFile, len(s.knowledge))
-	copy(cp, s.knowledge)
-	return cp
+	out := make([]internal.KnowledgeFile, len(s.knowledge))
+	for i, sf := range s.knowledge {
+		out[i] = sf.file(s.annotate)
+	}
+	return out
+}
+
+func (s *MemoryStore) ListFilesByTag(tags ...string) []internal.KnowledgeFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]internal.KnowledgeFile, 0, len(s.knowledge))
+	for _, sf := range s.knowledge {
+		// el filtro va antes de file() para no descomprimir los que no entran
+		if len(tags) == 0 || hasAnyTag(sf.KnowledgeFile, tags) {
+			out = append(out, sf.file(s.annotate))
+		}
+	}
+	return out
+}
+
+func (s *MemoryStore) SetTags(name string, tags []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.knowledge {
+		if s.knowledge[i].Name == name {
+			s.knowledge[i].Tags = NormalizeTags(tags)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) GetFile(name string) (internal.KnowledgeFile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sf := range s.knowledge {
+		if sf.Name == name {
+			return sf.file(s.annotate), true
+		}
+	}
+	return internal.KnowledgeFile{}, false
 }
 
 func (s *MemoryStore) RemoveFile(name string) int {
@@ -82,11 +556,72 @@ func (s *MemoryStore) RemoveFile(name string) int {
 		}
 	}
 	s.knowledge = out
+	delete(s.chunks, name)
+	return len(s.knowledge)
+}
+
+func (s *MemoryStore) RemoveByPrefix(prefix string) (removed, remaining int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prefix == "" {
+		return 0, len(s.knowledge)
+	}
+	out := s.knowledge[:0]
+	for _, f := range s.knowledge {
+		if strings.HasPrefix(f.Name, prefix) {
+			delete(s.chunks, f.Name)
+			removed++
+			continue
+		}
+		out = append(out, f)
+	}
+	s.knowledge = out
+	return removed, len(s.knowledge)
+}
+
+func (s *MemoryStore) FileCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return len(s.knowledge)
 }
 
+func (s *MemoryStore) FileNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, len(s.knowledge))
+	for i, f := range s.knowledge {
+		out[i] = f.Name
+	}
+	return out
+}
+
 func (s *MemoryStore) ClearFiles() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.knowledge = s.knowledge[:0]
+	clear(s.chunks)
+}
+
+// SetChunks guarda los fragmentos con embeddings de name. Se ignoran si el
+// archivo ya no está (p.ej. se borró mientras se calculaban).
+func (s *MemoryStore) SetChunks(name string, chunks []rag.Chunk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.knowledge {
+		if f.Name == name {
+			s.chunks[name] = chunks
+			return
+		}
+	}
+}
+
+// Chunks devuelve los fragmentos de todos los archivos, en el orden de carga.
+func (s *MemoryStore) Chunks() []rag.Chunk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []rag.Chunk
+	for _, f := range s.knowledge {
+		out = append(out, s.chunks[f.Name]...)
+	}
+	return out
 }
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// turn es una consulta con su respuesta, marcadas con i para reconocerlas.
+func turn(i int) []internal.Message {
+	now := time.Now()
+	return []internal.Message{
+		{Role: internal.RoleUser, Content: fmt.Sprintf("q%d", i), CreatedAt: now},
+		{Role: internal.RoleAssistant, Content: fmt.Sprintf("a%d", i), CreatedAt: now},
+	}
+}
+
+// checkTurns verifica que cada consulta esté seguida de su respuesta.
+func checkTurns(t *testing.T, msgs []internal.Message, n int) {
+	t.Helper()
+	if len(msgs) != 2*n {
+		t.Fatalf("%d mensajes, want %d", len(msgs), 2*n)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < len(msgs); i += 2 {
+		q, a := msgs[i], msgs[i+1]
+		if q.Role != internal.RoleUser || a.Role != internal.RoleAssistant || "a"+q.Content[1:] != a.Content {
+			t.Fatalf("turno intercalado en %d: %q, %q", i, q.Content, a.Content)
+		}
+		if seen[q.Content] {
+			t.Fatalf("turno repetido: %s", q.Content)
+		}
+		seen[q.Content] = true
+	}
+}
+
+func appendConcurrently(s Store, sid string, n int) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.AppendBatchForSession(sid, turn(i)...)
+			// lecturas en paralelo: ninguna debe ver un turno a medias
+			msgs := s.AllForSession(sid)
+			if len(msgs)%2 != 0 {
+				panic(fmt.Sprintf("turno a medias: %d mensajes", len(msgs)))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// Correr con -race.
+func TestMemoryAppendBatchConcurrent(t *testing.T) {
+	s := NewMemoryStore()
+	s.TouchSession("s1")
+	const n = 100
+	appendConcurrently(s, "s1", n)
+	msgs := s.AllForSession("s1")
+	checkTurns(t, msgs, n)
+	ids := make(map[string]bool)
+	for _, m := range msgs {
+		if m.ID == "" || ids[m.ID] {
+			t.Fatalf("ID vacío o repetido: %q", m.ID)
+		}
+		ids[m.ID] = true
+	}
+}
+
+func TestSQLiteAppendBatchConcurrent(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	s.TouchSession("s1")
+	const n = 50
+	appendConcurrently(s, "s1", n)
+	checkTurns(t, s.AllForSession("s1"), n)
+}
+
+func TestAppendBatchKeepsIDs(t *testing.T) {
+	s := NewMemoryStore()
+	msgs := turn(1)
+	msgs[0].ID = "fijo"
+	out := s.AppendBatchForSession("s1", msgs...)
+	if out[0].ID != "fijo" || out[1].ID == "" {
+		t.Errorf("IDs = %q, %q", out[0].ID, out[1].ID)
+	}
+}
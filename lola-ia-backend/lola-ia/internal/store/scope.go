@@ -0,0 +1,208 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// ErrReadOnlyFile: se intentó modificar o borrar un archivo compartido desde
+// una sesión.
+var ErrReadOnlyFile = errors.New("archivo compartido: es de solo lectura")
+
+// FileScope es la knowledge base vista desde una sesión: sus archivos propios
+// más los compartidos (p.ej. los de SEED_CSV_DIR), que se pueden consultar
+// pero no modificar (KnowledgeFile.ReadOnly). Un archivo propio con el mismo
+// nombre que uno compartido lo tapa.
+//
+// Los archivos propios se guardan en el Store con el prefijo de la sesión
+// (ver sessionFilePrefix), así los backends no cambian; los métodos reciben
+// y devuelven los nombres sin prefijo.
+type FileScope struct {
+	s      Store
+	prefix string // vacío: el espacio compartido
+}
+
+// SessionFiles devuelve los archivos que ve la sesión sessionID.
+func SessionFiles(s Store, sessionID string) FileScope {
+	return FileScope{s: s, prefix: sessionFilePrefix(sessionID)}
+}
+
+// SharedFiles devuelve el espacio compartido: los archivos que no son de
+// ninguna sesión, todos modificables.
+func SharedFiles(s Store) FileScope {
+	return FileScope{s: s}
+}
+
+// sessionFilePrefix es "@" y un hash del ID de la sesión: de largo fijo, así
+// un X-Session-ID armado a propósito no puede caer dentro del prefijo de otra.
+func sessionFilePrefix(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return "@" + hex.EncodeToString(sum[:16]) + "/"
+}
+
+// isSessionFile indica si name (tal como está en el Store) es de una sesión.
+func isSessionFile(name string) bool {
+	const n = 1 + 32 + 1 // "@", el hash y "/"
+	if len(name) <= n || name[0] != '@' || name[n-1] != '/' {
+		return false
+	}
+	_, err := hex.DecodeString(name[1 : n-1])
+	return err == nil
+}
+
+// Key es el nombre con el que f (devuelto por este scope) está en el Store;
+// es único entre sesiones, así que sirve para el índice de RAG o el cache.
+func (fs FileScope) Key(f internal.KnowledgeFile) string {
+	if f.ReadOnly {
+		return f.Name
+	}
+	return fs.prefix + f.Name
+}
+
+// WithKeys devuelve copias de files con Key como nombre.
+func (fs FileScope) WithKeys(files []internal.KnowledgeFile) []internal.KnowledgeFile {
+	out := make([]internal.KnowledgeFile, len(files))
+	for i, f := range files {
+		f.Name = fs.Key(f)
+		out[i] = f
+	}
+	return out
+}
+
+// visible devuelve, en el orden del Store, el nombre y la clave de cada
+// archivo que ve el scope.
+func (fs FileScope) visible() (names []string, keys map[string]string) {
+	keys = make(map[string]string)
+	for _, key := range fs.s.FileNames() {
+		name := key
+		switch {
+		case fs.prefix != "" && strings.HasPrefix(key, fs.prefix):
+			name = key[len(fs.prefix):]
+		case isSessionFile(key):
+			continue
+		case keys[name] != "":
+			// compartido tapado por uno propio anterior
+			continue
+		}
+		if keys[name] == "" {
+			names = append(names, name)
+		}
+		keys[name] = key
+	}
+	return names, keys
+}
+
+// file devuelve el archivo guardado como key, con el nombre visible.
+func (fs FileScope) file(name, key string) (internal.KnowledgeFile, bool) {
+	f, ok := fs.s.GetFile(key)
+	if !ok {
+		return f, false
+	}
+	f.Name = name
+	f.ReadOnly = fs.prefix != "" && key == name
+	return f, true
+}
+
+// AddFiles agrega (o reemplaza) archivos propios y devuelve el total visible.
+// Los límites de bytes del Store se aplican a lo que ve la sesión (sus
+// archivos y los compartidos), no a la suma de todas.
+func (fs FileScope) AddFiles(files []internal.KnowledgeFile) (int, error) {
+	keyed := make([]internal.KnowledgeFile, len(files))
+	for i, f := range files {
+		f.Name, f.ReadOnly = fs.prefix+f.Name, false
+		keyed[i] = f
+	}
+	_, err := fs.s.AddFiles(keyed)
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		limitErr.File = strings.TrimPrefix(limitErr.File, fs.prefix)
+	}
+	return fs.FileCount(), err
+}
+
+func (fs FileScope) ListFiles() []internal.KnowledgeFile {
+	names, keys := fs.visible()
+	out := make([]internal.KnowledgeFile, 0, len(names))
+	for _, name := range names {
+		if f, ok := fs.file(name, keys[name]); ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func (fs FileScope) ListFilesByTag(tags ...string) []internal.KnowledgeFile {
+	return filterByTag(fs.ListFiles(), tags)
+}
+
+// GetFile busca primero entre los propios y después entre los compartidos.
+func (fs FileScope) GetFile(name string) (internal.KnowledgeFile, bool) {
+	if fs.prefix != "" {
+		if f, ok := fs.file(name, fs.prefix+name); ok {
+			return f, true
+		}
+	}
+	if isSessionFile(name) {
+		return internal.KnowledgeFile{}, false
+	}
+	return fs.file(name, name)
+}
+
+// SetTags cambia los tags de un archivo propio; false si no hay ninguno con
+// ese nombre.
+func (fs FileScope) SetTags(name string, tags []string) bool {
+	if fs.prefix == "" && isSessionFile(name) {
+		return false
+	}
+	return fs.s.SetTags(fs.prefix+name, tags)
+}
+
+// RemoveFile borra un archivo propio y devuelve el total visible.
+func (fs FileScope) RemoveFile(name string) int {
+	if fs.prefix != "" || !isSessionFile(name) {
+		fs.s.RemoveFile(fs.prefix + name)
+	}
+	return fs.FileCount()
+}
+
+// RemoveByPrefix borra los archivos propios cuyo nombre empieza con prefix.
+func (fs FileScope) RemoveByPrefix(prefix string) (removed, remaining int) {
+	if prefix == "" {
+		return 0, fs.FileCount()
+	}
+	if fs.prefix == "" {
+		// sin tocar los de las sesiones, que empiezan con "@"
+		for _, name := range fs.s.FileNames() {
+			if strings.HasPrefix(name, prefix) && !isSessionFile(name) {
+				fs.s.RemoveFile(name)
+				removed++
+			}
+		}
+		return removed, fs.FileCount()
+	}
+	removed, _ = fs.s.RemoveByPrefix(fs.prefix + prefix)
+	return removed, fs.FileCount()
+}
+
+// ClearFiles borra todos los archivos propios.
+func (fs FileScope) ClearFiles() {
+	if fs.prefix != "" {
+		fs.s.RemoveByPrefix(fs.prefix)
+		return
+	}
+	for _, name := range fs.s.FileNames() {
+		if !isSessionFile(name) {
+			fs.s.RemoveFile(name)
+		}
+	}
+}
+
+// FileCount cuenta los archivos visibles, propios y compartidos.
+func (fs FileScope) FileCount() int {
+	names, _ := fs.visible()
+	return len(names)
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func fileNames(files []internal.KnowledgeFile) []string {
+	out := make([]string, len(files))
+	for i, f := range files {
+		out[i] = f.Name
+	}
+	return out
+}
+
+func TestSessionFiles(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		SharedFiles(s).AddFiles([]internal.KnowledgeFile{{Name: "seed.csv", Text: "id\n1\n"}})
+		a, b := SessionFiles(s, "sesion-a"), SessionFiles(s, "sesion-b")
+		if _, err := a.AddFiles([]internal.KnowledgeFile{{Name: "a.csv", Text: "id\n2\n"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := fileNames(a.ListFiles()); !slices.Equal(got, []string{"seed.csv", "a.csv"}) {
+			t.Errorf("A ve %v", got)
+		}
+		if got := fileNames(b.ListFiles()); !slices.Equal(got, []string{"seed.csv"}) {
+			t.Errorf("B ve %v", got)
+		}
+		if _, ok := b.GetFile("a.csv"); ok {
+			t.Error("B encontró el archivo de A")
+		}
+		if f, ok := b.GetFile("seed.csv"); !ok || !f.ReadOnly {
+			t.Errorf("seed desde B: %+v, %v", f, ok)
+		}
+		// ni con el nombre interno
+		if _, ok := b.GetFile(a.Key(internal.KnowledgeFile{Name: "a.csv"})); ok {
+			t.Error("B encontró el archivo de A por su clave")
+		}
+		if got := fileNames(SharedFiles(s).ListFiles()); !slices.Equal(got, []string{"seed.csv"}) {
+			t.Errorf("el espacio compartido ve %v", got)
+		}
+
+		// uno propio tapa al compartido del mismo nombre, solo en esa sesión
+		b.AddFiles([]internal.KnowledgeFile{{Name: "seed.csv", Text: "id\n3\n"}})
+		if f, _ := b.GetFile("seed.csv"); f.ReadOnly || f.Text != "id\n3\n" || b.FileCount() != 1 {
+			t.Errorf("propio de B: %+v, %d archivos", f, b.FileCount())
+		}
+		if f, _ := a.GetFile("seed.csv"); !f.ReadOnly || f.Text != "id\n1\n" {
+			t.Errorf("A ve el de B: %+v", f)
+		}
+
+		// borrar desde B no toca lo de A ni el compartido
+		b.RemoveFile("a.csv")
+		b.ClearFiles()
+		if a.FileCount() != 2 || b.FileCount() != 1 {
+			t.Errorf("después de borrar en B: A %d, B %d", a.FileCount(), b.FileCount())
+		}
+		a.RemoveFile("a.csv")
+		if got := fileNames(a.ListFiles()); !slices.Equal(got, []string{"seed.csv"}) {
+			t.Errorf("A después de borrar: %v", got)
+		}
+	})
+}
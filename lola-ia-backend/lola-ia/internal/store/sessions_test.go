@@ -0,0 +1,66 @@
+package store
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestSessionsAndDelete(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		s.TouchSession("k1:a")
+		s.AppendForSession("k1:a", internal.Message{Role: internal.RoleUser, Content: "hola", CreatedAt: at(1)})
+		s.AppendForSession("k1:a", internal.Message{Role: internal.RoleAssistant, Content: "¿qué tal?", CreatedAt: at(2)})
+		time.Sleep(5 * time.Millisecond)
+		s.TouchSession("k1:b")
+		s.TouchSession("k2:c")
+		SessionFiles(s, "k1:a").AddFiles([]internal.KnowledgeFile{{Name: "a.csv", Text: "id\n1\n"}})
+		SharedFiles(s).AddFiles([]internal.KnowledgeFile{{Name: "seed.csv", Text: "id\n3\n"}})
+		SessionFiles(s, "k1:b").AddFiles([]internal.KnowledgeFile{{Name: "b.csv", Text: "id\n2\n"}})
+
+		// solo las del prefijo, la más reciente primero
+		list := s.Sessions("k1:")
+		ids := make([]string, len(list))
+		for i, si := range list {
+			ids[i] = si.ID
+		}
+		if !slices.Equal(ids, []string{"k1:b", "k1:a"}) {
+			t.Fatalf("Sessions(k1:) = %v", ids)
+		}
+		if a := list[1]; a.Messages != 2 || a.CreatedAt.IsZero() || a.LastActivity.Before(a.CreatedAt) {
+			t.Errorf("k1:a = %+v", a)
+		}
+		if list[0].Messages != 0 || !list[0].LastActivity.After(list[1].LastActivity) {
+			t.Errorf("k1:b = %+v", list[0])
+		}
+		if got := s.Sessions("k3:"); got == nil || len(got) != 0 {
+			t.Errorf("Sessions(k3:) = %#v, want vacía", got)
+		}
+
+		if !s.DeleteSession("k1:a") {
+			t.Fatal("DeleteSession(k1:a) = false")
+		}
+		if s.DeleteSession("k1:a") || s.DeleteSession("no-existe") {
+			t.Error("DeleteSession de una sesión inexistente = true")
+		}
+		if got := fileNames(SessionFiles(s, "k1:a").ListFiles()); !slices.Equal(got, []string{"seed.csv"}) {
+			t.Errorf("archivos de k1:a después de borrarla: %v", got)
+		}
+		// las otras sesiones y el espacio compartido quedan
+		if got := fileNames(SessionFiles(s, "k1:b").ListFiles()); !slices.Equal(got, []string{"seed.csv", "b.csv"}) {
+			t.Errorf("archivos de k1:b: %v", got)
+		}
+		if n := s.SessionCount(); n != 2 {
+			t.Errorf("SessionCount = %d, want 2", n)
+		}
+		// si vuelve, empieza de cero
+		if !s.TouchSession("k1:a") {
+			t.Error("TouchSession después de borrarla no la creó")
+		}
+		if n := len(s.AllForSession("k1:a")); n != 0 {
+			t.Errorf("quedaron %d mensajes", n)
+		}
+	})
+}
@@ -0,0 +1,865 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+// SQLiteStore persiste mensajes y archivos en un archivo SQLite local.
+// Expone los mismos métodos que MemoryStore; los errores de la base se
+// registran en el log porque esa API no los devuelve.
+type SQLiteStore struct {
+	db       *sql.DB
+	limits   ByteLimits
+	annotate tabular.AnnotateOptions
+	undo     undoStacks
+}
+
+// NewSQLiteStore abre (o crea) la base en path y crea las tablas si faltan.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite no admite escrituras concurrentes: una sola conexión evita SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	s := &SQLiteStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate crea el esquema en el primer arranque. Es idempotente.
+func (s *SQLiteStore) migrate() error {
+	stmts := []string{
+		`PRAGMA journal_mode = WAL`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id         TEXT    PRIMARY KEY,
+			created_at INTEGER NOT NULL,
+			last_seen  INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS messages (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id TEXT    NOT NULL DEFAULT '',
+			role       TEXT    NOT NULL,
+			content    TEXT    NOT NULL,
+			created_at INTEGER NOT NULL
+		)`,
+		// conversaciones archivadas; sus mensajes quedan en messages con
+		// session_id = el id del archivo
+		`CREATE TABLE IF NOT EXISTS archived_conversations (
+			id           TEXT    PRIMARY KEY,
+			title        TEXT    NOT NULL,
+			custom_title INTEGER NOT NULL,
+			created_at   INTEGER NOT NULL,
+			updated_at   INTEGER NOT NULL,
+			archived_at  INTEGER NOT NULL
+		)`,
+		// consumo de tokens por sesión; no se borra con los mensajes
+		`CREATE TABLE IF NOT EXISTS session_usage (
+			session_id    TEXT    PRIMARY KEY,
+			input_tokens  INTEGER NOT NULL,
+			output_tokens INTEGER NOT NULL,
+			total_tokens  INTEGER NOT NULL,
+			replies       INTEGER NOT NULL,
+			updated_at    INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS knowledge_files (
+			name       TEXT    PRIMARY KEY,
+			size       INTEGER NOT NULL,
+			text       TEXT    NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		)`,
+	}
+	for _, q := range stmts {
+		if _, err := s.db.Exec(q); err != nil {
+			return fmt.Errorf("sqlite migrate: %w", err)
+		}
+	}
+	// bases creadas antes de las sesiones: los mensajes previos quedan en la sesión ""
+	if err := s.addColumnIfMissing("messages", "session_id", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("sqlite migrate: %w", err)
+	}
+	// format se agregó con TSV/JSON; vacío = se detecta al leer
+	if err := s.addColumnIfMissing("knowledge_files", "format", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("sqlite migrate: %w", err)
+	}
+	// tags de cada archivo, separados por comas (ver NormalizeTags)
+	if err := s.addColumnIfMissing("knowledge_files", "tags", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("sqlite migrate: %w", err)
+	}
+	// codificación original de cada archivo (el texto se guarda en UTF-8)
+	if err := s.addColumnIfMissing("knowledge_files", "encoding", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("sqlite migrate: %w", err)
+	}
+	// title es el título propio de la conversación; vacío = automático
+	if err := s.addColumnIfMissing("sessions", "title", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("sqlite migrate: %w", err)
+	}
+	// uid es el ID público del mensaje; el orden es created_at y id desempata
+	// (un turno que el outbox guarda tarde queda en su lugar)
+	if err := s.addColumnIfMissing("messages", "uid", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("sqlite migrate: %w", err)
+	}
+	for _, q := range []string{
+		// mensajes guardados antes de tener ID: les damos uno aleatorio con forma de UUID
+		`UPDATE messages SET uid = lower(printf('%s-%s-4%s-%s-%s',
+			hex(randomblob(4)), hex(randomblob(2)), substr(hex(randomblob(2)), 2),
+			hex(randomblob(2)), hex(randomblob(6)))) WHERE uid = ''`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_session ON messages (session_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_session_created ON messages (session_id, created_at, id)`,
+		// un reintento del outbox tras un commit dudoso no duplica el turno
+		// (ver insertMessage); antes se quitan los duplicados que ya hubiera
+		`DELETE FROM messages WHERE id NOT IN (SELECT MIN(id) FROM messages GROUP BY session_id, uid)`,
+		`DROP INDEX IF EXISTS idx_messages_uid`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_session_uid ON messages (session_id, uid)`,
+	} {
+		if _, err := s.db.Exec(q); err != nil {
+			return fmt.Errorf("sqlite migrate: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) addColumnIfMissing(table, column, decl string) error {
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = s.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + decl)
+	return err
+}
+
+func (s *SQLiteStore) Close() error { return s.db.Close() }
+
+func (s *SQLiteStore) TouchSession(id string) bool {
+	now := time.Now().UnixNano()
+	res, err := s.db.Exec(`INSERT INTO sessions (id, created_at, last_seen) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO NOTHING`, id, now, now)
+	if err != nil {
+		fmt.Printf("[sqlite] error registrando sesión: %v\n", err)
+		return false
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return true
+	}
+	if _, err := s.db.Exec(`UPDATE sessions SET last_seen = ? WHERE id = ?`, now, id); err != nil {
+		fmt.Printf("[sqlite] error registrando sesión: %v\n", err)
+	}
+	return false
+}
+
+func (s *SQLiteStore) SessionCount() int {
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&n); err != nil {
+		fmt.Printf("[sqlite] error contando sesiones: %v\n", err)
+	}
+	return n
+}
+
+func (s *SQLiteStore) Sessions(prefix string) []internal.SessionInfo {
+	out := make([]internal.SessionInfo, 0)
+	rows, err := s.db.Query(`SELECT s.id, s.created_at, s.last_seen,
+			(SELECT COUNT(*) FROM messages m WHERE m.session_id = s.id)
+		FROM sessions s WHERE substr(s.id, 1, length(?)) = ?
+		ORDER BY s.last_seen DESC, s.id`, prefix, prefix)
+	if err != nil {
+		fmt.Printf("[sqlite] error listando sesiones: %v\n", err)
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			si            internal.SessionInfo
+			created, seen int64
+		)
+		if err := rows.Scan(&si.ID, &created, &seen, &si.Messages); err != nil {
+			fmt.Printf("[sqlite] error leyendo sesión: %v\n", err)
+			continue
+		}
+		si.CreatedAt, si.LastActivity = time.Unix(0, created), time.Unix(0, seen)
+		out = append(out, si)
+	}
+	return out
+}
+
+func (s *SQLiteStore) DeleteSession(id string) bool {
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Printf("[sqlite] error borrando sesión: %v\n", err)
+		return false
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+	if err != nil {
+		fmt.Printf("[sqlite] error borrando sesión: %v\n", err)
+		return false
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false
+	}
+	if _, err := tx.Exec(`DELETE FROM messages WHERE session_id = ?`, id); err != nil {
+		fmt.Printf("[sqlite] error borrando sesión: %v\n", err)
+		return false
+	}
+	// los archivos propios de la sesión se van con ella
+	prefix := sessionFilePrefix(id)
+	if _, err := tx.Exec(`DELETE FROM knowledge_files WHERE substr(name, 1, length(?)) = ?`, prefix, prefix); err != nil {
+		fmt.Printf("[sqlite] error borrando sesión: %v\n", err)
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("[sqlite] error borrando sesión: %v\n", err)
+		return false
+	}
+	s.undo.clear(id)
+	return true
+}
+
+func (s *SQLiteStore) AllForSession(id string) []internal.Message {
+	rows, err := s.db.Query(`SELECT uid, role, content, created_at FROM messages WHERE session_id = ? ORDER BY created_at, id`, id)
+	if err != nil {
+		fmt.Printf("[sqlite] error leyendo mensajes: %v\n", err)
+		return []internal.Message{}
+	}
+	return scanMessages(rows)
+}
+
+func (s *SQLiteStore) RangeForSession(id string, before time.Time, limit int) ([]internal.Message, bool) {
+	cutoff := int64(math.MaxInt64)
+	if !before.IsZero() {
+		cutoff = before.UnixNano()
+	}
+	// pedimos uno de más para saber si quedan mensajes anteriores
+	rows, err := s.db.Query(`SELECT uid, role, content, created_at FROM messages
+		WHERE session_id = ? AND created_at < ? ORDER BY created_at DESC, id DESC LIMIT ?`, id, cutoff, limit+1)
+	if err != nil {
+		fmt.Printf("[sqlite] error leyendo mensajes: %v\n", err)
+		return []internal.Message{}, false
+	}
+	out := scanMessages(rows)
+	more := len(out) > limit
+	if more {
+		out = out[:limit]
+	}
+	slices.Reverse(out)
+	return out, more
+}
+
+// scanMessages lee y cierra rows de (uid, role, content, created_at).
+func scanMessages(rows *sql.Rows) []internal.Message {
+	defer rows.Close()
+	out := make([]internal.Message, 0, 64)
+	for rows.Next() {
+		var (
+			m  internal.Message
+			ts int64
+		)
+		if err := rows.Scan(&m.ID, &m.Role, &m.Content, &ts); err != nil {
+			fmt.Printf("[sqlite] error leyendo mensaje: %v\n", err)
+			continue
+		}
+		m.CreatedAt = time.Unix(0, ts)
+		out = append(out, m)
+	}
+	return out
+}
+
+func (s *SQLiteStore) AppendForSession(id string, msg internal.Message) internal.Message {
+	if msg.ID == "" {
+		msg.ID = uuid.NewString()
+	}
+	if err := insertMessage(s.db, id, msg); err != nil {
+		fmt.Printf("[sqlite] error guardando mensaje: %v\n", err)
+	}
+	s.undo.clear(id)
+	return msg
+}
+
+func (s *SQLiteStore) AppendBatchForSession(id string, msgs ...internal.Message) []internal.Message {
+	out, err := s.TryAppendBatchForSession(id, msgs...)
+	if err != nil {
+		fmt.Printf("[sqlite] error guardando mensajes: %v\n", err)
+	}
+	return out
+}
+
+// TryAppendBatchForSession es AppendBatchForSession devolviendo el error de
+// la base en vez de solo registrarlo, para que el caller pueda reintentar.
+// Los IDs se asignan antes de escribir: reintentar con los mensajes
+// devueltos no cambia los IDs ni duplica los que ya se guardaron.
+func (s *SQLiteStore) TryAppendBatchForSession(id string, msgs ...internal.Message) ([]internal.Message, error) {
+	out := make([]internal.Message, len(msgs))
+	for i, msg := range msgs {
+		if msg.ID == "" {
+			msg.ID = uuid.NewString()
+		}
+		out[i] = msg
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return out, err
+	}
+	defer tx.Rollback()
+	for _, msg := range out {
+		if err := insertMessage(tx, id, msg); err != nil {
+			return out, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return out, err
+	}
+	s.undo.clear(id)
+	return out, nil
+}
+
+// execer es lo común a *sql.DB y *sql.Tx que usa insertMessage.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insertMessage no hace nada si la sesión ya tiene un mensaje con ese ID:
+// reintentar un lote que sí se guardó (commit con error dudoso) no lo duplica.
+func insertMessage(db execer, sessionID string, msg internal.Message) error {
+	_, err := db.Exec(`INSERT INTO messages (session_id, uid, role, content, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(session_id, uid) DO NOTHING`,
+		sessionID, msg.ID, string(msg.Role), msg.Content, msg.CreatedAt.UnixNano())
+	return err
+}
+
+func (s *SQLiteStore) GetMessage(sessionID, msgID string) (internal.Message, bool) {
+	var (
+		m  internal.Message
+		ts int64
+	)
+	err := s.db.QueryRow(`SELECT uid, role, content, created_at FROM messages WHERE session_id = ? AND uid = ?`,
+		sessionID, msgID).Scan(&m.ID, &m.Role, &m.Content, &ts)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			fmt.Printf("[sqlite] error leyendo mensaje: %v\n", err)
+		}
+		return internal.Message{}, false
+	}
+	m.CreatedAt = time.Unix(0, ts)
+	return m, true
+}
+
+func (s *SQLiteStore) RemoveMessage(sessionID, msgID string) bool {
+	res, err := s.db.Exec(`DELETE FROM messages WHERE session_id = ? AND uid = ?`, sessionID, msgID)
+	if err != nil {
+		fmt.Printf("[sqlite] error borrando mensaje: %v\n", err)
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+func (s *SQLiteStore) LastUserMessage(sessionID string) (internal.Message, bool) {
+	rows, err := s.db.Query(`SELECT uid, role, content, created_at FROM messages
+		WHERE session_id = ? AND role = ? ORDER BY created_at DESC, id DESC LIMIT 1`, sessionID, string(internal.RoleUser))
+	if err != nil {
+		fmt.Printf("[sqlite] error leyendo mensajes: %v\n", err)
+		return internal.Message{}, false
+	}
+	msgs := scanMessages(rows)
+	if len(msgs) == 0 {
+		return internal.Message{}, false
+	}
+	return msgs[0], true
+}
+
+func (s *SQLiteStore) Conversations(prefix string) []internal.Conversation {
+	out := make([]internal.Conversation, 0)
+	rows, err := s.db.Query(`SELECT id, title, created_at, updated_at, n, first_user FROM (
+			SELECT s.id, s.title, s.created_at,
+				COALESCE((SELECT MAX(m.created_at) FROM messages m WHERE m.session_id = s.id), s.created_at) AS updated_at,
+				(SELECT COUNT(*) FROM messages m WHERE m.session_id = s.id) AS n,
+				COALESCE((SELECT m.content FROM messages m WHERE m.session_id = s.id AND m.role = ?
+					ORDER BY m.created_at, m.id LIMIT 1), '') AS first_user
+			FROM sessions s WHERE substr(s.id, 1, length(?)) = ?
+		) WHERE title != '' OR first_user != ''
+		ORDER BY updated_at DESC, id`, string(internal.RoleUser), prefix, prefix)
+	if err != nil {
+		fmt.Printf("[sqlite] error listando conversaciones: %v\n", err)
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			c                internal.Conversation
+			created, updated int64
+			firstUser        string
+		)
+		if err := rows.Scan(&c.ID, &c.Title, &created, &updated, &c.Messages, &firstUser); err != nil {
+			fmt.Printf("[sqlite] error leyendo conversación: %v\n", err)
+			continue
+		}
+		c.CreatedAt, c.UpdatedAt = time.Unix(0, created), time.Unix(0, updated)
+		c.CustomTitle = c.Title != ""
+		if !c.CustomTitle {
+			c.Title = autoTitle(firstUser)
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// ArchiveSession cambia el session_id de los mensajes al del archivo: no se
+// copian.
+func (s *SQLiteStore) ArchiveSession(id, archiveID string) (internal.ArchivedConversation, bool) {
+	var conv internal.Conversation
+	found := false
+	for _, c := range s.Conversations(id) {
+		if c.ID == id {
+			conv, found = c, true
+		}
+	}
+	if !found {
+		return internal.ArchivedConversation{}, false
+	}
+	conv.ID = archiveID
+	a := internal.ArchivedConversation{Conversation: conv, ArchivedAt: time.Now()}
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Printf("[sqlite] error archivando conversación: %v\n", err)
+		return internal.ArchivedConversation{}, false
+	}
+	defer tx.Rollback()
+	for _, q := range []struct {
+		sql  string
+		args []any
+	}{
+		{`INSERT INTO archived_conversations (id, title, custom_title, created_at, updated_at, archived_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			[]any{archiveID, conv.Title, conv.CustomTitle, conv.CreatedAt.UnixNano(), conv.UpdatedAt.UnixNano(), a.ArchivedAt.UnixNano()}},
+		{`UPDATE messages SET session_id = ? WHERE session_id = ?`, []any{archiveID, id}},
+		// la sesión sigue (mismo ID) pero como una conversación nueva
+		{`UPDATE sessions SET title = '', created_at = ? WHERE id = ?`, []any{a.ArchivedAt.UnixNano(), id}},
+	} {
+		if _, err := tx.Exec(q.sql, q.args...); err != nil {
+			fmt.Printf("[sqlite] error archivando conversación: %v\n", err)
+			return internal.ArchivedConversation{}, false
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("[sqlite] error archivando conversación: %v\n", err)
+		return internal.ArchivedConversation{}, false
+	}
+	s.undo.clear(id)
+	return a, true
+}
+
+func (s *SQLiteStore) ArchivedConversations(prefix string) []internal.ArchivedConversation {
+	return s.archived(`WHERE substr(a.id, 1, length(?)) = ? ORDER BY a.archived_at DESC, a.id`, prefix, prefix)
+}
+
+func (s *SQLiteStore) ArchivedMessages(archiveID string) (internal.ArchivedConversation, []internal.Message, bool) {
+	convs := s.archived(`WHERE a.id = ?`, archiveID)
+	if len(convs) == 0 {
+		return internal.ArchivedConversation{}, nil, false
+	}
+	return convs[0], s.AllForSession(archiveID), true
+}
+
+// archived lee conversaciones archivadas; where filtra y ordena.
+func (s *SQLiteStore) archived(where string, args ...any) []internal.ArchivedConversation {
+	out := make([]internal.ArchivedConversation, 0)
+	rows, err := s.db.Query(`SELECT a.id, a.title, a.custom_title, a.created_at, a.updated_at, a.archived_at,
+			(SELECT COUNT(*) FROM messages m WHERE m.session_id = a.id)
+		FROM archived_conversations a `+where, args...)
+	if err != nil {
+		fmt.Printf("[sqlite] error listando conversaciones archivadas: %v\n", err)
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			c                          internal.ArchivedConversation
+			created, updated, archived int64
+		)
+		if err := rows.Scan(&c.ID, &c.Title, &c.CustomTitle, &created, &updated, &archived, &c.Messages); err != nil {
+			fmt.Printf("[sqlite] error leyendo conversación archivada: %v\n", err)
+			continue
+		}
+		c.CreatedAt, c.UpdatedAt, c.ArchivedAt = time.Unix(0, created), time.Unix(0, updated), time.Unix(0, archived)
+		out = append(out, c)
+	}
+	return out
+}
+
+func (s *SQLiteStore) DeleteArchived(archiveID string) bool {
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Printf("[sqlite] error borrando conversación archivada: %v\n", err)
+		return false
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM archived_conversations WHERE id = ?`, archiveID)
+	if err != nil {
+		fmt.Printf("[sqlite] error borrando conversación archivada: %v\n", err)
+		return false
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false
+	}
+	if _, err := tx.Exec(`DELETE FROM messages WHERE session_id = ?`, archiveID); err != nil {
+		fmt.Printf("[sqlite] error borrando conversación archivada: %v\n", err)
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("[sqlite] error borrando conversación archivada: %v\n", err)
+		return false
+	}
+	return true
+}
+
+func (s *SQLiteStore) SetTitle(sessionID, title string) bool {
+	res, err := s.db.Exec(`UPDATE sessions SET title = ? WHERE id = ?`, title, sessionID)
+	if err != nil {
+		fmt.Printf("[sqlite] error guardando título: %v\n", err)
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+func (s *SQLiteStore) AddUsage(id string, u internal.Usage) {
+	_, err := s.db.Exec(`INSERT INTO session_usage
+		(session_id, input_tokens, output_tokens, total_tokens, replies, updated_at)
+		VALUES (?, ?, ?, ?, 1, ?)
+		ON CONFLICT (session_id) DO UPDATE SET
+			input_tokens = input_tokens + excluded.input_tokens,
+			output_tokens = output_tokens + excluded.output_tokens,
+			total_tokens = total_tokens + excluded.total_tokens,
+			replies = replies + 1,
+			updated_at = excluded.updated_at`,
+		id, u.InputTokens, u.OutputTokens, u.TotalTokens, time.Now().UnixNano())
+	if err != nil {
+		fmt.Printf("[sqlite] error guardando consumo: %v\n", err)
+	}
+}
+
+func (s *SQLiteStore) UsageBySession(prefix string) []internal.SessionUsage {
+	out := make([]internal.SessionUsage, 0)
+	rows, err := s.db.Query(`SELECT session_id, input_tokens, output_tokens, total_tokens, replies, updated_at
+		FROM session_usage WHERE substr(session_id, 1, length(?)) = ?
+		ORDER BY total_tokens DESC, session_id`, prefix, prefix)
+	if err != nil {
+		fmt.Printf("[sqlite] error listando consumo: %v\n", err)
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			su      internal.SessionUsage
+			updated int64
+		)
+		if err := rows.Scan(&su.SessionID, &su.InputTokens, &su.OutputTokens, &su.TotalTokens, &su.Replies, &updated); err != nil {
+			fmt.Printf("[sqlite] error leyendo consumo: %v\n", err)
+			continue
+		}
+		su.UpdatedAt = time.Unix(0, updated)
+		out = append(out, su)
+	}
+	return out
+}
+
+func (s *SQLiteStore) ClearUsage(prefix string) int {
+	res, err := s.db.Exec(`DELETE FROM session_usage WHERE substr(session_id, 1, length(?)) = ?`, prefix, prefix)
+	if err != nil {
+		fmt.Printf("[sqlite] error borrando consumo: %v\n", err)
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return int(n)
+}
+
+func (s *SQLiteStore) ResetForSession(id string) {
+	if _, err := s.db.Exec(`DELETE FROM messages WHERE session_id = ?`, id); err != nil {
+		fmt.Printf("[sqlite] error reiniciando mensajes: %v\n", err)
+	}
+	s.undo.clear(id)
+}
+
+func (s *SQLiteStore) UndoTurn(sessionID string) bool {
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Printf("[sqlite] error deshaciendo turno: %v\n", err)
+		return false
+	}
+	defer tx.Rollback()
+	// el turno es el último mensaje del usuario y lo que le sigue
+	var fromAt, from int64
+	err = tx.QueryRow(`SELECT created_at, id FROM messages WHERE session_id = ? AND role = ?
+		ORDER BY created_at DESC, id DESC LIMIT 1`, sessionID, string(internal.RoleUser)).Scan(&fromAt, &from)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			fmt.Printf("[sqlite] error deshaciendo turno: %v\n", err)
+		}
+		return false
+	}
+	rows, err := tx.Query(`SELECT uid, role, content, created_at FROM messages
+		WHERE session_id = ? AND (created_at, id) >= (?, ?) ORDER BY created_at, id`, sessionID, fromAt, from)
+	if err != nil {
+		fmt.Printf("[sqlite] error deshaciendo turno: %v\n", err)
+		return false
+	}
+	turn := scanMessages(rows)
+	if _, err := tx.Exec(`DELETE FROM messages WHERE session_id = ? AND (created_at, id) >= (?, ?)`, sessionID, fromAt, from); err != nil {
+		fmt.Printf("[sqlite] error deshaciendo turno: %v\n", err)
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("[sqlite] error deshaciendo turno: %v\n", err)
+		return false
+	}
+	s.undo.push(sessionID, turn)
+	return true
+}
+
+func (s *SQLiteStore) RedoTurn(sessionID string) bool {
+	turn, ok := s.undo.pop(sessionID)
+	if !ok {
+		return false
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Printf("[sqlite] error rehaciendo turno: %v\n", err)
+		return false
+	}
+	defer tx.Rollback()
+	for _, m := range turn {
+		if err := insertMessage(tx, sessionID, m); err != nil {
+			fmt.Printf("[sqlite] error rehaciendo turno: %v\n", err)
+			return false
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("[sqlite] error rehaciendo turno: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// SearchForSession filtra en Go y no en SQL: LIKE no ignora acentos y el
+// historial de una sesión es chico.
+func (s *SQLiteStore) SearchForSession(id, query string, limit int) ([]internal.SearchHit, bool) {
+	return searchMessages(s.AllForSession(id), query, limit)
+}
+
+// SetByteLimits se llama al arrancar, antes de atender requests.
+func (s *SQLiteStore) SetByteLimits(l ByteLimits) { s.limits = l }
+
+// SetAnnotateOptions se llama al arrancar, antes de atender requests.
+func (s *SQLiteStore) SetAnnotateOptions(o tabular.AnnotateOptions) { s.annotate = o }
+
+func (s *SQLiteStore) AddFiles(files []internal.KnowledgeFile) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return s.FileCount(), fmt.Errorf("guardando archivos: %w", err)
+	}
+	// el chequeo va dentro de la transacción: con una sola conexión nadie
+	// más puede escribir entre la lectura de tamaños y el insert
+	if err := s.limits.check(fileSizes(tx), files); err != nil {
+		tx.Rollback()
+		return s.FileCount(), err
+	}
+	now := time.Now().UnixNano()
+	// mismo criterio que MemoryStore: el nuevo reemplaza al del mismo nombre
+	// (el upsert conserva el rowid y por lo tanto el orden original)
+	for _, f := range files {
+		if f.Format == "" {
+			f.Format = tabular.DetectFormat(f.Name, f.Text)
+		}
+		_, err := tx.Exec(`INSERT INTO knowledge_files (name, size, text, format, tags, encoding, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(name) DO UPDATE SET size = excluded.size, text = excluded.text,
+				format = excluded.format, tags = excluded.tags, encoding = excluded.encoding,
+				updated_at = excluded.updated_at`,
+			f.Name, f.Size, f.Text, f.Format, joinTags(f.Tags), f.Encoding, now, now)
+		if err != nil {
+			tx.Rollback()
+			return s.FileCount(), fmt.Errorf("guardando %s: %w", f.Name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return s.FileCount(), fmt.Errorf("guardando archivos: %w", err)
+	}
+	return s.FileCount(), nil
+}
+
+// fileSizes devuelve nombre y tamaño de los archivos guardados, sin el texto.
+func fileSizes(tx *sql.Tx) []internal.KnowledgeFile {
+	rows, err := tx.Query(`SELECT name, size FROM knowledge_files`)
+	if err != nil {
+		fmt.Printf("[sqlite] error leyendo archivos: %v\n", err)
+		return nil
+	}
+	defer rows.Close()
+	var out []internal.KnowledgeFile
+	for rows.Next() {
+		var f internal.KnowledgeFile
+		if err := rows.Scan(&f.Name, &f.Size); err != nil {
+			fmt.Printf("[sqlite] error leyendo archivo: %v\n", err)
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func (s *SQLiteStore) ListFiles() []internal.KnowledgeFile {
+	return s.listFiles(`SELECT name, size, text, format, tags, encoding FROM knowledge_files ORDER BY rowid`)
+}
+
+func (s *SQLiteStore) ListFilesByTag(tags ...string) []internal.KnowledgeFile {
+	if len(tags) == 0 {
+		return s.ListFiles()
+	}
+	// los tags se comparan sin acentos en Go; acá solo se descartan los que no tienen
+	return filterByTag(s.listFiles(`SELECT name, size, text, format, tags, encoding FROM knowledge_files
+		WHERE tags != '' ORDER BY rowid`), tags)
+}
+
+func (s *SQLiteStore) listFiles(query string) []internal.KnowledgeFile {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		fmt.Printf("[sqlite] error leyendo archivos: %v\n", err)
+		return []internal.KnowledgeFile{}
+	}
+	defer rows.Close()
+	out := make([]internal.KnowledgeFile, 0)
+	for rows.Next() {
+		var f internal.KnowledgeFile
+		var tags string
+		if err := rows.Scan(&f.Name, &f.Size, &f.Text, &f.Format, &tags, &f.Encoding); err != nil {
+			fmt.Printf("[sqlite] error leyendo archivo: %v\n", err)
+			continue
+		}
+		f.Tags = splitTags(tags)
+		// solo persistimos el texto: las filas se reconstruyen al leer
+		tabular.Annotate(&f, s.annotate)
+		out = append(out, f)
+	}
+	return out
+}
+
+func (s *SQLiteStore) GetFile(name string) (internal.KnowledgeFile, bool) {
+	var f internal.KnowledgeFile
+	var tags string
+	err := s.db.QueryRow(`SELECT name, size, text, format, tags, encoding FROM knowledge_files WHERE name = ?`, name).
+		Scan(&f.Name, &f.Size, &f.Text, &f.Format, &tags, &f.Encoding)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			fmt.Printf("[sqlite] error leyendo %s: %v\n", name, err)
+		}
+		return internal.KnowledgeFile{}, false
+	}
+	f.Tags = splitTags(tags)
+	tabular.Annotate(&f, s.annotate)
+	return f, true
+}
+
+func (s *SQLiteStore) SetTags(name string, tags []string) bool {
+	res, err := s.db.Exec(`UPDATE knowledge_files SET tags = ?, updated_at = ? WHERE name = ?`,
+		joinTags(tags), time.Now().UnixNano(), name)
+	if err != nil {
+		fmt.Printf("[sqlite] error guardando tags de %s: %v\n", name, err)
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+// joinTags normaliza tags y los une con comas para guardarlos en una columna.
+func joinTags(tags []string) string {
+	return strings.Join(NormalizeTags(tags), ",")
+}
+
+func splitTags(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func (s *SQLiteStore) RemoveFile(name string) int {
+	if _, err := s.db.Exec(`DELETE FROM knowledge_files WHERE name = ?`, name); err != nil {
+		fmt.Printf("[sqlite] error borrando %s: %v\n", name, err)
+	}
+	return s.FileCount()
+}
+
+func (s *SQLiteStore) RemoveByPrefix(prefix string) (removed, remaining int) {
+	if prefix == "" {
+		return 0, s.FileCount()
+	}
+	// substr en vez de LIKE: así "_" y "%" del prefix no son comodines
+	res, err := s.db.Exec(`DELETE FROM knowledge_files WHERE substr(name, 1, length(?)) = ?`, prefix, prefix)
+	if err != nil {
+		fmt.Printf("[sqlite] error borrando %s*: %v\n", prefix, err)
+		return 0, s.FileCount()
+	}
+	n, _ := res.RowsAffected()
+	return int(n), s.FileCount()
+}
+
+func (s *SQLiteStore) ClearFiles() {
+	if _, err := s.db.Exec(`DELETE FROM knowledge_files`); err != nil {
+		fmt.Printf("[sqlite] error borrando archivos: %v\n", err)
+	}
+}
+
+func (s *SQLiteStore) FileNames() []string {
+	rows, err := s.db.Query(`SELECT name FROM knowledge_files ORDER BY rowid`)
+	if err != nil {
+		fmt.Printf("[sqlite] error leyendo archivos: %v\n", err)
+		return []string{}
+	}
+	defer rows.Close()
+	out := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			fmt.Printf("[sqlite] error leyendo archivo: %v\n", err)
+			continue
+		}
+		out = append(out, name)
+	}
+	return out
+}
+
+func (s *SQLiteStore) FileCount() int {
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM knowledge_files`).Scan(&n); err != nil {
+		fmt.Printf("[sqlite] error contando archivos: %v\n", err)
+	}
+	return n
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "lola.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	return s
+}
+
+// failInserts hace que todo insert en knowledge_files falle, como un disco
+// lleno o una base de solo lectura.
+func failInserts(t *testing.T, s *SQLiteStore) {
+	t.Helper()
+	_, err := s.db.Exec(`CREATE TRIGGER fail_insert BEFORE INSERT ON knowledge_files
+		BEGIN SELECT RAISE(ABORT, 'disco lleno'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func csvFile(name string) internal.KnowledgeFile {
+	text := "a,b\n1,2\n"
+	return internal.KnowledgeFile{Name: name, Size: len(text), Text: text}
+}
+
+func TestSQLiteAddFiles(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	total, err := s.AddFiles([]internal.KnowledgeFile{csvFile("a.csv"), csvFile("b.csv")})
+	if err != nil || total != 2 {
+		t.Fatalf("AddFiles = %d, %v", total, err)
+	}
+	if f, ok := s.GetFile("a.csv"); !ok || f.Text != "a,b\n1,2\n" {
+		t.Errorf("GetFile = %+v, %v", f, ok)
+	}
+}
+
+func TestSQLiteAddFilesInsertError(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	failInserts(t, s)
+	total, err := s.AddFiles([]internal.KnowledgeFile{csvFile("a.csv")})
+	if err == nil {
+		t.Fatal("AddFiles no devolvió el error del insert")
+	}
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		t.Errorf("el error de la base no es un LimitError: %v", err)
+	}
+	if total != 0 || s.FileCount() != 0 {
+		t.Errorf("total = %d, FileCount = %d; want 0", total, s.FileCount())
+	}
+}
+
+func TestSQLiteAddFilesInsertErrorRollsBack(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	if _, err := s.AddFiles([]internal.KnowledgeFile{csvFile("a.csv")}); err != nil {
+		t.Fatal(err)
+	}
+	// el segundo archivo del lote falla: tampoco queda el primero
+	if _, err := s.db.Exec(`CREATE TRIGGER fail_c BEFORE INSERT ON knowledge_files
+		WHEN NEW.name = 'c.csv' BEGIN SELECT RAISE(ABORT, 'disco lleno'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddFiles([]internal.KnowledgeFile{csvFile("b.csv"), csvFile("c.csv")}); err == nil {
+		t.Fatal("AddFiles no devolvió el error")
+	}
+	if _, ok := s.GetFile("b.csv"); ok {
+		t.Error("b.csv quedó guardado a pesar del rollback")
+	}
+	if s.FileCount() != 1 {
+		t.Errorf("FileCount = %d, want 1", s.FileCount())
+	}
+}
+
+func TestSessionFilesAddFilesInsertError(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	s.TouchSession("s1")
+	failInserts(t, s)
+	kb := SessionFiles(s, "s1")
+	total, err := kb.AddFiles([]internal.KnowledgeFile{csvFile("a.csv")})
+	if err == nil {
+		t.Fatal("FileScope.AddFiles no devolvió el error del insert")
+	}
+	if total != 0 || len(kb.ListFiles()) != 0 {
+		t.Errorf("total = %d, archivos = %d; want 0", total, len(kb.ListFiles()))
+	}
+}
+
+// Un turno que el outbox guarda tarde queda en su lugar por created_at, y
+// reintentar un lote que ya se guardó no lo duplica.
+func TestSQLiteAppendLateTurn(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	first := []internal.Message{
+		{ID: "u1", Role: internal.RoleUser, Content: "primera", CreatedAt: at(1)},
+		{ID: "a1", Role: internal.RoleAssistant, Content: "respuesta 1", CreatedAt: at(2)},
+	}
+	s.AppendBatchForSession("s1",
+		internal.Message{Role: internal.RoleUser, Content: "segunda", CreatedAt: at(3)},
+		internal.Message{Role: internal.RoleAssistant, Content: "respuesta 2", CreatedAt: at(4)})
+	for range 2 {
+		if _, err := s.TryAppendBatchForSession("s1", first...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"primera", "respuesta 1", "segunda", "respuesta 2"}
+	if got := contents(s.AllForSession("s1")); !slices.Equal(got, want) {
+		t.Errorf("mensajes = %q, want %q", got, want)
+	}
+	if m, ok := s.LastUserMessage("s1"); !ok || m.Content != "segunda" {
+		t.Errorf("LastUserMessage = %+v", m)
+	}
+	// deshacer quita el último turno por fecha, no el último guardado
+	s.UndoTurn("s1")
+	if got := contents(s.AllForSession("s1")); !slices.Equal(got, want[:2]) {
+		t.Errorf("después de deshacer: %q", got)
+	}
+	// el mismo ID en otra sesión es otro mensaje
+	s.AppendBatchForSession("s2", first...)
+	if n := len(s.AllForSession("s2")); n != 2 {
+		t.Errorf("s2: %d mensajes, want 2", n)
+	}
+}
+
+func TestSQLiteMigrateDuplicateUIDs(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	// una base de antes del índice único, con un turno guardado dos veces
+	if _, err := s.db.Exec(`DROP INDEX idx_messages_session_uid`); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		for _, m := range []internal.Message{
+			{ID: "u1", Role: internal.RoleUser, Content: "hola", CreatedAt: at(1)},
+			{ID: "a1", Role: internal.RoleAssistant, Content: "¡Hola!", CreatedAt: at(2)},
+		} {
+			if _, err := s.db.Exec(`INSERT INTO messages (session_id, uid, role, content, created_at) VALUES (?, ?, ?, ?, ?)`,
+				"s1", m.ID, string(m.Role), m.Content, m.CreatedAt.UnixNano()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := s.migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(s.AllForSession("s1")); !slices.Equal(got, []string{"hola", "¡Hola!"}) {
+		t.Errorf("mensajes = %q", got)
+	}
+}
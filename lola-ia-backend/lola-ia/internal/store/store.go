@@ -0,0 +1,144 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+	"github.com/nubank/lola-ia-backend/internal/textnorm"
+)
+
+// Store es lo que los handlers necesitan de un backend de persistencia.
+// Nuevos backends (Redis, Postgres, ...) solo tienen que implementarlo.
+// Los mensajes están separados por sesión; los archivos son globales y la
+// separación por sesión la hace FileScope sobre los nombres.
+type Store interface {
+	// TouchSession registra actividad en la sesión id y devuelve true si no
+	// existía (para que el caller la siembre con el saludo).
+	TouchSession(id string) bool
+	SessionCount() int
+	// Sessions devuelve las sesiones cuyo ID empieza con prefix, de la de
+	// actividad más reciente a la más vieja.
+	Sessions(prefix string) []internal.SessionInfo
+	// DeleteSession borra la sesión id con sus mensajes y sus archivos
+	// propios (ver FileScope); false si no existía. Su consumo (AddUsage) y
+	// sus conversaciones archivadas quedan.
+	DeleteSession(id string) bool
+	AllForSession(id string) []internal.Message
+	// RangeForSession devuelve, en orden cronológico, los últimos limit
+	// mensajes anteriores a before (zero = sin tope) y si quedan más antiguos.
+	RangeForSession(id string, before time.Time, limit int) ([]internal.Message, bool)
+	// AppendForSession guarda msg asignándole un ID si no trae uno y
+	// devuelve el mensaje tal como quedó guardado.
+	AppendForSession(id string, msg internal.Message) internal.Message
+	// AppendBatchForSession guarda msgs juntos y en orden (p.ej. la consulta
+	// y su respuesta): ningún otro request ve el turno a medias ni puede
+	// intercalar mensajes entre ellos. Devuelve los mensajes guardados.
+	AppendBatchForSession(id string, msgs ...internal.Message) []internal.Message
+	GetMessage(sessionID, msgID string) (internal.Message, bool)
+	// RemoveMessage borra un único mensaje; false si no existía.
+	RemoveMessage(sessionID, msgID string) bool
+	ResetForSession(id string)
+	// UndoTurn quita el último turno (el último mensaje del usuario y lo que
+	// vino después) y lo guarda para RedoTurn; false si no había ninguno.
+	UndoTurn(sessionID string) bool
+	// RedoTurn restaura el último turno deshecho, salvo que se haya agregado
+	// un mensaje desde entonces; false si no hay nada para rehacer.
+	RedoTurn(sessionID string) bool
+	// LastUserMessage devuelve el último mensaje del usuario en la sesión.
+	LastUserMessage(sessionID string) (internal.Message, bool)
+	// Conversations devuelve las sesiones cuyo ID empieza con prefix y que
+	// ya tienen un mensaje del usuario o un título propio, de la más
+	// reciente a la más vieja.
+	Conversations(prefix string) []internal.Conversation
+	// ArchiveSession mueve la conversación de la sesión id (mensajes,
+	// título y fechas) al archivo con el ID archiveID y deja la sesión vacía
+	// para empezar otra. false (sin cambios) si no había nada que archivar:
+	// ni mensajes del usuario ni título propio.
+	ArchiveSession(id, archiveID string) (internal.ArchivedConversation, bool)
+	// ArchivedConversations devuelve las conversaciones archivadas cuyo ID
+	// empieza con prefix, de la archivada más reciente a la más vieja.
+	ArchivedConversations(prefix string) []internal.ArchivedConversation
+	// ArchivedMessages devuelve los mensajes de una conversación archivada;
+	// false si no existe.
+	ArchivedMessages(archiveID string) (internal.ArchivedConversation, []internal.Message, bool)
+	// DeleteArchived borra definitivamente una conversación archivada;
+	// false si no existía.
+	DeleteArchived(archiveID string) bool
+	// SetTitle fija el título propio de la sesión (vacío vuelve al
+	// automático); false si la sesión no existe.
+	SetTitle(sessionID, title string) bool
+	// SearchForSession busca query en el contenido de los mensajes (sin
+	// distinguir mayúsculas ni acentos) y devuelve hasta limit coincidencias
+	// y si había más.
+	SearchForSession(id, query string, limit int) ([]internal.SearchHit, bool)
+
+	// AddUsage suma u al consumo acumulado de la sesión id. Es aparte de la
+	// conversación: ni ResetForSession ni ArchiveSession lo tocan.
+	AddUsage(id string, u internal.Usage)
+	// UsageBySession devuelve el consumo de las sesiones cuyo ID empieza con
+	// prefix, de la que más tokens usó a la que menos.
+	UsageBySession(prefix string) []internal.SessionUsage
+	// ClearUsage borra el consumo de las sesiones cuyo ID empieza con prefix
+	// (vacío = todas) y devuelve de cuántas.
+	ClearUsage(prefix string) int
+
+	// SetByteLimits fija los límites que aplica AddFiles.
+	SetByteLimits(l ByteLimits)
+	// SetAnnotateOptions fija cómo se parsean los archivos guardados (ver
+	// tabular.Annotate). Se llama al arrancar, antes de agregar archivos.
+	SetAnnotateOptions(o tabular.AnnotateOptions)
+	// AddFiles agrega (o reemplaza por nombre) los archivos y devuelve el
+	// total. Si se supera un límite devuelve *LimitError y no agrega ninguno;
+	// cualquier otro error es de la base y tampoco agrega ninguno.
+	AddFiles(files []internal.KnowledgeFile) (int, error)
+	ListFiles() []internal.KnowledgeFile
+	// ListFilesByTag es ListFiles limitado a los archivos con alguno de
+	// tags (sin distinguir mayúsculas ni acentos); sin tags, todos.
+	ListFilesByTag(tags ...string) []internal.KnowledgeFile
+	// SetTags reemplaza los tags del archivo name; false si no existe.
+	SetTags(name string, tags []string) bool
+	GetFile(name string) (internal.KnowledgeFile, bool)
+	RemoveFile(name string) int
+	// RemoveByPrefix borra los archivos cuyo nombre empieza con prefix y
+	// devuelve cuántos borró y cuántos quedan. Un prefix vacío no borra nada.
+	RemoveByPrefix(prefix string) (removed, remaining int)
+	ClearFiles()
+	// FileCount es len(ListFiles()) sin leer ni parsear los archivos.
+	FileCount() int
+	// FileNames son los nombres de ListFiles(), en el mismo orden, sin leer
+	// ni parsear los archivos.
+	FileNames() []string
+}
+
+// searchMessages es la búsqueda común a los stores: recorre msgs en orden y
+// arma cada coincidencia con el mensaje anterior y el siguiente.
+func searchMessages(msgs []internal.Message, query string, limit int) ([]internal.SearchHit, bool) {
+	q := textnorm.Fold(query)
+	hits := make([]internal.SearchHit, 0)
+	for i, m := range msgs {
+		if !strings.Contains(textnorm.Fold(m.Content), q) {
+			continue
+		}
+		if len(hits) == limit {
+			return hits, true
+		}
+		hit := internal.SearchHit{Message: m, Index: i}
+		if i > 0 {
+			prev := msgs[i-1]
+			hit.Before = &prev
+		}
+		if i+1 < len(msgs) {
+			next := msgs[i+1]
+			hit.After = &next
+		}
+		hits = append(hits, hit)
+	}
+	return hits, false
+}
+
+var (
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*SQLiteStore)(nil)
+)
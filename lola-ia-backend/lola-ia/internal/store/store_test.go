@@ -0,0 +1,235 @@
+package store
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+// eachStore corre fn contra el store en memoria y contra SQLite: los dos
+// tienen que comportarse igual.
+func eachStore(t *testing.T, fn func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) { fn(t, NewMemoryStore()) })
+	t.Run("sqlite", func(t *testing.T) { fn(t, newTestSQLiteStore(t)) })
+}
+
+// at es t0 + n segundos, para armar historiales con fechas conocidas.
+var t0 = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func at(n int) time.Time { return t0.Add(time.Duration(n) * time.Second) }
+
+func contents(msgs []internal.Message) []string {
+	out := make([]string, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Content
+	}
+	return out
+}
+
+func TestRangeForSessionEmpty(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		msgs, more := s.RangeForSession("vacía", time.Time{}, 10)
+		if len(msgs) != 0 || more {
+			t.Errorf("msgs = %v, more = %v", contents(msgs), more)
+		}
+		msgs, more = s.RangeForSession("vacía", at(5), 10)
+		if len(msgs) != 0 || more {
+			t.Errorf("con before: msgs = %v, more = %v", contents(msgs), more)
+		}
+	})
+}
+
+func TestRangeForSession(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		// m0..m4 con un segundo entre cada uno
+		for i, c := range []string{"m0", "m1", "m2", "m3", "m4"} {
+			s.AppendForSession("s1", internal.Message{Role: internal.RoleUser, Content: c, CreatedAt: at(i)})
+		}
+		cases := []struct {
+			name   string
+			before time.Time
+			limit  int
+			want   []string
+			more   bool
+		}{
+			{"sin before", time.Time{}, 2, []string{"m3", "m4"}, true},
+			{"todo", time.Time{}, 10, []string{"m0", "m1", "m2", "m3", "m4"}, false},
+			{"limit justo", time.Time{}, 5, []string{"m0", "m1", "m2", "m3", "m4"}, false},
+			// before es exclusivo: el mensaje de ese instante no entra
+			{"before exacto", at(3), 10, []string{"m0", "m1", "m2"}, false},
+			{"before entre dos", at(3).Add(time.Millisecond), 2, []string{"m2", "m3"}, true},
+			{"before del primero", at(0), 10, nil, false},
+			{"before antes de todo", at(-10), 10, nil, false},
+			{"before después de todo", at(100), 1, []string{"m4"}, true},
+		}
+		for _, tc := range cases {
+			msgs, more := s.RangeForSession("s1", tc.before, tc.limit)
+			if got := contents(msgs); !slices.Equal(got, tc.want) || more != tc.more {
+				t.Errorf("%s: %v, more = %v; want %v, %v", tc.name, got, more, tc.want, tc.more)
+			}
+		}
+	})
+}
+
+func TestSearchForSession(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		for i, c := range []string{
+			"hola",
+			"quiero un analisis de quejas",
+			"acá va el Análisis",
+			"gracias",
+			"ANÁLISIS de nuevo",
+		} {
+			s.AppendForSession("s1", internal.Message{Role: internal.RoleUser, Content: c, CreatedAt: at(i)})
+		}
+		s.AppendForSession("otra", internal.Message{Role: internal.RoleUser, Content: "análisis ajeno", CreatedAt: at(0)})
+
+		for _, q := range []string{"análisis", "analisis", "ANALISIS"} {
+			hits, more := s.SearchForSession("s1", q, 10)
+			if len(hits) != 3 || more {
+				t.Errorf("%q: %d resultados, more = %v; want 3", q, len(hits), more)
+				continue
+			}
+			// con el mensaje de antes y el de después para ubicarlo
+			h := hits[0]
+			if h.Index != 1 || h.Message.ID == "" || h.Before == nil || h.Before.Content != "hola" || h.After == nil {
+				t.Errorf("%q: primer resultado = %+v", q, h)
+			}
+			if last := hits[2]; last.After != nil {
+				t.Errorf("%q: el último mensaje no tiene siguiente: %+v", q, last.After)
+			}
+		}
+
+		hits, more := s.SearchForSession("s1", "análisis", 2)
+		if len(hits) != 2 || !more {
+			t.Errorf("con tope: %d resultados, more = %v", len(hits), more)
+		}
+		if hits, _ := s.SearchForSession("s1", "reembolso", 10); len(hits) != 0 {
+			t.Errorf("sin coincidencias: %d resultados", len(hits))
+		}
+	})
+}
+
+func TestRemoveByPrefix(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		var files []internal.KnowledgeFile
+		for _, name := range []string{"survey_2024_q1.csv", "survey_2024_q2.csv", "survey_2023.csv", "otro.csv"} {
+			files = append(files, internal.KnowledgeFile{Name: name, Text: "a\n1\n", Size: 4})
+		}
+		if _, err := s.AddFiles(files); err != nil {
+			t.Fatal(err)
+		}
+		removed, remaining := s.RemoveByPrefix("survey_2024_")
+		if removed != 2 || remaining != 2 {
+			t.Errorf("removed = %d, remaining = %d; want 2, 2", removed, remaining)
+		}
+		if _, ok := s.GetFile("survey_2023.csv"); !ok {
+			t.Error("survey_2023.csv no debería borrarse")
+		}
+		if removed, remaining := s.RemoveByPrefix("nada_"); removed != 0 || remaining != 2 {
+			t.Errorf("sin coincidencias: removed = %d, remaining = %d", removed, remaining)
+		}
+	})
+}
+
+func TestLastUserMessage(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		if m, ok := s.LastUserMessage("s1"); ok {
+			t.Errorf("sesión vacía: %+v", m)
+		}
+		s.AppendForSession("s1", internal.Message{Role: internal.RoleAssistant, Content: "¡Hola!", CreatedAt: at(0)})
+		if _, ok := s.LastUserMessage("s1"); ok {
+			t.Error("solo el saludo: no hay mensaje del usuario")
+		}
+		s.AppendForSession("s1", internal.Message{Role: internal.RoleUser, Content: "a", CreatedAt: at(1)})
+		s.AppendForSession("s1", internal.Message{Role: internal.RoleUser, Content: "b", CreatedAt: at(2)})
+		s.AppendForSession("s1", internal.Message{Role: internal.RoleAssistant, Content: "respuesta", CreatedAt: at(3)})
+		if m, ok := s.LastUserMessage("s1"); !ok || m.Content != "b" || !m.CreatedAt.Equal(at(2)) {
+			t.Errorf("LastUserMessage = %+v, %v", m, ok)
+		}
+		if _, ok := s.LastUserMessage("otra"); ok {
+			t.Error("otra sesión no tiene mensajes")
+		}
+	})
+}
+
+func TestUndoRedoTurn(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		if s.UndoTurn("s1") || s.RedoTurn("s1") {
+			t.Error("sesión vacía: no hay nada que deshacer ni rehacer")
+		}
+		s.AppendForSession("s1", internal.Message{Role: internal.RoleAssistant, Content: "saludo", CreatedAt: at(0)})
+		if s.UndoTurn("s1") {
+			t.Error("solo el saludo: no hay turno para deshacer")
+		}
+		for i, c := range []string{"p1", "r1", "p2", "r2"} {
+			role := internal.RoleUser
+			if i%2 == 1 {
+				role = internal.RoleAssistant
+			}
+			s.AppendForSession("s1", internal.Message{Role: role, Content: c, CreatedAt: at(i + 1)})
+		}
+
+		if !s.UndoTurn("s1") || !s.UndoTurn("s1") {
+			t.Fatal("UndoTurn = false con turnos")
+		}
+		if got := contents(s.AllForSession("s1")); !slices.Equal(got, []string{"saludo"}) {
+			t.Errorf("después de deshacer dos: %v", got)
+		}
+		if s.UndoTurn("s1") {
+			t.Error("no quedaban turnos")
+		}
+		if !s.RedoTurn("s1") {
+			t.Fatal("RedoTurn = false")
+		}
+		if got := contents(s.AllForSession("s1")); !slices.Equal(got, []string{"saludo", "p1", "r1"}) {
+			t.Errorf("después de rehacer: %v", got)
+		}
+
+		// un mensaje nuevo invalida lo que quedaba por rehacer
+		s.AppendForSession("s1", internal.Message{Role: internal.RoleUser, Content: "p3", CreatedAt: at(10)})
+		if s.RedoTurn("s1") {
+			t.Error("RedoTurn después de un mensaje nuevo")
+		}
+		if got := contents(s.AllForSession("s1")); !slices.Equal(got, []string{"saludo", "p1", "r1", "p3"}) {
+			t.Errorf("historial = %v", got)
+		}
+	})
+}
+
+func TestUndoDepth(t *testing.T) {
+	s := NewMemoryStore()
+	for i := 0; i < undoDepth+5; i++ {
+		s.AppendForSession("s1", internal.Message{Role: internal.RoleUser, Content: "p", CreatedAt: at(i)})
+	}
+	for s.UndoTurn("s1") {
+	}
+	var redone int
+	for s.RedoTurn("s1") {
+		redone++
+	}
+	if redone != undoDepth {
+		t.Errorf("se rehicieron %d turnos, want %d", redone, undoDepth)
+	}
+}
+
+// Las opciones de parseo son de cada store: dos stores en el mismo proceso
+// pueden parsear distinto.
+func TestSetAnnotateOptions(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		plain := NewMemoryStore()
+		s.SetAnnotateOptions(tabular.AnnotateOptions{SnakeCaseHeaders: true})
+		for _, st := range []Store{s, plain} {
+			st.AddFiles([]internal.KnowledgeFile{{Name: "nps.csv", Text: "Customer Name,NPS\nAna,9\n"}})
+		}
+		if f, ok := s.GetFile("nps.csv"); !ok || f.Parsed == nil || f.Parsed.Headers[0] != "customer_name" {
+			t.Errorf("con SnakeCaseHeaders: %+v", f.Parsed)
+		}
+		if f, ok := plain.GetFile("nps.csv"); !ok || f.Parsed == nil || f.Parsed.Headers[0] != "Customer Name" {
+			t.Errorf("sin opciones: %+v", f.Parsed)
+		}
+	})
+}
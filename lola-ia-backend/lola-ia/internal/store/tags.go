@@ -0,0 +1,53 @@
+package store
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/textnorm"
+)
+
+// NormalizeTags deja los tags en minúscula y sin espacios de más, separa los
+// que vienen juntos ("cards,pix"), descarta vacíos y repetidos y los ordena.
+// Devuelve nil si no queda ninguno.
+func NormalizeTags(tags []string) []string {
+	var out []string
+	for _, t := range tags {
+		for _, part := range strings.Split(t, ",") {
+			part = strings.ToLower(strings.Join(strings.Fields(part), " "))
+			if part != "" && !slices.Contains(out, part) {
+				out = append(out, part)
+			}
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// hasAnyTag indica si f tiene alguno de tags, sin distinguir acentos.
+func hasAnyTag(f internal.KnowledgeFile, tags []string) bool {
+	for _, have := range f.Tags {
+		for _, want := range tags {
+			if textnorm.Fold(have) == textnorm.Fold(want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterByTag devuelve los archivos de files con alguno de tags; sin tags,
+// files tal cual.
+func filterByTag(files []internal.KnowledgeFile, tags []string) []internal.KnowledgeFile {
+	if len(tags) == 0 {
+		return files
+	}
+	out := make([]internal.KnowledgeFile, 0, len(files))
+	for _, f := range files {
+		if hasAnyTag(f, tags) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
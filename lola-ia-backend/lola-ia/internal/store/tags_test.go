@@ -0,0 +1,62 @@
+package store
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags([]string{" Pix ", "cards,  Tarjetas  de crédito", "pix", ""})
+	want := []string{"cards", "pix", "tarjetas de crédito"}
+	if !slices.Equal(got, want) {
+		t.Errorf("NormalizeTags = %q, want %q", got, want)
+	}
+	if got := NormalizeTags(nil); len(got) != 0 {
+		t.Errorf("NormalizeTags(nil) = %q", got)
+	}
+}
+
+func TestListFilesByTag(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		s.AddFiles([]internal.KnowledgeFile{
+			{Name: "a.csv", Text: "id\n1\n", Tags: []string{"cards"}},
+			{Name: "b.csv", Text: "id\n2\n", Tags: []string{"pix", "Cartões"}},
+			{Name: "c.csv", Text: "id\n3\n"},
+		})
+		names := func(tags ...string) []string {
+			var out []string
+			for _, f := range s.ListFilesByTag(tags...) {
+				out = append(out, f.Name)
+			}
+			slices.Sort(out)
+			return out
+		}
+		cases := []struct {
+			tags []string
+			want []string
+		}{
+			{nil, []string{"a.csv", "b.csv", "c.csv"}}, // sin tags, todos
+			{[]string{"pix"}, []string{"b.csv"}},
+			{[]string{"cartoes"}, []string{"b.csv"}}, // sin distinguir acentos
+			{[]string{"cards", "pix"}, []string{"a.csv", "b.csv"}},
+			{[]string{"otro"}, nil},
+		}
+		for _, tc := range cases {
+			if got := names(tc.tags...); !slices.Equal(got, tc.want) {
+				t.Errorf("ListFilesByTag(%q) = %q, want %q", tc.tags, got, tc.want)
+			}
+		}
+
+		if !s.SetTags("c.csv", []string{"PIX"}) || s.SetTags("nada.csv", []string{"pix"}) {
+			t.Error("SetTags")
+		}
+		if got := names("pix"); !slices.Equal(got, []string{"b.csv", "c.csv"}) {
+			t.Errorf("después de SetTags: %q", got)
+		}
+		if f, _ := s.GetFile("c.csv"); !slices.Equal(f.Tags, []string{"pix"}) {
+			t.Errorf("tags guardados = %q", f.Tags)
+		}
+	})
+}
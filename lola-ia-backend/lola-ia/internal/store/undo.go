@@ -0,0 +1,66 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// undoDepth es cuántos turnos deshechos se recuerdan por sesión.
+const undoDepth = 10
+
+// undoStacks guarda, por sesión, los turnos quitados con UndoTurn para que
+// RedoTurn los restaure. Vive en memoria en ambos stores: un reinicio pierde
+// la posibilidad de rehacer, no los mensajes.
+type undoStacks struct {
+	mu     sync.Mutex
+	stacks map[string][][]internal.Message
+}
+
+func (u *undoStacks) push(sessionID string, turn []internal.Message) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.stacks == nil {
+		u.stacks = make(map[string][][]internal.Message)
+	}
+	st := append(u.stacks[sessionID], turn)
+	if len(st) > undoDepth {
+		st = st[len(st)-undoDepth:]
+	}
+	u.stacks[sessionID] = st
+}
+
+// pop saca el último turno deshecho de la sesión.
+func (u *undoStacks) pop(sessionID string) ([]internal.Message, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	st := u.stacks[sessionID]
+	if len(st) == 0 {
+		return nil, false
+	}
+	turn := st[len(st)-1]
+	if len(st) == 1 {
+		delete(u.stacks, sessionID)
+	} else {
+		u.stacks[sessionID] = st[:len(st)-1]
+	}
+	return turn, true
+}
+
+// clear olvida lo deshecho en la sesión: un mensaje nuevo invalida el redo.
+func (u *undoStacks) clear(sessionID string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.stacks, sessionID)
+}
+
+// lastTurn devuelve desde dónde empieza el último turno de msgs (el último
+// mensaje del usuario); -1 si no hay ninguno, p.ej. solo el saludo.
+func lastTurn(msgs []internal.Message) int {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == internal.RoleUser {
+			return i
+		}
+	}
+	return -1
+}
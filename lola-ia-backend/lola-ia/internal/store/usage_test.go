@@ -0,0 +1,39 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestUsageBySession(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		s.TouchSession("k1:a")
+		s.AddUsage("k1:a", internal.Usage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15})
+		s.AddUsage("k1:a", internal.Usage{InputTokens: 20, OutputTokens: 7, TotalTokens: 27})
+		s.AddUsage("k1:b", internal.Usage{InputTokens: 100, OutputTokens: 1, TotalTokens: 101})
+		s.AddUsage("k2:a", internal.Usage{InputTokens: 1, OutputTokens: 1, TotalTokens: 2})
+
+		got := s.UsageBySession("k1:")
+		if len(got) != 2 || got[0].SessionID != "k1:b" || got[1].SessionID != "k1:a" {
+			t.Fatalf("UsageBySession = %+v", got)
+		}
+		if a := got[1]; a.InputTokens != 30 || a.OutputTokens != 12 || a.TotalTokens != 42 || a.Replies != 2 || a.UpdatedAt.IsZero() {
+			t.Errorf("k1:a = %+v", a)
+		}
+
+		// la conversación se puede borrar; el consumo queda
+		s.ResetForSession("k1:a")
+		s.DeleteSession("k1:a")
+		if got := s.UsageBySession("k1:a"); len(got) != 1 || got[0].TotalTokens != 42 {
+			t.Errorf("después de reset y delete: %+v", got)
+		}
+
+		if n := s.ClearUsage("k1:"); n != 2 {
+			t.Errorf("ClearUsage = %d, want 2", n)
+		}
+		if got := s.UsageBySession(""); len(got) != 1 || got[0].SessionID != "k2:a" {
+			t.Errorf("después de ClearUsage: %+v", got)
+		}
+	})
+}
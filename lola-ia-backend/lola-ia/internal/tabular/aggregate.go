@@ -0,0 +1,146 @@
+package tabular
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// Funciones de agregación que acepta Aggregate.
+const (
+	AggCount = "count"
+	AggSum   = "sum"
+	AggAvg   = "avg"
+	AggMin   = "min"
+	AggMax   = "max"
+)
+
+// AggregateFuncs son las funciones válidas, para los mensajes de error.
+var AggregateFuncs = []string{AggCount, AggSum, AggAvg, AggMin, AggMax}
+
+// Aggregate calcula q.Func sobre q.Column en las filas de t, agrupadas por
+// q.GroupBy (sin GroupBy hay un único grupo con clave ""). Las columnas se
+// buscan como SnakeCase. count cuenta filas y no
+// necesita Column; las demás funciones ignoran las celdas vacías y fallan si
+// alguna otra no es un número. Los grupos salen ordenados por valor, de
+// mayor a menor; un grupo sin números no tiene valor (salvo en sum, que es 0).
+func Aggregate(t *internal.Table, q internal.FileQueryRequest) ([]internal.AggregateGroup, error) {
+	fn := strings.ToLower(strings.TrimSpace(q.Func))
+	if fn == "" {
+		fn = AggCount
+	}
+	valid := false
+	for _, f := range AggregateFuncs {
+		valid = valid || f == fn
+	}
+	if !valid {
+		return nil, fmt.Errorf("función desconocida %q: usar %s", q.Func, strings.Join(AggregateFuncs, ", "))
+	}
+	group, value := -1, -1
+	if q.GroupBy != "" {
+		i, ok := columnIndex(t, q.GroupBy)
+		if !ok {
+			return nil, fmt.Errorf("columna no encontrada: %s", q.GroupBy)
+		}
+		group = i
+	}
+	if fn != AggCount {
+		if q.Column == "" {
+			return nil, fmt.Errorf("%s requiere column", fn)
+		}
+		i, ok := columnIndex(t, q.Column)
+		if !ok {
+			return nil, fmt.Errorf("columna no encontrada: %s", q.Column)
+		}
+		value = i
+	}
+
+	type acc struct {
+		key   string
+		count int
+		v     float64 // suma, mínimo o máximo según fn
+		n     int     // celdas numéricas
+	}
+	groups := make(map[string]*acc)
+	var order []*acc
+	for r, row := range t.Rows {
+		key := ""
+		if group >= 0 {
+			key = cell(row, group)
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &acc{key: key}
+			groups[key] = g
+			order = append(order, g)
+		}
+		g.count++
+		if value < 0 {
+			continue
+		}
+		v := cell(row, value)
+		if v == "" || nullValues[strings.ToLower(v)] {
+			continue
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			// fila r+2: la 1 es el encabezado
+			return nil, fmt.Errorf("la columna %s no es numérica (fila %d: %q)", t.Headers[value], r+2, v)
+		}
+		switch {
+		case g.n == 0:
+			g.v = n
+		case fn == AggMin:
+			g.v = min(g.v, n)
+		case fn == AggMax:
+			g.v = max(g.v, n)
+		default:
+			g.v += n
+		}
+		g.n++
+	}
+
+	out := make([]internal.AggregateGroup, len(order))
+	for i, g := range order {
+		out[i] = internal.AggregateGroup{Key: g.key, Count: g.count}
+		v := g.v
+		switch {
+		case fn == AggCount:
+			v = float64(g.count)
+		case fn == AggAvg && g.n > 0:
+			v /= float64(g.n)
+		case g.n == 0 && fn != AggSum:
+			// sin números no hay promedio, mínimo ni máximo
+			continue
+		}
+		out[i].Value = &v
+	}
+	// sin valor van al final
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].Value, out[j].Value
+		return a != nil && (b == nil || *a > *b)
+	})
+	return out, nil
+}
+
+// columnIndex busca name entre los encabezados de t como Filters.Apply.
+func columnIndex(t *internal.Table, name string) (int, bool) {
+	want := SnakeCase(name)
+	for i, h := range t.Headers {
+		if SnakeCase(h) == want {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// cell devuelve la celda col de row sin espacios; "" si la fila es corta.
+func cell(row []string, col int) string {
+	if col < len(row) {
+		return strings.TrimSpace(row[col])
+	}
+	return ""
+}
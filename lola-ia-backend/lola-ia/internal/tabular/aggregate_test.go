@@ -0,0 +1,79 @@
+package tabular
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestAggregate(t *testing.T) {
+	tbl, err := ParseCSV("id,Canal,monto\n" +
+		"1,app,10\n" +
+		"2,chat,2.5\n" +
+		"3,app,5\n" +
+		"4,chat,N/A\n" +
+		"5,web,\n" +
+		"6,app\n") // fila corta
+	if err != nil {
+		t.Fatal(err)
+	}
+	type group struct {
+		key   string
+		count int
+		value float64 // -1 = sin valor
+	}
+	cases := []struct {
+		name string
+		q    internal.FileQueryRequest
+		want []group
+	}{
+		{"count por grupo", internal.FileQueryRequest{GroupBy: "canal"}, []group{{"app", 3, 3}, {"chat", 2, 2}, {"web", 1, 1}}},
+		{"sum", internal.FileQueryRequest{GroupBy: "canal", Func: "SUM", Column: "monto"}, []group{{"app", 3, 15}, {"chat", 2, 2.5}, {"web", 1, 0}}},
+		{"avg ignora vacíos", internal.FileQueryRequest{GroupBy: "canal", Func: "avg", Column: "monto"}, []group{{"app", 3, 7.5}, {"chat", 2, 2.5}, {"web", 1, -1}}},
+		{"max", internal.FileQueryRequest{GroupBy: "canal", Func: "max", Column: "monto"}, []group{{"app", 3, 10}, {"chat", 2, 2.5}, {"web", 1, -1}}},
+		{"min sin grupo", internal.FileQueryRequest{Func: "min", Column: "monto"}, []group{{"", 6, 2.5}}},
+	}
+	for _, tc := range cases {
+		got, err := Aggregate(tbl, tc.q)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: %d grupos, want %d", tc.name, len(got), len(tc.want))
+			continue
+		}
+		for i, w := range tc.want {
+			g := got[i]
+			v := -1.0
+			if g.Value != nil {
+				v = *g.Value
+			}
+			if g.Key != w.key || g.Count != w.count || v != w.value {
+				t.Errorf("%s: grupo %d = {%s %d %v}, want %+v", tc.name, i, g.Key, g.Count, v, w)
+			}
+		}
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	tbl, _ := ParseCSV("id,canal,monto\n1,app,10\n2,chat,mucho\n")
+	cases := []struct {
+		q    internal.FileQueryRequest
+		want string
+	}{
+		{internal.FileQueryRequest{Func: "mediana", Column: "monto"}, "función desconocida"},
+		{internal.FileQueryRequest{GroupBy: "region"}, "columna no encontrada: region"},
+		{internal.FileQueryRequest{Func: "sum"}, "sum requiere column"},
+		{internal.FileQueryRequest{Func: "sum", Column: "total"}, "columna no encontrada: total"},
+		{internal.FileQueryRequest{Func: "sum", Column: "canal"}, "la columna canal no es numérica (fila 2"},
+		{internal.FileQueryRequest{Func: "avg", Column: "monto"}, `(fila 3: "mucho")`},
+	}
+	for _, tc := range cases {
+		_, err := Aggregate(tbl, tc.q)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: err = %v, want %q", tc.q, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package tabular
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/textnorm"
+)
+
+// Filters son filtros de filas ya validados; ver CompileFilters.
+type Filters []columnFilter
+
+type columnFilter struct {
+	column string // normalizado con SnakeCase
+	eq     string // normalizado; vacío = sin igualdad
+	from   bound
+	to     bound
+}
+
+// bound es un extremo de un rango: una fecha o un número.
+type bound struct {
+	set  bool
+	date bool
+	t    time.Time
+	n    float64
+}
+
+// CompileFilters valida los filtros de un request. Las columnas se comparan
+// como SnakeCase y los valores sin distinguir mayúsculas ni acentos; From y
+// To son inclusivos y tienen que ser ambos fechas (ver dateLayouts) o números.
+func CompileFilters(m map[string]internal.RowFilter) (Filters, error) {
+	cols := make([]string, 0, len(m))
+	for col := range m {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	out := make(Filters, 0, len(m))
+	for _, col := range cols {
+		rf := m[col]
+		if strings.TrimSpace(col) == "" {
+			return nil, fmt.Errorf("filtro sin nombre de columna")
+		}
+		if rf.Eq == "" && rf.From == "" && rf.To == "" {
+			return nil, fmt.Errorf("filtro vacío para %q: usar eq, from o to", col)
+		}
+		cf := columnFilter{column: SnakeCase(col), eq: textnorm.Fold(strings.TrimSpace(rf.Eq))}
+		var err error
+		if cf.from, err = parseBound(rf.From, false); err != nil {
+			return nil, fmt.Errorf("filtro %q: from %w", col, err)
+		}
+		if cf.to, err = parseBound(rf.To, true); err != nil {
+			return nil, fmt.Errorf("filtro %q: to %w", col, err)
+		}
+		if cf.from.set && cf.to.set && cf.from.date != cf.to.date {
+			return nil, fmt.Errorf("filtro %q: from y to tienen que ser del mismo tipo", col)
+		}
+		out = append(out, cf)
+	}
+	return out, nil
+}
+
+// parseBound interpreta v como fecha o número. Un "to" con fecha sin hora
+// incluye todo ese día.
+func parseBound(v string, upper bool) (bound, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return bound{}, nil
+	}
+	if t, layout, ok := parseDate(v); ok {
+		if upper && !strings.Contains(layout, "15") {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return bound{set: true, date: true, t: t}, nil
+	}
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		return bound{set: true, n: n}, nil
+	}
+	return bound{}, fmt.Errorf("%q no es una fecha ni un número", v)
+}
+
+func parseDate(v string) (time.Time, string, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, layout, true
+		}
+	}
+	return time.Time{}, "", false
+}
+
+// Apply devuelve las filas de t que cumplen todos los filtros. Los filtros
+// sobre columnas que t no tiene se ignoran; si no aplica ninguno devuelve t
+// tal cual y false.
+func (fs Filters) Apply(t *internal.Table) (*internal.Table, bool) {
+	index := make(map[string]int, len(t.Headers))
+	for i, h := range t.Headers {
+		index[SnakeCase(h)] = i
+	}
+	type active struct {
+		columnFilter
+		col int
+	}
+	var act []active
+	for _, f := range fs {
+		if i, ok := index[f.column]; ok {
+			act = append(act, active{f, i})
+		}
+	}
+	if len(act) == 0 {
+		return t, false
+	}
+	out := &internal.Table{Headers: t.Headers, Rows: make([][]string, 0)}
+rows:
+	for _, row := range t.Rows {
+		for _, f := range act {
+			v := ""
+			if f.col < len(row) {
+				v = strings.TrimSpace(row[f.col])
+			}
+			if !f.match(v) {
+				continue rows
+			}
+		}
+		out.Rows = append(out.Rows, row)
+	}
+	return out, true
+}
+
+func (f columnFilter) match(v string) bool {
+	if f.eq != "" && textnorm.Fold(v) != f.eq {
+		return false
+	}
+	if !f.from.set && !f.to.set {
+		return true
+	}
+	date := f.from.date || f.to.date
+	if date {
+		t, _, ok := parseDate(v)
+		if !ok {
+			return false
+		}
+		return (!f.from.set || !t.Before(f.from.t)) && (!f.to.set || !t.After(f.to.t))
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return false
+	}
+	return (!f.from.set || n >= f.from.n) && (!f.to.set || n <= f.to.n)
+}
+
+// CSVText serializa t como CSV (encabezado y filas).
+func CSVText(t *internal.Table) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	_ = w.Write(t.Headers)
+	_ = w.WriteAll(t.Rows)
+	return b.String()
+}
+
+// CSVRows serializa rows como CSV separado por comma, sin encabezado.
+func CSVRows(rows [][]string, comma rune) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Comma = comma
+	_ = w.WriteAll(rows)
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package tabular
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+var feedback = &internal.Table{
+	Headers: []string{"ID", "Canal", "Fecha", "NPS"},
+	Rows: [][]string{
+		{"1", "App", "2024-04-30", "9"},
+		{"2", "chat", "2024-05-01", "3"},
+		{"3", "Encuesta", "2024-05-15 18:30:00", "7"},
+		{"4", "app", "31/05/2024", "10"},
+		{"5", "Cajero automático", "2024-06-01", ""},
+	},
+}
+
+func ids(t *internal.Table) []string {
+	out := make([]string, len(t.Rows))
+	for i, r := range t.Rows {
+		out[i] = r[0]
+	}
+	return out
+}
+
+func TestFiltersApply(t *testing.T) {
+	cases := []struct {
+		name    string
+		filters map[string]internal.RowFilter
+		want    []string
+	}{
+		// columnas como SnakeCase, valores sin mayúsculas ni acentos
+		{"igualdad", map[string]internal.RowFilter{"canal": {Eq: "APP"}}, []string{"1", "4"}},
+		{"igualdad con acentos", map[string]internal.RowFilter{"Canal": {Eq: "cajero automatico"}}, []string{"5"}},
+		// to sin hora incluye todo el día; las filas con fechas en otro formato también cuentan
+		{"rango de fechas", map[string]internal.RowFilter{"fecha": {From: "2024-05-01", To: "2024-05-31"}}, []string{"2", "3", "4"}},
+		{"solo desde", map[string]internal.RowFilter{"fecha": {From: "2024-05-15"}}, []string{"3", "4", "5"}},
+		{"rango numérico", map[string]internal.RowFilter{"nps": {From: "7", To: "9"}}, []string{"1", "3"}},
+		{"combinados", map[string]internal.RowFilter{"canal": {Eq: "app"}, "nps": {From: "10"}}, []string{"4"}},
+		{"sin coincidencias", map[string]internal.RowFilter{"canal": {Eq: "telefono"}}, []string{}},
+	}
+	for _, tc := range cases {
+		fs, err := CompileFilters(tc.filters)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, ok := fs.Apply(feedback)
+		if !ok || !slices.Equal(ids(got), tc.want) {
+			t.Errorf("%s: filas %v (aplicado = %v), want %v", tc.name, ids(got), ok, tc.want)
+		}
+		if !slices.Equal(got.Headers, feedback.Headers) {
+			t.Errorf("%s: headers = %v", tc.name, got.Headers)
+		}
+	}
+}
+
+func TestFiltersMissingColumn(t *testing.T) {
+	fs, err := CompileFilters(map[string]internal.RowFilter{"region": {Eq: "sur"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := fs.Apply(feedback); ok || got != feedback {
+		t.Errorf("sin la columna el archivo tendría que quedar igual: aplicado = %v", ok)
+	}
+}
+
+func TestCompileFiltersInvalid(t *testing.T) {
+	for name, m := range map[string]map[string]internal.RowFilter{
+		"sin columna":   {" ": {Eq: "x"}},
+		"vacío":         {"canal": {}},
+		"from inválido": {"fecha": {From: "ayer"}},
+		"tipos mixtos":  {"fecha": {From: "2024-05-01", To: "10"}},
+	} {
+		if _, err := CompileFilters(m); err == nil {
+			t.Errorf("%s: CompileFilters no falló", name)
+		}
+	}
+}
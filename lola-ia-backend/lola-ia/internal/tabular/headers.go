@@ -0,0 +1,76 @@
+package tabular
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/textnorm"
+)
+
+// AnnotateOptions ajusta cómo Annotate parsea los archivos.
+type AnnotateOptions struct {
+	// SnakeCaseHeaders normaliza los encabezados con NormalizeHeaders
+	// (NORMALIZE_HEADERS=true).
+	SnakeCaseHeaders bool
+}
+
+// SnakeCase normaliza un nombre de columna: en minúsculas, sin acentos y con
+// "_" entre palabras ("Customer Name", "customer-name" y "CustomerName" dan
+// "customer_name"). Todo lo que no es letra ni número separa palabras. Es
+// también como se comparan las columnas en filtros, esquemas y consultas.
+func SnakeCase(h string) string {
+	runes := []rune(strings.TrimSpace(h))
+	var b strings.Builder
+	sep := false
+	for i, r := range runes {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// acento suelto (texto en NFD): Fold lo quita
+			continue
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			sep = true
+			continue
+		case unicode.IsUpper(r) && i > 0:
+			prev := runes[i-1]
+			// "customerName" y el final de una sigla: "HTTPStatus"
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				sep = true
+			}
+		}
+		if sep && b.Len() > 0 {
+			b.WriteByte('_')
+		}
+		sep = false
+		b.WriteString(textnorm.Fold(string(r)))
+	}
+	return b.String()
+}
+
+// NormalizeHeaders pasa los encabezados de t a SnakeCase y devuelve los que
+// cambiaron, en orden. Un encabezado que queda vacío pasa a col_N (N es su
+// posición, desde 1) y uno repetido lleva un sufijo (_2, _3...).
+func NormalizeHeaders(t *internal.Table) []internal.HeaderRename {
+	var renamed []internal.HeaderRename
+	seen := make(map[string]bool, len(t.Headers))
+	for i, h := range t.Headers {
+		name := SnakeCase(h)
+		if name == "" {
+			name = fmt.Sprintf("col_%d", i+1)
+		}
+		if seen[name] {
+			base := name
+			for n := 2; seen[name]; n++ {
+				name = fmt.Sprintf("%s_%d", base, n)
+			}
+		}
+		seen[name] = true
+		if name != h {
+			renamed = append(renamed, internal.HeaderRename{Original: h, Name: name})
+			t.Headers[i] = name
+		}
+	}
+	return renamed
+}
@@ -0,0 +1,64 @@
+package tabular
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestSnakeCase(t *testing.T) {
+	cases := map[string]string{
+		"Customer Name":     "customer_name",
+		"  customer_name  ": "customer_name",
+		"customer-name":     "customer_name",
+		"CustomerName":      "customer_name",
+		"HTTPStatus":        "http_status",
+		"Región / País":     "region_pais",
+		"NPS (0-10)":        "nps_0_10",
+		"Año2024":           "ano2024",
+		"???":               "",
+	}
+	for in, want := range cases {
+		if got := SnakeCase(in); got != want {
+			t.Errorf("SnakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeHeaders(t *testing.T) {
+	tbl := &internal.Table{Headers: []string{"id", "Customer Name", "customer name", "", "NPS"}}
+	renamed := NormalizeHeaders(tbl)
+	if want := []string{"id", "customer_name", "customer_name_2", "col_4", "nps"}; !reflect.DeepEqual(tbl.Headers, want) {
+		t.Errorf("headers = %q, want %q", tbl.Headers, want)
+	}
+	want := []internal.HeaderRename{
+		{Original: "Customer Name", Name: "customer_name"},
+		{Original: "customer name", Name: "customer_name_2"},
+		{Original: "", Name: "col_4"},
+		{Original: "NPS", Name: "nps"},
+	}
+	if !reflect.DeepEqual(renamed, want) {
+		t.Errorf("renamed = %+v", renamed)
+	}
+}
+
+func TestAnnotateSnakeCaseHeaders(t *testing.T) {
+	text := "Customer Name,NPS\nAna,9\n"
+
+	f := internal.KnowledgeFile{Name: "nps.csv", Text: text}
+	Annotate(&f, AnnotateOptions{})
+	if f.Parsed.Headers[0] != "Customer Name" || f.OriginalHeaders != nil {
+		t.Errorf("sin normalizar: %q, %q", f.Parsed.Headers, f.OriginalHeaders)
+	}
+
+	f = internal.KnowledgeFile{Name: "nps.csv", Text: text}
+	Annotate(&f, AnnotateOptions{SnakeCaseHeaders: true})
+	if !reflect.DeepEqual(f.Parsed.Headers, []string{"customer_name", "nps"}) ||
+		!reflect.DeepEqual(f.OriginalHeaders, []string{"Customer Name", "NPS"}) || len(f.RenamedHeaders) != 2 {
+		t.Errorf("normalizado: %q, originales %q, renamed %+v", f.Parsed.Headers, f.OriginalHeaders, f.RenamedHeaders)
+	}
+	if f.Text != text {
+		t.Error("cambió el texto del archivo")
+	}
+}
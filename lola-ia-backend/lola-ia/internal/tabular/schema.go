@@ -0,0 +1,98 @@
+package tabular
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// Schema son las columnas que se esperan en los archivos de un dataset. Se
+// aplica a los archivos cuyo nombre coincide con Pattern (glob de path.Match,
+// sin distinguir mayúsculas); con Strict además se rechazan columnas de más.
+type Schema struct {
+	Name    string   `json:"-"`
+	Pattern string   `json:"pattern"`
+	Columns []string `json:"columns"`
+	Strict  bool     `json:"strict"`
+}
+
+// Schemas son los esquemas cargados, ordenados por nombre.
+type Schemas []Schema
+
+// LoadSchemas lee de path un JSON que mapea cada dataset a su esquema:
+//
+//	{"ventas": {"pattern": "ventas*.csv", "columns": ["fecha", "region", "monto"]}}
+//
+// Sin pattern se usa "<dataset>*".
+func LoadSchemas(path string) (Schemas, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]Schema
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	out := make(Schemas, 0, len(m))
+	for name, s := range m {
+		if len(s.Columns) == 0 {
+			return nil, fmt.Errorf("%s: el dataset %q no tiene columns", path, name)
+		}
+		s.Name = name
+		if s.Pattern == "" {
+			s.Pattern = name + "*"
+		}
+		if _, err := matchName(s.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: pattern inválido en %q: %w", path, name, err)
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Match devuelve el primer esquema (por nombre de dataset) cuyo pattern
+// coincide con el nombre de archivo name.
+func (ss Schemas) Match(name string) (Schema, bool) {
+	for _, s := range ss {
+		if ok, _ := matchName(s.Pattern, name); ok {
+			return s, true
+		}
+	}
+	return Schema{}, false
+}
+
+func matchName(pattern, name string) (bool, error) {
+	return path.Match(strings.ToLower(pattern), strings.ToLower(name))
+}
+
+// Check compara los encabezados de t con el esquema como SnakeCase (sin
+// distinguir mayúsculas, acentos ni separadores) y devuelve las columnas
+// que faltan y, si el esquema es estricto, las que sobran.
+func (s Schema) Check(t *internal.Table) (missing, unexpected []string) {
+	have := make(map[string]bool, len(t.Headers))
+	for _, h := range t.Headers {
+		have[SnakeCase(h)] = true
+	}
+	want := make(map[string]bool, len(s.Columns))
+	for _, c := range s.Columns {
+		key := SnakeCase(c)
+		want[key] = true
+		if !have[key] {
+			missing = append(missing, c)
+		}
+	}
+	if s.Strict {
+		for _, h := range t.Headers {
+			if !want[SnakeCase(h)] {
+				unexpected = append(unexpected, h)
+			}
+		}
+	}
+	return missing, unexpected
+}
@@ -0,0 +1,66 @@
+package tabular
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func writeSchemas(t *testing.T, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "schemas.json")
+	if err := os.WriteFile(p, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadSchemas(t *testing.T) {
+	ss, err := LoadSchemas(writeSchemas(t, `{
+		"ventas": {"pattern": "ventas_*.csv", "columns": ["fecha", "región", "monto"], "strict": true},
+		"nps": {"columns": ["id", "nps"]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ordenados por nombre; sin pattern, "<dataset>*"
+	if len(ss) != 2 || ss[0].Name != "nps" || ss[0].Pattern != "nps*" || ss[1].Name != "ventas" || !ss[1].Strict {
+		t.Errorf("schemas = %+v", ss)
+	}
+	for name, want := range map[string]string{"VENTAS_mayo.csv": "ventas", "nps-2024.csv": "nps", "ventas.csv": "", "otros.csv": ""} {
+		s, ok := ss.Match(name)
+		if ok != (want != "") || s.Name != want {
+			t.Errorf("Match(%q) = %q, %v; want %q", name, s.Name, ok, want)
+		}
+	}
+
+	for _, body := range []string{`{"x": {"columns": []}}`, `{"x": {"pattern": "[", "columns": ["a"]}}`, `[`} {
+		if _, err := LoadSchemas(writeSchemas(t, body)); err == nil {
+			t.Errorf("%s: sin error", body)
+		}
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	s := Schema{Columns: []string{"fecha", "región", "monto"}}
+	cases := []struct {
+		name                string
+		headers             []string
+		strict              bool
+		missing, unexpected []string
+	}{
+		{"completo", []string{"Fecha", "Region", "Monto", "extra"}, false, nil, nil},
+		{"falta una", []string{"fecha", "monto"}, false, []string{"región"}, nil},
+		{"estricto con de más", []string{"fecha", "REGIÓN", "monto", "canal"}, true, nil, []string{"canal"}},
+	}
+	for _, tc := range cases {
+		s.Strict = tc.strict
+		missing, unexpected := s.Check(&internal.Table{Headers: tc.headers})
+		if !slices.Equal(missing, tc.missing) || !slices.Equal(unexpected, tc.unexpected) {
+			t.Errorf("%s: missing %q, unexpected %q", tc.name, missing, unexpected)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package tabular
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// Tipos que puede inferir ColumnStats.
+const (
+	TypeNumber = "number"
+	TypeDate   = "date"
+	TypeString = "string"
+)
+
+// Formatos de fecha que se reconocen al inferir el tipo de una columna.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+	"02/01/2006",
+	"2006/01/02",
+}
+
+// nullValues son los valores que se cuentan como vacíos (además de "").
+var nullValues = map[string]bool{"na": true, "n/a": true, "null": true, "nil": true, "none": true, "-": true}
+
+// ColumnStats calcula estadísticas por columna de t. Recorre una columna a la
+// vez, así que el único mapa vivo es el de valores distintos de esa columna.
+// Las celdas que faltan en filas cortas cuentan como vacías y las que sobran
+// en filas largas se ignoran.
+func ColumnStats(t *internal.Table) []internal.ColumnStats {
+	out := make([]internal.ColumnStats, len(t.Headers))
+	for col, name := range t.Headers {
+		out[col] = columnStats(t.Rows, col, name)
+	}
+	return out
+}
+
+func columnStats(rows [][]string, col int, name string) internal.ColumnStats {
+	st := internal.ColumnStats{Name: name}
+	distinct := make(map[string]struct{})
+	isNumber, isDate, seen := true, true, false
+	var lo, hi float64
+	for _, row := range rows {
+		v := ""
+		if col < len(row) {
+			v = strings.TrimSpace(row[col])
+		}
+		if v == "" || nullValues[strings.ToLower(v)] {
+			st.Nulls++
+			continue
+		}
+		distinct[v] = struct{}{}
+		if isNumber {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				if !seen || f < lo {
+					lo = f
+				}
+				if !seen || f > hi {
+					hi = f
+				}
+			} else {
+				isNumber = false
+			}
+		}
+		if isDate && !parsesAsDate(v) {
+			isDate = false
+		}
+		seen = true
+	}
+	st.Distinct = len(distinct)
+	switch {
+	case !seen:
+		st.Type = TypeString
+	case isNumber:
+		st.Type = TypeNumber
+		st.Min, st.Max = &lo, &hi
+	case isDate:
+		st.Type = TypeDate
+	default:
+		st.Type = TypeString
+	}
+	return st
+}
+
+func parsesAsDate(v string) bool {
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, v); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package tabular
+
+import (
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestColumnStats(t *testing.T) {
+	tbl, err := ParseCSV("id,nps,canal,fecha,extra\n" +
+		"1,9,app,2024-01-05,x\n" +
+		"2,-3.5,chat,2024-02-10\n" +
+		"3,N/A,app,05/03/2024,y,sobra\n" +
+		"4,10,,2024-03-01\n" +
+		"5\n") // fila corta
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := func(v float64) *float64 { return &v }
+	want := []internal.ColumnStats{
+		{Name: "id", Type: TypeNumber, Nulls: 0, Distinct: 5, Min: f(1), Max: f(5)},
+		{Name: "nps", Type: TypeNumber, Nulls: 2, Distinct: 3, Min: f(-3.5), Max: f(10)},
+		{Name: "canal", Type: TypeString, Nulls: 2, Distinct: 2},
+		{Name: "fecha", Type: TypeDate, Nulls: 1, Distinct: 4},
+		{Name: "extra", Type: TypeString, Nulls: 3, Distinct: 2},
+	}
+	got := ColumnStats(tbl)
+	if len(got) != len(want) {
+		t.Fatalf("%d columnas, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Name != w.Name || g.Type != w.Type || g.Nulls != w.Nulls || g.Distinct != w.Distinct ||
+			!sameBound(g.Min, w.Min) || !sameBound(g.Max, w.Max) {
+			t.Errorf("%s: got %+v (min %v, max %v), want %+v", w.Name, g, deref(g.Min), deref(g.Max), w)
+		}
+	}
+}
+
+func TestColumnStatsAllEmpty(t *testing.T) {
+	tbl := &internal.Table{Headers: []string{"vacía"}, Rows: [][]string{{""}, {"null"}}}
+	st := ColumnStats(tbl)[0]
+	if st.Type != TypeString || st.Nulls != 2 || st.Min != nil {
+		t.Errorf("%+v", st)
+	}
+}
+
+func sameBound(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func deref(p *float64) any {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
@@ -0,0 +1,320 @@
+// Package tabular convierte el texto de los archivos subidos en filas estructuradas.
+package tabular
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// Formatos soportados (KnowledgeFile.Format).
+const (
+	FormatCSV  = "csv"
+	FormatTSV  = "tsv"
+	FormatJSON = "json"
+)
+
+// Supported indica si format es uno de los formatos soportados.
+func Supported(format string) bool {
+	return format == FormatCSV || format == FormatTSV || format == FormatJSON
+}
+
+// DetectFormat decide el formato por la extensión de name y, si no la hay o
+// no es conocida, mirando el contenido: un JSON empieza con "[", y un TSV
+// tiene tabs pero no comas en la primera línea.
+func DetectFormat(name, text string) string {
+	if ext := strings.TrimPrefix(strings.ToLower(path.Ext(name)), "."); Supported(ext) {
+		return ext
+	}
+	text = strings.TrimPrefix(text, "\ufeff")
+	if strings.HasPrefix(strings.TrimSpace(text), "[") {
+		return FormatJSON
+	}
+	first, _, _ := strings.Cut(text, "\n")
+	if strings.Contains(first, "\t") && !strings.Contains(first, ",") {
+		return FormatTSV
+	}
+	return FormatCSV
+}
+
+// Parse parsea text según format. Todos los formatos terminan en la misma
+// representación: encabezados más filas de strings.
+func Parse(format, text string) (*internal.Table, error) {
+	switch format {
+	case FormatCSV:
+		return ParseCSV(text)
+	case FormatTSV:
+		return ParseTSV(text)
+	case FormatJSON:
+		return ParseJSON(text)
+	default:
+		return nil, fmt.Errorf("formato no soportado: %q", format)
+	}
+}
+
+// Delimiters son los separadores que reconoce SniffDelimiter, en orden de
+// preferencia ante un empate.
+var Delimiters = []rune{',', ';', '\t', '|'}
+
+// sniffLines es cuántas líneas mira SniffDelimiter.
+const sniffLines = 10
+
+// SniffDelimiter adivina el separador de un CSV mirando las primeras líneas:
+// gana el de Delimiters que aparece (fuera de comillas) la misma cantidad de
+// veces en más líneas que el encabezado, y ante un empate el que más columnas
+// da. Si ninguno aparece en el encabezado devuelve ','.
+func SniffDelimiter(text string) rune {
+	text = strings.TrimPrefix(text, "\ufeff")
+	var lines []string
+	for _, line := range strings.SplitN(text, "\n", sniffLines+1) {
+		if strings.TrimSpace(line) != "" && len(lines) < sniffLines {
+			lines = append(lines, line)
+		}
+	}
+	best, bestScore, bestCols := ',', 0, 0
+	for _, d := range Delimiters {
+		if len(lines) == 0 {
+			break
+		}
+		cols := countOutsideQuotes(lines[0], d)
+		if cols == 0 {
+			continue
+		}
+		score := 0
+		for _, line := range lines {
+			if countOutsideQuotes(line, d) == cols {
+				score++
+			}
+		}
+		if score > bestScore || (score == bestScore && cols > bestCols) {
+			best, bestScore, bestCols = d, score, cols
+		}
+	}
+	return best
+}
+
+// countOutsideQuotes cuenta las apariciones de d en line que no están entre
+// comillas dobles.
+func countOutsideQuotes(line string, d rune) int {
+	n, quoted := 0, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == d && !quoted:
+			n++
+		}
+	}
+	return n
+}
+
+// ParseCSV parsea text como CSV con el separador que detecta SniffDelimiter.
+func ParseCSV(text string) (*internal.Table, error) {
+	return ParseDelimited(text, SniffDelimiter(text))
+}
+
+// ParseDelimited parsea text como CSV separado por comma: la primera fila
+// son los encabezados. Acepta filas con distinta cantidad de columnas,
+// comillas y fin de línea CRLF.
+func ParseDelimited(text string, comma rune) (*internal.Table, error) {
+	text = strings.TrimPrefix(text, "\ufeff") // BOM de Excel
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+
+	headers, err := r.Read()
+	if err == io.EOF {
+		return nil, errors.New("archivo vacío")
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := &internal.Table{Headers: headers, Rows: make([][]string, 0, 64)}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		t.Rows = append(t.Rows, rec)
+	}
+	return t, nil
+}
+
+// ParseTSV parsea text como TSV: campos separados por tab, una fila por
+// línea y sin comillas (las comillas son parte del valor).
+func ParseTSV(text string) (*internal.Table, error) {
+	text = strings.TrimPrefix(text, "\ufeff")
+	lines := strings.Split(strings.TrimRight(text, "\r\n"), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return nil, errors.New("archivo vacío")
+	}
+	t := &internal.Table{Rows: make([][]string, 0, len(lines)-1)}
+	for i, line := range lines {
+		fields := strings.Split(strings.TrimSuffix(line, "\r"), "\t")
+		if i == 0 {
+			t.Headers = fields
+			continue
+		}
+		t.Rows = append(t.Rows, fields)
+	}
+	return t, nil
+}
+
+// ParseJSON parsea un array de objetos. Los encabezados son la unión de las
+// claves en el orden en que aparecen; a una fila sin alguna clave le queda
+// la celda vacía. Los valores anidados se guardan como JSON compacto.
+func ParseJSON(text string) (*internal.Table, error) {
+	var objs []json.RawMessage
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(text, "\ufeff")), &objs); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, errors.New("se esperaba un array de objetos JSON")
+		}
+		return nil, err
+	}
+	if len(objs) == 0 {
+		return nil, errors.New("array JSON vacío")
+	}
+	t := &internal.Table{Rows: make([][]string, 0, len(objs))}
+	col := make(map[string]int)
+	for _, raw := range objs {
+		fields, err := objectFields(raw)
+		if err != nil {
+			return nil, err
+		}
+		row := make([]string, len(t.Headers), len(t.Headers)+len(fields))
+		for _, kv := range fields {
+			i, ok := col[kv.key]
+			if !ok {
+				i = len(t.Headers)
+				col[kv.key] = i
+				t.Headers = append(t.Headers, kv.key)
+				row = append(row, "")
+			}
+			row[i] = jsonCell(kv.value)
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	// las filas anteriores a la aparición de una clave quedan más cortas
+	for i, row := range t.Rows {
+		for len(row) < len(t.Headers) {
+			row = append(row, "")
+		}
+		t.Rows[i] = row
+	}
+	return t, nil
+}
+
+type jsonField struct {
+	key   string
+	value json.RawMessage
+}
+
+// objectFields devuelve los pares clave/valor de un objeto JSON en el orden
+// del texto (un map los perdería).
+func objectFields(raw json.RawMessage) ([]jsonField, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("se esperaba un array de objetos JSON")
+	}
+	var fields []jsonField
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		fields = append(fields, jsonField{key: tok.(string), value: v})
+	}
+	return fields, nil
+}
+
+// jsonCell convierte un valor JSON en el texto de una celda.
+func jsonCell(v json.RawMessage) string {
+	var s string
+	if json.Unmarshal(v, &s) == nil {
+		return s
+	}
+	if string(v) == "null" {
+		return ""
+	}
+	var buf bytes.Buffer
+	if json.Compact(&buf, v) == nil {
+		return buf.String()
+	}
+	return string(v)
+}
+
+// Validate decide si text es un archivo tabular aceptable mirando el
+// contenido y no solo la extensión: descarta binarios y HTML/XML antes de
+// intentar parsearlo en el formato dado.
+func Validate(format, text string) error {
+	if strings.TrimSpace(text) == "" {
+		return errors.New("archivo vacío")
+	}
+	if strings.ContainsRune(text, 0) || !utf8.ValidString(text) {
+		return errors.New("contenido binario, no es texto")
+	}
+	sniff := text[:min(len(text), 512)]
+	ct := http.DetectContentType([]byte(sniff))
+	switch {
+	case strings.HasPrefix(ct, "text/html"), strings.HasPrefix(ct, "text/xml"):
+		return errors.New("parece HTML/XML, no datos tabulares")
+	case !strings.HasPrefix(ct, "text/plain"):
+		return fmt.Errorf("tipo de contenido no soportado (%s)", ct)
+	}
+	if _, err := Parse(format, text); err != nil {
+		return fmt.Errorf("no es un %s válido: %w", strings.ToUpper(format), err)
+	}
+	return nil
+}
+
+// Annotate detecta el formato de f si no lo trae (y el separador si es un
+// CSV), lo parsea y completa f.Parsed o f.ParseError. Con
+// opts.SnakeCaseHeaders normaliza los encabezados de f.Parsed y deja los
+// originales en f.
+func Annotate(f *internal.KnowledgeFile, opts AnnotateOptions) {
+	if f.Format == "" {
+		f.Format = DetectFormat(f.Name, f.Text)
+	}
+	var (
+		t   *internal.Table
+		err error
+	)
+	if f.Format == FormatCSV {
+		d := SniffDelimiter(f.Text)
+		f.Delimiter = string(d)
+		t, err = ParseDelimited(f.Text, d)
+	} else {
+		f.Delimiter = ""
+		t, err = Parse(f.Format, f.Text)
+	}
+	f.OriginalHeaders, f.RenamedHeaders = nil, nil
+	if err != nil {
+		f.Parsed, f.ParseError = nil, err.Error()
+		return
+	}
+	if opts.SnakeCaseHeaders {
+		orig := slices.Clone(t.Headers)
+		if renamed := NormalizeHeaders(t); len(renamed) > 0 {
+			f.OriginalHeaders, f.RenamedHeaders = orig, renamed
+		}
+	}
+	f.Parsed, f.ParseError = t, ""
+}
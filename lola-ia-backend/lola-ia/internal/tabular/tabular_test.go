@@ -0,0 +1,186 @@
+package tabular
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestParseCSV(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want *internal.Table
+	}{
+		{
+			name: "comillas",
+			in:   "id,comentario\n1,\"dijo \"\"hola\"\"\"\n",
+			want: &internal.Table{Headers: []string{"id", "comentario"}, Rows: [][]string{{"1", `dijo "hola"`}}},
+		},
+		{
+			name: "coma dentro de comillas",
+			in:   "id,comentario\n1,\"lento, caro\"\n2,ok\n",
+			want: &internal.Table{Headers: []string{"id", "comentario"}, Rows: [][]string{{"1", "lento, caro"}, {"2", "ok"}}},
+		},
+		{
+			name: "CRLF",
+			in:   "id,nps\r\n1,9\r\n2,3\r\n",
+			want: &internal.Table{Headers: []string{"id", "nps"}, Rows: [][]string{{"1", "9"}, {"2", "3"}}},
+		},
+		{
+			name: "salto de línea dentro de comillas",
+			in:   "id,comentario\r\n1,\"línea 1\r\nlínea 2\"\r\n",
+			want: &internal.Table{Headers: []string{"id", "comentario"}, Rows: [][]string{{"1", "línea 1\nlínea 2"}}},
+		},
+		{
+			name: "BOM y filas desparejas",
+			in:   "\ufeffa,b\n1\n2,3,4\n",
+			want: &internal.Table{Headers: []string{"a", "b"}, Rows: [][]string{{"1"}, {"2", "3", "4"}}},
+		},
+	}
+	for _, tc := range cases {
+		got, err := ParseCSV(tc.in)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	for _, in := range []string{"", "a,b\n1,\"sin cerrar\n"} {
+		if _, err := ParseCSV(in); err == nil {
+			t.Errorf("ParseCSV(%q) debería fallar", in)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	f := internal.KnowledgeFile{Name: "ok.csv", Text: "a,b\n1,2\n"}
+	Annotate(&f, AnnotateOptions{})
+	if f.Format != FormatCSV || f.Parsed == nil || f.ParseError != "" || len(f.Parsed.Rows) != 1 {
+		t.Errorf("CSV válido: %+v", f)
+	}
+
+	// un CSV roto se acepta igual, marcado con el error
+	bad := internal.KnowledgeFile{Name: "roto.csv", Text: "a,b\n1,\"sin cerrar\n"}
+	Annotate(&bad, AnnotateOptions{})
+	if bad.Parsed != nil || bad.ParseError == "" {
+		t.Errorf("CSV roto: Parsed = %v, ParseError = %q", bad.Parsed, bad.ParseError)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := []struct{ name, text, want string }{
+		{"a.csv", "[1]", FormatCSV}, // la extensión manda
+		{"a.TSV", "a,b", FormatTSV},
+		{"a.json", "", FormatJSON},
+		{"export", "  [{\"a\":1}]", FormatJSON},
+		{"export.txt", "a\tb\n1\t2\n", FormatTSV},
+		{"export.txt", "a,b\tc\n", FormatCSV},
+		{"", "a;b\n1;2\n", FormatCSV},
+	}
+	for _, tc := range cases {
+		if got := DetectFormat(tc.name, tc.text); got != tc.want {
+			t.Errorf("DetectFormat(%q, %q) = %s, want %s", tc.name, tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestParseTSV(t *testing.T) {
+	got, err := ParseTSV("id\tcomentario\r\n1\t\"con comillas\", y coma\r\n2\t\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &internal.Table{
+		Headers: []string{"id", "comentario"},
+		Rows:    [][]string{{"1", `"con comillas", y coma`}, {"2", ""}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	// claves distintas en cada objeto: los encabezados son la unión en orden
+	got, err := ParseJSON(`[
+		{"id": 1, "canal": "app"},
+		{"id": 2, "nps": 9.5, "canal": null},
+		{"extra": {"a": [1, 2]}, "id": "3", "ok": true}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &internal.Table{
+		Headers: []string{"id", "canal", "nps", "extra", "ok"},
+		Rows: [][]string{
+			{"1", "app", "", "", ""},
+			{"2", "", "9.5", "", ""},
+			{"3", "", "", `{"a":[1,2]}`, "true"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for _, in := range []string{`[]`, `{"id": 1}`, `[1, 2]`, `[{"id": 1}`} {
+		if _, err := ParseJSON(in); err == nil {
+			t.Errorf("ParseJSON(%q) debería fallar", in)
+		}
+	}
+}
+
+func TestAnnotateFormats(t *testing.T) {
+	for _, f := range []internal.KnowledgeFile{
+		{Name: "a.tsv", Text: "id\tnps\n1\t9\n"},
+		{Name: "a.json", Text: `[{"id":1,"nps":9}]`},
+	} {
+		Annotate(&f, AnnotateOptions{})
+		if f.Parsed == nil || len(f.Parsed.Headers) != 2 || len(f.Parsed.Rows) != 1 || f.Delimiter != "" {
+			t.Errorf("%s: %+v", f.Name, f)
+		}
+	}
+}
+
+func TestSniffDelimiter(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want rune
+	}{
+		{"coma", "id,comentario,nps\n1,ok,9\n", ','},
+		{"punto y coma", "id;comentario;nps\n1;ok;9\n", ';'},
+		{"tab", "id\tcomentario\tnps\n1\tok\t9\n", '\t'},
+		{"pipe", "id|comentario|nps\n1|ok|9\n", '|'},
+		{"coma decimal europea", "id;monto;nps\n1;12,50;9\n2;3,75;7\n", ';'},
+		{"separador entre comillas", "id;comentario\n1;\"lento, caro, malo\"\n2;\"a, b\"\n", ';'},
+		{"BOM", "\ufeffid;nps\n1;9\n", ';'},
+		{"una columna", "comentario\nok\n", ','},
+		{"vacío", "", ','},
+	}
+	for _, tc := range cases {
+		if got := SniffDelimiter(tc.in); got != tc.want {
+			t.Errorf("%s: SniffDelimiter = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAnnotateDelimiters(t *testing.T) {
+	comma := internal.KnowledgeFile{Name: "nps.csv", Text: "id,comentario,nps\n1,\"lento; caro\",3\n2,ok,9\n"}
+	semi := internal.KnowledgeFile{Name: "nps.csv", Text: "id;comentario;nps\r\n1;\"lento; caro\";3\r\n2;ok;9\r\n"}
+	Annotate(&comma, AnnotateOptions{})
+	Annotate(&semi, AnnotateOptions{})
+	if comma.Delimiter != "," || semi.Delimiter != ";" {
+		t.Errorf("Delimiter = %q y %q", comma.Delimiter, semi.Delimiter)
+	}
+	if comma.Parsed == nil || semi.Parsed == nil {
+		t.Fatalf("errores: %q, %q", comma.ParseError, semi.ParseError)
+	}
+	if !reflect.DeepEqual(comma.Parsed, semi.Parsed) || len(semi.Parsed.Headers) != 3 {
+		t.Errorf("schemas distintos:\n%+v\n%+v", comma.Parsed, semi.Parsed)
+	}
+}
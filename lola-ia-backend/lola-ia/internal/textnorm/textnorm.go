@@ -0,0 +1,28 @@
+// Package textnorm normaliza texto para comparaciones que no distinguen
+// mayúsculas ni acentos ("Análisis" == "analisis").
+package textnorm
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fold pasa s a minúsculas y le quita los diacríticos (á→a, ü→u, ñ→n).
+func Fold(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// Contains indica si substr aparece en s ignorando mayúsculas y acentos.
+func Contains(s, substr string) bool {
+	return strings.Contains(Fold(s), Fold(substr))
+}
@@ -7,9 +7,14 @@ type Role string
 const (
 	RoleUser      Role = "user"
 	RoleAssistant Role = "assistant"
+	// RoleSystem son instrucciones guardadas en el historial (p.ej. la
+	// persona); el provider las usa en vez de su prompt del sistema fijo.
+	RoleSystem Role = "system"
 )
 
 type Message struct {
+	// ID lo asigna el store al guardar el mensaje (UUID).
+	ID        string    `json:"id"`
 	Role      Role      `json:"role"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
@@ -17,15 +22,194 @@ type Message struct {
 
 type ChatHistory struct {
 	Messages []Message `json:"messages"`
+	// HasMore indica que hay mensajes más antiguos que los devueltos (paginación).
+	HasMore bool `json:"has_more,omitempty"`
+}
+
+// Conversation es una sesión vista como conversación, para listarlas en la
+// barra lateral. Title es el título propio si se fijó con PATCH
+// (CustomTitle) o uno armado con el primer mensaje del usuario.
+type Conversation struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	CustomTitle bool      `json:"custom_title"`
+	Messages    int       `json:"messages"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ConversationList struct {
+	Conversations []Conversation `json:"conversations"`
+}
+
+// SessionInfo resume una sesión activa para GET /api/sessions (soporte).
+// LastActivity es el último request de la sesión, no su último mensaje.
+type SessionInfo struct {
+	ID           string    `json:"id"`
+	Messages     int       `json:"messages"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+type SessionList struct {
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// ArchivedConversation es una conversación que POST /api/reset guardó antes
+// de empezar una nueva: se puede leer pero ya no recibe mensajes.
+type ArchivedConversation struct {
+	Conversation
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+type ArchivedConversationList struct {
+	Conversations []ArchivedConversation `json:"conversations"`
+}
+
+// ArchivedConversationResponse es GET /api/conversations/archived/:id.
+type ArchivedConversationResponse struct {
+	Conversation ArchivedConversation `json:"conversation"`
+	Messages     []Message            `json:"messages"`
+	ReadOnly     bool                 `json:"read_only"`
+}
+
+// UpdateConversationRequest es el body de PATCH /api/conversations/:id; un
+// título vacío vuelve al automático.
+type UpdateConversationRequest struct {
+	Title *string `json:"title"`
+}
+
+// SearchHit es un mensaje que coincide con la búsqueda, con su contexto
+// inmediato. Index es su posición en el historial de la sesión.
+type SearchHit struct {
+	Message Message  `json:"message"`
+	Index   int      `json:"index"`
+	Before  *Message `json:"before,omitempty"`
+	After   *Message `json:"after,omitempty"`
+}
+
+type SearchResponse struct {
+	Query   string      `json:"query"`
+	Results []SearchHit `json:"results"`
+	// Truncated indica que había más coincidencias que el máximo devuelto.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 type SendMessageRequest struct {
 	Content string `json:"content"`
+	// Template elige un prompt por nombre (ver GET /api/templates); vacío
+	// usa la heurística de modo analista.
+	Template string `json:"template,omitempty"`
+	// Model usa otro modelo solo para este mensaje; tiene que estar en
+	// ALLOWED_MODELS.
+	Model string `json:"model,omitempty"`
+	// Filters acota las filas de los archivos que entran al contexto, por
+	// nombre de columna.
+	Filters map[string]RowFilter `json:"filters,omitempty"`
+	// Language cambia el idioma de la respuesta ("es", "en", "pt"); vacío usa
+	// OUTPUT_LANGUAGE.
+	Language string `json:"language,omitempty"`
+	// Tags limita el contexto a los archivos con alguno de estos tags; vacío
+	// usa todos.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// RowFilter es el predicado de una columna: igualdad (Eq) y/o rango
+// inclusivo de fechas o números (From, To).
+type RowFilter struct {
+	Eq   string `json:"eq,omitempty"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
 }
 
 type SendMessageResponse struct {
 	Reply Message `json:"reply"`
 	Model string  `json:"model"`
+	Usage *Usage  `json:"usage,omitempty"`
+	// Sources son los archivos cuyo contenido entró en el contexto del
+	// prompt, en orden; vacío en el modo normal, que no lleva archivos.
+	Sources []string `json:"sources,omitempty"`
+	// Degraded indica una respuesta automática porque el proveedor está
+	// caído (circuit breaker abierto); Reply no se guardó en la sesión.
+	Degraded bool `json:"degraded,omitempty"`
+	// Unsaved indica que la respuesta no se pudo guardar en la sesión (falla
+	// de la base); se sigue reintentando en segundo plano.
+	Unsaved bool `json:"unsaved,omitempty"`
+	// Prompt es el texto enviado al proveedor; solo con DEBUG_PROMPTS=true.
+	Prompt string `json:"prompt,omitempty"`
+	// FormatIncomplete indica una respuesta de análisis a la que le faltan
+	// secciones del formato (MissingSections); ver ANALYST_FORMAT_CHECK.
+	FormatIncomplete bool     `json:"format_incomplete,omitempty"`
+	MissingSections  []string `json:"missing_sections,omitempty"`
+	// Analysis es la respuesta de análisis separada en sus secciones; solo
+	// con ANALYST_STRUCTURED=true y en modo analyst.
+	Analysis *AnalystReport `json:"analysis,omitempty"`
+}
+
+// AnalystReport son las cinco secciones del formato del modo analyst.
+type AnalystReport struct {
+	Summary    string           `json:"summary"`
+	PainPoints []string         `json:"pain_points"`
+	Actionable []string         `json:"actionable"`
+	Topics     []ReportTopic    `json:"topics"`
+	Verbatims  []TopicVerbatims `json:"verbatims"`
+}
+
+// ReportTopic es uno de los temas más mencionados; Pct es su porcentaje de
+// menciones, nil si la respuesta no lo trae.
+type ReportTopic struct {
+	Name string   `json:"name"`
+	Pct  *float64 `json:"pct,omitempty"`
+}
+
+// TopicVerbatims son las citas textuales de un tema.
+type TopicVerbatims struct {
+	Topic  string   `json:"topic"`
+	Quotes []string `json:"quotes"`
+}
+
+// RegenerateRequest es el body (opcional) de POST /api/messages/regenerate.
+type RegenerateRequest struct {
+	// Temperature reemplaza la temperatura del modelo (0 a 2) solo para esta
+	// respuesta, para variar más o menos respecto de la anterior.
+	Temperature *float64 `json:"temperature,omitempty"`
+}
+
+// DryRunResponse es la respuesta de POST /api/messages?dry_run=true: el prompt
+// que se habría enviado, sin llamar al proveedor.
+type DryRunResponse struct {
+	Prompt string `json:"prompt"`
+	Mode   string `json:"mode"`
+	Model  string `json:"model"`
+	// Sources son los archivos que entraron en el contexto (ver SendMessageResponse).
+	Sources []string `json:"sources,omitempty"`
+	// Stored es el mensaje del usuario si se pidió guardarlo (store_message=true).
+	Stored *Message `json:"stored,omitempty"`
+}
+
+// Usage es el consumo de tokens de una llamada al proveedor.
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// SessionUsage es el consumo de tokens acumulado de una sesión, para
+// chargeback. No se borra con el reset de la conversación.
+type SessionUsage struct {
+	SessionID string `json:"session_id"`
+	Usage
+	// Replies son las respuestas del proveedor que informaron consumo.
+	Replies   int       `json:"replies"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UsageReport es la respuesta de GET /api/usage: el consumo por sesión (de
+// la que más tokens usó a la que menos) y el total.
+type UsageReport struct {
+	Sessions []SessionUsage `json:"sessions"`
+	Total    Usage          `json:"total"`
+	Replies  int            `json:"replies"`
 }
 
 // --- Knowledge base (CSV files) ---
@@ -33,13 +217,184 @@ type KnowledgeFile struct {
 	Name string `json:"name"`
 	Size int    `json:"size"`
 	Text string `json:"text"`
+	// Format es "csv", "tsv" o "json"; si el cliente no lo manda se detecta
+	// por la extensión o el contenido.
+	Format string `json:"format,omitempty"`
+	// Tags agrupan archivos (p.ej. "cards", "pix") para acotar el contexto
+	// con SendMessageRequest.Tags.
+	Tags []string `json:"tags,omitempty"`
+	// Encoding es la codificación en la que se subió el archivo (p.ej.
+	// "windows-1252"); Text ya está en UTF-8. Vacío si llegó como JSON.
+	Encoding string `json:"encoding,omitempty"`
+	// Delimiter es el separador detectado al parsear un CSV ("," ";" tab o
+	// "|"); se recalcula al cargar el archivo.
+	Delimiter string `json:"delimiter,omitempty"`
+	// ReadOnly es un archivo compartido por todas las sesiones (p.ej. los de
+	// SEED_CSV_DIR) visto desde una de ellas: se consulta pero no se
+	// modifica ni se borra.
+	ReadOnly bool `json:"read_only,omitempty"`
+	// OriginalHeaders son los encabezados tal como vienen en el archivo
+	// cuando NORMALIZE_HEADERS los cambió en Parsed (ver RenamedHeaders);
+	// se recalculan al cargar el archivo.
+	OriginalHeaders []string       `json:"original_headers,omitempty"`
+	RenamedHeaders  []HeaderRename `json:"renamed_headers,omitempty"`
+
+	// Parsed es el CSV ya parseado al subirlo; nil si no se pudo parsear,
+	// en cuyo caso ParseError explica por qué. Los uploads se validan antes,
+	// así que solo pasa con archivos guardados previamente o cargados por código.
+	Parsed     *Table `json:"-"`
+	ParseError string `json:"parse_error,omitempty"`
+}
+
+// HeaderRename es un encabezado que se normalizó al parsear
+// (NORMALIZE_HEADERS): Original es el del archivo y Name el que se usa.
+type HeaderRename struct {
+	Original string `json:"original"`
+	Name     string `json:"name"`
+}
+
+// Table es la representación estructurada de un archivo tabular.
+type Table struct {
+	Headers []string   `json:"headers"`
+	Rows    [][]string `json:"rows"`
 }
 
 type UploadFilesRequest struct {
 	Files []KnowledgeFile `json:"files"`
 }
 
+// MergeFilesRequest une Files (mismas columnas) en un CSV nuevo llamado Name.
+type MergeFilesRequest struct {
+	Files           []string `json:"files"`
+	Name            string   `json:"name"`
+	RemoveOriginals bool     `json:"remove_originals,omitempty"`
+}
+
+type MergeFilesResponse struct {
+	File    FileInfoResponse `json:"file"`
+	Total   int              `json:"total"`
+	Removed []string         `json:"removed,omitempty"`
+}
+
+// AppendFileRequest es el body de POST /api/files/:name/append: un CSV con
+// el mismo encabezado que el archivo, cuyas filas se agregan al final.
+type AppendFileRequest struct {
+	Text string `json:"text"`
+}
+
+type AppendFileResponse struct {
+	File     FileInfoResponse `json:"file"`
+	Appended int              `json:"appended"`
+	Created  bool             `json:"created,omitempty"`
+	Total    int              `json:"total"`
+}
+
 type UploadFilesResponse struct {
-	Count int `json:"count"`
-	Total int `json:"total"`
+	Count    int             `json:"count"`
+	Total    int             `json:"total"`
+	Accepted []string        `json:"accepted"`
+	Rejected []FileRejection `json:"rejected,omitempty"`
+	// RenamedHeaders son, por archivo aceptado, los encabezados que cambió
+	// NORMALIZE_HEADERS.
+	RenamedHeaders map[string][]HeaderRename `json:"renamed_headers,omitempty"`
+}
+
+// ReseedFilesResponse es el resultado de POST /api/files/reseed: cuántos
+// archivos de la carpeta de seed son nuevos, cuántos reemplazaron a uno con el
+// mismo nombre y cuántos ya estaban iguales.
+type ReseedFilesResponse struct {
+	Added     int             `json:"added"`
+	Updated   int             `json:"updated"`
+	Unchanged int             `json:"unchanged"`
+	Total     int             `json:"total"`
+	Rejected  []FileRejection `json:"rejected,omitempty"`
+}
+
+// FileRejection explica por qué no se aceptó un archivo subido. Si no
+// cumplía el esquema de su dataset (SCHEMA_PATH), Schema es el dataset y
+// Missing/Unexpected las columnas que faltan o sobran.
+type FileRejection struct {
+	Name       string   `json:"name"`
+	Error      string   `json:"error"`
+	Schema     string   `json:"schema,omitempty"`
+	Missing    []string `json:"missing,omitempty"`
+	Unexpected []string `json:"unexpected,omitempty"`
+}
+
+// ColumnStats resume una columna de un CSV. Min y Max solo se informan en
+// columnas numéricas.
+type ColumnStats struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Nulls    int      `json:"nulls"`
+	Distinct int      `json:"distinct"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+}
+
+// FileInfoResponse es la metadata de un archivo; Text solo se incluye si se
+// pide con ?include_text=true.
+type FileInfoResponse struct {
+	Name       string   `json:"name"`
+	Size       int      `json:"size"`
+	Format     string   `json:"format,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Encoding   string   `json:"encoding,omitempty"`
+	Delimiter  string   `json:"delimiter,omitempty"`
+	ReadOnly   bool     `json:"read_only,omitempty"`
+	Parsed     bool     `json:"parsed"`
+	Rows       int      `json:"rows"`
+	ParseError string   `json:"parse_error,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	// RenamedHeaders son los encabezados que cambió NORMALIZE_HEADERS.
+	RenamedHeaders []HeaderRename `json:"renamed_headers,omitempty"`
+}
+
+// UpdateFileTagsRequest es el body de PATCH /api/files/:name/tags; reemplaza
+// los tags del archivo (una lista vacía los borra).
+type UpdateFileTagsRequest struct {
+	Tags *[]string `json:"tags"`
+}
+
+type FileStatsResponse struct {
+	Name    string        `json:"name"`
+	Rows    int           `json:"rows"`
+	Columns []ColumnStats `json:"columns"`
+}
+
+// FileQueryRequest es una agregación sobre las filas de un archivo
+// (POST /api/files/:name/query): Func sobre Column, por grupo de GroupBy.
+type FileQueryRequest struct {
+	// GroupBy es la columna por la que se agrupa; vacío es un solo grupo.
+	GroupBy string `json:"group_by,omitempty"`
+	// Func es count, sum, avg, min o max; vacío es count.
+	Func string `json:"func"`
+	// Column es la columna numérica que se agrega; count no la usa.
+	Column string `json:"column,omitempty"`
+}
+
+// AggregateGroup es el resultado de un grupo: Count filas y el valor de la
+// agregación (null si el grupo no tiene números).
+type AggregateGroup struct {
+	Key   string   `json:"key"`
+	Count int      `json:"count"`
+	Value *float64 `json:"value"`
+}
+
+type FileQueryResponse struct {
+	Name    string           `json:"name"`
+	GroupBy string           `json:"group_by,omitempty"`
+	Func    string           `json:"func"`
+	Column  string           `json:"column,omitempty"`
+	Rows    int              `json:"rows"`
+	Groups  []AggregateGroup `json:"groups"`
+}
+
+type FilePreviewResponse struct {
+	Name      string     `json:"name"`
+	Headers   []string   `json:"headers"`
+	Rows      [][]string `json:"rows"`
+	TotalRows int        `json:"total_rows"`
+	// OriginalHeaders son los del archivo si NORMALIZE_HEADERS cambió Headers.
+	OriginalHeaders []string `json:"original_headers,omitempty"`
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultOutputLanguage keeps the original behaviour: answers in Spanish.
+const defaultOutputLanguage = "es"
+
+// outputLanguages maps the codes accepted in OUTPUT_LANGUAGE and in the
+// request's "language" field to the name used in the prompt.
+var outputLanguages = map[string]string{
+	"es": "neutral Spanish",
+	"en": "English",
+	"pt": "Brazilian Portuguese",
+}
+
+// parseLanguage normalizes a language code ("PT-br" -> "pt"). Empty means
+// the default.
+func parseLanguage(v string) (string, error) {
+	code := strings.ToLower(strings.TrimSpace(v))
+	if code == "" {
+		return defaultOutputLanguage, nil
+	}
+	code, _, _ = strings.Cut(code, "-")
+	if _, ok := outputLanguages[code]; !ok {
+		codes := make([]string, 0, len(outputLanguages))
+		for c := range outputLanguages {
+			codes = append(codes, c)
+		}
+		sort.Strings(codes)
+		return "", fmt.Errorf("idioma no soportado: %q (opciones: %s)", v, strings.Join(codes, ", "))
+	}
+	return code, nil
+}
+
+var outputLanguageLine = regexp.MustCompile(`(?m)^Output language:.*$`)
+
+// withLanguage rewrites the language instructions of an analyst template:
+// the "Output language:" line and the other "neutral Spanish" mentions. A
+// template without that line gets one appended unless lang is the default.
+func withLanguage(tmpl, lang string) string {
+	name := outputLanguages[lang]
+	if lang == defaultOutputLanguage || name == "" {
+		return tmpl
+	}
+	line := "Output language: Respond strictly in " + name + "."
+	if outputLanguageLine.MatchString(tmpl) {
+		tmpl = outputLanguageLine.ReplaceAllLiteralString(tmpl, line)
+	} else {
+		tmpl += "\n\n" + line
+	}
+	return strings.ReplaceAll(tmpl, "in neutral Spanish", "in "+name)
+}
+
+// plainPrompt is the prompt for plain mode: the message itself, plus a
+// language hint when the answer should not be in the default language.
+func plainPrompt(content, lang string) string {
+	name := outputLanguages[lang]
+	if lang == defaultOutputLanguage || name == "" {
+		return content
+	}
+	return content + "\n\n(Respond in " + name + ".)"
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestParseLanguage(t *testing.T) {
+	for in, want := range map[string]string{"": "es", "en": "en", " PT-br ": "pt", "ES": "es"} {
+		if got, err := parseLanguage(in); err != nil || got != want {
+			t.Errorf("parseLanguage(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := parseLanguage("fr"); err == nil {
+		t.Error("parseLanguage(fr) debería fallar")
+	}
+}
+
+func TestBuildAnalystPromptLanguage(t *testing.T) {
+	// los datos no se reescriben aunque digan "in neutral Spanish"
+	data := "id,comentario\n1,me respondieron in neutral Spanish\n"
+	es := buildAnalystPrompt(analystTemplate, "¿qué opinan?", data, "es")
+	if !strings.Contains(es, "Output language: Respond strictly in neutral Spanish.") {
+		t.Error("es: falta la instrucción en español")
+	}
+	for _, lang := range []string{"en", "pt"} {
+		p := buildAnalystPrompt(analystTemplate, "¿qué opinan?", data, lang)
+		want := "Output language: Respond strictly in " + outputLanguages[lang] + "."
+		if !strings.Contains(p, want) {
+			t.Errorf("%s: falta %q", lang, want)
+		}
+		if strings.Count(p, "neutral Spanish") != 1 {
+			t.Errorf("%s: quedó \"neutral Spanish\" fuera de los datos", lang)
+		}
+		if !strings.Contains(p, data) || !strings.Contains(p, "¿qué opinan?") {
+			t.Errorf("%s: placeholders sin llenar", lang)
+		}
+		if strings.Contains(p, analystDataPlaceholder) || strings.Contains(p, analystQueryPlaceholder) {
+			t.Errorf("%s: quedaron placeholders", lang)
+		}
+	}
+
+	// un template sin la línea la recibe al final
+	p := buildAnalystPrompt(sentimentTemplate, "q", "datos", "en")
+	if !strings.HasSuffix(p, "\n\nOutput language: Respond strictly in English.") {
+		t.Errorf("template sin línea de idioma:\n%s", p)
+	}
+}
+
+func TestPlainPromptLanguage(t *testing.T) {
+	if got := plainPrompt("hola", "es"); got != "hola" {
+		t.Errorf("es: %q", got)
+	}
+	if got := plainPrompt("hola", "en"); got != "hola\n\n(Respond in English.)" {
+		t.Errorf("en: %q", got)
+	}
+}
+
+func TestSendMessageLanguage(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"OUTPUT_LANGUAGE": "pt", "DEBUG_PROMPTS": "true"})
+	prompt := func(body, sid string) string {
+		t.Helper()
+		w := call(r, "POST", "/api/messages", body, "X-Session-ID", sid)
+		if w.Code != 200 {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var res internal.SendMessageResponse
+		decode(t, w, &res)
+		return res.Prompt
+	}
+	if p := prompt(`{"content":"hola"}`, "s-lang-1"); !strings.HasSuffix(p, "(Respond in Brazilian Portuguese.)") {
+		t.Errorf("OUTPUT_LANGUAGE=pt: %q", p)
+	}
+	if p := prompt(`{"content":"hola","language":"es"}`, "s-lang-2"); p != "hola" {
+		t.Errorf("language=es: %q", p)
+	}
+	if w := call(r, "POST", "/api/messages", `{"content":"hola","language":"klingon"}`, "X-Session-ID", "s-lang-3"); w.Code != 400 {
+		t.Errorf("idioma inválido: status %d, want 400", w.Code)
+	}
+}
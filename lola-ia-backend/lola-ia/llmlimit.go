@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultLLMQueueTimeout = 10 * time.Second
+
+// errLLMBusy: no se liberó un lugar para llamar al proveedor dentro del
+// tiempo de espera.
+var errLLMBusy = errors.New("demasiadas consultas al modelo en curso; intente de nuevo en unos segundos")
+
+// llmLimiter acota las llamadas simultáneas al proveedor (MAX_CONCURRENT_LLM)
+// para que una ráfaga de consultas no dispare los rate limits del proveedor.
+// Las que exceden el límite esperan un lugar hasta queueTimeout.
+type llmLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+// newLLMLimiter devuelve nil (sin límite) si max <= 0.
+func newLLMLimiter(max int, queueTimeout time.Duration) *llmLimiter {
+	if max <= 0 {
+		return nil
+	}
+	fmt.Printf("[provider] máximo %d llamada(s) simultáneas (espera hasta %s)\n", max, queueTimeout)
+	return &llmLimiter{slots: make(chan struct{}, max), queueTimeout: queueTimeout}
+}
+
+// max devuelve el límite configurado; 0 = sin límite.
+func (l *llmLimiter) max() int {
+	if l == nil {
+		return 0
+	}
+	return cap(l.slots)
+}
+
+// acquire toma un lugar y devuelve la función que lo libera. Falla con
+// errLLMBusy si no hay lugar a tiempo, o con el error de ctx si el cliente
+// se va mientras espera.
+func (l *llmLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	release := func() { <-l.slots }
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		fmt.Printf("[provider] sin lugar para llamar al proveedor tras %s (%d en curso)\n", l.queueTimeout, len(l.slots))
+		return nil, errLLMBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// busy responde 429 con Retry-After igual al tiempo de espera.
+func (l *llmLimiter) busy(c *gin.Context) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(l.queueTimeout.Seconds()))))
+	c.JSON(429, gin.H{"error": errLLMBusy.Error()})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// peakCounter registra cuántas llamadas hay en curso y el máximo visto.
+type peakCounter struct {
+	cur, peak atomic.Int32
+}
+
+func (p *peakCounter) enter() {
+	n := p.cur.Add(1)
+	for {
+		old := p.peak.Load()
+		if n <= old || p.peak.CompareAndSwap(old, n) {
+			return
+		}
+	}
+}
+
+func (p *peakCounter) leave() { p.cur.Add(-1) }
+
+func TestLLMLimiterCap(t *testing.T) {
+	l := newLLMLimiter(3, 5*time.Second)
+	var pc peakCounter
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release()
+			pc.enter()
+			time.Sleep(10 * time.Millisecond)
+			pc.leave()
+		}()
+	}
+	wg.Wait()
+	if n := pc.peak.Load(); n != 3 {
+		t.Errorf("máximo en curso %d, want 3", n)
+	}
+}
+
+func TestLLMLimiterWait(t *testing.T) {
+	l := newLLMLimiter(1, 20*time.Millisecond)
+	release, _ := l.acquire(context.Background())
+	if _, err := l.acquire(context.Background()); !errors.Is(err, errLLMBusy) {
+		t.Errorf("sin lugar: err = %v, want errLLMBusy", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("cliente que se fue: err = %v", err)
+	}
+	// el lugar liberado se puede volver a tomar
+	release()
+	if r, err := l.acquire(context.Background()); err != nil {
+		t.Errorf("después de liberar: %v", err)
+	} else {
+		r()
+	}
+
+	// sin MAX_CONCURRENT_LLM no hay límite
+	var none *llmLimiter
+	if newLLMLimiter(0, time.Second) != nil || none.max() != 0 {
+		t.Error("con 0 debería no haber límite")
+	}
+	if _, err := none.acquire(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSendMessageLLMLimit(t *testing.T) {
+	var pc peakCounter
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		pc.enter()
+		defer pc.leave()
+		time.Sleep(30 * time.Millisecond)
+		w.Write([]byte(`{"message":{"role":"assistant","content":"respuesta"},"done":true}`))
+	}
+	send := func(r http.Handler, n int) (codes map[int]int, retryAfter string) {
+		codes = make(map[int]int)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				w := call(r, "POST", "/api/messages", `{"content":"hola"}`, "X-Session-ID", fmt.Sprintf("s-llm-%d", i))
+				mu.Lock()
+				defer mu.Unlock()
+				codes[w.Code]++
+				if w.Code == 429 {
+					retryAfter = w.Header().Get("Retry-After")
+				}
+			}(i)
+		}
+		wg.Wait()
+		return codes, retryAfter
+	}
+
+	// con espera suficiente todas terminan, de a 2
+	r := newOllamaRouter(t, slow, map[string]string{"MAX_CONCURRENT_LLM": "2", "RATE_LIMIT_BURST": "1000"})
+	if codes, _ := send(r, 8); codes[200] != 8 {
+		t.Errorf("status: %v, want 8 × 200", codes)
+	}
+	if n := pc.peak.Load(); n != 2 {
+		t.Errorf("máximo en curso %d, want 2", n)
+	}
+
+	// sin espera las que no entran reciben 429
+	r = newOllamaRouter(t, slow, map[string]string{"MAX_CONCURRENT_LLM": "1", "LLM_QUEUE_TIMEOUT": "1ms", "RATE_LIMIT_BURST": "1000"})
+	codes, retryAfter := send(r, 4)
+	if codes[200] == 0 || codes[429] == 0 || codes[200]+codes[429] != 4 || retryAfter != "1" {
+		t.Errorf("status: %v, Retry-After %q", codes, retryAfter)
+	}
+}
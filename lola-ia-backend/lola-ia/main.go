@@ -1,117 +1,182 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 
 	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/charset"
+	"github.com/nubank/lola-ia-backend/internal/classify"
 	"github.com/nubank/lola-ia-backend/internal/provider"
 	"github.com/nubank/lola-ia-backend/internal/store"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
 )
 
-// buildFilesContext returns a compact context string about currently uploaded CSVs.
-// It avoids sending large payloads by truncating content.
-func buildFilesContext(mem *store.MemoryStore) string {
-	files := mem.ListFiles()
-	if len(files) == 0 {
-		return ""
-	}
-	const (
-		maxPerFileBytes = 20 * 1024 // include up to 20KB of each file
-		maxTotalBytes   = 80 * 1024 // and cap overall context to ~80KB
-	)
-	var b strings.Builder
-	b.WriteString("[Contexto de archivos CSV cargados]\n")
-	b.WriteString("Puedes usar estos datos para responder si el usuario los menciona o pide análisis.\n")
-	total := 0
-	for _, f := range files {
-		// encabezado por archivo
-		fmt.Fprintf(&b, "- %s (%d bytes)\n", f.Name, f.Size)
-		if total >= maxTotalBytes {
-			continue
-		}
-		// contenido (truncado)
-		txt := f.Text
-		// limitar per-file
-		if len(txt) > maxPerFileBytes {
-			txt = txt[:maxPerFileBytes]
-		}
-		// asegurar límites totales
-		if total+len(txt) > maxTotalBytes {
-			txt = txt[:maxTotalBytes-total]
-		}
-		// evitar cortar runas UTF-8 por la mitad
-		for !utf8.ValidString(txt) && len(txt) > 0 {
-			txt = txt[:len(txt)-1]
-		}
-		if len(txt) > 0 {
-			b.WriteString("Contenido (parcial):\n\n")
-			b.WriteString(txt)
-			b.WriteString("\n\n")
-			total += len(txt)
-		}
-	}
-	return b.String()
+// seedResult is what preloadSeedCSVs did; Stored are the new or updated
+// files, so the caller can index them.
+type seedResult struct {
+	internal.ReseedFilesResponse
+	Stored []internal.KnowledgeFile
 }
 
-// preloadSeedCSVs scans a directory for .csv files and loads them into memory.
-// It returns the number of files added. Non-fatal errors are logged to stdout.
-func preloadSeedCSVs(dir string, mem *store.MemoryStore) int {
+// preloadSeedCSVs scans a directory for .csv, .tsv and .json files and loads them into files
+// (the shared space, visible from every session).
+// Files already loaded with the same name and content are skipped, so running
+// it again only picks up what changed in the directory. Files that are invalid
+// or exceed the limits are reported in Rejected and logged to stdout.
+func preloadSeedCSVs(dir string, files store.FileScope) (seedResult, error) {
+	var res seedResult
 	if dir == "" {
-		return 0
+		return res, nil
 	}
 	// Check dir exists
 	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
-		fmt.Printf("[seed] carpeta no válida: %s\n", dir)
-		return 0
+		return res, fmt.Errorf("carpeta no válida: %s", dir)
 	}
 	// Gather CSV files
 	entries, err := os.ReadDir(dir)
 	if err != nil {
-		fmt.Printf("[seed] error leyendo dir: %v\n", err)
-		return 0
+		return res, fmt.Errorf("error leyendo dir: %w", err)
 	}
 
-	files := make([]internal.KnowledgeFile, 0, len(entries))
+	reject := func(name, reason string) {
+		fmt.Printf("[seed] %s descartado: %s\n", name, reason)
+		res.Rejected = append(res.Rejected, internal.FileRejection{Name: name, Error: reason})
+	}
+	// Respect simple max limit used by POST /api/files (only new names take a slot)
+	free := filesMax - files.FileCount()
 	for _, e := range entries {
 		if e.IsDir() {
 			continue
 		}
 		name := e.Name()
-		if strings.HasSuffix(strings.ToLower(name), ".csv") {
-			p := filepath.Join(dir, name)
-			b, err := os.ReadFile(p)
-			if err != nil {
-				fmt.Printf("[seed] error leyendo %s: %v\n", name, err)
-				continue
-			}
+		format := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+		if !tabular.Supported(format) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			reject(name, err.Error())
+			continue
+		}
+		text, enc, err := charset.Decode(b)
+		if err != nil {
+			reject(name, err.Error())
+			continue
+		}
+		if err := tabular.Validate(format, text); err != nil {
+			reject(name, err.Error())
+			continue
+		}
+		f := internal.KnowledgeFile{Name: name, Size: len(text), Text: text, Format: format, Encoding: enc}
 
-			files = append(files, internal.KnowledgeFile{Name: name, Size: len(b), Text: string(b)})
+		old, exists := files.GetFile(name)
+		if exists && old.Text == f.Text {
+			res.Unchanged++
+			continue
 		}
+		if !exists && free <= 0 {
+			reject(name, fmt.Sprintf("se alcanzó el máximo de %d archivos", filesMax))
+			continue
+		}
+		// de a uno, para que un archivo que excede los límites no frene al resto
+		if _, err := files.AddFiles([]internal.KnowledgeFile{f}); err != nil {
+			reject(name, err.Error())
+			continue
+		}
+		if exists {
+			res.Updated++
+		} else {
+			res.Added++
+			free--
+		}
+		res.Stored = append(res.Stored, f)
 	}
-	if len(files) == 0 {
-		return 0
-	}
-	// Respect simple max limit used by POST /api/files
-	if len(mem.ListFiles())+len(files) > filesMax {
-		// trim to available slots
-		slots := filesMax - len(mem.ListFiles())
-		if slots <= 0 {
-			return 0
+	res.Total = files.FileCount()
+	fmt.Printf("[seed] %d archivo(s) nuevos, %d actualizados, %d sin cambios desde %s (total en memoria: %d)\n",
+		res.Added, res.Updated, res.Unchanged, dir, res.Total)
+	return res, nil
+}
+
+// validateUploads separa los archivos subidos en los que son CSV y los que
+// no (o no cumplen el esquema de su dataset), con el motivo de cada rechazo.
+// Si se acepta al menos uno, el upload responde 200 con la lista de
+// rechazados; si no, 422.
+func validateUploads(files []internal.KnowledgeFile, schemas tabular.Schemas) ([]internal.KnowledgeFile, []internal.FileRejection) {
+	accepted := make([]internal.KnowledgeFile, 0, len(files))
+	var rejected []internal.FileRejection
+	for _, f := range files {
+		if strings.TrimSpace(f.Name) == "" {
+			rejected = append(rejected, internal.FileRejection{Name: f.Name, Error: "name requerido"})
+			continue
+		}
+		if f.Format == "" {
+			f.Format = tabular.DetectFormat(f.Name, f.Text)
+		}
+		if !tabular.Supported(f.Format) {
+			rejected = append(rejected, internal.FileRejection{Name: f.Name, Error: "formato no soportado: " + f.Format})
+			continue
+		}
+		if err := tabular.Validate(f.Format, f.Text); err != nil {
+			rejected = append(rejected, internal.FileRejection{Name: f.Name, Error: err.Error()})
+			continue
 		}
-		files = files[:slots]
+		if rej, ok := checkSchema(f, schemas); !ok {
+			rejected = append(rejected, rej)
+			continue
+		}
+		// los límites de bytes se miden sobre lo recibido, no sobre lo declarado
+		f.Size = len(f.Text)
+		accepted = append(accepted, f)
 	}
-	total := mem.AddFiles(files)
-	fmt.Printf("[seed] precargados %d CSV(s) desde %s (total en memoria: %d)\n", len(files), dir, total)
-	return len(files)
+	return accepted, rejected
+}
+
+// checkSchema valida f contra el esquema de SCHEMA_PATH cuyo pattern
+// coincide con su nombre. Los archivos sin esquema pasan sin revisar.
+func checkSchema(f internal.KnowledgeFile, schemas tabular.Schemas) (internal.FileRejection, bool) {
+	schema, ok := schemas.Match(f.Name)
+	if !ok {
+		return internal.FileRejection{}, true
+	}
+	t, err := tabular.Parse(f.Format, f.Text)
+	if err != nil {
+		return internal.FileRejection{Name: f.Name, Error: err.Error()}, false
+	}
+	missing, unexpected := schema.Check(t)
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return internal.FileRejection{}, true
+	}
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "faltan columnas: "+strings.Join(missing, ", "))
+	}
+	if len(unexpected) > 0 {
+		problems = append(problems, "columnas no esperadas: "+strings.Join(unexpected, ", "))
+	}
+	return internal.FileRejection{
+		Name:       f.Name,
+		Error:      fmt.Sprintf("no cumple el esquema %q (%s)", schema.Name, strings.Join(problems, "; ")),
+		Schema:     schema.Name,
+		Missing:    missing,
+		Unexpected: unexpected,
+	}, false
 }
 
 // Analyst prompt template (raw string). Fill placeholders with user query and CSV context.
@@ -141,75 +206,508 @@ Format:
 --- Top 3 Topics and (%) of Mentions [List the topics with their percentage here, e.g., 1. Topic One (X%) 2. Topic Two (Y%) 3. Topic Three (Z%) ]
 --- Examples of Verbatim for those main topics [Provide verbatim examples here, clearly separating them by topic.]`
 
-func buildAnalystPrompt(userQuery, csvContext string) string {
+// Placeholders that every analyst template must contain.
+const (
+	analystDataPlaceholder  = "{Insert your raw customer data here}"
+	analystQueryPlaceholder = "{Insert the Nubanker's question here, e.g., \"what are credit card customers' main pain points from the last 3 months?\"}"
+)
+
+// Diagnostic headers set by POST /api/messages.
+const (
+	// modeHeader tells how the prompt was built: "analyst", "plain" or the
+	// name of the requested template.
+	modeHeader = "X-Lola-Mode"
+	// promptBytesHeader is the prompt length; only with DEBUG_PROMPTS=true.
+	promptBytesHeader = "X-Lola-Prompt-Bytes"
+)
+
+func buildAnalystPrompt(tmpl, userQuery, csvContext, lang string) string {
+	// Switch the language before filling, so the data is never rewritten
+	tmpl = withLanguage(tmpl, lang)
 	// Insert CSV context and user query into the template
-	s := strings.Replace(analystTemplate, "{Insert your raw customer data here}", csvContext, 1)
-	s = strings.Replace(s, "{Insert the Nubanker's question here, e.g., \"what are credit card customers' main pain points from the last 3 months?\"}", userQuery, 1)
+	s := strings.Replace(tmpl, analystDataPlaceholder, csvContext, 1)
+	s = strings.Replace(s, analystQueryPlaceholder, userQuery, 1)
 	return s
 }
 
-// Heuristic: detect if the user query asks for analysis/insights rather than casual chat.
-func isAnalystQuery(q string) bool {
-	ql := strings.ToLower(q)
-	keywords := []string{
-		"analiza", "análisis", "analysis", "analizar", "insights", "resumen", "summary",
-		"puntos de dolor", "pain points", "temas", "topics", "top 3", "top3", "%", "porcentaje",
-		"frecuencia", "tendencias", "trends", "verbatim", "citas", "quotes", "encuesta", "surveys",
-		"feedback", "quejas", "needs", "necesidades", "social", "menciones", "cluster", "tema",
-		"csv", "datos", "data"}
-	for _, kw := range keywords {
-		if strings.Contains(ql, kw) {
-			return true
-		}
-	}
-	return false
+// loadAnalystTemplate reads the analyst template from path, or returns the
+// built-in analystTemplate when path is empty. A file template must keep both
+// placeholders, otherwise the data or the question would silently go missing.
+func loadAnalystTemplate(path string) (string, error) {
+	if path == "" {
+		return analystTemplate, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	tmpl := string(b)
+	for _, ph := range []string{analystDataPlaceholder, analystQueryPlaceholder} {
+		if !strings.Contains(tmpl, ph) {
+			return "", fmt.Errorf("%s no contiene el placeholder %s", path, ph)
+		}
+	}
+	return tmpl, nil
 }
 
 const filesMax = 50
 
+// Límites de bytes por defecto de la knowledge base (MAX_FILE_BYTES, MAX_TOTAL_BYTES)
+const (
+	defaultMaxFileBytes  = 5 << 20
+	defaultMaxTotalBytes = 20 << 20
+)
+
+// envInt lee un entero positivo de la variable name, o def si falta o es inválido.
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// envFloat lee un número positivo de la variable name, o def si falta o es inválido.
+func envFloat(name string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// envDuration lee una duración positiva (p.ej. "30s") de la variable name, o def.
+func envDuration(name string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// Paginación de GET /api/messages
+const (
+	messagesLimitDefault = 100
+	messagesLimitMax     = 500
+)
+
+// Máximo de coincidencias de GET /api/messages/search
+const searchResultsMax = 50
+
+// Largo máximo del título propio de una conversación (PATCH /api/conversations/:id)
+const maxConversationTitle = 200
+
+// parseBefore acepta RFC3339 (con o sin fracción) o epoch en milisegundos.
+func parseBefore(v string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339Nano, v)
+}
+
+const (
+	assistantHello      = "¡Hola! Soy Lola IA lista para ayudarte 🚀"
+	assistantHelloReset = "He reiniciado la conversación. ¿En qué te ayudo?"
+	defaultSessionTTL   = 2 * time.Hour
+
+	defaultShutdownTimeout = 15 * time.Second
+)
+
+// newChatProvider builds the provider named by PROVIDER (openai, azure, anthropic, gemini, ollama, mock).
+// Without PROVIDER it keeps the old behavior: OpenAI when there is an API key,
+// mock otherwise. Any construction error falls back to the mock. It also
+// returns the name of the provider actually in use.
+//
+// The model comes from OPENAI_MODEL, ANTHROPIC_MODEL, etc., falling back to
+// the provider's default (see provider.ModelFromEnv). System prompt,
+// temperature, top_p, max tokens and retries come from <PREFIX>_SYSTEM_PROMPT,
+// <PREFIX>_TEMPERATURE, etc. (see provider.ConfigFromEnv).
+func newChatProvider(name string) (provider.ChatProvider, string) {
+	if name == "" {
+		name = "mock"
+		if _, ok := os.LookupEnv("OPENAI_API_KEY"); ok {
+			name = "openai"
+		}
+	}
+	var (
+		p   provider.ChatProvider
+		err error
+	)
+	name = strings.ToLower(name)
+	switch name {
+	case "openai":
+		p, err = provider.NewOpenAIProvider(provider.ModelFromEnv(name), provider.ConfigFromEnv("OPENAI"))
+	case "azure":
+		p, err = provider.NewAzureOpenAIProvider(os.Getenv("AZURE_OPENAI_DEPLOYMENT"), provider.ConfigFromEnv("AZURE_OPENAI"))
+	case "anthropic":
+		p, err = provider.NewAnthropicProvider(provider.ModelFromEnv(name), provider.ConfigFromEnv("ANTHROPIC"))
+	case "gemini":
+		p, err = provider.NewGeminiProvider(provider.ModelFromEnv(name), provider.ConfigFromEnv("GEMINI"))
+	case "ollama":
+		p, err = provider.NewOllamaProvider(provider.ModelFromEnv(name), provider.ConfigFromEnv("OLLAMA"))
+	case "mock":
+		return newMockProvider(), name
+	default:
+		err = fmt.Errorf("PROVIDER desconocido: %q", name)
+	}
+	if err != nil {
+		fmt.Printf("[provider] %v; usando mock\n", err)
+		return newMockProvider(), "mock"
+	}
+	return p, name
+}
+
+// newMockProvider builds the mock, named after MOCK_MODEL if set.
+// MOCK_RESPONSES may point to a JSON file of canned replies keyed by input
+// substring (see provider.MockResponse), so integration tests can assert
+// formatting and routing without a real API.
+func newMockProvider() provider.ChatProvider {
+	m := provider.MockProvider{Config: provider.ConfigFromEnv("OPENAI"), ModelName: provider.ModelFromEnv("mock")}
+	if path := os.Getenv("MOCK_RESPONSES"); path != "" {
+		rs, err := provider.LoadMockResponses(path)
+		if err != nil {
+			fmt.Printf("[provider] MOCK_RESPONSES: %v\n", err)
+		} else {
+			m.Responses = rs
+			fmt.Printf("[provider] mock con %d respuesta(s) fija(s)\n", len(rs))
+		}
+	}
+	return m
+}
+
 func main() {
 	_ = godotenv.Load() // carga .env si existe
 
+	// stop detiene las tareas de fondo del router (p.ej. la expiración de
+	// sesiones) al apagar
+	stop, cancelStop := context.WithCancel(context.Background())
+	defer cancelStop()
+	r, mem, err := newRouter(stop)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// Puerto
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("[server] %v\n", err)
+			os.Exit(1)
+		}
+	}()
+
+	// Apagado ordenado: SIGINT/SIGTERM deja de aceptar conexiones, espera a
+	// los requests en curso (hasta SHUTDOWN_TIMEOUT) y luego cierra el store.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	fmt.Println("[server] apagando...")
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout))
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		fmt.Printf("[server] requests sin terminar al apagar: %v\n", err)
+	}
+	cancelStop()
+	closeStore(mem)
+}
+
+// closeStore cierra mem si tiene algo que cerrar (SQLite).
+func closeStore(mem store.Store) {
+	if cl, ok := mem.(io.Closer); ok {
+		if err := cl.Close(); err != nil {
+			fmt.Printf("[store] error al cerrar: %v\n", err)
+		}
+	}
+}
+
+// newRouter arma el router con toda la configuración del entorno y devuelve
+// también el store, que el caller cierra al apagar. Las tareas de fondo
+// corren hasta que se cancela ctx. Un error de configuración se devuelve (y
+// el store, si llegó a abrirse, queda cerrado).
+func newRouter(ctx context.Context) (_ *gin.Engine, _ store.Store, err error) {
 	r := gin.Default()
+	// la IP del cliente (rate limit) solo sale de X-Forwarded-For detrás de
+	// estos proxies; por defecto ninguno
+	trustedProxies := trustProxies(r, os.Getenv("TRUSTED_PROXIES"))
 
-	// CORS con credenciales: permite localhost, el front en ngrok y *.vercel.{app,dev}
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, ngrok-skip-browser-warning")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "*")
-		if c.Request.Method == http.MethodOptions {
-			c.AbortWithStatus(204)
-			return
+	// CORS: orígenes permitidos desde ALLOWED_ORIGINS (separados por coma,
+	// "*" para cualquiera sin credenciales, "https://*.vercel.app" para subdominios)
+	origins := os.Getenv("ALLOWED_ORIGINS")
+	if origins == "" {
+		origins = defaultAllowedOrigins
+	}
+	allowedOrigins := parseOrigins(origins)
+	r.Use(corsMiddleware(allowedOrigins))
+
+	// Rate limit por IP (RATE_LIMIT_RPM requests/minuto, ráfagas de RATE_LIMIT_BURST)
+	limiter := newRateLimiter(envInt("RATE_LIMIT_RPM", defaultRateLimitRPM), envInt("RATE_LIMIT_BURST", defaultRateLimitBurst))
+	r.Use(rateLimitMiddleware(ctx, limiter, "/health", "/health/ready", "/metrics"))
+
+	// Auth por API key (API_KEYS separadas por coma); sin keys queda abierto
+	if keys := parseAPIKeys(os.Getenv("API_KEYS")); len(keys) > 0 {
+		r.Use(authMiddleware(keys, "/health", "/health/ready"))
+		fmt.Printf("[auth] %d api key(s) configurada(s)\n", len(keys))
+	} else {
+		fmt.Printf("[auth] API_KEYS vacío: la API no requiere autenticación\n")
+	}
+
+	// Tope del body (MAX_REQUEST_BYTES) para que un request enorme no llegue
+	// a leerse entero antes de los límites de archivos
+	maxRequestBytes := envInt("MAX_REQUEST_BYTES", defaultMaxRequestBytes)
+	r.Use(bodyLimitMiddleware(int64(maxRequestBytes)))
+
+	// NORMALIZE_HEADERS=true pasa los encabezados a snake_case al parsear
+	// ("Customer Name" → customer_name)
+	var annotate tabular.AnnotateOptions
+	annotate.SnakeCaseHeaders, _ = strconv.ParseBool(os.Getenv("NORMALIZE_HEADERS"))
+
+	// Store: SQLite si hay DB_PATH, si no en memoria (MVP sin auth)
+	var mem store.Store
+	if dbPath := os.Getenv("DB_PATH"); dbPath != "" {
+		db, err := store.NewSQLiteStore(dbPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("[store] no se pudo abrir %s: %w", dbPath, err)
 		}
-		c.Next()
-	})
+		mem = db
+	} else {
+		mem = store.NewMemoryStore()
+	}
+	defer func() {
+		if err != nil {
+			closeStore(mem)
+		}
+	}()
+
+	// Límites de tamaño de la knowledge base (uploads y seed), por sesión
+	limits := store.ByteLimits{
+		MaxFileBytes:  envInt("MAX_FILE_BYTES", defaultMaxFileBytes),
+		MaxTotalBytes: envInt("MAX_TOTAL_BYTES", defaultMaxTotalBytes),
+	}
+	mem.SetByteLimits(limits)
+	// antes de cargar cualquier archivo
+	mem.SetAnnotateOptions(annotate)
+
+	// Topes de un zip de CSVs (POST /api/files/zip) contra zip bombs
+	zipLim := zipLimits{
+		MaxEntries:   envInt("ZIP_MAX_ENTRIES", defaultZipMaxEntries),
+		MaxBytes:     envInt("ZIP_MAX_BYTES", limits.MaxTotalBytes),
+		MaxFileBytes: limits.MaxFileBytes,
+	}
+
+	// Cada sesión ve sus propios archivos más los compartidos (los de la
+	// seed, de solo lectura); SHARED_FILES=true vuelve a una knowledge base
+	// común a todas las sesiones
+	sharedFiles, _ := strconv.ParseBool(os.Getenv("SHARED_FILES"))
+	filesFor := func(sid string) store.FileScope {
+		if sharedFiles {
+			return store.SharedFiles(mem)
+		}
+		return store.SessionFiles(mem, sid)
+	}
 
-	// Store en memoria (MVP sin auth)
-	mem := store.NewMemoryStore()
-	store.SeedAssistantHello(mem, "¡Hola! Soy Lola IA lista para ayudarte 🚀")
+	// Sesiones inactivas se eliminan pasado SESSION_TTL (p.ej. "30m")
+	evictIdleSessions(ctx, mem, envDuration("SESSION_TTL", defaultSessionTTL))
 
 	// Precarga de CSVs desde carpeta (opcional)
 	seedDir := os.Getenv("SEED_CSV_DIR")
 	if seedDir == "" {
 		seedDir = "./seed"
 	}
-	_ = preloadSeedCSVs(seedDir, mem)
+	if _, err := preloadSeedCSVs(seedDir, store.SharedFiles(mem)); err != nil {
+		fmt.Printf("[seed] %v\n", err)
+	}
 
 	// Feature flag to enable analyst formatting mode
 	useAnalyst := true
+	// ANALYST_TEMPLATE_PATH permite cambiar el prompt sin recompilar
+	analystTmpl, err := loadAnalystTemplate(os.Getenv("ANALYST_TEMPLATE_PATH"))
+	if err != nil {
+		fmt.Printf("[prompt] %v; usando el template por defecto\n", err)
+		analystTmpl = analystTemplate
+	}
+	// Esquemas de columnas por dataset (SCHEMA_PATH): los uploads cuyo nombre
+	// coincide con un pattern tienen que traer esas columnas
+	var schemas tabular.Schemas
+	if path := os.Getenv("SCHEMA_PATH"); path != "" {
+		schemas, err = tabular.LoadSchemas(path)
+		if err != nil {
+			fmt.Printf("[files] SCHEMA_PATH: %v\n", err)
+		} else {
+			fmt.Printf("[files] %d esquema(s) de dataset cargados\n", len(schemas))
+		}
+	}
+	// Templates con nombre elegibles por request (PROMPT_TEMPLATES_DIR suma <nombre>.txt)
+	templates := loadPromptTemplates(analystTmpl, os.Getenv("PROMPT_TEMPLATES_DIR"))
+	// DEBUG_PROMPTS=true expone el prompt enviado (tamaño en header y texto en
+	// el body) para diagnosticar el modo análisis; no activar en producción
+	debugPrompts, _ := strconv.ParseBool(os.Getenv("DEBUG_PROMPTS"))
+	// ANALYST_FORMAT_CHECK revisa que las respuestas de análisis traigan las
+	// secciones del template: flag (default) las marca, retry pide una vez
+	// más antes de marcarlas y off no revisa
+	format := newFormatChecker(os.Getenv("ANALYST_FORMAT_CHECK"), templates)
+	// ANALYST_STRUCTURED=true agrega a las respuestas del modo analyst sus
+	// secciones ya separadas (SendMessageResponse.Analysis)
+	structured, _ := strconv.ParseBool(os.Getenv("ANALYST_STRUCTURED"))
+	// Idioma de las respuestas (OUTPUT_LANGUAGE: es, en, pt); cada request puede pedir otro
+	outputLang, err := parseLanguage(os.Getenv("OUTPUT_LANGUAGE"))
+	if err != nil {
+		fmt.Printf("[prompt] %v; usando %s\n", err, defaultOutputLanguage)
+		outputLang = defaultOutputLanguage
+	}
+	// Modelos que un request puede pedir en vez del default (ALLOWED_MODELS, separados por coma)
+	allowedModels := parseAllowedModels(os.Getenv("ALLOWED_MODELS"))
+	// ANALYST_THRESHOLD: puntaje mínimo para activarlo (ver classify.DefaultThreshold)
+	analyst := classify.New(classify.DefaultKeywords, envFloat("ANALYST_THRESHOLD", classify.DefaultThreshold))
 
-	// Provider (OpenAI si hay API key, si no: mock)
-	var chat provider.ChatProvider
-	if _, ok := os.LookupEnv("OPENAI_API_KEY"); ok {
-		mdl := os.Getenv("OPENAI_MODEL")
-		p, err := provider.NewOpenAIProvider(mdl)
-		if err == nil {
-			chat = p
+	// Presupuesto de tokens para el contexto de CSVs
+	// REDACT_PII=true enmascara emails, teléfonos y tarjetas antes de enviarlos
+	redactPII, _ := strconv.ParseBool(os.Getenv("REDACT_PII"))
+	// CONTEXT_TRUNCATION: qué parte de un archivo que no entra se manda
+	// (head, tail o smart: encabezado y últimas filas)
+	truncation, err := parseTruncation(os.Getenv("CONTEXT_TRUNCATION"))
+	if err != nil {
+		fmt.Printf("[context] %v; usando %s\n", err, truncationHead)
+		truncation = truncationHead
+	}
+	ctxCfg := filesContextConfig{
+		MaxContextTokens: envInt("MAX_CONTEXT_TOKENS", defaultMaxContextTokens),
+		MaxFileTokens:    envInt("MAX_FILE_CONTEXT_TOKENS", defaultMaxFileTokens),
+		RedactPII:        redactPII,
+		Truncation:       truncation,
+	}
+
+	// Provider según PROVIDER (openai, azure, anthropic, gemini, ollama, mock)
+	chat, providerName := newChatProvider(os.Getenv("PROVIDER"))
+
+	// TOOLS=true deja que el modelo pida cálculos sobre los archivos (por
+	// ahora count_rows_where) que se ejecutan acá; solo con providers que
+	// soportan tool calling.
+	toolsOn := false
+	if on, _ := strconv.ParseBool(os.Getenv("TOOLS")); on {
+		if tc, ok := chat.(provider.ToolCaller); ok {
+			tc.SetTools(provider.NewToolRegistry(countRowsTool{mem: mem}))
+			toolsOn = true
+			fmt.Printf("[provider] tools activadas: count_rows_where\n")
+		} else {
+			fmt.Printf("[provider] %s no soporta tools; TOOLS se ignora\n", chat.Model())
+		}
+	}
+
+	// VALIDATE_MODEL=true consulta al arrancar que el proveedor tenga los
+	// modelos configurados: un typo corta el arranque en vez de fallar en
+	// la primera consulta
+	if on, _ := strconv.ParseBool(os.Getenv("VALIDATE_MODEL")); on {
+		models := append([]string{os.Getenv("PLAIN_MODEL"), os.Getenv("ANALYST_MODEL")}, allowedModels...)
+		if err := validateModels(chat, models); err != nil {
+			return nil, nil, fmt.Errorf("[provider] %w", err)
 		}
+		fmt.Printf("[provider] modelos validados con el proveedor\n")
+	}
+
+	// Métricas de Prometheus en /metrics; el provider queda instrumentado
+	// Retrieval por embeddings si el provider lo soporta (antes de envolverlo)
+	rt := newRetriever(chat, mem, envInt("RAG_TOP_K", defaultRAGTopK), envFloat("RAG_MIN_SCORE", 0), ctxCfg.RedactPII, annotate)
+	if rt != nil {
+		rt.indexFiles(mem.ListFiles())
+	}
+
+	ready := newReadiness(chat)
+	mod, err := newModerationGate(chat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[moderation] %w", err)
 	}
-	if chat == nil {
-		chat = provider.MockProvider{}
+
+	met := newMetrics(mem)
+	chat = instrumentedProvider{ChatProvider: chat, m: met}
+	// Con BREAKER_FAILURES fallas seguidas del proveedor dentro de
+	// BREAKER_WINDOW se contesta un mensaje automático durante BREAKER_COOLDOWN
+	if brk := newBreaker(envInt("BREAKER_FAILURES", 0),
+		envDuration("BREAKER_WINDOW", defaultBreakerWindow),
+		envDuration("BREAKER_COOLDOWN", defaultBreakerCooldown)); brk != nil {
+		chat = breakerProvider{ChatProvider: chat, b: brk}
+		met.reg.MustRegister(brk.collector())
+		ready.breaker = brk
+	}
+
+	// PLAIN_MODEL y ANALYST_MODEL: modelo para las consultas casuales y para
+	// las de análisis cuando el request no pide uno (vacío = el default)
+	router := newModelRouter(chat, os.Getenv("PLAIN_MODEL"), os.Getenv("ANALYST_MODEL"))
+
+	// Streaming SSE: un ": ping" cada SSE_HEARTBEAT sin tokens y cada
+	// escritura con SSE_WRITE_TIMEOUT como máximo; un cliente que no lee se corta
+	sseCfg := sseConfig{
+		Heartbeat:    envDuration("SSE_HEARTBEAT", defaultSSEHeartbeat),
+		WriteTimeout: envDuration("SSE_WRITE_TIMEOUT", defaultSSEWriteTimeout),
+	}
+
+	// Un turno que no se pudo guardar se reintenta OUTBOX_ATTEMPTS veces
+	// (desde OUTBOX_BACKOFF, duplicando) y después en segundo plano
+	box := newOutbox(mem,
+		envInt("OUTBOX_ATTEMPTS", defaultOutboxAttempts),
+		envDuration("OUTBOX_BACKOFF", defaultOutboxBackoff))
+
+	// Doble envío del mismo mensaje dentro de DEDUP_WINDOW (p.ej. "2s")
+	dedupWindow := envDuration("DEDUP_WINDOW", defaultDedupWindow)
+	pending := newInflight()
+	// Idempotency-Key: las respuestas se guardan IDEMPOTENCY_TTL, hasta IDEMPOTENCY_MAX_KEYS keys
+	idem := newIdempotencyCache(
+		envDuration("IDEMPOTENCY_TTL", defaultIdempotencyTTL),
+		envInt("IDEMPOTENCY_MAX_KEYS", defaultIdempotencyMaxKeys),
+	)
+	// MAX_CONCURRENT_LLM acota las consultas simultáneas al proveedor; las
+	// demás esperan hasta LLM_QUEUE_TIMEOUT (p.ej. "10s") y si no, 429
+	llmSlots := newLLMLimiter(envInt("MAX_CONCURRENT_LLM", 0), envDuration("LLM_QUEUE_TIMEOUT", defaultLLMQueueTimeout))
+	// ANSWER_CACHE=true reutiliza las respuestas de análisis mientras no
+	// cambien los archivos (ANSWER_CACHE_TTL, ANSWER_CACHE_MAX entradas)
+	cacheAnswers, _ := strconv.ParseBool(os.Getenv("ANSWER_CACHE"))
+	answers := newAnswerCache(cacheAnswers,
+		envDuration("ANSWER_CACHE_TTL", defaultAnswerCacheTTL),
+		envInt("ANSWER_CACHE_MAX", defaultAnswerCacheMax), met)
+
+	// Configuración efectiva para GET /api/config
+	effective := runtimeConfig{
+		Provider:             providerName,
+		Model:                chat.Model(),
+		AllowedModels:        allowedModels,
+		PlainModel:           router.model(chat, "plain"),
+		AnalystModel:         router.model(chat, "analyst"),
+		Store:                "memory",
+		SharedFiles:          sharedFiles,
+		FilesMax:             filesMax,
+		MaxFileBytes:         limits.MaxFileBytes,
+		MaxTotalBytes:        limits.MaxTotalBytes,
+		MaxRequestBytes:      maxRequestBytes,
+		NormalizeHeaders:     annotate.SnakeCaseHeaders,
+		ZipMaxEntries:        zipLim.MaxEntries,
+		ZipMaxBytes:          zipLim.MaxBytes,
+		Schemas:              len(schemas),
+		MaxContextTokens:     ctxCfg.MaxContextTokens,
+		MaxFileContextTokens: ctxCfg.MaxFileTokens,
+		RedactPII:            ctxCfg.RedactPII,
+		ContextTruncation:    ctxCfg.Truncation,
+		RAG:                  rt != nil,
+		RAGMinScore:          rt.scoreFloor(),
+		AnalystMode:          useAnalyst,
+		AnalystThreshold:     analyst.Threshold(),
+		OutputLanguage:       outputLang,
+		Templates:            templates.names(),
+		Tools:                toolsOn,
+		MaxConcurrentLLM:     llmSlots.max(),
+		AnswerCache:          answers != nil,
+		Moderation:           mod != nil,
+		DebugPrompts:         debugPrompts,
+		AnalystFormatCheck:   format.checkMode(),
+		AnalystStructured:    structured,
+
+		TrustedProxies: trustedProxies,
+	}
+	if _, ok := mem.(*store.SQLiteStore); ok {
+		effective.Store = "sqlite"
+	}
+	if ready.breaker != nil {
+		effective.BreakerFailures = ready.breaker.threshold
 	}
 
 	// Rutas
@@ -217,66 +715,713 @@ func main() {
 		c.JSON(200, gin.H{"ok": true, "uptime": time.Now().Format(time.RFC3339)})
 	})
 
+	// /health es liveness; /health/ready además verifica el proveedor
+	r.GET("/health/ready", ready.handler())
+
+	r.GET("/metrics", met.handler())
+
 	r.GET("/api/model", func(c *gin.Context) {
-		c.JSON(200, gin.H{"model": chat.Model()})
+		c.JSON(200, gin.H{"model": chat.Model(), "allowed_models": allowedModels})
+	})
+
+	// Como reseed, es de administración: sin API_KEYS no se expone
+	r.GET("/api/config", func(c *gin.Context) {
+		if sessionNamespace(c) == "" {
+			c.JSON(403, gin.H{"error": "config requiere autenticación: configurar API_KEYS"})
+			return
+		}
+		c.JSON(200, effective)
+	})
+
+	r.GET("/api/templates", func(c *gin.Context) {
+		c.JSON(200, gin.H{"templates": templates.names()})
 	})
 
 	r.GET("/api/messages", func(c *gin.Context) {
-		c.JSON(200, internal.ChatHistory{Messages: mem.All()})
+		sid := sessionID(c, mem)
+		limit := messagesLimitDefault
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				c.JSON(400, gin.H{"error": "limit inválido"})
+				return
+			}
+			limit = min(n, messagesLimitMax)
+		}
+		var before time.Time
+		if v := c.Query("before"); v != "" {
+			t, err := parseBefore(v)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "before inválido (RFC3339 o epoch en ms)"})
+				return
+			}
+			before = t
+		}
+		msgs, more := mem.RangeForSession(sid, before, limit)
+		c.JSON(200, internal.ChatHistory{Messages: msgs, HasMore: more})
 	})
 
+	r.GET("/api/messages/search", func(c *gin.Context) {
+		q := strings.TrimSpace(c.Query("q"))
+		if q == "" {
+			c.JSON(400, gin.H{"error": "q requerido"})
+			return
+		}
+		sid := sessionID(c, mem)
+		hits, more := mem.SearchForSession(sid, q, searchResultsMax)
+		c.JSON(200, internal.SearchResponse{Query: q, Results: hits, Truncated: more})
+	})
+
+	r.GET("/api/messages/export", func(c *gin.Context) {
+		sid := sessionID(c, mem)
+		if !writeExport(c, mem.AllForSession(sid), c.DefaultQuery("format", "md")) {
+			c.JSON(400, gin.H{"error": "format inválido (md o json)"})
+		}
+	})
+
+	// Import restaura un export JSON (?format=json) en la sesión actual, con
+	// los mismos IDs y en el mismo orden. Si la sesión ya tiene una
+	// conversación se rechaza; con ?force=true se archiva (como en
+	// /api/reset) y se reemplaza. Los mensajes de sistema del export no se
+	// importan: la sesión lleva SYSTEM_PERSONA.
+	r.POST("/api/messages/import", func(c *gin.Context) {
+		var req internal.ChatHistory
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "JSON inválido o vacío"})
+			return
+		}
+		if err := validateImport(req.Messages, time.Now()); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		msgs := withoutSystem(req.Messages)
+		if len(msgs) == 0 {
+			c.JSON(400, gin.H{"error": "messages sin mensajes de usuario ni del asistente"})
+			return
+		}
+		sid := sessionID(c, mem)
+		resp := gin.H{"ok": true}
+		// el saludo no cuenta: la sesión tiene conversación si el usuario escribió
+		if _, ok := mem.LastUserMessage(sid); ok {
+			if force, _ := strconv.ParseBool(c.Query("force")); !force {
+				c.JSON(409, gin.H{"error": "la sesión ya tiene una conversación: usar ?force=true para reemplazarla"})
+				return
+			}
+			ns := sessionNamespace(c)
+			if a, ok := mem.ArchiveSession(sid, ns+uuid.NewString()); ok {
+				resp["archived"] = strings.TrimPrefix(a.ID, ns)
+			}
+		}
+		mem.ResetForSession(sid)
+		imported := len(msgs)
+		// la sesión lleva el mensaje de sistema de la configuración, no el del export
+		if persona := os.Getenv("SYSTEM_PERSONA"); persona != "" {
+			msgs = append([]internal.Message{{Role: internal.RoleSystem, Content: persona, CreatedAt: msgs[0].CreatedAt}}, msgs...)
+		}
+		mem.AppendBatchForSession(sid, msgs...)
+		resp["imported"] = imported
+		fmt.Printf("[messages] %d mensaje(s) importados en la sesión %s (%d de sistema descartados)\n", imported, sid, len(req.Messages)-imported)
+		c.JSON(200, resp)
+	})
+
+	r.GET("/api/messages/:id", func(c *gin.Context) {
+		sid := sessionID(c, mem)
+		msg, ok := mem.GetMessage(sid, c.Param("id"))
+		if !ok {
+			c.JSON(404, gin.H{"error": "mensaje no encontrado"})
+			return
+		}
+		c.JSON(200, msg)
+	})
+
+	r.DELETE("/api/messages/:id", func(c *gin.Context) {
+		sid := sessionID(c, mem)
+		if !mem.RemoveMessage(sid, c.Param("id")) {
+			c.JSON(404, gin.H{"error": "mensaje no encontrado"})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	// historyFor es el historial que se manda al proveedor: el saludo y los
+	// últimos MAX_HISTORY_MESSAGES mensajes (sin tope si no está). Con
+	// HISTORY_SUMMARY=true, en cambio, lo viejo se reemplaza por un resumen.
+	maxHistory := envInt("MAX_HISTORY_MESSAGES", 0)
+	summ := newSummarizer(chat)
+	historyFor := func(ctx context.Context, sid string) []internal.Message {
+		if summ != nil {
+			return summ.collapse(ctx, sid, mem.AllForSession(sid))
+		}
+		return trimHistory(mem.AllForSession(sid), maxHistory)
+	}
+
+	// promptMode decide el modo de la consulta (ver modeHeader): el template
+	// pedido, "analyst" si el clasificador la ve como análisis o "plain".
+	promptMode := func(req internal.SendMessageRequest) string {
+		if req.Template != "" {
+			return req.Template
+		}
+		if useAnalyst && analyst.Analyst(req.Content) {
+			return "analyst"
+		}
+		return "plain"
+	}
+
+	// composePromptWith arma el prompt final conmutando modo análisis si
+	// aplica, con el presupuesto de archivos cfg, y devuelve el modo elegido
+	// y los archivos que entraron en el contexto (SendMessageResponse.Sources).
+	composePromptWith := func(ctx context.Context, kb store.FileScope, req internal.SendMessageRequest, cfg filesContextConfig) (prompt, mode string, sources []string) {
+		lang := outputLang
+		if req.Language != "" {
+			// ya validado al recibir el request
+			lang, _ = parseLanguage(req.Language)
+		}
+		filesCtx := func() string {
+			// con tags solo entran los archivos que tienen alguno
+			files := kb.ListFilesByTag(req.Tags...)
+			var s string
+			// los fragmentos de RAG no están filtrados: con filtros va el contexto completo
+			if rt != nil && len(req.Filters) == 0 {
+				var ok bool
+				if s, sources, ok = rt.context(ctx, req.Content, cfg, fileKeys(kb, files)); ok {
+					return s
+				}
+			}
+			// los filtros ya se validaron al recibir el request
+			filters, _ := tabular.CompileFilters(req.Filters)
+			s, sources = buildFilesContext(files, req.Content, cfg, filters)
+			return s
+		}
+		// Modo normal: no forzamos formato ni añadimos CSV para preguntas casuales
+		mode = promptMode(req)
+		if mode == "plain" {
+			return plainPrompt(req.Content, lang), mode, nil
+		}
+		// análisis o template pedido explícitamente: siempre con el contexto de archivos
+		return buildAnalystPrompt(templates[mode], req.Content, filesCtx(), lang), mode, sources
+	}
+
+	// composePrompt es composePromptWith con el presupuesto configurado.
+	composePrompt := func(ctx context.Context, kb store.FileScope, req internal.SendMessageRequest) (prompt, mode string, sources []string) {
+		return composePromptWith(ctx, kb, req, ctxCfg)
+	}
+
+	// countMessage suma el mensaje a lola_messages_total según su modo.
+	countMessage := func(mode string) {
+		label := mode
+		if mode == "plain" {
+			label = "normal" // nombre histórico del label
+		}
+		met.messages.WithLabelValues(label).Inc()
+	}
+
+	// buildPrompt es composePrompt contando el mensaje en las métricas por modo.
+	buildPrompt := func(ctx context.Context, kb store.FileScope, req internal.SendMessageRequest) (prompt, mode string, sources []string) {
+		prompt, mode, sources = composePrompt(ctx, kb, req)
+		countMessage(mode)
+		return prompt, mode, sources
+	}
+
+	// Los turnos del chat, iguales por HTTP y por WebSocket
+	turns := &turnService{
+		mem:         mem,
+		box:         box,
+		chat:        chat,
+		templates:   templates,
+		models:      allowedModels,
+		router:      router,
+		mod:         mod,
+		slots:       llmSlots,
+		pending:     pending,
+		dedupWindow: dedupWindow,
+		answers:     answers,
+		format:      format,
+		structured:  structured,
+		ctxCfg:      ctxCfg,
+		history:     historyFor,
+		mode:        promptMode,
+		compose:     composePromptWith,
+		count:       countMessage,
+	}
+
+	// Chat por WebSocket: mismo store y provider, con difusión por sesión
+	r.GET("/ws", newWSChat(turns, filesFor, allowedOrigins).handle)
+
 	r.POST("/api/messages", func(c *gin.Context) {
 		var req internal.SendMessageRequest
-		if err := c.BindJSON(&req); err != nil || req.Content == "" {
-			c.JSON(400, gin.H{"error": "content requerido"})
+		if err := c.BindJSON(&req); err != nil {
+			req.Content = ""
+		}
+		reqChat, err := turns.validate(req)
+		if err == nil {
+			err = turns.moderate(c.Request.Context(), req.Content)
+		}
+		if err != nil {
+			writeTurnError(c, err)
 			return
 		}
+		sid := sessionID(c, mem)
+		// los archivos de la sesión: el contexto y las tools solo ven esos
+		kb := filesFor(sid)
+		c.Request = c.Request.WithContext(withFiles(c.Request.Context(), kb))
 
-		// Guardamos mensaje del usuario
-		userMsg := internal.Message{
-			Role:      internal.RoleUser,
-			Content:   req.Content,
-			CreatedAt: time.Now(),
+		// ?dry_run=true arma el prompt (clasificador y contexto incluidos) y lo
+		// devuelve sin llamar al proveedor; el mensaje del usuario solo se
+		// guarda con store_message=true y nunca se agrega respuesta.
+		if dry, _ := strconv.ParseBool(c.Query("dry_run")); dry {
+			out := internal.DryRunResponse{Model: reqChat.Model()}
+			if keep, _ := strconv.ParseBool(c.Query("store_message")); keep {
+				userMsg := mem.AppendForSession(sid, internal.Message{
+					Role:      internal.RoleUser,
+					Content:   req.Content,
+					CreatedAt: time.Now(),
+				})
+				out.Stored = &userMsg
+			}
+			out.Prompt, out.Mode, out.Sources = composePrompt(c.Request.Context(), kb, req)
+			fmt.Printf("[messages] dry run en la sesión %s (%s, %d bytes)\n", sid, out.Mode, len(out.Prompt))
+			c.Header(modeHeader, out.Mode)
+			if debugPrompts {
+				c.Header(promptBytesHeader, strconv.Itoa(len(out.Prompt)))
+			}
+			c.JSON(200, out)
+			return
 		}
-		mem.Append(userMsg)
 
-		// Construimos el prompt final conmutando modo análisis si aplica
-		var prompt string
-		if useAnalyst && isAnalystQuery(req.Content) {
-			csvCtx := buildFilesContext(mem)
-			prompt = buildAnalystPrompt(req.Content, csvCtx)
-		} else {
-			// Modo normal: no forzamos formato ni añadimos CSV para preguntas casuales
-			prompt = req.Content
+		// Reintento con la misma Idempotency-Key: se devuelve la respuesta
+		// guardada sin volver a llamar al proveedor. La key es por sesión.
+		var result *internal.SendMessageResponse
+		if key := c.GetHeader(idempotencyHeader); key != "" {
+			e, owner, err := idem.begin(sid+"\x00"+key, req.Template+"\x00"+req.Model+"\x00"+req.Content)
+			if err != nil {
+				c.JSON(422, gin.H{"error": err.Error()})
+				return
+			}
+			if !owner {
+				resp, ok := idem.wait(c.Request.Context(), e)
+				if !ok {
+					c.JSON(409, gin.H{"error": "el request original con esta Idempotency-Key no terminó; vuelva a intentar"})
+					return
+				}
+				c.Header(idempotencyReplayedHeader, "true")
+				writeReply(c, resp)
+				return
+			}
+			defer func() { idem.finish(e, result) }()
+		}
+
+		var debugPrompt string
+		t := chatTurn{
+			sid:  sid,
+			req:  req,
+			chat: reqChat,
+			kb:   kb,
+			// los headers van antes de responder (en streaming se envían con el primer chunk)
+			started: func(_ internal.Message, mode, prompt string) {
+				c.Header(modeHeader, mode)
+				if debugPrompts {
+					c.Header(promptBytesHeader, strconv.Itoa(len(prompt)))
+					debugPrompt = prompt
+				}
+			},
+		}
+		// Streaming SSE si el cliente lo pide
+		stream := wantsStream(c)
+		if stream {
+			t.stream = func(ctx context.Context, chat provider.ChatProvider, history []internal.Message, prompt string) (provider.Result, error) {
+				return streamReply(c, sseCfg, chat, history, prompt)
+			}
 		}
-		replyText, err := chat.Reply(mem.All(), prompt)
+		out, err := turns.run(c.Request.Context(), t)
 		if err != nil {
+			if clientGone(c, err, sid) {
+				return
+			}
+			if errors.Is(err, errLLMBusy) {
+				llmSlots.busy(c)
+				return
+			}
+			status, msg := providerError(err, reqChat.Model())
+			body := gin.H{"error": msg}
+			if errors.Is(err, provider.ErrModelNotFound) {
+				body["model"] = reqChat.Model()
+			}
+			if stream {
+				// sin mensaje parcial: lo que llegó a streamear se descarta
+				c.SSEvent("error", body)
+				return
+			}
+			c.JSON(status, body)
+			return
+		}
+		if out.Response.Degraded {
+			writeReply(c, out.Response)
+			return
+		}
+		if out.Cached {
+			c.Header(answerCacheHeader, "hit")
+		}
+		result = &out.Response
+		result.Prompt = debugPrompt
+		writeReply(c, *result)
+	})
+
+	// Deshacer/rehacer el último turno; sin nada que hacer es un no-op con 200.
+	// En ambos casos se devuelve el historial completo actualizado.
+	r.POST("/api/messages/undo", func(c *gin.Context) {
+		sid := sessionID(c, mem)
+		if !mem.UndoTurn(sid) {
+			fmt.Printf("[messages] nada para deshacer en la sesión %s\n", sid)
+		}
+		c.JSON(200, internal.ChatHistory{Messages: mem.AllForSession(sid)})
+	})
+
+	r.POST("/api/messages/redo", func(c *gin.Context) {
+		sid := sessionID(c, mem)
+		if !mem.RedoTurn(sid) {
+			fmt.Printf("[messages] nada para rehacer en la sesión %s\n", sid)
+		}
+		c.JSON(200, internal.ChatHistory{Messages: mem.AllForSession(sid)})
+	})
+
+	// Regenerar la última respuesta: se vuelve a consultar al proveedor con
+	// la misma pregunta (reclasificada, con el contexto de archivos actual) y
+	// la respuesta nueva reemplaza a la anterior. Si el proveedor falla la
+	// anterior queda como estaba.
+	r.POST("/api/messages/regenerate", func(c *gin.Context) {
+		var req internal.RegenerateRequest
+		// el body es opcional
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "JSON inválido"})
+				return
+			}
+		}
+		if t := req.Temperature; t != nil && (*t < 0 || *t > 2) {
+			c.JSON(400, gin.H{"error": "temperature tiene que estar entre 0 y 2"})
+			return
+		}
+		sid := sessionID(c, mem)
+		msgs := mem.AllForSession(sid)
+		n := len(msgs)
+		if n == 0 || msgs[n-1].Role != internal.RoleAssistant {
+			c.JSON(400, gin.H{"error": "el último mensaje no es una respuesta del asistente"})
+			return
+		}
+		if n < 2 || msgs[n-2].Role != internal.RoleUser {
+			// p.ej. solo el saludo
+			c.JSON(400, gin.H{"error": "no hay consulta para regenerar"})
+			return
+		}
+		last, question := msgs[n-1], internal.SendMessageRequest{Content: msgs[n-2].Content}
+
+		reqChat, err := router.pick(chat, "", promptMode(question), allowedModels)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error(), "models": allowedModels})
+			return
+		}
+		if req.Temperature != nil {
+			cfg, ok := reqChat.(provider.Configurable)
+			if !ok {
+				c.JSON(400, gin.H{"error": "el provider no admite cambiar la temperatura"})
+				return
+			}
+			reqChat = cfg.With(provider.CallOptions{Temperature: req.Temperature})
+		}
+		kb := filesFor(sid)
+		c.Request = c.Request.WithContext(withFiles(c.Request.Context(), kb))
+
+		release, err := llmSlots.acquire(c.Request.Context())
+		if err != nil {
+			if clientGone(c, err, sid) {
+				return
+			}
+			llmSlots.busy(c)
+			return
+		}
+		defer release()
+
+		prompt, mode, sources := buildPrompt(c.Request.Context(), kb, question)
+		c.Header(modeHeader, mode)
+		// el historial sin la consulta y la respuesta que se regeneran
+		history := historyFor(c.Request.Context(), sid)
+		if h := len(history); h >= 2 && history[h-1].ID == last.ID {
+			history = history[:h-2]
+		}
+		res, err := reqChat.Reply(c.Request.Context(), history, prompt)
+		if errors.Is(err, provider.ErrContextLength) {
+			if p, s, ok := turns.shrink(c.Request.Context(), kb, question, prompt); ok {
+				prompt, sources = p, s
+				res, err = reqChat.Reply(c.Request.Context(), history, prompt)
+			}
+		}
+		if err != nil {
+			if clientGone(c, err, sid) {
+				return
+			}
+			if errors.Is(err, errProviderDown) {
+				c.JSON(200, degradedResponse(reqChat.Model()))
+				return
+			}
+			if errors.Is(err, provider.ErrModelNotFound) {
+				fmt.Printf("[provider] modelo inexistente: %v\n", err)
+				c.JSON(400, gin.H{"error": modelNotFoundMessage(reqChat.Model()), "model": reqChat.Model()})
+				return
+			}
+			if errors.Is(err, provider.ErrContextLength) {
+				fmt.Printf("[provider] prompt demasiado largo: %v\n", err)
+				c.JSON(400, gin.H{"error": provider.ErrContextLength.Error()})
+				return
+			}
+			fmt.Printf("[provider] error: %v\n", err)
 			c.JSON(502, gin.H{"error": err.Error()})
 			return
 		}
+		res, missing := format.check(c.Request.Context(), reqChat, history, prompt, mode, res)
 
-		assistantMsg := internal.Message{
+		mem.RemoveMessage(sid, last.ID)
+		saved, ok := box.append(sid, internal.Message{
 			Role:      internal.RoleAssistant,
-			Content:   replyText,
+			Content:   res.Text,
 			CreatedAt: time.Now(),
-		}
-		mem.Append(assistantMsg)
-
+		})
+		recordUsage(mem, sid, res.Usage)
+		fmt.Printf("[messages] respuesta regenerada en la sesión %s (%s)\n", sid, mode)
 		c.JSON(200, internal.SendMessageResponse{
-			Reply: assistantMsg,
-			Model: chat.Model(),
+			Reply:   saved[0],
+			Model:   reqChat.Model(),
+			Usage:   res.Usage,
+			Sources: sources,
+			Unsaved: !ok,
+
+			FormatIncomplete: len(missing) > 0,
+			MissingSections:  missing,
+			Analysis:         structuredAnalysis(structured, mode, res.Text),
 		})
 	})
 
+	// Reset archiva la conversación actual (ver /api/conversations/archived)
+	// y empieza otra en la misma sesión; ?hard=true la borra sin archivar.
 	r.POST("/api/reset", func(c *gin.Context) {
-		mem.Reset()
-		store.SeedAssistantHello(mem, "He reiniciado la conversación. ¿En qué te ayudo?")
+		sid := sessionID(c, mem)
+		resp := gin.H{"ok": true}
+		hard, _ := strconv.ParseBool(c.Query("hard"))
+		if !hard {
+			ns := sessionNamespace(c)
+			if a, ok := mem.ArchiveSession(sid, ns+uuid.NewString()); ok {
+				resp["archived"] = strings.TrimPrefix(a.ID, ns)
+			}
+		}
+		mem.ResetForSession(sid)
+		seedSession(mem, sid, true)
+		c.JSON(200, resp)
+	})
+
+	// Consumo de tokens por sesión para chargeback: el reset no lo borra.
+	// Requiere auth (lista los IDs de sesión) y ve solo las sesiones de la key.
+	r.GET("/api/usage", func(c *gin.Context) {
+		ns := sessionNamespace(c)
+		if ns == "" {
+			c.JSON(403, gin.H{"error": "ver el consumo requiere autenticación: configurar API_KEYS"})
+			return
+		}
+		c.JSON(200, usageReport(mem, ns))
+	})
+
+	// Borrar el consumo es aparte y requiere auth: son datos de facturación
+	r.DELETE("/api/usage", func(c *gin.Context) {
+		ns := sessionNamespace(c)
+		if ns == "" {
+			c.JSON(403, gin.H{"error": "borrar el consumo requiere autenticación: configurar API_KEYS"})
+			return
+		}
+		n := mem.ClearUsage(ns)
+		fmt.Printf("[usage] consumo de %d sesión(es) borrado\n", n)
+		c.JSON(200, gin.H{"ok": true, "sessions": n})
+	})
+
+	// Sesiones activas, para soporte: requieren auth (el ID de una sesión da
+	// acceso a ella) y ven solo las de la key.
+	r.GET("/api/sessions", func(c *gin.Context) {
+		ns := sessionNamespace(c)
+		if ns == "" {
+			c.JSON(403, gin.H{"error": "listar sesiones requiere autenticación: configurar API_KEYS"})
+			return
+		}
+		list := mem.Sessions(ns)
+		for i := range list {
+			list[i].ID = strings.TrimPrefix(list[i].ID, ns)
+		}
+		c.JSON(200, internal.SessionList{Sessions: list})
+	})
+
+	// Borra una sesión (mensajes y archivos propios) sin reiniciar, p.ej.
+	// una abusiva; si el cliente vuelve, empieza de cero.
+	r.DELETE("/api/sessions/:id", func(c *gin.Context) {
+		ns := sessionNamespace(c)
+		if ns == "" {
+			c.JSON(403, gin.H{"error": "borrar sesiones requiere autenticación: configurar API_KEYS"})
+			return
+		}
+		id := c.Param("id")
+		if !mem.DeleteSession(ns + id) {
+			c.JSON(404, gin.H{"error": "sesión no encontrada"})
+			return
+		}
+		fmt.Printf("[session] sesión %s eliminada\n", ns+id)
+		c.JSON(200, gin.H{"ok": true, "session": id})
+	})
+
+	// Conversaciones (sesiones) para la barra lateral; el UI cambia de una a
+	// otra mandando su id en X-Session-ID. Requieren auth, como
+	// /api/sessions: se listan y renombran solo las de la key.
+	r.GET("/api/conversations", func(c *gin.Context) {
+		ns := sessionNamespace(c)
+		if ns == "" {
+			c.JSON(403, gin.H{"error": "listar conversaciones requiere autenticación: configurar API_KEYS"})
+			return
+		}
+		convs := mem.Conversations(ns)
+		for i := range convs {
+			convs[i].ID = strings.TrimPrefix(convs[i].ID, ns)
+		}
+		c.JSON(200, internal.ConversationList{Conversations: convs})
+	})
+
+	r.PATCH("/api/conversations/:id", func(c *gin.Context) {
+		ns, id := sessionNamespace(c), c.Param("id")
+		if ns == "" {
+			c.JSON(403, gin.H{"error": "renombrar conversaciones requiere autenticación: configurar API_KEYS"})
+			return
+		}
+		var req internal.UpdateConversationRequest
+		if err := c.BindJSON(&req); err != nil || req.Title == nil {
+			c.JSON(400, gin.H{"error": "title requerido"})
+			return
+		}
+		title := strings.TrimSpace(*req.Title)
+		if utf8.RuneCountInString(title) > maxConversationTitle {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("title demasiado largo (máx. %d caracteres)", maxConversationTitle)})
+			return
+		}
+		if !mem.SetTitle(ns+id, title) {
+			c.JSON(404, gin.H{"error": "conversación no encontrada"})
+			return
+		}
+		// sin título propio ni mensajes del usuario no aparece en la lista
+		conv := internal.Conversation{ID: id}
+		for _, cv := range mem.Conversations(ns + id) {
+			if cv.ID == ns+id {
+				conv = cv
+				conv.ID = id
+			}
+		}
+		c.JSON(200, conv)
+	})
+
+	// Conversaciones archivadas por /api/reset: solo lectura, hasta que se
+	// borran con DELETE. Requieren auth y ven solo las de la key.
+	r.GET("/api/conversations/archived", func(c *gin.Context) {
+		ns := sessionNamespace(c)
+		if ns == "" {
+			c.JSON(403, gin.H{"error": "ver las conversaciones archivadas requiere autenticación: configurar API_KEYS"})
+			return
+		}
+		convs := mem.ArchivedConversations(ns)
+		for i := range convs {
+			convs[i].ID = strings.TrimPrefix(convs[i].ID, ns)
+		}
+		c.JSON(200, internal.ArchivedConversationList{Conversations: convs})
+	})
+
+	r.GET("/api/conversations/archived/:id", func(c *gin.Context) {
+		ns, id := sessionNamespace(c), c.Param("id")
+		if ns == "" {
+			c.JSON(403, gin.H{"error": "ver las conversaciones archivadas requiere autenticación: configurar API_KEYS"})
+			return
+		}
+		conv, msgs, ok := mem.ArchivedMessages(ns + id)
+		if !ok {
+			c.JSON(404, gin.H{"error": "conversación archivada no encontrada"})
+			return
+		}
+		conv.ID = id
+		c.JSON(200, internal.ArchivedConversationResponse{Conversation: conv, Messages: msgs, ReadOnly: true})
+	})
+
+	r.DELETE("/api/conversations/archived/:id", func(c *gin.Context) {
+		ns := sessionNamespace(c)
+		if ns == "" {
+			c.JSON(403, gin.H{"error": "borrar conversaciones archivadas requiere autenticación: configurar API_KEYS"})
+			return
+		}
+		if !mem.DeleteArchived(ns + c.Param("id")) {
+			c.JSON(404, gin.H{"error": "conversación archivada no encontrada"})
+			return
+		}
 		c.JSON(200, gin.H{"ok": true})
 	})
 
+	// storeUploads guarda los archivos recibidos (por JSON o multipart) y
+	// responde: 422 si no se aceptó ninguno, 413 si se exceden los límites.
+	// rejected son los que ya se descartaron al leerlos.
+	storeUploads := func(c *gin.Context, files []internal.KnowledgeFile, rejected []internal.FileRejection) {
+		kb := filesFor(sessionID(c, mem))
+		accepted, invalid := validateUploads(files, schemas)
+		rejected = append(rejected, invalid...)
+		met.filesUploaded.WithLabelValues("rejected").Add(float64(len(rejected)))
+		if len(accepted) == 0 {
+			c.JSON(422, internal.UploadFilesResponse{
+				Total:    kb.FileCount(),
+				Accepted: []string{},
+				Rejected: rejected,
+			})
+			return
+		}
+		// límite simple para MVP
+		current := kb.FileCount()
+		incoming := len(accepted)
+		if current+incoming > filesMax {
+			c.JSON(413, gin.H{"error": "se excede el máximo de archivos", "max": filesMax})
+			return
+		}
+		total, err := kb.AddFiles(accepted)
+		if addFilesFailed(c, err) {
+			return
+		}
+		met.filesUploaded.WithLabelValues("accepted").Add(float64(len(accepted)))
+		answers.invalidate()
+		if rt != nil {
+			rt.indexFiles(kb.WithKeys(accepted))
+		}
+		names := make([]string, len(accepted))
+		var renamed map[string][]internal.HeaderRename
+		for i, f := range accepted {
+			names[i] = f.Name
+			if annotate.SnakeCaseHeaders {
+				tabular.Annotate(&f, annotate)
+				if len(f.RenamedHeaders) > 0 {
+					if renamed == nil {
+						renamed = make(map[string][]internal.HeaderRename)
+					}
+					renamed[f.Name] = f.RenamedHeaders
+				}
+			}
+		}
+		c.JSON(200, internal.UploadFilesResponse{
+			Count:          len(accepted),
+			Total:          total,
+			Accepted:       names,
+			Rejected:       rejected,
+			RenamedHeaders: renamed,
+		})
+	}
+
 	// Archivos CSV (knowledge base)
+	// ?tag= (repetible) lista solo los archivos con alguno de esos tags
 	r.GET("/api/files", func(c *gin.Context) {
-		c.JSON(200, gin.H{"files": mem.ListFiles()})
+		kb := filesFor(sessionID(c, mem))
+		c.JSON(200, gin.H{"files": kb.ListFilesByTag(c.QueryArray("tag")...)})
 	})
 
 	r.POST("/api/files", func(c *gin.Context) {
@@ -289,32 +1434,378 @@ func main() {
 			c.JSON(400, gin.H{"error": "files requerido"})
 			return
 		}
-		// límite simple para MVP
-		current := len(mem.ListFiles())
-		incoming := len(req.Files)
-		if current+incoming > filesMax {
+		storeUploads(c, req.Files, nil)
+	})
+
+	// Vuelve a leer la carpeta de seed sin reiniciar: agrega los archivos
+	// nuevos y reemplaza los que cambiaron. Es de administración, así que sin
+	// API_KEYS (API abierta) no se permite.
+	r.POST("/api/files/reseed", func(c *gin.Context) {
+		if sessionNamespace(c) == "" {
+			c.JSON(403, gin.H{"error": "reseed requiere autenticación: configurar API_KEYS"})
+			return
+		}
+		res, err := preloadSeedCSVs(seedDir, store.SharedFiles(mem))
+		if err != nil {
+			fmt.Printf("[seed] %v\n", err)
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if len(res.Stored) > 0 {
+			answers.invalidate()
+			if rt != nil {
+				rt.indexFiles(res.Stored)
+			}
+		}
+		c.JSON(200, res.ReseedFilesResponse)
+	})
+
+	// Upload desde un <form> (multipart/form-data): cada parte con archivo es
+	// un KnowledgeFile; misma validación y límites que POST /api/files. El
+	// campo "tags" (separados por comas) se aplica a todos los archivos.
+	r.POST("/api/files/upload", func(c *gin.Context) {
+		files, rejected, err := readMultipartFiles(c.Request, limits.MaxFileBytes)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if len(files) == 0 && len(rejected) == 0 {
+			c.JSON(400, gin.H{"error": "no se recibió ningún archivo"})
+			return
+		}
+		storeUploads(c, files, rejected)
+	})
+
+	r.POST("/api/files/zip", func(c *gin.Context) {
+		files, rejected, err := readZipUpload(c.Request, zipLim)
+		if errors.Is(err, errZipLimit) {
+			fmt.Printf("[files] zip rechazado: %v\n", err)
+			c.JSON(413, gin.H{"error": err.Error(), "max_entries": zipLim.MaxEntries, "max_bytes": zipLim.MaxBytes})
+			return
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if len(files) == 0 && len(rejected) == 0 {
+			c.JSON(400, gin.H{"error": "el zip no tiene archivos .csv"})
+			return
+		}
+		storeUploads(c, files, rejected)
+	})
+
+	r.POST("/api/files/merge", func(c *gin.Context) {
+		var req internal.MergeFilesRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "JSON inválido o vacío"})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if len(req.Files) < 2 || req.Name == "" {
+			c.JSON(400, gin.H{"error": "se requieren name y al menos dos files"})
+			return
+		}
+		if !strings.EqualFold(filepath.Ext(req.Name), ".csv") {
+			c.JSON(400, gin.H{"error": "el archivo combinado se guarda como CSV: name tiene que terminar en .csv"})
+			return
+		}
+		kb := filesFor(sessionID(c, mem))
+		files := make([]internal.KnowledgeFile, 0, len(req.Files))
+		for _, name := range req.Files {
+			f, ok := kb.GetFile(name)
+			if !ok {
+				c.JSON(404, gin.H{"error": "archivo no encontrado", "file": name})
+				return
+			}
+			// los compartidos se pueden combinar pero no borrar
+			if req.RemoveOriginals && f.ReadOnly && name != req.Name {
+				c.JSON(403, gin.H{"error": store.ErrReadOnlyFile.Error(), "file": name})
+				return
+			}
+			if f.Parsed == nil {
+				c.JSON(422, gin.H{"error": "el archivo no se pudo parsear", "file": name, "parse_error": f.ParseError})
+				return
+			}
+			files = append(files, f)
+		}
+		merged, err := mergeTables(files)
+		var mismatch *headerMismatchError
+		if errors.As(err, &mismatch) {
+			c.JSON(400, gin.H{"error": mismatch.Error(), "file": mismatch.File})
+			return
+		}
+		// el combinado reemplaza a uno de los originales: no cuenta como archivo nuevo
+		_, replaces := kb.GetFile(req.Name)
+		if !replaces && kb.FileCount()+1 > filesMax {
 			c.JSON(413, gin.H{"error": "se excede el máximo de archivos", "max": filesMax})
 			return
 		}
-		total := mem.AddFiles(req.Files)
-		c.JSON(200, internal.UploadFilesResponse{Count: len(req.Files), Total: total})
+		text := tabular.CSVText(merged)
+		out := internal.KnowledgeFile{Name: req.Name, Size: len(text), Text: text, Format: tabular.FormatCSV}
+		total, err := kb.AddFiles([]internal.KnowledgeFile{out})
+		if addFilesFailed(c, err) {
+			return
+		}
+		var removed []string
+		if req.RemoveOriginals {
+			for _, name := range req.Files {
+				if name != req.Name {
+					total = kb.RemoveFile(name)
+					removed = append(removed, name)
+				}
+			}
+		}
+		fmt.Printf("[files] %d archivo(s) combinados en %s (%d filas)\n", len(files), req.Name, len(merged.Rows))
+		answers.invalidate()
+		if rt != nil {
+			rt.indexFiles(kb.WithKeys([]internal.KnowledgeFile{out}))
+		}
+		c.JSON(200, internal.MergeFilesResponse{
+			File: internal.FileInfoResponse{
+				Name:   out.Name,
+				Size:   out.Size,
+				Format: out.Format,
+				Parsed: true,
+				Rows:   len(merged.Rows),
+			},
+			Total:   total,
+			Removed: removed,
+		})
+	})
+
+	// Agrega filas al final de un CSV (p.ej. un log que crece cada período)
+	// sin volver a subirlo entero; el body trae encabezado y filas nuevas. Si
+	// el archivo no existe se crea con ese contenido.
+	var appendMu sync.Mutex // leer, agregar y guardar no puede intercalarse
+	r.POST("/api/files/:name/append", func(c *gin.Context) {
+		var req internal.AppendFileRequest
+		if err := c.BindJSON(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+			c.JSON(400, gin.H{"error": "text requerido"})
+			return
+		}
+		name := c.Param("name")
+		appendMu.Lock()
+		defer appendMu.Unlock()
+
+		out := internal.KnowledgeFile{Name: name, Text: req.Text, Format: tabular.FormatCSV}
+		appended := 0
+		kb := filesFor(sessionID(c, mem))
+		f, exists := kb.GetFile(name)
+		switch {
+		case exists && f.ReadOnly:
+			c.JSON(403, gin.H{"error": store.ErrReadOnlyFile.Error(), "file": name})
+			return
+		case exists && f.Format != tabular.FormatCSV:
+			c.JSON(400, gin.H{"error": "solo se pueden agregar filas a archivos CSV", "format": f.Format})
+			return
+		case exists && f.Parsed == nil:
+			c.JSON(422, gin.H{"error": "el archivo no se pudo parsear", "file": name, "parse_error": f.ParseError})
+			return
+		case exists:
+			var err error
+			out, appended, err = appendRows(f, req.Text)
+			var mismatch *headerMismatchError
+			if errors.As(err, &mismatch) {
+				c.JSON(400, gin.H{"error": mismatch.Error(), "file": mismatch.File})
+				return
+			}
+			if err != nil {
+				c.JSON(400, gin.H{"error": "CSV inválido: " + err.Error()})
+				return
+			}
+		case tabular.DetectFormat(name, req.Text) != tabular.FormatCSV:
+			c.JSON(400, gin.H{"error": "el archivo se crea como CSV: name tiene que terminar en .csv"})
+			return
+		case kb.FileCount()+1 > filesMax:
+			c.JSON(413, gin.H{"error": "se excede el máximo de archivos", "max": filesMax})
+			return
+		}
+		// mismas validaciones que un upload (incluido SCHEMA_PATH) sobre el resultado
+		accepted, rejected := validateUploads([]internal.KnowledgeFile{out}, schemas)
+		if len(accepted) == 0 {
+			c.JSON(422, rejected[0])
+			return
+		}
+		out = accepted[0]
+		tabular.Annotate(&out, annotate)
+		if !exists && out.Parsed != nil {
+			appended = len(out.Parsed.Rows)
+		}
+		total, err := kb.AddFiles([]internal.KnowledgeFile{out})
+		if addFilesFailed(c, err) {
+			return
+		}
+		fmt.Printf("[files] %d fila(s) agregadas a %s\n", appended, name)
+		if appended > 0 || !exists {
+			answers.invalidate()
+			if rt != nil {
+				rt.indexFiles(kb.WithKeys([]internal.KnowledgeFile{out}))
+			}
+		}
+		info := internal.FileInfoResponse{
+			Name:      out.Name,
+			Size:      out.Size,
+			Format:    out.Format,
+			Tags:      out.Tags,
+			Encoding:  out.Encoding,
+			Delimiter: out.Delimiter,
+			Parsed:    out.Parsed != nil,
+
+			RenamedHeaders: out.RenamedHeaders,
+		}
+		if out.Parsed != nil {
+			info.Rows = len(out.Parsed.Rows)
+		}
+		c.JSON(200, internal.AppendFileResponse{File: info, Appended: appended, Created: !exists, Total: total})
 	})
 
+	// Sin parámetros borra todo; con ?prefix= solo los que empiezan así. Los
+	// compartidos no se tocan.
 	r.DELETE("/api/files", func(c *gin.Context) {
-		mem.ClearFiles()
+		kb := filesFor(sessionID(c, mem))
+		if prefix, ok := c.GetQuery("prefix"); ok {
+			if prefix == "" {
+				c.JSON(400, gin.H{"error": "prefix vacío; para borrar todo usa DELETE /api/files sin parámetros"})
+				return
+			}
+			removed, remaining := kb.RemoveByPrefix(prefix)
+			answers.invalidate()
+			c.JSON(200, gin.H{"removed": removed, "total": remaining})
+			return
+		}
+		kb.ClearFiles()
+		answers.invalidate()
 		c.JSON(200, gin.H{"ok": true})
 	})
 
+	r.GET("/api/files/:name", func(c *gin.Context) {
+		f, ok := filesFor(sessionID(c, mem)).GetFile(c.Param("name"))
+		if !ok {
+			c.JSON(404, gin.H{"error": "archivo no encontrado"})
+			return
+		}
+		info := internal.FileInfoResponse{
+			Name:       f.Name,
+			Size:       f.Size,
+			Format:     f.Format,
+			Tags:       f.Tags,
+			Encoding:   f.Encoding,
+			Delimiter:  f.Delimiter,
+			ReadOnly:   f.ReadOnly,
+			Parsed:     f.Parsed != nil,
+			ParseError: f.ParseError,
+
+			RenamedHeaders: f.RenamedHeaders,
+		}
+		if f.Parsed != nil {
+			info.Rows = len(f.Parsed.Rows)
+		}
+		if withText, _ := strconv.ParseBool(c.Query("include_text")); withText {
+			info.Text = f.Text
+		}
+		c.JSON(200, info)
+	})
+
+	// Reemplaza los tags del archivo; con "tags": [] se le quitan todos
+	r.PATCH("/api/files/:name/tags", func(c *gin.Context) {
+		var req internal.UpdateFileTagsRequest
+		if err := c.BindJSON(&req); err != nil || req.Tags == nil {
+			c.JSON(400, gin.H{"error": "tags requerido"})
+			return
+		}
+		name := c.Param("name")
+		kb := filesFor(sessionID(c, mem))
+		if f, ok := kb.GetFile(name); ok && f.ReadOnly {
+			c.JSON(403, gin.H{"error": store.ErrReadOnlyFile.Error(), "file": name})
+			return
+		}
+		if !kb.SetTags(name, *req.Tags) {
+			c.JSON(404, gin.H{"error": "archivo no encontrado"})
+			return
+		}
+		// con tags cambia qué archivos entran en cada consulta
+		answers.invalidate()
+		c.JSON(200, gin.H{"name": name, "tags": store.NormalizeTags(*req.Tags)})
+	})
+
+	// Descarga del archivo original (los comprimidos se descomprimen al leerlos)
+	r.GET("/api/files/:name/download", func(c *gin.Context) {
+		f, ok := filesFor(sessionID(c, mem)).GetFile(c.Param("name"))
+		if !ok {
+			c.JSON(404, gin.H{"error": "archivo no encontrado"})
+			return
+		}
+		writeFileDownload(c, f)
+	})
+
+	r.GET("/api/files/:name/preview", func(c *gin.Context) {
+		writeFilePreview(c, filesFor(sessionID(c, mem)))
+	})
+
+	r.GET("/api/files/:name/stats", func(c *gin.Context) {
+		f, ok := filesFor(sessionID(c, mem)).GetFile(c.Param("name"))
+		if !ok {
+			c.JSON(404, gin.H{"error": "archivo no encontrado"})
+			return
+		}
+		if f.Parsed == nil {
+			c.JSON(422, gin.H{"error": "el archivo no se pudo parsear", "parse_error": f.ParseError})
+			return
+		}
+		c.JSON(200, internal.FileStatsResponse{
+			Name:    f.Name,
+			Rows:    len(f.Parsed.Rows),
+			Columns: tabular.ColumnStats(f.Parsed),
+		})
+	})
+
+	// Agregaciones simples (p.ej. cantidad por categoría) calculadas sobre
+	// las filas, sin pasar por el modelo
+	r.POST("/api/files/:name/query", func(c *gin.Context) {
+		var req internal.FileQueryRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "JSON inválido o vacío"})
+			return
+		}
+		f, ok := filesFor(sessionID(c, mem)).GetFile(c.Param("name"))
+		if !ok {
+			c.JSON(404, gin.H{"error": "archivo no encontrado"})
+			return
+		}
+		if f.Parsed == nil {
+			c.JSON(422, gin.H{"error": "el archivo no se pudo parsear", "parse_error": f.ParseError})
+			return
+		}
+		groups, err := tabular.Aggregate(f.Parsed, req)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error(), "columns": f.Parsed.Headers})
+			return
+		}
+		fn := strings.ToLower(strings.TrimSpace(req.Func))
+		if fn == "" {
+			fn = tabular.AggCount
+		}
+		c.JSON(200, internal.FileQueryResponse{
+			Name:    f.Name,
+			GroupBy: req.GroupBy,
+			Func:    fn,
+			Column:  req.Column,
+			Rows:    len(f.Parsed.Rows),
+			Groups:  groups,
+		})
+	})
+
 	r.DELETE("/api/files/:name", func(c *gin.Context) {
 		name := c.Param("name")
-		left := mem.RemoveFile(name)
+		kb := filesFor(sessionID(c, mem))
+		if f, ok := kb.GetFile(name); ok && f.ReadOnly {
+			c.JSON(403, gin.H{"error": store.ErrReadOnlyFile.Error(), "file": name})
+			return
+		}
+		left := kb.RemoveFile(name)
+		answers.invalidate()
 		c.JSON(200, gin.H{"total": left})
 	})
 
-	// Puerto
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-	_ = r.Run(":" + port)
+	return r, mem, nil
 }
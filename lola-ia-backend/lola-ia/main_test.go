@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+func TestParseBefore(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 0, 0, 500_000_000, time.UTC)
+	for _, v := range []string{"2024-05-01T12:00:00.5Z", "2024-05-01T09:00:00.5-03:00", "1714564800500"} {
+		got, err := parseBefore(v)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseBefore(%q) = %v, %v", v, got, err)
+		}
+	}
+	for _, v := range []string{"ayer", "2024-05-01", ""} {
+		if _, err := parseBefore(v); err == nil {
+			t.Errorf("parseBefore(%q) debería fallar", v)
+		}
+	}
+}
+
+func TestListMessagesParams(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s-page"}
+	for _, path := range []string{"/api/messages?limit=0", "/api/messages?limit=x", "/api/messages?before=ayer"} {
+		if w := call(r, "GET", path, "", sid...); w.Code != 400 {
+			t.Errorf("%s: status %d, want 400", path, w.Code)
+		}
+	}
+
+	// una sesión nueva tiene solo el saludo
+	var h internal.ChatHistory
+	decode(t, call(r, "GET", "/api/messages?limit=100000", "", sid...), &h)
+	if len(h.Messages) != 1 || h.HasMore {
+		t.Errorf("sesión nueva: %d mensajes, has_more = %v", len(h.Messages), h.HasMore)
+	}
+	decode(t, call(r, "GET", "/api/messages?before=0", "", sid...), &h)
+	if len(h.Messages) != 0 || h.HasMore {
+		t.Errorf("before=0: %d mensajes, has_more = %v", len(h.Messages), h.HasMore)
+	}
+}
+
+func TestPreloadSeedSkipsOversized(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"chico.csv":  "id,nps\n1,9\n",
+		"grande.csv": "id,comentario\n1," + strings.Repeat("x", 500) + "\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mem := store.NewMemoryStore()
+	mem.SetByteLimits(store.ByteLimits{MaxFileBytes: 100})
+	res, err := preloadSeedCSVs(dir, store.SharedFiles(mem))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Added != 1 || len(res.Rejected) != 1 || res.Rejected[0].Name != "grande.csv" {
+		t.Errorf("res = %+v", res.ReseedFilesResponse)
+	}
+	if _, ok := mem.GetFile("chico.csv"); !ok {
+		t.Error("chico.csv no se cargó")
+	}
+}
+
+func TestFileStatsEndpoint(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s-stats"}
+	if w := call(r, "GET", "/api/files/nada.csv/stats", "", sid...); w.Code != 404 {
+		t.Errorf("archivo inexistente: status %d, want 404", w.Code)
+	}
+	call(r, "POST", "/api/files", `{"files":[{"name":"nps.csv","text":"id,nps\n1,9\n2,x\n"}]}`, sid...)
+	var res internal.FileStatsResponse
+	w := call(r, "GET", "/api/files/nps.csv/stats", "", sid...)
+	decode(t, w, &res)
+	if w.Code != 200 || res.Rows != 2 || len(res.Columns) != 2 || res.Columns[1].Type != "string" {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestFileInfoEndpoint(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s-info"}
+	if w := call(r, "GET", "/api/files/nada.csv", "", sid...); w.Code != 404 {
+		t.Errorf("archivo inexistente: status %d, want 404", w.Code)
+	}
+	text := "id,nps\n1,9\n2,7\n"
+	call(r, "POST", "/api/files", `{"files":[{"name":"nps.csv","text":"id,nps\n1,9\n2,7\n"}]}`, sid...)
+
+	var info internal.FileInfoResponse
+	w := call(r, "GET", "/api/files/nps.csv", "", sid...)
+	decode(t, w, &info)
+	if w.Code != 200 || info.Name != "nps.csv" || info.Size != len(text) || info.Format != "csv" || !info.Parsed || info.Rows != 2 {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+	if info.Text != "" {
+		t.Error("sin include_text no se manda el texto")
+	}
+	for query, want := range map[string]string{"?include_text=true": text, "?include_text=false": "", "?include_text=x": ""} {
+		info = internal.FileInfoResponse{}
+		decode(t, call(r, "GET", "/api/files/nps.csv"+query, "", sid...), &info)
+		if info.Text != want {
+			t.Errorf("%s: text = %q, want %q", query, info.Text, want)
+		}
+	}
+}
+
+func TestPreloadSeedFormats(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"a.csv":    "id,nps\n1,9\n",
+		"b.tsv":    "id\tnps\n1\t9\n",
+		"c.json":   `[{"id":1,"nps":9}]`,
+		"notas.md": "# no es un dataset",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mem := store.NewMemoryStore()
+	res, err := preloadSeedCSVs(dir, store.SharedFiles(mem))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Added != 3 || len(res.Rejected) != 0 {
+		t.Errorf("res = %+v", res.ReseedFilesResponse)
+	}
+	for name, format := range map[string]string{"a.csv": "csv", "b.tsv": "tsv", "c.json": "json"} {
+		f, ok := mem.GetFile(name)
+		if !ok || f.Format != format || f.Parsed == nil {
+			t.Errorf("%s: ok = %v, format = %q, parsed = %v", name, ok, f.Format, f.Parsed != nil)
+		}
+	}
+}
+
+func TestDeleteFilesByPrefix(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s-prefix"}
+	call(r, "POST", "/api/files", `{"files":[
+		{"name":"survey_2024_a.csv","text":"id\n1\n"},
+		{"name":"survey_2024_b.csv","text":"id\n1\n"},
+		{"name":"otro.csv","text":"id\n1\n"}]}`, sid...)
+
+	// un prefix vacío no borra todo
+	if w := call(r, "DELETE", "/api/files?prefix=", "", sid...); w.Code != 400 {
+		t.Errorf("prefix vacío: status %d, want 400", w.Code)
+	}
+	var res struct{ Removed, Total int }
+	w := call(r, "DELETE", "/api/files?prefix=survey_2024_", "", sid...)
+	decode(t, w, &res)
+	if w.Code != 200 || res.Removed != 2 || res.Total != 1 {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestLoadAnalystTemplateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analyst.txt")
+	tmpl := "Datos:\n" + analystDataPlaceholder + "\nPregunta: " + analystQueryPlaceholder + "\n"
+	if err := os.WriteFile(path, []byte(tmpl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadAnalystTemplate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt := buildAnalystPrompt(got, "¿pain points?", "id,nps\n1,9", "")
+	if prompt != "Datos:\nid,nps\n1,9\nPregunta: ¿pain points?\n" {
+		t.Errorf("prompt = %q", prompt)
+	}
+}
+
+func TestLoadAnalystTemplateMissingPlaceholder(t *testing.T) {
+	dir := t.TempDir()
+	for name, tmpl := range map[string]string{
+		"sin_datos.txt":    "Pregunta: " + analystQueryPlaceholder,
+		"sin_pregunta.txt": "Datos: " + analystDataPlaceholder,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(tmpl), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadAnalystTemplate(path); err == nil || !strings.Contains(err.Error(), "placeholder") {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+	if _, err := loadAnalystTemplate(filepath.Join(dir, "no-existe.txt")); err == nil {
+		t.Error("un archivo inexistente debería fallar")
+	}
+	// sin path se usa el template embebido
+	if tmpl, err := loadAnalystTemplate(""); err != nil || tmpl != analystTemplate {
+		t.Errorf("default: err = %v", err)
+	}
+}
+
+func TestUndoRedoEndpoints(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s-undo"}
+	history := func(path string) []internal.Message {
+		t.Helper()
+		w := call(r, "POST", path, "", sid...)
+		if w.Code != 200 {
+			t.Fatalf("%s: status %d", path, w.Code)
+		}
+		var h internal.ChatHistory
+		decode(t, w, &h)
+		return h.Messages
+	}
+	// solo el saludo: no-op con 200
+	if msgs := history("/api/messages/undo"); len(msgs) != 1 {
+		t.Errorf("undo sin turnos: %d mensajes", len(msgs))
+	}
+	if msgs := history("/api/messages/redo"); len(msgs) != 1 {
+		t.Errorf("redo sin nada deshecho: %d mensajes", len(msgs))
+	}
+
+	call(r, "POST", "/api/messages", `{"content":"hola"}`, sid...)
+	if msgs := history("/api/messages/undo"); len(msgs) != 1 {
+		t.Errorf("undo: %d mensajes, want solo el saludo", len(msgs))
+	}
+	msgs := history("/api/messages/redo")
+	if len(msgs) != 3 || msgs[1].Content != "hola" || msgs[2].Role != internal.RoleAssistant {
+		t.Errorf("redo: %+v", msgs)
+	}
+}
+
+// Correr con -race.
+func TestSendMessageConcurrentTurns(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"RATE_LIMIT_BURST": "1000"})
+	sid := []string{"X-Session-ID", "s-turnos"}
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if w := call(r, "POST", "/api/messages", fmt.Sprintf(`{"content":"pregunta %d"}`, i), sid...); w.Code != 200 {
+				t.Errorf("pregunta %d: status %d", i, w.Code)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			// saludo + turnos completos: nunca un par
+			var h internal.ChatHistory
+			decode(t, call(r, "GET", "/api/messages?limit=1000", "", sid...), &h)
+			if len(h.Messages)%2 != 1 {
+				t.Errorf("turno a medias: %d mensajes", len(h.Messages))
+			}
+		}()
+	}
+	wg.Wait()
+
+	var h internal.ChatHistory
+	decode(t, call(r, "GET", "/api/messages?limit=1000", "", sid...), &h)
+	if len(h.Messages) != 1+2*n {
+		t.Fatalf("%d mensajes, want %d", len(h.Messages), 1+2*n)
+	}
+	// cada respuesta sigue a su pregunta, sin otro turno en el medio
+	for i := 1; i < len(h.Messages); i += 2 {
+		q, a := h.Messages[i], h.Messages[i+1]
+		if q.Role != internal.RoleUser || a.Role != internal.RoleAssistant || !strings.Contains(a.Content, `"`+q.Content+`"`) {
+			t.Errorf("mensajes %d y %d: %s %q, %s %q", i, i+1, q.Role, q.Content, a.Role, a.Content)
+		}
+	}
+}
+
+func TestFileQueryEndpoint(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s-query"}
+	call(r, "POST", "/api/files", `{"files":[{"name":"ventas.csv","text":"id,canal,monto\n1,app,10\n2,chat,2.5\n3,app,5\n"}]}`, sid...)
+
+	var res internal.FileQueryResponse
+	decode(t, call(r, "POST", "/api/files/ventas.csv/query", `{"group_by":"canal"}`, sid...), &res)
+	if res.Func != "count" || res.Rows != 3 || len(res.Groups) != 2 || res.Groups[0].Key != "app" || *res.Groups[0].Value != 2 {
+		t.Errorf("count por canal = %+v", res)
+	}
+	decode(t, call(r, "POST", "/api/files/ventas.csv/query", `{"group_by":"canal","func":"sum","column":"monto"}`, sid...), &res)
+	if len(res.Groups) != 2 || *res.Groups[0].Value != 15 || *res.Groups[1].Value != 2.5 {
+		t.Errorf("sum de monto = %+v", res)
+	}
+
+	for _, tc := range []struct {
+		path, body string
+		want       int
+	}{
+		{"/api/files/ventas.csv/query", `{"group_by":"region"}`, 400},
+		{"/api/files/ventas.csv/query", `{"func":"sum","column":"canal"}`, 400},
+		{"/api/files/ventas.csv/query", `{"func":"mediana","column":"monto"}`, 400},
+		{"/api/files/ventas.csv/query", ``, 400},
+		{"/api/files/otro.csv/query", `{}`, 404},
+	} {
+		if w := call(r, "POST", tc.path, tc.body, sid...); w.Code != tc.want {
+			t.Errorf("%s %s: status %d, want %d: %s", tc.path, tc.body, w.Code, tc.want, w.Body)
+		}
+	}
+}
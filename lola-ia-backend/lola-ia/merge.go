@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+// headerMismatchError indica qué archivo no tiene las mismas columnas que el
+// primero de la lista.
+type headerMismatchError struct {
+	File string
+	Want []string
+	Got  []string
+}
+
+func (e *headerMismatchError) Error() string {
+	return fmt.Sprintf("%s tiene columnas distintas: se esperaba [%s] y tiene [%s]",
+		e.File, strings.Join(e.Want, ", "), strings.Join(e.Got, ", "))
+}
+
+// mergeTables concatena las filas de files, que tienen que estar parseados y
+// tener las mismas columnas en el mismo orden (comparadas como
+// tabular.SnakeCase). El resultado usa los encabezados del primero tal
+// como están en el archivo.
+func mergeTables(files []internal.KnowledgeFile) (*internal.Table, error) {
+	first := fileHeaders(files[0])
+	want := normalizedHeaders(first)
+	out := &internal.Table{Headers: first}
+	for _, f := range files {
+		if got := fileHeaders(f); !slices.Equal(normalizedHeaders(got), want) {
+			return nil, &headerMismatchError{File: f.Name, Want: first, Got: got}
+		}
+		out.Rows = append(out.Rows, f.Parsed.Rows...)
+	}
+	return out, nil
+}
+
+// fileHeaders devuelve los encabezados de f como están en su texto, antes de
+// NORMALIZE_HEADERS: los sufijos de duplicados (_2) no se comparan bien.
+func fileHeaders(f internal.KnowledgeFile) []string {
+	if f.OriginalHeaders != nil {
+		return f.OriginalHeaders
+	}
+	return f.Parsed.Headers
+}
+
+func normalizedHeaders(hs []string) []string {
+	out := make([]string, len(hs))
+	for i, h := range hs {
+		out[i] = tabular.SnakeCase(h)
+	}
+	return out
+}
+
+// appendRows agrega a f las filas del CSV text, cuyo encabezado tiene que
+// coincidir con el de f como en mergeTables. El texto existente no se toca:
+// las filas nuevas se escriben a continuación, con el separador de f.
+// Devuelve el archivo actualizado y la cantidad de filas agregadas.
+func appendRows(f internal.KnowledgeFile, text string) (internal.KnowledgeFile, int, error) {
+	t, err := tabular.ParseCSV(text)
+	if err != nil {
+		return f, 0, err
+	}
+	if want := fileHeaders(f); !slices.Equal(normalizedHeaders(t.Headers), normalizedHeaders(want)) {
+		return f, 0, &headerMismatchError{File: f.Name, Want: want, Got: t.Headers}
+	}
+	if len(t.Rows) == 0 {
+		return f, 0, nil
+	}
+	if f.Text != "" && !strings.HasSuffix(f.Text, "\n") {
+		f.Text += "\n"
+	}
+	comma := ','
+	if f.Delimiter != "" {
+		comma, _ = utf8.DecodeRuneInString(f.Delimiter)
+	}
+	f.Text += tabular.CSVRows(t.Rows, comma)
+	f.Size = len(f.Text)
+	return f, len(t.Rows), nil
+}
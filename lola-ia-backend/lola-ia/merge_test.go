@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestMergeTables(t *testing.T) {
+	merged, err := mergeTables([]internal.KnowledgeFile{
+		csvFile("enero.csv", "ID,Canal\n1,app\n"),
+		// las columnas se comparan como snake_case
+		csvFile("febrero.csv", "id,canal\n2,chat\n3,app\n"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(merged.Headers, []string{"ID", "Canal"}) || len(merged.Rows) != 3 || merged.Rows[2][0] != "3" {
+		t.Errorf("merged = %+v", merged)
+	}
+
+	_, err = mergeTables([]internal.KnowledgeFile{
+		csvFile("enero.csv", "id,canal\n1,app\n"),
+		csvFile("marzo.csv", "canal,id\napp,4\n"),
+	})
+	var mismatch *headerMismatchError
+	if !errors.As(err, &mismatch) || mismatch.File != "marzo.csv" {
+		t.Errorf("err = %v, want headerMismatchError de marzo.csv", err)
+	}
+}
+
+func TestMergeFilesEndpoint(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s-merge"}
+	call(r, "POST", "/api/files", `{"files":[
+		{"name":"enero.csv","text":"id,nps\n1,9\n2,7\n"},
+		{"name":"febrero.csv","text":"id,nps\n3,10\n"},
+		{"name":"otro.csv","text":"id,comentario\n1,lento\n"}
+	]}`, sid...)
+
+	w := call(r, "POST", "/api/files/merge", `{"files":["enero.csv","otro.csv"],"name":"q1.csv"}`, sid...)
+	var bad struct{ File string }
+	decode(t, w, &bad)
+	if w.Code != 400 || bad.File != "otro.csv" {
+		t.Errorf("columnas distintas: status %d: %s", w.Code, w.Body)
+	}
+	if w := call(r, "POST", "/api/files/merge", `{"files":["enero.csv","nada.csv"],"name":"q1.csv"}`, sid...); w.Code != 404 {
+		t.Errorf("archivo inexistente: status %d, want 404", w.Code)
+	}
+
+	w = call(r, "POST", "/api/files/merge", `{"files":["enero.csv","febrero.csv"],"name":"q1.csv","remove_originals":true}`, sid...)
+	var res internal.MergeFilesResponse
+	decode(t, w, &res)
+	if w.Code != 200 || res.File.Name != "q1.csv" || res.File.Rows != 3 || res.Total != 2 {
+		t.Fatalf("merge: status %d: %s", w.Code, w.Body)
+	}
+	if !slices.Equal(res.Removed, []string{"enero.csv", "febrero.csv"}) {
+		t.Errorf("removed = %v", res.Removed)
+	}
+	var info internal.FileInfoResponse
+	decode(t, call(r, "GET", "/api/files/q1.csv?include_text=true", "", sid...), &info)
+	if info.Text != "id,nps\n1,9\n2,7\n3,10\n" {
+		t.Errorf("texto combinado = %q", info.Text)
+	}
+	if w := call(r, "GET", "/api/files/enero.csv", "", sid...); w.Code != 404 {
+		t.Errorf("enero.csv sigue estando: status %d", w.Code)
+	}
+}
+
+func TestAppendRows(t *testing.T) {
+	cases := []struct {
+		name, old, text string
+		want            string
+		n               int
+	}{
+		{"agrega", "id,canal\n1,app\n", "ID,Canal\n2,chat\n3,\"a, b\"\n", "id,canal\n1,app\n2,chat\n3,\"a, b\"\n", 2},
+		{"sin salto final", "id,canal\n1,app", "id,canal\n2,chat\n", "id,canal\n1,app\n2,chat\n", 1},
+		{"con el separador del archivo", "id;canal\n1;app\n", "id,canal\n2,chat\n", "id;canal\n1;app\n2;chat\n", 1},
+		{"sin filas", "id,canal\n1,app\n", "id,canal\n", "id,canal\n1,app\n", 0},
+	}
+	for _, tc := range cases {
+		out, n, err := appendRows(csvFile("log.csv", tc.old), tc.text)
+		if err != nil || out.Text != tc.want || n != tc.n || out.Size != len(tc.want) {
+			t.Errorf("%s: %q, %d filas, size %d, %v", tc.name, out.Text, n, out.Size, err)
+		}
+	}
+
+	_, _, err := appendRows(csvFile("log.csv", "id,canal\n1,app\n"), "id,region\n2,sur\n")
+	var mismatch *headerMismatchError
+	if !errors.As(err, &mismatch) || mismatch.File != "log.csv" {
+		t.Errorf("encabezado distinto: err = %v", err)
+	}
+}
+
+func TestAppendFileEndpoint(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s-append"}
+	appendText := func(name, text string) (int, internal.AppendFileResponse) {
+		t.Helper()
+		w := call(r, "POST", "/api/files/"+name+"/append", `{"text":"`+text+`"}`, sid...)
+		var res internal.AppendFileResponse
+		if w.Code == 200 {
+			decode(t, w, &res)
+		}
+		return w.Code, res
+	}
+
+	// si no existe se crea
+	code, res := appendText("log.csv", `id,evento\n1,login\n`)
+	if code != 200 || !res.Created || res.Appended != 1 || res.File.Rows != 1 || res.Total != 1 {
+		t.Fatalf("crear: status %d, %+v", code, res)
+	}
+	code, res = appendText("log.csv", `id,evento\n2,logout\n3,login\n`)
+	if code != 200 || res.Created || res.Appended != 2 || res.File.Rows != 3 {
+		t.Errorf("agregar: status %d, %+v", code, res)
+	}
+	want := "id,evento\n1,login\n2,logout\n3,login\n"
+	var info internal.FileInfoResponse
+	decode(t, call(r, "GET", "/api/files/log.csv?include_text=true", "", sid...), &info)
+	if info.Text != want || info.Size != len(want) {
+		t.Errorf("archivo = %q (%d bytes)", info.Text, info.Size)
+	}
+
+	for _, tc := range []struct {
+		name, file, text string
+	}{
+		{"encabezado distinto", "log.csv", `id,usuario\n4,ana\n`},
+		{"sin text", "log.csv", ``},
+		{"no es CSV", "log.json", `id,evento\n1,login\n`},
+	} {
+		if code, _ := appendText(tc.file, tc.text); code != 400 {
+			t.Errorf("%s: status %d, want 400", tc.name, code)
+		}
+	}
+	// el rechazo no tocó el archivo
+	decode(t, call(r, "GET", "/api/files/log.csv?include_text=true", "", sid...), &info)
+	if info.Text != want {
+		t.Errorf("después de los rechazos: %q", info.Text)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+// metrics agrupa las métricas de Prometheus del servidor. Usa un registry
+// propio (no el global) que se crea una sola vez en main.
+type metrics struct {
+	reg             *prometheus.Registry
+	messages        *prometheus.CounterVec
+	providerLatency *prometheus.HistogramVec
+	providerErrors  *prometheus.CounterVec
+	filesUploaded   *prometheus.CounterVec
+	answerCache     *prometheus.CounterVec
+}
+
+func newMetrics(mem store.Store) *metrics {
+	m := &metrics{
+		reg: prometheus.NewRegistry(),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lola_messages_total",
+			Help: "Mensajes de usuario procesados, por modo (analyst o normal).",
+		}, []string{"mode"}),
+		providerLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "lola_provider_request_duration_seconds",
+			Help:    "Duración de las llamadas al proveedor de chat.",
+			Buckets: []float64{0.25, 0.5, 1, 2, 4, 8, 16, 32, 64},
+		}, []string{"model", "stream"}),
+		providerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lola_provider_errors_total",
+			Help: "Errores del proveedor de chat, por tipo.",
+		}, []string{"type"}),
+		filesUploaded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lola_files_uploaded_total",
+			Help: "Archivos recibidos en POST /api/files, aceptados o rechazados.",
+		}, []string{"result"}),
+		answerCache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lola_answer_cache_total",
+			Help: "Consultas de análisis buscadas en el cache de respuestas, por resultado (hit o miss).",
+		}, []string{"result"}),
+	}
+	m.reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.messages, m.providerLatency, m.providerErrors, m.filesUploaded, m.answerCache,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "lola_files",
+			Help: "Archivos cargados en la knowledge base.",
+		}, func() float64 { return float64(mem.FileCount()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "lola_sessions",
+			Help: "Sesiones de chat activas.",
+		}, func() float64 { return float64(mem.SessionCount()) }),
+	)
+	return m
+}
+
+func (m *metrics) handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{}))
+}
+
+// providerErrorType clasifica err para la etiqueta type de lola_provider_errors_total.
+func providerErrorType(err error) string {
+	var apiErr *provider.APIError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &apiErr):
+		if apiErr.StatusCode == 429 {
+			return "rate_limited"
+		}
+		return "http_" + strconv.Itoa(apiErr.StatusCode/100) + "xx"
+	case errors.As(err, &netErr):
+		return "network"
+	default:
+		return "other"
+	}
+}
+
+// instrumentedProvider mide latencia y errores de cada llamada al provider.
+type instrumentedProvider struct {
+	provider.ChatProvider
+	m *metrics
+}
+
+func (p instrumentedProvider) observe(stream string, start time.Time, err error) {
+	p.m.providerLatency.WithLabelValues(p.Model(), stream).Observe(time.Since(start).Seconds())
+	if err != nil {
+		p.m.providerErrors.WithLabelValues(providerErrorType(err)).Inc()
+	}
+}
+
+// With mantiene la instrumentación en la copia con opts, si el provider
+// envuelto admite CallOptions.
+func (p instrumentedProvider) With(opts provider.CallOptions) provider.ChatProvider {
+	cfg, ok := p.ChatProvider.(provider.Configurable)
+	if !ok {
+		return p
+	}
+	return instrumentedProvider{ChatProvider: cfg.With(opts), m: p.m}
+}
+
+func (p instrumentedProvider) Reply(ctx context.Context, history []internal.Message, userInput string) (provider.Result, error) {
+	start := time.Now()
+	res, err := p.ChatProvider.Reply(ctx, history, userInput)
+	p.observe("false", start, err)
+	return res, err
+}
+
+func (p instrumentedProvider) ReplyStream(ctx context.Context, history []internal.Message, userInput string, out chan<- string) (provider.Result, error) {
+	start := time.Now()
+	res, err := p.ChatProvider.ReplyStream(ctx, history, userInput, out)
+	p.observe("true", start, err)
+	return res, err
+}
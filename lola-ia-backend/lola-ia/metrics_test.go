@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+func TestMetricsScrape(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s-metrics"}
+	if w := call(r, "POST", "/api/messages", `{"content":"hola"}`, sid...); w.Code != 200 {
+		t.Fatalf("mensaje: status %d: %s", w.Code, w.Body)
+	}
+	if w := call(r, "POST", "/api/files", `{"files":[{"name":"a.csv","text":"id\n1\n"}]}`, sid...); w.Code != 200 {
+		t.Fatalf("archivo: status %d: %s", w.Code, w.Body)
+	}
+
+	w := call(r, "GET", "/metrics", "")
+	if w.Code != 200 {
+		t.Fatalf("/metrics: status %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`lola_messages_total{mode="normal"} 1`,
+		`lola_files_uploaded_total{result="accepted"} 1`,
+		fmt.Sprintf(`lola_provider_request_duration_seconds_count{model=%q,stream="false"} 1`, provider.DefaultModel("mock")),
+		"lola_files 1",
+		"lola_sessions 1",
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics sin %q", want)
+		}
+	}
+}
+
+func TestProviderErrorType(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{context.DeadlineExceeded, "timeout"},
+		{fmt.Errorf("openai: %w", context.Canceled), "canceled"},
+		{&provider.APIError{StatusCode: 429}, "rate_limited"},
+		{&provider.APIError{StatusCode: 503}, "http_5xx"},
+		{&provider.APIError{StatusCode: 401}, "http_4xx"},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "network"},
+		{errors.New("respuesta vacía"), "other"},
+	}
+	for _, tc := range cases {
+		if got := providerErrorType(tc.err); got != tc.want {
+			t.Errorf("providerErrorType(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
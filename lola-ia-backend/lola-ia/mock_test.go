@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestMockProviderReplies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "respuestas.json")
+	if err := os.WriteFile(path, []byte(`[{"contains":"feriado","reply":"El lunes es feriado."}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(t, map[string]string{"MOCK_RESPONSES": path})
+	reply := func(sid, content string) (string, string) {
+		t.Helper()
+		w := call(r, "POST", "/api/messages", `{"content":"`+content+`"}`, "X-Session-ID", sid)
+		if w.Code != 200 {
+			t.Fatalf("%q: status %d: %s", content, w.Code, w.Body)
+		}
+		var res internal.SendMessageResponse
+		decode(t, w, &res)
+		return w.Header().Get(modeHeader), res.Reply.Content
+	}
+
+	if _, got := reply("s1", "¿hay feriado?"); got != "El lunes es feriado." {
+		t.Errorf("respuesta fija: %q", got)
+	}
+	// el modo analista responde con las secciones del template, en orden
+	mode, got := reply("s2", "Hazme un análisis de las encuestas")
+	if mode != "analyst" {
+		t.Fatalf("%s = %q", modeHeader, mode)
+	}
+	var headers []string
+	for _, line := range strings.Split(got, "\n") {
+		if strings.HasPrefix(line, "--- ") {
+			headers = append(headers, line)
+		}
+	}
+	want := []string{"--- Summary", "--- Main Pain Points & Needs", "--- Actionable Feedback",
+		"--- Top 3 Topics and (%) of Mentions", "--- Examples of Verbatim for those main topics"}
+	if !slices.Equal(headers, want) {
+		t.Errorf("secciones = %q", headers)
+	}
+	if _, got := reply("s3", "hola"); !strings.Contains(got, `Me pediste: "hola"`) {
+		t.Errorf("eco: %q", got)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+// parseAllowedModels separa la lista ALLOWED_MODELS (separada por comas).
+func parseAllowedModels(v string) []string {
+	var out []string
+	for _, m := range strings.Split(v, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// errModelNotAllowed: el modelo pedido no está en ALLOWED_MODELS.
+var errModelNotAllowed = errors.New("modelo no permitido")
+
+// withModel devuelve chat usando model solo para esta llamada. Vacío o igual
+// al actual devuelve chat tal cual; un modelo fuera de allowed da
+// errModelNotAllowed.
+func withModel(chat provider.ChatProvider, model string, allowed []string) (provider.ChatProvider, error) {
+	if model == "" || model == chat.Model() {
+		return chat, nil
+	}
+	if !slices.Contains(allowed, model) {
+		return nil, errModelNotAllowed
+	}
+	return switchModel(chat, model)
+}
+
+var errModelSwitch = errors.New("el provider no admite cambiar de modelo")
+
+// switchModel devuelve chat con model, sin mirar ALLOWED_MODELS.
+func switchModel(chat provider.ChatProvider, model string) (provider.ChatProvider, error) {
+	cfg, ok := chat.(provider.Configurable)
+	if !ok {
+		return nil, errModelSwitch
+	}
+	out := cfg.With(provider.CallOptions{Model: model})
+	if out.Model() != model {
+		return nil, errModelSwitch
+	}
+	return out, nil
+}
+
+// modelRouter elige el modelo según el modo de la consulta cuando el request
+// no pide uno: PLAIN_MODEL para las casuales y ANALYST_MODEL para el modo
+// análisis y los templates. Vacío es el modelo default.
+type modelRouter struct {
+	plain, analyst string
+}
+
+// newModelRouter descarta (con un log) los modelos que chat no puede usar.
+func newModelRouter(chat provider.ChatProvider, plain, analyst string) modelRouter {
+	check := func(env, model string) string {
+		if model == "" || model == chat.Model() {
+			return ""
+		}
+		if _, err := switchModel(chat, model); err != nil {
+			fmt.Printf("[provider] %s=%s ignorado: %v\n", env, model, err)
+			return ""
+		}
+		return model
+	}
+	r := modelRouter{plain: check("PLAIN_MODEL", plain), analyst: check("ANALYST_MODEL", analyst)}
+	if r.plain != "" || r.analyst != "" {
+		fmt.Printf("[provider] modelo por modo: plain=%s analyst=%s\n", r.model(chat, "plain"), r.model(chat, "analyst"))
+	}
+	return r
+}
+
+// model devuelve el modelo que corresponde a mode.
+func (r modelRouter) model(chat provider.ChatProvider, mode string) string {
+	m := r.analyst
+	if mode == "plain" {
+		m = r.plain
+	}
+	if m == "" {
+		return chat.Model()
+	}
+	return m
+}
+
+// pick devuelve el provider para una consulta en modo mode: el modelo pedido
+// en el request (validado contra allowed, como withModel) o, si no pidió
+// ninguno, el del modo.
+func (r modelRouter) pick(chat provider.ChatProvider, requested, mode string, allowed []string) (provider.ChatProvider, error) {
+	if requested != "" {
+		return withModel(chat, requested, allowed)
+	}
+	m := r.model(chat, mode)
+	if m == chat.Model() {
+		return chat, nil
+	}
+	// ya verificado en newModelRouter
+	return switchModel(chat, m)
+}
+
+// modelCheckTimeout acota cada consulta de validateModels.
+const modelCheckTimeout = 10 * time.Second
+
+// validateModels verifica con el proveedor (ver provider.Pinger) que existan
+// el modelo de chat y los de models (PLAIN_MODEL, ANALYST_MODEL,
+// ALLOWED_MODELS). Solo falla si la API dice que un modelo no existe: si no
+// responde se avisa y se sigue, para no depender de ella al arrancar.
+func validateModels(chat provider.ChatProvider, models []string) error {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, model := range append([]string{chat.Model()}, models...) {
+		if model == "" || seen[model] {
+			continue
+		}
+		seen[model] = true
+		p := chat
+		if model != chat.Model() {
+			var err error
+			if p, err = switchModel(chat, model); err != nil {
+				continue // newModelRouter ya lo avisa
+			}
+		}
+		pinger, ok := p.(provider.Pinger)
+		if !ok {
+			fmt.Printf("[provider] el provider no permite validar modelos; VALIDATE_MODEL se ignora\n")
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), modelCheckTimeout)
+		err := pinger.Ping(ctx)
+		cancel()
+		switch {
+		case errors.Is(err, provider.ErrModelNotFound):
+			missing = append(missing, model)
+		case err != nil:
+			fmt.Printf("[provider] no se pudo validar el modelo %s: %v\n", model, err)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", provider.ErrModelNotFound, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// modelNotFoundMessage es el error para el cliente cuando el proveedor no
+// conoce model, en vez del mensaje de la API.
+func modelNotFoundMessage(model string) string {
+	return fmt.Sprintf("el proveedor no tiene el modelo %q: revisar el modelo pedido o la configuración", model)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/classify"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+func TestSendMessageModelOverride(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"ALLOWED_MODELS": "mock-grande, mock-chico"})
+	cases := []struct {
+		name  string
+		model string
+		code  int
+		want  string
+	}{
+		{"default", "", 200, provider.DefaultModel("mock")},
+		{"override", "mock-grande", 200, "mock-grande"},
+		{"el default pedido explícito", provider.DefaultModel("mock"), 200, provider.DefaultModel("mock")},
+		{"no permitido", "gpt-enorme", 400, ""},
+	}
+	for i, tc := range cases {
+		body := `{"content":"hola","model":"` + tc.model + `"}`
+		// una sesión por caso: el mismo mensaje seguido es un duplicado
+		w := call(r, "POST", "/api/messages", body, "X-Session-ID", fmt.Sprintf("s-model-%d", i))
+		if w.Code != tc.code {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, w.Code, tc.code, w.Body)
+			continue
+		}
+		if tc.code != 200 {
+			continue
+		}
+		var res internal.SendMessageResponse
+		decode(t, w, &res)
+		if res.Model != tc.want {
+			t.Errorf("%s: model = %q, want %q", tc.name, res.Model, tc.want)
+		}
+	}
+
+	// el override es solo para ese mensaje
+	var res internal.SendMessageResponse
+	decode(t, call(r, "POST", "/api/messages", `{"content":"otra"}`, "X-Session-ID", "s-model-0"), &res)
+	if res.Model != provider.DefaultModel("mock") {
+		t.Errorf("después del override: model = %q", res.Model)
+	}
+}
+
+func TestWithModel(t *testing.T) {
+	chat := provider.MockProvider{}
+	allowed := parseAllowedModels(" grande ,, chico")
+	if len(allowed) != 2 {
+		t.Fatalf("parseAllowedModels = %q", allowed)
+	}
+	if p, err := withModel(chat, "", allowed); err != nil || p.Model() != chat.Model() {
+		t.Errorf("sin modelo: %v, %v", p, err)
+	}
+	if p, err := withModel(chat, "grande", allowed); err != nil || p.Model() != "grande" {
+		t.Errorf("grande: %v, %v", p, err)
+	}
+	if _, err := withModel(chat, "otro", allowed); err != errModelNotAllowed {
+		t.Errorf("otro: err = %v, want errModelNotAllowed", err)
+	}
+	if chat.Model() == "grande" {
+		t.Error("withModel cambió el provider original")
+	}
+}
+
+func TestModelRouter(t *testing.T) {
+	chat := provider.MockProvider{}
+	r := newModelRouter(chat, "chico", "grande")
+	for _, tc := range []struct{ requested, mode, want string }{
+		{"", "plain", "chico"},
+		{"", "analyst", "grande"},
+		{"", "resumen", "grande"}, // los templates van con el de análisis
+		{"otro", "plain", "otro"}, // el pedido gana
+	} {
+		p, err := r.pick(chat, tc.requested, tc.mode, []string{"otro"})
+		if err != nil || p.Model() != tc.want {
+			t.Errorf("pick(%q, %q) = %v, %v; want %s", tc.requested, tc.mode, p, err, tc.want)
+		}
+	}
+
+	// sin PLAIN_MODEL ni ANALYST_MODEL todo va al modelo de chat
+	r = newModelRouter(chat, "", chat.Model())
+	for _, mode := range []string{"plain", "analyst"} {
+		if p, _ := r.pick(chat, "", mode, nil); p.Model() != chat.Model() {
+			t.Errorf("%s sin configurar: %s", mode, p.Model())
+		}
+	}
+}
+
+func TestSendMessageModelByMode(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"PLAIN_MODEL": "mock-chico", "ANALYST_MODEL": "mock-grande"})
+	analyst := classify.New(classify.DefaultKeywords, classify.DefaultThreshold)
+	seen := make(map[string]bool)
+	for i, content := range []string{
+		"hola, ¿cómo estás?",
+		"gracias",
+		"analizá los principales pain points y temas de los comentarios de NPS",
+		"¿cuáles son los motivos de queja más frecuentes? dame verbatims",
+	} {
+		want := "mock-chico"
+		if analyst.Analyst(content) {
+			want = "mock-grande"
+		}
+		var res internal.SendMessageResponse
+		decode(t, call(r, "POST", "/api/messages", `{"content":"`+content+`"}`, "X-Session-ID", fmt.Sprintf("s-mode-%d", i)), &res)
+		if res.Model != want {
+			t.Errorf("%q: model = %q, want %q", content, res.Model, want)
+		}
+		seen[res.Model] = true
+	}
+	if !seen["mock-chico"] || !seen["mock-grande"] {
+		t.Errorf("no se usaron los dos modelos: %v", seen)
+	}
+}
+
+// rewrite manda todos los requests a srv, para apuntar un provider real a
+// un stub.
+type rewrite struct{ srv *httptest.Server }
+
+func (rw rewrite) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(rw.srv.URL)
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestValidateModels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/models/gpt-4o-mini", "/v1/models/gpt-4o":
+			w.Write([]byte(`{"id":"ok","object":"model"}`))
+		case "/v1/models/gpt-caido":
+			w.WriteHeader(503)
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"error":{"message":"The model does not exist","code":"model_not_found"}}`))
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("OPENAI_API_KEY", "k")
+	retries := 0
+	chat, err := provider.NewOpenAIProvider("gpt-4o-mini", provider.ProviderConfig{HTTPClient: &http.Client{Transport: rewrite{srv}}, MaxRetries: &retries})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validateModels(chat, []string{"", "gpt-4o", "gpt-4o"}); err != nil {
+		t.Errorf("modelos existentes: %v", err)
+	}
+	// si la API no responde se sigue: el arranque no depende de ella
+	if err := validateModels(chat, []string{"gpt-caido"}); err != nil {
+		t.Errorf("API caída: %v", err)
+	}
+	err = validateModels(chat, []string{"gpt-4o", "gpt-4o-mnii", "gtp-4o"})
+	if !errors.Is(err, provider.ErrModelNotFound) || !strings.Contains(err.Error(), "gpt-4o-mnii, gtp-4o") {
+		t.Errorf("modelos con typo: err = %v", err)
+	}
+	// un provider que no sabe validar no bloquea
+	if err := validateModels(provider.MockProvider{}, []string{"otro"}); err != nil {
+		t.Errorf("mock: %v", err)
+	}
+}
+
+func TestSendMessageModelNotFound(t *testing.T) {
+	r := newOllamaRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"error":"model 'llama9' not found, try pulling it first"}`))
+	}, map[string]string{"OLLAMA_MODEL": "llama9"})
+	w := call(r, "POST", "/api/messages", `{"content":"hola"}`, "X-Session-ID", "s-typo")
+	if w.Code != 400 || !strings.Contains(w.Body.String(), `no tiene el modelo \"llama9\"`) {
+		t.Errorf("status %d, want 400: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nubank/lola-ia-backend/internal/provider"
+	"github.com/nubank/lola-ia-backend/internal/textnorm"
+)
+
+// moderationGate filtra los mensajes del usuario antes de guardarlos o
+// mandarlos al proveedor. Un gate nil no bloquea nada.
+type moderationGate struct {
+	m provider.Moderator
+	// failOpen deja pasar el mensaje si la moderación misma falla.
+	failOpen bool
+}
+
+// errModerationUnavailable: la moderación falló y el gate no es fail-open.
+var errModerationUnavailable = errors.New("no se pudo verificar el mensaje; intente de nuevo")
+
+// newModerationGate arma el gate si MODERATION=true: con la lista de
+// palabras de MODERATION_WORDLIST (una por línea) o, si no hay, con el
+// endpoint de moderación del provider. chat es el provider sin envolver.
+// Si MODERATION_WORDLIST no se puede cargar devuelve el error: arrancar sin
+// la moderación pedida dejaría pasar todo sin que nadie se entere.
+func newModerationGate(chat provider.ChatProvider) (*moderationGate, error) {
+	if on, _ := strconv.ParseBool(os.Getenv("MODERATION")); !on {
+		return nil, nil
+	}
+	failOpen := true
+	if v, err := strconv.ParseBool(os.Getenv("MODERATION_FAIL_OPEN")); err == nil {
+		failOpen = v
+	}
+	if path := os.Getenv("MODERATION_WORDLIST"); path != "" {
+		wl, err := loadWordlist(path)
+		if err != nil {
+			return nil, fmt.Errorf("MODERATION_WORDLIST: %w", err)
+		}
+		fmt.Printf("[moderation] lista de %d términos (%s)\n", len(wl.terms), path)
+		return &moderationGate{m: wl, failOpen: failOpen}, nil
+	}
+	if m, ok := chat.(provider.Moderator); ok {
+		fmt.Printf("[moderation] usando el endpoint de moderación del provider\n")
+		return &moderationGate{m: m, failOpen: failOpen}, nil
+	}
+	fmt.Printf("[moderation] el provider no modera y no hay MODERATION_WORDLIST; moderación desactivada\n")
+	return nil, nil
+}
+
+// check devuelve el motivo si content debe bloquearse. El error solo se
+// devuelve cuando la moderación falló y el gate no es fail-open.
+func (g *moderationGate) check(ctx context.Context, content string) (reason string, blocked bool, err error) {
+	if g == nil {
+		return "", false, nil
+	}
+	res, err := g.m.Moderate(ctx, content)
+	if err != nil {
+		fmt.Printf("[moderation] error: %v\n", err)
+		if g.failOpen {
+			return "", false, nil
+		}
+		return "", false, errModerationUnavailable
+	}
+	if !res.Flagged {
+		return "", false, nil
+	}
+	reason = "contenido no permitido"
+	if len(res.Categories) > 0 {
+		reason += ": " + strings.Join(res.Categories, ", ")
+	}
+	fmt.Printf("[moderation] mensaje bloqueado (%s)\n", reason)
+	return reason, true, nil
+}
+
+// wordlist es un Moderator local: marca los textos que contienen alguno de
+// los términos como palabra completa, sin distinguir mayúsculas ni acentos.
+type wordlist struct {
+	terms []string // normalizados, con las palabras separadas por un espacio
+}
+
+func loadWordlist(path string) (*wordlist, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	wl := &wordlist{}
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		wl.terms = append(wl.terms, strings.Join(words(line), " "))
+	}
+	if len(wl.terms) == 0 {
+		return nil, fmt.Errorf("%s no tiene términos", path)
+	}
+	return wl, nil
+}
+
+func (wl *wordlist) Moderate(_ context.Context, text string) (provider.Moderation, error) {
+	// con espacios en los bordes, " term " solo matchea palabras completas
+	padded := " " + strings.Join(words(text), " ") + " "
+	for _, t := range wl.terms {
+		if strings.Contains(padded, " "+t+" ") {
+			return provider.Moderation{Flagged: true}, nil
+		}
+	}
+	return provider.Moderation{}, nil
+}
+
+// words separa s en palabras normalizadas (ver textnorm.Fold).
+func words(s string) []string {
+	return strings.FieldsFunc(textnorm.Fold(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+// stubModerator responde siempre res, err.
+type stubModerator struct {
+	res provider.Moderation
+	err error
+}
+
+func (s stubModerator) Moderate(context.Context, string) (provider.Moderation, error) {
+	return s.res, s.err
+}
+
+func writeWordlist(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wordlist.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestModerationGateWordlistInvalid(t *testing.T) {
+	t.Setenv("MODERATION", "true")
+	for name, path := range map[string]string{
+		"no existe": filepath.Join(t.TempDir(), "no-existe.txt"),
+		"vacía":     writeWordlist(t, "# solo comentarios\n\n"),
+	} {
+		t.Setenv("MODERATION_WORDLIST", path)
+		g, err := newModerationGate(nil)
+		if err == nil || g != nil {
+			t.Errorf("%s: gate = %v, err = %v; want error", name, g, err)
+		}
+	}
+}
+
+func TestModerationGateOff(t *testing.T) {
+	t.Setenv("MODERATION", "")
+	// sin MODERATION la lista no se lee: un path roto no impide arrancar
+	t.Setenv("MODERATION_WORDLIST", filepath.Join(t.TempDir(), "no-existe.txt"))
+	g, err := newModerationGate(nil)
+	if g != nil || err != nil {
+		t.Errorf("gate = %v, err = %v; want nil, nil", g, err)
+	}
+}
+
+func TestModerationGateWordlist(t *testing.T) {
+	t.Setenv("MODERATION", "true")
+	t.Setenv("MODERATION_WORDLIST", writeWordlist(t, "# términos\nestafa\nlavado de dinero\n"))
+	g, err := newModerationGate(nil)
+	if err != nil || g == nil {
+		t.Fatalf("gate = %v, err = %v", g, err)
+	}
+	cases := []struct {
+		in      string
+		blocked bool
+	}{
+		{"¿Esto es una ESTAFA?", true},
+		{"ayuda con lavado  de  dinero", true},
+		{"Lavado de Dinero, dijo", true},
+		{"estafadores", false}, // solo palabras completas
+		{"lavado de autos", false},
+		{"hola, ¿cómo estás?", false},
+	}
+	for _, tc := range cases {
+		_, blocked, err := g.check(context.Background(), tc.in)
+		if err != nil || blocked != tc.blocked {
+			t.Errorf("check(%q) = %v, %v; want %v", tc.in, blocked, err, tc.blocked)
+		}
+	}
+}
+
+func TestModerationGateCheck(t *testing.T) {
+	down := errors.New("moderación caída")
+	cases := []struct {
+		name     string
+		m        stubModerator
+		failOpen bool
+		blocked  bool
+		reason   string
+		err      error
+	}{
+		{"limpio", stubModerator{}, false, false, "", nil},
+		{"marcado", stubModerator{res: provider.Moderation{Flagged: true, Categories: []string{"harassment", "violence"}}}, false, true, "contenido no permitido: harassment, violence", nil},
+		{"marcado sin categorías", stubModerator{res: provider.Moderation{Flagged: true}}, false, true, "contenido no permitido", nil},
+		{"falla fail-open", stubModerator{err: down}, true, false, "", nil},
+		{"falla fail-closed", stubModerator{err: down}, false, false, "", errModerationUnavailable},
+	}
+	for _, tc := range cases {
+		g := &moderationGate{m: tc.m, failOpen: tc.failOpen}
+		reason, blocked, err := g.check(context.Background(), "texto")
+		if blocked != tc.blocked || reason != tc.reason || err != tc.err {
+			t.Errorf("%s: check = %q, %v, %v", tc.name, reason, blocked, err)
+		}
+	}
+	var off *moderationGate
+	if _, blocked, err := off.check(context.Background(), "texto"); blocked || err != nil {
+		t.Error("un gate nil no debería bloquear")
+	}
+}
+
+func TestSendMessageModeration(t *testing.T) {
+	r := newTestRouter(t, map[string]string{
+		"MODERATION":          "true",
+		"MODERATION_WORDLIST": writeWordlist(t, "estafa\n"),
+	})
+	sid := []string{"X-Session-ID", "s-mod"}
+	w := call(r, "POST", "/api/messages", `{"content":"esto es una estafa"}`, sid...)
+	if w.Code != 422 {
+		t.Fatalf("bloqueado: status %d, want 422", w.Code)
+	}
+	var res struct{ Reason string }
+	decode(t, w, &res)
+	if res.Reason == "" {
+		t.Error("422 sin reason")
+	}
+	// no se guarda nada del mensaje bloqueado
+	var h internal.ChatHistory
+	decode(t, call(r, "GET", "/api/messages", "", sid...), &h)
+	if len(h.Messages) != 1 {
+		t.Errorf("%d mensajes guardados, want solo el saludo", len(h.Messages))
+	}
+	if w := call(r, "POST", "/api/messages", `{"content":"hola"}`, sid...); w.Code != 200 {
+		t.Errorf("limpio: status %d", w.Code)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+const (
+	defaultOutboxAttempts = 3
+	defaultOutboxBackoff  = 200 * time.Millisecond
+	// reintentos en segundo plano de un turno que no se pudo guardar
+	// durante el request: de outboxRetryFirst a outboxRetryMaxWait
+	outboxRetries      = 8
+	outboxRetryFirst   = time.Second
+	outboxRetryMaxWait = time.Minute
+)
+
+// fallibleAppender lo implementan los stores cuya escritura puede fallar y
+// lo informan (SQLite); en memoria no falla nunca.
+type fallibleAppender interface {
+	TryAppendBatchForSession(id string, msgs ...internal.Message) ([]internal.Message, error)
+}
+
+// outbox guarda el turno (consulta y respuesta) después de que el proveedor
+// respondió: si la base falla, reintenta con backoff para no perder una
+// respuesta ya pagada por un problema pasajero. Los turnos pendientes
+// viven en memoria y se pierden si el proceso se reinicia.
+type outbox struct {
+	mem      store.Store
+	w        fallibleAppender // nil: el store no falla
+	attempts int
+	backoff  time.Duration
+	pending  atomic.Int64
+}
+
+// newOutbox reintenta cada turno attempts veces durante el request, con
+// backoff (que se duplica) entre intentos.
+func newOutbox(mem store.Store, attempts int, backoff time.Duration) *outbox {
+	w, _ := mem.(fallibleAppender)
+	return &outbox{mem: mem, w: w, attempts: attempts, backoff: backoff}
+}
+
+// append guarda msgs en la sesión sid como AppendBatchForSession. saved es
+// false si no se pudo guardar tras los reintentos: el turno queda en el
+// outbox, que lo sigue intentando en segundo plano, y el caller responde
+// igual (con SendMessageResponse.Unsaved).
+func (o *outbox) append(sid string, msgs ...internal.Message) (out []internal.Message, saved bool) {
+	if o.w == nil {
+		return o.mem.AppendBatchForSession(sid, msgs...), true
+	}
+	// con los IDs fijos, cada reintento guarda los mismos mensajes
+	msgs = append([]internal.Message(nil), msgs...)
+	for i := range msgs {
+		if msgs[i].ID == "" {
+			msgs[i].ID = uuid.NewString()
+		}
+	}
+	err := o.try(sid, msgs, o.attempts, o.backoff, outboxRetryMaxWait)
+	if err == nil {
+		return msgs, true
+	}
+	n := o.pending.Add(1)
+	fmt.Printf("[outbox] no se pudo guardar el turno de la sesión %s (%v); se reintenta en segundo plano (%d pendiente(s))\n", sid, err, n)
+	go func() {
+		defer o.pending.Add(-1)
+		if err := o.try(sid, msgs, outboxRetries, outboxRetryFirst, outboxRetryMaxWait); err != nil {
+			fmt.Printf("[outbox] se descarta el turno de la sesión %s tras %d reintentos: %v\n", sid, outboxRetries, err)
+			return
+		}
+		fmt.Printf("[outbox] turno de la sesión %s guardado en un reintento\n", sid)
+	}()
+	return msgs, false
+}
+
+// try intenta guardar msgs hasta attempts veces; la espera entre intentos
+// empieza en wait y se duplica hasta maxWait. Devuelve el último error.
+func (o *outbox) try(sid string, msgs []internal.Message, attempts int, wait, maxWait time.Duration) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(wait)
+			wait = min(wait*2, maxWait)
+		}
+		if _, err = o.w.TryAppendBatchForSession(sid, msgs...); err == nil {
+			return nil
+		}
+	}
+	return err
+}
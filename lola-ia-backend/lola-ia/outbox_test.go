@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+// flakyStore es un MemoryStore cuyas primeras fails escrituras fallan.
+type flakyStore struct {
+	*store.MemoryStore
+	mu    sync.Mutex
+	fails int
+	calls int
+}
+
+func (s *flakyStore) TryAppendBatchForSession(id string, msgs ...internal.Message) ([]internal.Message, error) {
+	s.mu.Lock()
+	s.calls++
+	fail := s.calls <= s.fails
+	s.mu.Unlock()
+	if fail {
+		return nil, errors.New("database is locked")
+	}
+	return s.AppendBatchForSession(id, msgs...), nil
+}
+
+func turn() []internal.Message {
+	return []internal.Message{
+		{Role: internal.RoleUser, Content: "¿cuántas quejas hubo?"},
+		{Role: internal.RoleAssistant, Content: "Hubo 12 quejas."},
+	}
+}
+
+func TestOutboxRetries(t *testing.T) {
+	mem := &flakyStore{MemoryStore: store.NewMemoryStore(), fails: 2}
+	box := newOutbox(mem, 3, time.Millisecond)
+	out, saved := box.append("s1", turn()...)
+	if !saved || mem.calls != 3 {
+		t.Fatalf("saved = %v tras %d intentos", saved, mem.calls)
+	}
+	got := mem.AllForSession("s1")
+	if len(got) != 2 || got[1].Content != "Hubo 12 quejas." || got[1].ID != out[1].ID || out[1].ID == "" {
+		t.Errorf("guardado = %+v, devuelto = %+v", got, out)
+	}
+}
+
+func TestOutboxBackground(t *testing.T) {
+	// falla los dos intentos del request; el primero en segundo plano anda
+	mem := &flakyStore{MemoryStore: store.NewMemoryStore(), fails: 2}
+	box := newOutbox(mem, 2, time.Millisecond)
+	out, saved := box.append("s1", turn()...)
+	if saved || len(out) != 2 || out[0].ID == "" {
+		t.Fatalf("saved = %v, out = %+v", saved, out)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for box.pending.Load() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := mem.AllForSession("s1")
+	if box.pending.Load() != 0 || len(got) != 2 {
+		t.Fatalf("pendientes %d, guardados %d", box.pending.Load(), len(got))
+	}
+	// se guardó con los mismos IDs que vio el cliente
+	ids := []string{got[0].ID, got[1].ID}
+	if !slices.Equal(ids, []string{out[0].ID, out[1].ID}) {
+		t.Errorf("IDs guardados %v, devueltos %s %s", ids, out[0].ID, out[1].ID)
+	}
+}
+
+func TestOutboxMemory(t *testing.T) {
+	// un store que no falla guarda directo
+	mem := store.NewMemoryStore()
+	if _, saved := newOutbox(mem, 3, time.Millisecond).append("s1", turn()...); !saved || len(mem.AllForSession("s1")) != 2 {
+		t.Errorf("saved = %v", saved)
+	}
+}
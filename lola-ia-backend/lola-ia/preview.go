@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+// Filas por defecto y máximas de GET /api/files/:name/preview
+const (
+	previewRowsDefault = 20
+	previewRowsMax     = 500
+)
+
+// writeFilePreview responde el archivo :name de files como JSON: los
+// encabezados y hasta ?rows= filas (previewRowsDefault, acotado a
+// previewRowsMax), tal como las parseó el store y las ve el modelo.
+func writeFilePreview(c *gin.Context, files store.FileScope) {
+	f, ok := files.GetFile(c.Param("name"))
+	if !ok {
+		c.JSON(404, gin.H{"error": "archivo no encontrado"})
+		return
+	}
+	if f.Parsed == nil {
+		c.JSON(422, gin.H{"error": "el archivo no se pudo parsear", "parse_error": f.ParseError})
+		return
+	}
+	n := previewRowsDefault
+	if v, err := strconv.Atoi(c.Query("rows")); err == nil && v >= 0 {
+		n = v
+	}
+	n = min(n, previewRowsMax, len(f.Parsed.Rows))
+	c.JSON(200, internal.FilePreviewResponse{
+		Name:      f.Name,
+		Headers:   f.Parsed.Headers,
+		Rows:      f.Parsed.Rows[:n],
+		TotalRows: len(f.Parsed.Rows),
+
+		OriginalHeaders: f.OriginalHeaders,
+	})
+}
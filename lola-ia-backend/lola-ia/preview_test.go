@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+func newPreviewRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("id,nps\n")
+	for i := 0; i < previewRowsMax+100; i++ {
+		fmt.Fprintf(&b, "%d,%d\n", i, i%11)
+	}
+	files := store.SharedFiles(store.NewMemoryStore())
+	if _, err := files.AddFiles([]internal.KnowledgeFile{
+		{Name: "nps.csv", Text: b.String(), Size: b.Len()},
+		{Name: "chico.csv", Text: "id,nps\n1,9\n2,3\n", Size: 15},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/files/:name/preview", func(c *gin.Context) { writeFilePreview(c, files) })
+	return r
+}
+
+func TestFilePreviewRows(t *testing.T) {
+	r := newPreviewRouter(t)
+	cases := []struct {
+		path string
+		rows int
+	}{
+		{"/api/files/nps.csv/preview", previewRowsDefault},
+		{"/api/files/nps.csv/preview?rows=5", 5},
+		{"/api/files/nps.csv/preview?rows=0", 0},
+		{"/api/files/nps.csv/preview?rows=100000", previewRowsMax},
+		{"/api/files/nps.csv/preview?rows=-3", previewRowsDefault},
+		{"/api/files/nps.csv/preview?rows=muchas", previewRowsDefault},
+		{"/api/files/chico.csv/preview?rows=50", 2},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != 200 {
+			t.Errorf("%s: status %d", tc.path, w.Code)
+			continue
+		}
+		var res internal.FilePreviewResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Rows) != tc.rows {
+			t.Errorf("%s: %d filas, want %d", tc.path, len(res.Rows), tc.rows)
+		}
+		if len(res.Headers) != 2 || res.Headers[0] != "id" {
+			t.Errorf("%s: headers = %v", tc.path, res.Headers)
+		}
+	}
+}
+
+func TestFilePreviewNotFound(t *testing.T) {
+	w := httptest.NewRecorder()
+	newPreviewRouter(t).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/files/otro.csv/preview", nil))
+	if w.Code != 404 {
+		t.Errorf("status %d, want 404", w.Code)
+	}
+}
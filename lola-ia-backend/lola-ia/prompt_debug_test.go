@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/classify"
+)
+
+func TestModeHeaderMatchesClassifier(t *testing.T) {
+	r := newTestRouter(t, nil)
+	for i, q := range []string{
+		"hola, ¿cómo va?",
+		"¿Cuáles son los pain points más comunes?",
+		"Hazme un análisis de las encuestas",
+		"gracias!",
+	} {
+		want := "plain"
+		if classify.Analyst(q) {
+			want = "analyst"
+		}
+		w := call(r, "POST", "/api/messages", `{"content":"`+q+`"}`, "X-Session-ID", fmt.Sprintf("s-mode-%d", i))
+		if w.Code != 200 {
+			t.Fatalf("%q: status %d: %s", q, w.Code, w.Body)
+		}
+		if got := w.Header().Get(modeHeader); got != want {
+			t.Errorf("%q: %s = %q, want %q", q, modeHeader, got, want)
+		}
+		// sin DEBUG_PROMPTS no se expone el prompt
+		if w.Header().Get(promptBytesHeader) != "" {
+			t.Errorf("%q: %s sin DEBUG_PROMPTS", q, promptBytesHeader)
+		}
+		var res internal.SendMessageResponse
+		decode(t, w, &res)
+		if res.Prompt != "" {
+			t.Errorf("%q: prompt en el body sin DEBUG_PROMPTS", q)
+		}
+	}
+}
+
+func TestDebugPrompts(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"DEBUG_PROMPTS": "true"})
+	w := call(r, "POST", "/api/messages", `{"content":"Hazme un análisis de las encuestas"}`, "X-Session-ID", "s-debug")
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var res internal.SendMessageResponse
+	decode(t, w, &res)
+	if res.Prompt == "" {
+		t.Fatal("DEBUG_PROMPTS=true sin prompt en el body")
+	}
+	if got := w.Header().Get(promptBytesHeader); got != strconv.Itoa(len(res.Prompt)) {
+		t.Errorf("%s = %q, want %d", promptBytesHeader, got, len(res.Prompt))
+	}
+}
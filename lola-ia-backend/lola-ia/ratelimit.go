@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRateLimitRPM   = 120
+	defaultRateLimitBurst = 30
+)
+
+// bucket es un token bucket: se recarga a rate tokens/segundo hasta burst.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter limita requests por IP de cliente con un token bucket por IP.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	rate    float64 // tokens por segundo
+	burst   float64
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{
+		buckets: make(map[string]*bucket),
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+	}
+}
+
+// allow consume un token de key. Si no hay, devuelve cuánto falta para el próximo.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// cleanup borra los buckets que ya se recargaron por completo: volver a
+// crearlos da el mismo resultado y así el mapa no crece sin límite.
+func (l *rateLimiter) cleanup() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+			n++
+		}
+	}
+	return n
+}
+
+// trustProxies fija los proxies (IPs o CIDRs separados por coma, de
+// TRUSTED_PROXIES) de los que se acepta X-Forwarded-For para c.ClientIP,
+// y los devuelve. Sin lista, o si alguno no es válido, no se confía en
+// ninguno: la IP es la de la conexión, así un cliente no puede mandar su
+// propio X-Forwarded-For para estrenar un bucket en cada request.
+func trustProxies(r *gin.Engine, v string) []string {
+	var proxies []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		fmt.Printf("[ratelimit] TRUSTED_PROXIES inválido (%v); no se confía en ningún proxy\n", err)
+		_ = r.SetTrustedProxies(nil)
+		return nil
+	}
+	return proxies
+}
+
+// rateLimitMiddleware responde 429 con Retry-After cuando la IP del cliente
+// agota su bucket. Las rutas en exempt (p.ej. /health) no se limitan. La
+// limpieza de buckets viejos corre hasta que se cancela ctx.
+func rateLimitMiddleware(ctx context.Context, l *rateLimiter, exempt ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(exempt))
+	for _, p := range exempt {
+		skip[p] = true
+	}
+	go func() {
+		t := time.NewTicker(time.Minute)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				l.cleanup()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func(c *gin.Context) {
+		if skip[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		ok, wait := l.allow(c.ClientIP())
+		if !ok {
+			secs := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(max(secs, 1)))
+			c.AbortWithStatusJSON(429, gin.H{"error": "demasiadas solicitudes, intenta más tarde"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRateLimitedRouter(t *testing.T, l *rateLimiter, proxies string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	r := gin.New()
+	trustProxies(r, proxies)
+	r.Use(rateLimitMiddleware(ctx, l, "/health"))
+	r.GET("/health", func(c *gin.Context) { c.Status(200) })
+	r.GET("/api/x", func(c *gin.Context) { c.Status(200) })
+	return r
+}
+
+func get(r http.Handler, path, remote, forwarded string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remote
+	if forwarded != "" {
+		req.Header.Set("X-Forwarded-For", forwarded)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitExhaustAndRecover(t *testing.T) {
+	// 600/min: un token cada 100ms
+	r := newRateLimitedRouter(t, newRateLimiter(600, 3), "")
+	for i := 0; i < 3; i++ {
+		if w := get(r, "/api/x", "10.0.0.1:1234", ""); w.Code != 200 {
+			t.Fatalf("request %d: status %d", i+1, w.Code)
+		}
+	}
+	w := get(r, "/api/x", "10.0.0.1:1234", "")
+	if w.Code != 429 {
+		t.Fatalf("bucket agotado: status %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After = %q, want 1", w.Header().Get("Retry-After"))
+	}
+	// otra IP tiene su propio bucket
+	if w := get(r, "/api/x", "10.0.0.2:1234", ""); w.Code != 200 {
+		t.Errorf("otra IP: status %d", w.Code)
+	}
+	// /health no se limita
+	if w := get(r, "/health", "10.0.0.1:1234", ""); w.Code != 200 {
+		t.Errorf("/health: status %d", w.Code)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if w := get(r, "/api/x", "10.0.0.1:1234", ""); w.Code != 200 {
+		t.Errorf("después de recargar: status %d", w.Code)
+	}
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	r := newRateLimitedRouter(t, newRateLimiter(1, 1), "")
+	if w := get(r, "/api/x", "10.0.0.1:1234", "1.1.1.1"); w.Code != 200 {
+		t.Fatalf("status %d", w.Code)
+	}
+	// sin proxies de confianza un X-Forwarded-For nuevo no da otro bucket
+	if w := get(r, "/api/x", "10.0.0.1:1234", "2.2.2.2"); w.Code != 429 {
+		t.Errorf("X-Forwarded-For falso: status %d, want 429", w.Code)
+	}
+}
+
+func TestRateLimitTrustedProxy(t *testing.T) {
+	r := newRateLimitedRouter(t, newRateLimiter(1, 1), "10.0.0.0/8")
+	// detrás de un proxy de confianza cada cliente tiene su bucket
+	if w := get(r, "/api/x", "10.0.0.1:1234", "1.1.1.1"); w.Code != 200 {
+		t.Fatalf("status %d", w.Code)
+	}
+	if w := get(r, "/api/x", "10.0.0.1:1234", "2.2.2.2"); w.Code != 200 {
+		t.Errorf("otro cliente detrás del proxy: status %d", w.Code)
+	}
+	if w := get(r, "/api/x", "10.0.0.1:1234", "1.1.1.1"); w.Code != 429 {
+		t.Errorf("mismo cliente: status %d, want 429", w.Code)
+	}
+}
+
+func TestTrustProxiesInvalid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if got := trustProxies(gin.New(), "no-es-una-ip"); got != nil {
+		t.Errorf("trustProxies = %v, want nil", got)
+	}
+	if got := trustProxies(gin.New(), " 10.0.0.1 , 192.168.0.0/16,"); len(got) != 2 {
+		t.Errorf("trustProxies = %v", got)
+	}
+}
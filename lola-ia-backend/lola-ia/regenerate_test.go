@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestRegenerate(t *testing.T) {
+	type payload struct {
+		Messages []internal.Message `json:"messages"`
+		Options  *struct {
+			Temperature *float64 `json:"temperature"`
+		} `json:"options"`
+	}
+	var (
+		mu   sync.Mutex
+		seen []payload
+	)
+	r := newOllamaRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		var p payload
+		json.NewDecoder(r.Body).Decode(&p)
+		mu.Lock()
+		seen = append(seen, p)
+		n := len(seen)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"message":{"role":"assistant","content":"respuesta %d"},"done":true}`, n)
+	}, nil)
+	sid := []string{"X-Session-ID", "s-regen"}
+
+	call(r, "POST", "/api/messages", `{"content":"¿qué opinan de la app?"}`, sid...)
+	w := call(r, "POST", "/api/messages/regenerate", `{"temperature":1.3}`, sid...)
+	var res internal.SendMessageResponse
+	decode(t, w, &res)
+	if w.Code != 200 || res.Reply.Content != "respuesta 2" {
+		t.Fatalf("regenerate: %d %+v", w.Code, res)
+	}
+
+	// la consulta va una sola vez y sin la respuesta reemplazada
+	mu.Lock()
+	p := seen[1]
+	mu.Unlock()
+	var all []string
+	for _, m := range p.Messages {
+		all = append(all, m.Content)
+	}
+	joined := strings.Join(all, "\n")
+	if strings.Count(joined, "¿qué opinan de la app?") != 1 || strings.Contains(joined, "respuesta 1") {
+		t.Errorf("payload del regenerate:\n%s", joined)
+	}
+	if p.Options == nil || p.Options.Temperature == nil || *p.Options.Temperature != 1.3 {
+		t.Errorf("temperature = %+v", p.Options)
+	}
+
+	// la respuesta nueva reemplaza a la anterior
+	var h internal.ChatHistory
+	decode(t, call(r, "GET", "/api/messages", "", sid...), &h)
+	var got []string
+	for _, m := range h.Messages[1:] {
+		got = append(got, m.Content)
+	}
+	if strings.Join(got, "|") != "¿qué opinan de la app?|respuesta 2" {
+		t.Errorf("historial = %q", got)
+	}
+}
+
+func TestRegenerateGuards(t *testing.T) {
+	r := newTestRouter(t, nil)
+	// solo el saludo
+	if w := call(r, "POST", "/api/messages/regenerate", "", "X-Session-ID", "s-regen-0"); w.Code != 400 {
+		t.Errorf("solo el saludo: status %d, want 400", w.Code)
+	}
+
+	// el último mensaje es del usuario (guardado sin respuesta)
+	sid := []string{"X-Session-ID", "s-regen-1"}
+	call(r, "POST", "/api/messages?dry_run=true&store_message=true", `{"content":"hola"}`, sid...)
+	w := call(r, "POST", "/api/messages/regenerate", "", sid...)
+	if w.Code != 400 || !strings.Contains(w.Body.String(), "no es una respuesta del asistente") {
+		t.Errorf("último del usuario: %d %s", w.Code, w.Body)
+	}
+
+	sid = []string{"X-Session-ID", "s-regen-2"}
+	call(r, "POST", "/api/messages", `{"content":"hola"}`, sid...)
+	for _, body := range []string{`{"temperature":5}`, `{"temperature":-1}`, `{roto`} {
+		if w := call(r, "POST", "/api/messages/regenerate", body, sid...); w.Code != 400 {
+			t.Errorf("%s: status %d, want 400", body, w.Code)
+		}
+	}
+	if w := call(r, "POST", "/api/messages/regenerate", "", sid...); w.Code != 200 {
+		t.Errorf("sin body: status %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+func writeSeed(t *testing.T, dir, name, text string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReseedEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	writeSeed(t, dir, "a.csv", "id,nps\n1,9\n")
+	r := newTestRouter(t, map[string]string{"SEED_CSV_DIR": dir, "API_KEYS": "key-a"})
+	reseed := func(hdr ...string) (int, internal.ReseedFilesResponse) {
+		t.Helper()
+		w := call(r, "POST", "/api/files/reseed", "", hdr...)
+		var res internal.ReseedFilesResponse
+		if w.Code == 200 {
+			decode(t, w, &res)
+		}
+		return w.Code, res
+	}
+	auth := []string{"Authorization", "Bearer key-a"}
+
+	if code, _ := reseed(); code != 401 {
+		t.Errorf("sin key: status %d, want 401", code)
+	}
+	// a.csv ya se cargó al arrancar
+	if _, res := reseed(auth...); res.Added != 0 || res.Unchanged != 1 || res.Total != 1 {
+		t.Errorf("sin cambios: %+v", res)
+	}
+
+	writeSeed(t, dir, "a.csv", "id,nps\n1,9\n2,7\n")
+	writeSeed(t, dir, "b.csv", "id,nps\n3,10\n")
+	writeSeed(t, dir, "notas.txt", "no es un dataset")
+	if _, res := reseed(auth...); res.Added != 1 || res.Updated != 1 || res.Unchanged != 0 || res.Total != 2 {
+		t.Errorf("con cambios: %+v", res)
+	}
+	// volver a correrlo no agrega ni duplica nada
+	if _, res := reseed(auth...); res.Added != 0 || res.Updated != 0 || res.Unchanged != 2 || res.Total != 2 {
+		t.Errorf("segunda vez: %+v", res)
+	}
+}
+
+func TestReseedRequiresAPIKeys(t *testing.T) {
+	r := newTestRouter(t, nil)
+	if w := call(r, "POST", "/api/files/reseed", ""); w.Code != 403 {
+		t.Errorf("sin API_KEYS: status %d, want 403", w.Code)
+	}
+}
+
+func TestPreloadSeedMaxFiles(t *testing.T) {
+	mem := store.NewMemoryStore()
+	files := make([]internal.KnowledgeFile, filesMax-1)
+	for i := range files {
+		files[i] = internal.KnowledgeFile{Name: fmt.Sprintf("subido-%d.csv", i), Text: "id\n1\n"}
+	}
+	if _, err := mem.AddFiles(files); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeSeed(t, dir, "a.csv", "id\n1\n")
+	writeSeed(t, dir, "b.csv", "id\n2\n")
+	// uno ya subido con el mismo nombre no ocupa un lugar nuevo
+	writeSeed(t, dir, "subido-0.csv", "id\n3\n")
+
+	res, err := preloadSeedCSVs(dir, store.SharedFiles(mem))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Added != 1 || res.Updated != 1 || len(res.Rejected) != 1 || res.Rejected[0].Name != "b.csv" || res.Total != filesMax {
+		t.Errorf("res = %+v", res.ReseedFilesResponse)
+	}
+}
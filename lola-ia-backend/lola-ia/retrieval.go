@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/pii"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+	"github.com/nubank/lola-ia-backend/internal/rag"
+	"github.com/nubank/lola-ia-backend/internal/store"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+const (
+	defaultRAGTopK  = 8
+	ragRowsPerChunk = 20
+	ragIndexTimeout = 2 * time.Minute
+)
+
+// chunkIndex es el store que puede guardar fragmentos con embeddings
+// (hoy solo MemoryStore).
+type chunkIndex interface {
+	SetChunks(name string, chunks []rag.Chunk)
+	Chunks() []rag.Chunk
+}
+
+// retriever arma el contexto del modo analista con los fragmentos de CSV más
+// parecidos a la consulta, en vez de truncar los archivos por bytes.
+type retriever struct {
+	emb  provider.Embedder
+	idx  chunkIndex
+	topK int
+	// minScore es la similitud coseno mínima para que un fragmento entre
+	// en el contexto (RAG_MIN_SCORE); 0 = sin mínimo.
+	minScore float64
+	// redact enmascara datos personales en los fragmentos antes de calcular
+	// sus embeddings, así no salen ni en el embedding ni en el contexto.
+	redact bool
+	// annotate parsea los archivos que llegan sin parsear, como el store
+	annotate tabular.AnnotateOptions
+}
+
+// newRetriever devuelve nil (y se usa el contexto por truncado) si el provider
+// no calcula embeddings, el store no guarda fragmentos o RAG=off.
+func newRetriever(chat provider.ChatProvider, mem store.Store, topK int, minScore float64, redact bool, annotate tabular.AnnotateOptions) *retriever {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("RAG")), "off") {
+		return nil
+	}
+	emb, ok := chat.(provider.Embedder)
+	if !ok {
+		return nil
+	}
+	idx, ok := mem.(chunkIndex)
+	if !ok {
+		fmt.Printf("[rag] el store no guarda embeddings; se usa el contexto por truncado\n")
+		return nil
+	}
+	if minScore > 1 {
+		fmt.Printf("[rag] RAG_MIN_SCORE=%g descartaría todo (la similitud llega a 1); se ignora\n", minScore)
+		minScore = 0
+	}
+	fmt.Printf("[rag] activado (top %d fragmentos de %d filas, similitud mínima %g)\n", topK, ragRowsPerChunk, minScore)
+	return &retriever{emb: emb, idx: idx, topK: topK, minScore: minScore, redact: redact, annotate: annotate}
+}
+
+// scoreFloor devuelve la similitud mínima configurada; 0 = sin mínimo o sin RAG.
+func (r *retriever) scoreFloor() float64 {
+	if r == nil {
+		return 0
+	}
+	return r.minScore
+}
+
+// indexFiles calcula y guarda los embeddings de files en segundo plano.
+// Mientras tanto (o si falla) las consultas usan el contexto por truncado.
+func (r *retriever) indexFiles(files []internal.KnowledgeFile) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), ragIndexTimeout)
+		defer cancel()
+		for _, f := range files {
+			if f.Parsed == nil {
+				tabular.Annotate(&f, r.annotate)
+			}
+			chunks := rag.ChunkFile(f, ragRowsPerChunk)
+			if len(chunks) == 0 {
+				continue
+			}
+			texts := make([]string, len(chunks))
+			var masked int
+			for i := range chunks {
+				if r.redact {
+					var n pii.Counts
+					chunks[i].Text, n = pii.Redact(chunks[i].Text)
+					masked += n.Total()
+				}
+				texts[i] = chunks[i].Text
+			}
+			if masked > 0 {
+				fmt.Printf("[rag] %s: %d valor(es) enmascarados\n", f.Name, masked)
+			}
+			vecs, err := r.emb.Embed(ctx, texts)
+			if err != nil {
+				fmt.Printf("[rag] error indexando %s: %v\n", f.Name, err)
+				continue
+			}
+			for i := range chunks {
+				chunks[i].Vector = vecs[i]
+			}
+			r.idx.SetChunks(f.Name, chunks)
+			fmt.Printf("[rag] %s: %d fragmento(s) indexados\n", f.Name, len(chunks))
+		}
+	}()
+}
+
+// context devuelve el contexto con los fragmentos más relevantes para query.
+// Solo se usan fragmentos de los archivos en files (ver fileKeys), que se
+// muestran con el nombre que ve la sesión. sources son los archivos
+// de esos fragmentos, sin repetir. Si ninguno llega a la similitud mínima el
+// contexto lo dice (sin datos relevantes) y sources queda vacío. ok es false si
+// no hay nada indexado o falla el embedding de la consulta, y el caller debe
+// caer a buildFilesContext.
+func (r *retriever) context(ctx context.Context, query string, cfg filesContextConfig, files map[string]string) (text string, sources []string, ok bool) {
+	var chunks []rag.Chunk
+	for _, c := range r.idx.Chunks() {
+		if name, ok := files[c.File]; ok {
+			c.File = name
+			chunks = append(chunks, c)
+		}
+	}
+	if len(chunks) == 0 {
+		return "", nil, false
+	}
+	vecs, err := r.emb.Embed(ctx, []string{query})
+	if err != nil {
+		fmt.Printf("[rag] error con el embedding de la consulta: %v\n", err)
+		return "", nil, false
+	}
+	count := cfg.CountTokens
+	if count == nil {
+		count = estimateTokens
+	}
+
+	var b strings.Builder
+	b.WriteString("[Fragmentos relevantes de los archivos CSV cargados]\n")
+	top := rag.TopK(vecs[0], chunks, r.topK, r.minScore)
+	if len(top) == 0 {
+		// mejor decirlo que caer al contexto por truncado con datos que no
+		// tienen que ver: el template pide avisar que no hay datos relevantes
+		fmt.Printf("[rag] ningún fragmento llega a la similitud mínima %g\n", r.minScore)
+		b.WriteString("No se encontraron datos relevantes para la pregunta: ningún fragmento de los archivos cargados es lo bastante parecido.\n")
+		return b.String(), nil, true
+	}
+	b.WriteString("Se eligieron por similitud con la pregunta; no son los archivos completos.\n\n")
+	used, n := count(b.String()), 0
+	for _, c := range top {
+		part := fmt.Sprintf("- %s, filas %d-%d:\n%s\n", c.File, c.FromRow, c.ToRow, c.Text)
+		if used+count(part) > cfg.MaxContextTokens {
+			break
+		}
+		b.WriteString(part)
+		used += count(part)
+		n++
+		if !slices.Contains(sources, c.File) {
+			sources = append(sources, c.File)
+		}
+	}
+	if n == 0 {
+		return "", nil, false
+	}
+	fmt.Printf("[rag] %d fragmento(s) en el contexto (~%d/%d tokens)\n", n, used, cfg.MaxContextTokens)
+	return b.String(), sources, true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+	"github.com/nubank/lola-ia-backend/internal/rag"
+	"github.com/nubank/lola-ia-backend/internal/store"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+// queryEmbedder devuelve siempre el mismo vector para la consulta.
+type queryEmbedder []float32
+
+func (q queryEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i := range texts {
+		out[i] = q
+	}
+	return out, nil
+}
+
+func TestRetrieverMinScore(t *testing.T) {
+	mem := store.NewMemoryStore()
+	// solo se guardan fragmentos de archivos que están en el store
+	mem.AddFiles([]internal.KnowledgeFile{{Name: "@s/pagos.csv", Text: "id,motivo\n"}, {Name: "@s/app.csv", Text: "id,motivo\n"}})
+	mem.SetChunks("@s/pagos.csv", []rag.Chunk{
+		{File: "@s/pagos.csv", FromRow: 1, ToRow: 20, Text: "id,motivo\n1,cobro doble\n", Vector: []float32{1, 0.1}}, // ~0.99
+		{File: "@s/pagos.csv", FromRow: 21, ToRow: 40, Text: "id,motivo\n21,demora\n", Vector: []float32{1, 1}},      // ~0.71
+	})
+	mem.SetChunks("@s/app.csv", []rag.Chunk{
+		{File: "@s/app.csv", FromRow: 1, ToRow: 20, Text: "id,motivo\n1,login\n", Vector: []float32{0, 1}}, // 0
+	})
+	files := map[string]string{"@s/pagos.csv": "pagos.csv", "@s/app.csv": "app.csv"}
+	cfg := filesContextConfig{MaxContextTokens: 1000, MaxFileTokens: 1000}
+
+	cases := []struct {
+		minScore float64
+		in, out  []string
+		sources  []string
+	}{
+		{0, []string{"cobro doble", "demora", "login"}, nil, []string{"pagos.csv", "app.csv"}},
+		{0.5, []string{"cobro doble", "demora"}, []string{"login"}, []string{"pagos.csv"}},
+		{0.9, []string{"cobro doble"}, []string{"demora", "login"}, []string{"pagos.csv"}},
+	}
+	for _, tc := range cases {
+		r := &retriever{emb: queryEmbedder{1, 0}, idx: mem, topK: 10, minScore: tc.minScore}
+		text, sources, ok := r.context(context.Background(), "cobros", cfg, files)
+		if !ok {
+			t.Fatalf("min %g: sin contexto", tc.minScore)
+		}
+		for _, s := range tc.in {
+			if !strings.Contains(text, s) {
+				t.Errorf("min %g: falta %q:\n%s", tc.minScore, s, text)
+			}
+		}
+		for _, s := range tc.out {
+			if strings.Contains(text, s) {
+				t.Errorf("min %g: entró %q:\n%s", tc.minScore, s, text)
+			}
+		}
+		if !slices.Equal(sources, tc.sources) {
+			t.Errorf("min %g: sources = %v, want %v", tc.minScore, sources, tc.sources)
+		}
+	}
+
+	// nada llega al mínimo: el contexto dice que no hay datos relevantes
+	r := &retriever{emb: queryEmbedder{-1, 0}, idx: mem, topK: 10, minScore: 0.3}
+	text, sources, ok := r.context(context.Background(), "otra cosa", cfg, files)
+	if !ok || len(sources) != 0 || !strings.Contains(text, "No se encontraron datos relevantes") || strings.Contains(text, "id,motivo") {
+		t.Errorf("sin fragmentos relevantes: ok = %v, sources = %v\n%s", ok, sources, text)
+	}
+
+	t.Setenv("RAG", "")
+	chat := struct {
+		provider.MockProvider
+		queryEmbedder
+	}{queryEmbedder: queryEmbedder{1, 0}}
+	if got := newRetriever(chat, mem, 8, 0.4, false, tabular.AnnotateOptions{}).scoreFloor(); got != 0.4 {
+		t.Errorf("scoreFloor = %g, want 0.4", got)
+	}
+	if got := newRetriever(chat, mem, 8, 1.5, false, tabular.AnnotateOptions{}).scoreFloor(); got != 0 {
+		t.Errorf("RAG_MIN_SCORE > 1: scoreFloor = %g, want 0", got)
+	}
+}
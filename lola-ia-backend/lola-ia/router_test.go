@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter arma el router de main con el provider mock, el store en
+// memoria y sin archivos precargados; env agrega o pisa variables.
+func newTestRouter(t *testing.T, env map[string]string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	defaults := map[string]string{
+		"PROVIDER":     "mock",
+		"DB_PATH":      "",
+		"SEED_CSV_DIR": t.TempDir(),
+		"API_KEYS":     "",
+	}
+	for k, v := range defaults {
+		if _, ok := env[k]; !ok {
+			t.Setenv(k, v)
+		}
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r, mem, err := newRouter(ctx)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		closeStore(mem)
+	})
+	return r
+}
+
+// newOllamaRouter es newTestRouter con el provider Ollama apuntando a un
+// servidor de prueba que atiende upstream.
+func newOllamaRouter(t *testing.T, upstream http.HandlerFunc, env map[string]string) *gin.Engine {
+	t.Helper()
+	srv := httptest.NewServer(upstream)
+	t.Cleanup(srv.Close)
+	all := map[string]string{
+		"PROVIDER":           "ollama",
+		"OLLAMA_HOST":        srv.URL + "/",
+		"OLLAMA_MAX_RETRIES": "0",
+	}
+	for k, v := range env {
+		all[k] = v
+	}
+	return newTestRouter(t, all)
+}
+
+// newCountingRouter arma el router con un Ollama que cuenta las llamadas en
+// calls y responde siempre lo mismo.
+func newCountingRouter(t *testing.T, calls *atomic.Int32, env map[string]string) *gin.Engine {
+	t.Helper()
+	return newOllamaRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		calls.Add(1)
+		w.Write([]byte(`{"message":{"role":"assistant","content":"respuesta"},"done":true}`))
+	}, env)
+}
+
+// call hace un request a r; hdr son pares nombre, valor de headers. Un body
+// no vacío se manda como JSON.
+func call(r http.Handler, method, path, body string, hdr ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(hdr); i += 2 {
+		req.Header.Set(hdr[i], hdr[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// decode parsea la respuesta JSON de w en v.
+func decode(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("respuesta %d no es JSON: %v\n%s", w.Code, err, w.Body)
+	}
+}
+
+func TestNewRouterConfigError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"DB_PATH": dir + "/no/existe/lola.db"}, "[store]"},
+		// falla con el store ya abierto
+		{map[string]string{"DB_PATH": dir + "/lola.db", "MODERATION": "true", "MODERATION_WORDLIST": dir + "/no-existe.txt"}, "[moderation]"},
+	} {
+		t.Setenv("PROVIDER", "mock")
+		t.Setenv("SEED_CSV_DIR", t.TempDir())
+		t.Setenv("MODERATION", "")
+		for k, v := range tc.env {
+			t.Setenv(k, v)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		r, mem, err := newRouter(ctx)
+		cancel()
+		if err == nil || !strings.Contains(err.Error(), tc.want) || r != nil || mem != nil {
+			t.Errorf("%v: r = %v, mem = %v, err = %v", tc.env, r, mem, err)
+		}
+	}
+}
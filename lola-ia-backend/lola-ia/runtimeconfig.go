@@ -0,0 +1,49 @@
+package main
+
+// runtimeConfig es la configuración efectiva que devuelve GET /api/config:
+// los valores ya leídos y validados (con los defaults aplicados), no las
+// variables de entorno. No lleva secretos: ni API keys ni credenciales de
+// proveedores, ni rutas de archivos del servidor.
+type runtimeConfig struct {
+	Provider      string   `json:"provider"`
+	Model         string   `json:"model"`
+	AllowedModels []string `json:"allowed_models,omitempty"`
+	PlainModel    string   `json:"plain_model"`   // PLAIN_MODEL o el default
+	AnalystModel  string   `json:"analyst_model"` // ANALYST_MODEL o el default
+	Store         string   `json:"store"`         // memory o sqlite
+
+	SharedFiles     bool `json:"shared_files"` // false: archivos por sesión
+	FilesMax        int  `json:"files_max"`
+	MaxFileBytes    int  `json:"max_file_bytes"`
+	MaxTotalBytes   int  `json:"max_total_bytes"`
+	MaxRequestBytes int  `json:"max_request_bytes"`
+	ZipMaxEntries   int  `json:"zip_max_entries"`
+	ZipMaxBytes     int  `json:"zip_max_bytes"` // descomprimido
+	Schemas         int  `json:"schemas"`
+	// NormalizeHeaders: encabezados en snake_case al parsear
+	NormalizeHeaders bool `json:"normalize_headers"`
+
+	MaxContextTokens     int     `json:"max_context_tokens"`
+	MaxFileContextTokens int     `json:"max_file_context_tokens"`
+	RedactPII            bool    `json:"redact_pii"`
+	ContextTruncation    string  `json:"context_truncation"`
+	RAG                  bool    `json:"rag"`
+	RAGMinScore          float64 `json:"rag_min_score"` // 0 = sin mínimo
+
+	AnalystMode      bool     `json:"analyst_mode"`
+	AnalystThreshold float64  `json:"analyst_threshold"`
+	OutputLanguage   string   `json:"output_language"`
+	Templates        []string `json:"templates"`
+	Tools            bool     `json:"tools"`
+
+	MaxConcurrentLLM int  `json:"max_concurrent_llm"` // 0 = sin límite
+	BreakerFailures  int  `json:"breaker_failures"`   // 0 = sin circuit breaker
+	AnswerCache      bool `json:"answer_cache"`
+	Moderation       bool `json:"moderation"`
+	DebugPrompts     bool `json:"debug_prompts"`
+	// AnalystFormatCheck: off, flag o retry (ANALYST_FORMAT_CHECK)
+	AnalystFormatCheck string `json:"analyst_format_check"`
+	AnalystStructured  bool   `json:"analyst_structured"`
+
+	TrustedProxies []string `json:"trusted_proxies,omitempty"` // IPs o CIDRs
+}
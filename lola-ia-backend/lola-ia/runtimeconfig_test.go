@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigEndpoint(t *testing.T) {
+	secrets := map[string]string{
+		"API_KEYS":          "admin-secreta",
+		"OPENAI_API_KEY":    "sk-muy-secreta",
+		"AZURE_OPENAI_KEY":  "az-secreta",
+		"ANTHROPIC_API_KEY": "ant-secreta",
+	}
+	env := map[string]string{
+		"MAX_FILE_BYTES":     "12345",
+		"MAX_REQUEST_BYTES":  "99999",
+		"MAX_CONTEXT_TOKENS": "4321",
+		"OUTPUT_LANGUAGE":    "pt",
+		"REDACT_PII":         "true",
+	}
+	for k, v := range secrets {
+		env[k] = v
+	}
+	r := newTestRouter(t, env)
+
+	if w := call(r, "GET", "/api/config", ""); w.Code != 401 {
+		t.Errorf("sin key: status %d, want 401", w.Code)
+	}
+	w := call(r, "GET", "/api/config", "", "Authorization", "Bearer admin-secreta")
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	for k, v := range secrets {
+		if strings.Contains(w.Body.String(), v) {
+			t.Errorf("la config expone %s:\n%s", k, w.Body)
+		}
+	}
+	var cfg runtimeConfig
+	decode(t, w, &cfg)
+	if cfg.Provider != "mock" || cfg.Store != "memory" || cfg.FilesMax != filesMax ||
+		cfg.MaxFileBytes != 12345 || cfg.MaxRequestBytes != 99999 || cfg.MaxContextTokens != 4321 ||
+		cfg.OutputLanguage != "pt" || !cfg.RedactPII || !cfg.AnalystMode {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	// sin API_KEYS no se expone
+	r = newTestRouter(t, map[string]string{"API_KEYS": ""})
+	if w := call(r, "GET", "/api/config", ""); w.Code != 403 {
+		t.Errorf("sin API_KEYS: status %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+const (
+	sessionHeader = "X-Session-ID"
+	sessionCookie = "lola_session"
+)
+
+// sessionID devuelve el ID de sesión del request: header X-Session-ID,
+// luego la cookie, y si no hay ninguno genera uno nuevo y lo deja en la cookie.
+// La sesión se crea (sembrada con el saludo) la primera vez que se ve.
+// Con auth, el ID que se usa en el store lleva delante el de la API key, así
+// dos keys con el mismo X-Session-ID no comparten conversación.
+func sessionID(c *gin.Context, mem store.Store) string {
+	id := c.GetHeader(sessionHeader)
+	if id == "" {
+		id, _ = c.Cookie(sessionCookie)
+	}
+	if id == "" {
+		id = newSessionID()
+		c.SetCookie(sessionCookie, id, int((365 * 24 * time.Hour).Seconds()), "/", "", false, true)
+	}
+	c.Header(sessionHeader, id)
+	id = sessionNamespace(c) + id
+	if mem.TouchSession(id) {
+		seedSession(mem, id, false)
+	}
+	return id
+}
+
+// seedSession empieza una sesión nueva (o reiniciada, con reset) con la
+// persona de SYSTEM_PERSONA como mensaje de sistema, si está configurada, y
+// el saludo: ASSISTANT_HELLO o el default de cada caso. SEED_HELLO=false
+// deja la conversación sin saludo (p.ej. para automatizaciones).
+func seedSession(mem store.Store, id string, reset bool) {
+	hello := os.Getenv("ASSISTANT_HELLO")
+	if hello == "" {
+		hello = assistantHello
+		if reset {
+			hello = assistantHelloReset
+		}
+	}
+	if on, err := strconv.ParseBool(os.Getenv("SEED_HELLO")); err == nil && !on {
+		hello = ""
+	}
+	store.SeedSession(mem, id, os.Getenv("SYSTEM_PERSONA"), hello)
+}
+
+// sessionNamespace es el prefijo de los IDs de sesión en el store para el
+// request: "<key>:" con auth, vacío sin ella.
+func sessionNamespace(c *gin.Context) string {
+	if ns := c.GetString(authNamespaceKey); ns != "" {
+		return ns + ":"
+	}
+	return ""
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand no debería fallar; si pasa, caemos a un ID por tiempo
+		return fmt.Sprintf("s%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// evictIdleSessions borra periódicamente las sesiones inactivas si el store
+// lo soporta (el store en memoria; SQLite persiste y no expira), hasta que
+// se cancela ctx.
+func evictIdleSessions(ctx context.Context, mem store.Store, ttl time.Duration) {
+	ev, ok := mem.(interface{ EvictIdle(ttl time.Duration) int })
+	if !ok || ttl <= 0 {
+		return
+	}
+	every := ttl / 4
+	if every < time.Minute {
+		every = time.Minute
+	}
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if n := ev.EvictIdle(ttl); n > 0 {
+					fmt.Printf("[session] %d sesión(es) inactiva(s) eliminada(s)\n", n)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
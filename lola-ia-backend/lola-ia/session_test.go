@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestSystemPersonaReachesProvider(t *testing.T) {
+	var last []string
+	r := newOllamaRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		var p struct{ Messages []map[string]string }
+		json.NewDecoder(r.Body).Decode(&p)
+		last = last[:0]
+		for _, m := range p.Messages {
+			last = append(last, m["role"]+":"+m["content"])
+		}
+		w.Write([]byte(`{"message":{"role":"assistant","content":"respuesta"},"done":true}`))
+	}, map[string]string{"SYSTEM_PERSONA": "Sos Lola, analista de Nubank.", "ASSISTANT_HELLO": "¡Hola!"})
+	sid := []string{"X-Session-ID", "s-persona"}
+	send := func(q string) {
+		t.Helper()
+		if w := call(r, "POST", "/api/messages", `{"content":"`+q+`"}`, sid...); w.Code != 200 {
+			t.Fatalf("%s: status %d: %s", q, w.Code, w.Body)
+		}
+	}
+
+	// la persona guardada reemplaza el prompt fijo y va primero
+	send("p1")
+	send("p2")
+	want := []string{"system:Sos Lola, analista de Nubank.", "assistant:¡Hola!", "user:p1", "assistant:respuesta", "user:p2"}
+	if !slices.Equal(last, want) {
+		t.Errorf("al proveedor: %q, want %q", last, want)
+	}
+	// el reset vuelve a sembrarla
+	if w := call(r, "POST", "/api/reset", "", sid...); w.Code != 200 {
+		t.Fatalf("reset: status %d", w.Code)
+	}
+	send("p3")
+	want = []string{"system:Sos Lola, analista de Nubank.", "assistant:¡Hola!", "user:p3"}
+	if !slices.Equal(last, want) {
+		t.Errorf("después del reset: %q, want %q", last, want)
+	}
+}
+
+func TestSeedGreeting(t *testing.T) {
+	cases := []struct {
+		name       string
+		env        map[string]string
+		start, end []string // saludo al empezar y después del reset
+	}{
+		{"default", nil, []string{assistantHello}, []string{assistantHelloReset}},
+		{"ASSISTANT_HELLO", map[string]string{"ASSISTANT_HELLO": "Buenas, ¿qué analizamos?"},
+			[]string{"Buenas, ¿qué analizamos?"}, []string{"Buenas, ¿qué analizamos?"}},
+		{"SEED_HELLO=false", map[string]string{"SEED_HELLO": "false", "ASSISTANT_HELLO": "no se usa"}, []string{}, []string{}},
+	}
+	for _, tc := range cases {
+		r := newTestRouter(t, tc.env)
+		sid := []string{"X-Session-ID", "s-saludo"}
+		history := func() []string {
+			var h internal.ChatHistory
+			decode(t, call(r, "GET", "/api/messages", "", sid...), &h)
+			out := []string{}
+			for _, m := range h.Messages {
+				out = append(out, m.Content)
+			}
+			return out
+		}
+		if got := history(); !slices.Equal(got, tc.start) {
+			t.Errorf("%s: al empezar %q, want %q", tc.name, got, tc.start)
+		}
+		call(r, "POST", "/api/reset", "", sid...)
+		if got := history(); !slices.Equal(got, tc.end) {
+			t.Errorf("%s: después del reset %q, want %q", tc.name, got, tc.end)
+		}
+	}
+}
+
+func TestSessionsEndpoints(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"API_KEYS": "key-a,key-b"})
+	a := []string{"Authorization", "Bearer key-a"}
+	as := func(id string) []string { return append(slices.Clone(a), "X-Session-ID", id) }
+	if w := call(r, "POST", "/api/messages", `{"content":"ventas de mayo"}`, as("s1")...); w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if w := call(r, "POST", "/api/files", `{"files":[{"name":"a.csv","text":"id,comentario\n1,de s1\n"}]}`, as("s1")...); w.Code != 200 {
+		t.Fatalf("upload: status %d: %s", w.Code, w.Body)
+	}
+	call(r, "GET", "/api/messages", "", as("s2")...)
+	call(r, "GET", "/api/messages", "", "Authorization", "Bearer key-b", "X-Session-ID", "s3")
+
+	// solo las de la key, sin el namespace
+	var list internal.SessionList
+	decode(t, call(r, "GET", "/api/sessions", "", a...), &list)
+	counts := make(map[string]int)
+	for _, s := range list.Sessions {
+		counts[s.ID] = s.Messages
+		if s.LastActivity.IsZero() {
+			t.Errorf("%s sin última actividad", s.ID)
+		}
+	}
+	// s1: saludo, consulta y respuesta; s2: el saludo
+	if len(counts) != 2 || counts["s1"] != 3 || counts["s2"] != 1 {
+		t.Errorf("sesiones = %+v", list.Sessions)
+	}
+
+	if w := call(r, "DELETE", "/api/sessions/s1", "", a...); w.Code != 200 {
+		t.Fatalf("DELETE: status %d: %s", w.Code, w.Body)
+	}
+	var after internal.SessionList
+	decode(t, call(r, "GET", "/api/sessions", "", a...), &after)
+	if len(after.Sessions) != 1 || after.Sessions[0].ID != "s2" {
+		t.Errorf("después de borrar s1: %+v", after.Sessions)
+	}
+	// si vuelve, empieza de cero y sin sus archivos
+	var files struct {
+		Files []internal.KnowledgeFile `json:"files"`
+	}
+	decode(t, call(r, "GET", "/api/files", "", as("s1")...), &files)
+	if len(files.Files) != 0 {
+		t.Errorf("archivos de s1 después de borrarla: %+v", files.Files)
+	}
+	var h internal.ChatHistory
+	decode(t, call(r, "GET", "/api/messages", "", as("s1")...), &h)
+	if len(h.Messages) != 1 || h.Messages[0].Role != internal.RoleAssistant {
+		t.Errorf("s1 después de borrarla: %+v", h.Messages)
+	}
+
+	for _, tc := range []struct {
+		hdr  []string
+		path string
+		want int
+	}{
+		{a, "/api/sessions/no-existe", 404},
+		// la sesión de otra key no existe para esta
+		{a, "/api/sessions/s3", 404},
+		{nil, "/api/sessions/s2", 401},
+	} {
+		if w := call(r, "DELETE", tc.path, "", tc.hdr...); w.Code != tc.want {
+			t.Errorf("DELETE %s: status %d, want %d", tc.path, w.Code, tc.want)
+		}
+	}
+	if w := call(r, "GET", "/api/sessions", ""); w.Code != 401 {
+		t.Errorf("GET sin key: status %d, want 401", w.Code)
+	}
+
+	// sin API_KEYS no hay a quién permitírselo
+	open := newTestRouter(t, nil)
+	if w := call(open, "GET", "/api/sessions", ""); w.Code != 403 {
+		t.Errorf("GET sin API_KEYS: status %d, want 403", w.Code)
+	}
+	if w := call(open, "DELETE", "/api/sessions/default", ""); w.Code != 403 {
+		t.Errorf("DELETE sin API_KEYS: status %d, want 403", w.Code)
+	}
+}
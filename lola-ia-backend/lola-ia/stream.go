@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+)
+
+// wantsStream reports whether the client asked for Server-Sent Events.
+func wantsStream(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
+
+// statusClientClosed is nginx's "client closed request"; it only shows up in
+// the access log, the client is already gone.
+const statusClientClosed = 499
+
+// clientGone reports whether err happened because the client disconnected
+// (its request context was canceled) or stopped reading the stream, rather
+// than because the provider failed. In that case it logs it and aborts
+// without writing a response.
+func clientGone(c *gin.Context, err error, sid string) bool {
+	if errors.Is(err, errClientStalled) {
+		// los headers ya salieron: solo queda cortar
+		fmt.Printf("[messages] %v; stream cortado (sesión %s)\n", err, sid)
+		c.Abort()
+		return true
+	}
+	if c.Request.Context().Err() == nil || !errors.Is(err, context.Canceled) {
+		return false
+	}
+	fmt.Printf("[messages] cliente desconectado; consulta cancelada (sesión %s)\n", sid)
+	c.AbortWithStatus(statusClientClosed)
+	return true
+}
+
+// writeReply sends an already generated reply, as an SSE "done" event if the
+// client asked for streaming or as plain JSON otherwise.
+func writeReply(c *gin.Context, resp internal.SendMessageResponse) {
+	if wantsStream(c) {
+		c.Header("Content-Type", "text/event-stream")
+		c.SSEvent("done", resp)
+		return
+	}
+	c.JSON(200, resp)
+}
+
+const (
+	defaultSSEHeartbeat    = 15 * time.Second
+	defaultSSEWriteTimeout = 30 * time.Second
+)
+
+// errClientStalled: the client stopped reading the stream and a write did
+// not finish within sseConfig.WriteTimeout.
+var errClientStalled = errors.New("el cliente no lee el stream")
+
+// sseConfig controls how streamReply deals with slow clients. Zero disables
+// each one.
+type sseConfig struct {
+	// Heartbeat is how often a ": ping" comment is sent while no token
+	// arrives, so proxies keep the connection open and a dead client shows
+	// up as a failed write.
+	Heartbeat time.Duration
+	// WriteTimeout bounds every write to the client.
+	WriteTimeout time.Duration
+}
+
+// streamReply runs chat.ReplyStream and forwards every chunk to the client as
+// an SSE "token" event, and every tool the model runs meanwhile as a "status"
+// event (see provider.WithToolStatus), so a multi-step answer doesn't look
+// stuck. It returns the provider's result once it is done.
+// If a write fails (e.g. the client stopped reading and WriteTimeout passed)
+// the provider call is canceled and errClientStalled is returned.
+func streamReply(c *gin.Context, cfg sseConfig, chat provider.ChatProvider, history []internal.Message, prompt string) (provider.Result, error) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	type outcome struct {
+		res provider.Result
+		err error
+	}
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	tokens := make(chan string)
+	status := make(chan provider.ToolStatus)
+	ctx = provider.WithToolStatus(ctx, status)
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := chat.ReplyStream(ctx, history, prompt, tokens)
+		done <- outcome{res, err}
+		close(tokens)
+	}()
+
+	rc := http.NewResponseController(c.Writer)
+	deadline := func() {
+		if cfg.WriteTimeout > 0 {
+			_ = rc.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		}
+	}
+	// net/http guarda el error de un flush que no terminó: lo devuelve la
+	// escritura siguiente (el próximo token o ping)
+	write := func(frame func(io.Writer) error) error {
+		deadline()
+		if err := frame(c.Writer); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	var (
+		ping   *time.Ticker
+		pingCh <-chan time.Time
+	)
+	if cfg.Heartbeat > 0 {
+		ping = time.NewTicker(cfg.Heartbeat)
+		defer ping.Stop()
+		pingCh = ping.C
+	}
+
+	var werr error
+loop:
+	for {
+		select {
+		case tok, ok := <-tokens:
+			if !ok {
+				break loop
+			}
+			werr = write(func(w io.Writer) error {
+				return sse.Encode(w, sse.Event{Event: "token", Data: gin.H{"delta": tok}})
+			})
+			if ping != nil {
+				ping.Reset(cfg.Heartbeat)
+			}
+		case s := <-status:
+			werr = write(func(w io.Writer) error {
+				return sse.Encode(w, sse.Event{Event: "status", Data: gin.H{"status": s.String(), "tool": s.Tool, "args": s.Args}})
+			})
+			if ping != nil {
+				ping.Reset(cfg.Heartbeat)
+			}
+		case <-pingCh:
+			werr = write(func(w io.Writer) error {
+				_, err := io.WriteString(w, ": ping\n\n")
+				return err
+			})
+		}
+		if werr != nil {
+			break
+		}
+	}
+	if werr != nil {
+		cancel()
+	}
+	// si el cliente se fue antes, vaciamos el canal para no bloquear al provider
+	for range tokens {
+	}
+	o := <-done
+	switch {
+	case errors.Is(werr, os.ErrDeadlineExceeded):
+		return o.res, fmt.Errorf("%w: %v", errClientStalled, werr)
+	case werr != nil:
+		// la conexión se cerró: net/http ya canceló el request
+		return o.res, fmt.Errorf("%w: %v", context.Canceled, werr)
+	}
+	// el evento final (done o error) tampoco puede quedar trabado
+	deadline()
+	return o.res, o.err
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+// streamStub manda tokens de chunk bytes cada every hasta que le cancelan
+// el contexto o mandó n; canceled se cierra si fue cancelado.
+type streamStub struct {
+	provider.MockProvider
+	chunk    int
+	every    time.Duration
+	n        int
+	canceled chan struct{}
+}
+
+func (s streamStub) ReplyStream(ctx context.Context, _ []internal.Message, _ string, out chan<- string) (provider.Result, error) {
+	tok := strings.Repeat("x", s.chunk)
+	for i := 0; s.n == 0 || i < s.n; i++ {
+		select {
+		case <-time.After(s.every):
+		case <-ctx.Done():
+			close(s.canceled)
+			return provider.Result{}, ctx.Err()
+		}
+		select {
+		case out <- tok:
+		case <-ctx.Done():
+			close(s.canceled)
+			return provider.Result{}, ctx.Err()
+		}
+	}
+	return provider.Result{Text: "listo"}, nil
+}
+
+func TestStreamReplyHeartbeat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/messages", nil)
+	chat := streamStub{chunk: 1, every: 100 * time.Millisecond, n: 2, canceled: make(chan struct{})}
+	res, err := streamReply(c, sseConfig{Heartbeat: 10 * time.Millisecond}, chat, nil, "hola")
+	if err != nil || res.Text != "listo" {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	body := w.Body.String()
+	if n := strings.Count(body, ": ping\n\n"); n < 2 {
+		t.Errorf("%d pings en 200ms sin tokens:\n%s", n, body)
+	}
+	if strings.Count(body, "event:token") != 2 {
+		t.Errorf("tokens:\n%s", body)
+	}
+}
+
+func TestStreamReplyStalledClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	chat := streamStub{chunk: 64 << 10, every: time.Millisecond, canceled: make(chan struct{})}
+	result := make(chan error, 1)
+	r := gin.New()
+	r.POST("/stream", func(c *gin.Context) {
+		_, err := streamReply(c, sseConfig{WriteTimeout: 100 * time.Millisecond}, chat, nil, "hola")
+		result <- err
+		clientGone(c, err, "s-lento")
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	// un cliente que manda el request y nunca lee la respuesta
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "POST /stream HTTP/1.1\r\nHost: lola\r\nContent-Length: 0\r\n\r\n")
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, errClientStalled) {
+			t.Errorf("err = %v, want errClientStalled", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("el stream sigue escribiendo a un cliente que no lee")
+	}
+	select {
+	case <-chat.canceled:
+	case <-time.After(time.Second):
+		t.Error("no se canceló la consulta al proveedor")
+	}
+}
+
+func TestStreamReplyToolStatus(t *testing.T) {
+	// la primera vuelta pide count_rows_where, la segunda responde
+	var rounds int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rounds++
+		w.Header().Set("Content-Type", "text/event-stream")
+		if rounds == 1 {
+			fmt.Fprint(w, `data: {"type":"response.output_item.done","item":{"type":"function_call","call_id":"c1","name":"count_rows_where","arguments":"{\"file\":\"nps.csv\",\"column\":\"canal\",\"eq\":\"app\"}"}}`+"\n\n")
+		} else {
+			fmt.Fprint(w, `data: {"type":"response.output_text.delta","delta":"Son "}`+"\n\n")
+			fmt.Fprint(w, `data: {"type":"response.output_text.delta","delta":"2 filas."}`+"\n\n")
+		}
+		fmt.Fprint(w, `data: {"type":"response.completed","response":{}}`+"\n\n")
+	}))
+	defer srv.Close()
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_API_STYLE", "")
+	retries := 0
+	chat, err := provider.NewOpenAIProvider("gpt-4o-mini", provider.ProviderConfig{HTTPClient: &http.Client{Transport: rewrite{srv}}, MaxRetries: &retries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat.SetTools(provider.NewToolRegistry(countRowsTool{mem: store.NewMemoryStore()}))
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/messages", nil)
+	res, err := streamReply(c, sseConfig{}, chat, nil, "¿cuántas filas son de la app?")
+	if err != nil || res.Text != "Son 2 filas." {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	body := w.Body.String()
+	status, token := strings.Index(body, "event:status"), strings.Index(body, "event:token")
+	if status < 0 || token < 0 || status > token {
+		t.Fatalf("el status no precede al texto:\n%s", body)
+	}
+	if !strings.Contains(body, `"status":"ejecutando: count_rows_where {\"file\":\"nps.csv\"`) || !strings.Contains(body, `"tool":"count_rows_where"`) {
+		t.Errorf("evento de status:\n%s", body)
+	}
+	if n := strings.Count(body, "event:status"); n != 1 {
+		t.Errorf("%d eventos de status, want 1", n)
+	}
+}
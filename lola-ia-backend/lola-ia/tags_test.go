@@ -0,0 +1,52 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestFileTagsContext(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s-tags"}
+	call(r, "POST", "/api/files", `{"files":[
+		{"name":"cards.csv","text":"id,comentario\n1,la tarjeta\n","tags":["Cards"]},
+		{"name":"pix.csv","text":"id,comentario\n1,el pix\n","tags":["pix"]},
+		{"name":"otros.csv","text":"id,comentario\n1,otro\n"}]}`, sid...)
+	sources := func(tags string) []string {
+		t.Helper()
+		var res internal.DryRunResponse
+		decode(t, call(r, "POST", "/api/messages?dry_run=true", `{"content":"Hazme un análisis de las encuestas","tags":`+tags+`}`, sid...), &res)
+		slices.Sort(res.Sources)
+		return res.Sources
+	}
+
+	if got := sources(`[]`); !slices.Equal(got, []string{"cards.csv", "otros.csv", "pix.csv"}) {
+		t.Errorf("sin tags: %q", got)
+	}
+	if got := sources(`["cards"]`); !slices.Equal(got, []string{"cards.csv"}) {
+		t.Errorf("cards: %q", got)
+	}
+
+	var tagged struct{ Tags []string }
+	decode(t, call(r, "PATCH", "/api/files/otros.csv/tags", `{"tags":["Pix, cards"]}`, sid...), &tagged)
+	if !slices.Equal(tagged.Tags, []string{"cards", "pix"}) {
+		t.Errorf("PATCH: tags = %q", tagged.Tags)
+	}
+	if got := sources(`["pix"]`); !slices.Equal(got, []string{"otros.csv", "pix.csv"}) {
+		t.Errorf("pix después del PATCH: %q", got)
+	}
+	// "tags": [] le quita todos
+	call(r, "PATCH", "/api/files/cards.csv/tags", `{"tags":[]}`, sid...)
+	if got := sources(`["cards"]`); !slices.Equal(got, []string{"otros.csv"}) {
+		t.Errorf("cards después de quitar los tags: %q", got)
+	}
+
+	if w := call(r, "PATCH", "/api/files/otros.csv/tags", `{}`, sid...); w.Code != 400 {
+		t.Errorf("sin tags: status %d, want 400", w.Code)
+	}
+	if w := call(r, "PATCH", "/api/files/nada.csv/tags", `{"tags":["x"]}`, sid...); w.Code != 404 {
+		t.Errorf("archivo inexistente: status %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Templates built in besides "analyst". They use the same placeholders as
+// analystTemplate so buildAnalystPrompt fills them the same way.
+const (
+	sentimentTemplate = `You are a customer experience analyst for a major financial institution. Classify the sentiment of the customer feedback below.
+Customer Data: ` + analystDataPlaceholder + `
+User Query: ` + analystQueryPlaceholder + `
+Format the final response using the exact structure below.
+--- Overall Sentiment [Positive / Neutral / Negative with the approximate share (%) of each.]
+--- Drivers of Negative Sentiment [Bullet points.]
+--- Drivers of Positive Sentiment [Bullet points.]
+--- Examples of Verbatim [Two or three quotes per sentiment.]`
+
+	npsTemplate = `You are a customer experience analyst for a major financial institution. Break down the Net Promoter Score feedback below.
+Customer Data: ` + analystDataPlaceholder + `
+User Query: ` + analystQueryPlaceholder + `
+Format the final response using the exact structure below.
+--- NPS [Promoters (%), Passives (%), Detractors (%) and the resulting score, if the data allows computing it.]
+--- Why Promoters Recommend Us [Bullet points.]
+--- Why Detractors Do Not [Bullet points.]
+--- Actionable Feedback [Bullet points.]`
+
+	competitorsTemplate = `You are a market researcher for a major financial institution. Find the mentions of competitors in the customer feedback below.
+Customer Data: ` + analystDataPlaceholder + `
+User Query: ` + analystQueryPlaceholder + `
+Format the final response using the exact structure below.
+--- Competitors Mentioned [Each competitor with its number and share (%) of mentions.]
+--- What Customers Compare [Bullet points per competitor.]
+--- Examples of Verbatim [Quotes, separated by competitor.]`
+)
+
+// promptTemplates maps a template name to its text.
+type promptTemplates map[string]string
+
+// loadPromptTemplates returns the built-in templates, with analyst replaced by
+// analystTmpl, plus every <name>.txt in dir (PROMPT_TEMPLATES_DIR). A file
+// with a built-in name overrides it; files missing a placeholder are skipped.
+func loadPromptTemplates(analystTmpl, dir string) promptTemplates {
+	t := promptTemplates{
+		"analyst":     analystTmpl,
+		"sentiment":   sentimentTemplate,
+		"nps":         npsTemplate,
+		"competitors": competitorsTemplate,
+	}
+	if dir == "" {
+		return t
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		fmt.Printf("[prompt] error leyendo %s: %v\n", dir, err)
+		return t
+	}
+	for _, p := range paths {
+		tmpl, err := loadAnalystTemplate(p)
+		if err != nil {
+			fmt.Printf("[prompt] template descartado: %v\n", err)
+			continue
+		}
+		t[strings.TrimSuffix(filepath.Base(p), ".txt")] = tmpl
+	}
+	fmt.Printf("[prompt] templates: %s\n", strings.Join(t.names(), ", "))
+	return t
+}
+
+func (t promptTemplates) names() []string {
+	out := make([]string, 0, len(t))
+	for name := range t {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
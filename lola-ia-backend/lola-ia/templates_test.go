@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestSendMessageTemplates(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"DEBUG_PROMPTS": "true"})
+	prompt := func(template string) string {
+		t.Helper()
+		// una sesión por template: el mismo mensaje seguido en una sesión es un duplicado
+		w := call(r, "POST", "/api/messages", `{"content":"¿qué opinan de la app?","template":"`+template+`"}`, "X-Session-ID", "s-"+template)
+		if w.Code != 200 {
+			t.Fatalf("template %s: status %d: %s", template, w.Code, w.Body)
+		}
+		if got := w.Header().Get(modeHeader); got != template {
+			t.Errorf("template %s: %s = %q", template, modeHeader, got)
+		}
+		var res internal.SendMessageResponse
+		decode(t, w, &res)
+		return res.Prompt
+	}
+	sentiment, nps := prompt("sentiment"), prompt("nps")
+	if sentiment == nps {
+		t.Fatal("los dos templates dieron el mismo prompt")
+	}
+	if !strings.Contains(sentiment, "Overall Sentiment") || !strings.Contains(nps, "Why Promoters Recommend Us") {
+		t.Errorf("prompts sin su formato:\n%s\n---\n%s", sentiment, nps)
+	}
+	for _, p := range []string{sentiment, nps} {
+		if !strings.Contains(p, "¿qué opinan de la app?") {
+			t.Errorf("el prompt no trae la consulta:\n%s", p)
+		}
+	}
+}
+
+func TestSendMessageUnknownTemplate(t *testing.T) {
+	r := newTestRouter(t, nil)
+	w := call(r, "POST", "/api/messages", `{"content":"hola","template":"nada"}`, "X-Session-ID", "s-templates")
+	if w.Code != 400 {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+	var res struct{ Templates []string }
+	decode(t, w, &res)
+	if !slices.Contains(res.Templates, "analyst") {
+		t.Errorf("templates = %v", res.Templates)
+	}
+}
+
+func TestLoadPromptTemplatesDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"churn.txt":    "Churn. " + analystDataPlaceholder + " " + analystQueryPlaceholder,
+		"nps.txt":      "NPS propio. " + analystDataPlaceholder + " " + analystQueryPlaceholder,
+		"roto.txt":     "sin placeholders",
+		"no-es-txt.md": "Otro. " + analystDataPlaceholder + " " + analystQueryPlaceholder,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tmpl := loadPromptTemplates(analystTemplate, dir)
+	want := []string{"analyst", "churn", "competitors", "nps", "sentiment"}
+	if got := tmpl.names(); !slices.Equal(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+	if !strings.HasPrefix(tmpl["nps"], "NPS propio.") {
+		t.Errorf("nps.txt no pisó el template incluido: %q", tmpl["nps"])
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+type filesKey struct{}
+
+// withFiles deja en ctx los archivos de la sesión que hace la consulta: las
+// tools se registran una sola vez y reciben la sesión por acá.
+func withFiles(ctx context.Context, kb store.FileScope) context.Context {
+	return context.WithValue(ctx, filesKey{}, kb)
+}
+
+// countRowsTool deja que el modelo cuente filas de un archivo cargado con los
+// mismos filtros que POST /api/messages (eq, from, to), en vez de contarlas
+// a ojo sobre el contexto, que además puede estar truncado.
+type countRowsTool struct {
+	mem store.Store
+}
+
+// files devuelve los archivos que ve la consulta; sin sesión en ctx, solo
+// los compartidos.
+func (t countRowsTool) files(ctx context.Context) store.FileScope {
+	if kb, ok := ctx.Value(filesKey{}).(store.FileScope); ok {
+		return kb
+	}
+	return store.SharedFiles(t.mem)
+}
+
+func (countRowsTool) Name() string { return "count_rows_where" }
+
+func (countRowsTool) Description() string {
+	return "Cuenta las filas de un archivo cargado que cumplen una condición sobre una columna: " +
+		"igualdad (eq, sin distinguir mayúsculas ni acentos) y/o rango (from, to) de números o fechas."
+}
+
+func (countRowsTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "file": {"type": "string", "description": "Nombre del archivo, p.ej. ventas.csv"},
+    "column": {"type": "string", "description": "Columna sobre la que se filtra"},
+    "eq": {"type": "string", "description": "Valor exacto"},
+    "from": {"type": "string", "description": "Mínimo (número o fecha), inclusive"},
+    "to": {"type": "string", "description": "Máximo (número o fecha), inclusive"}
+  },
+  "required": ["file", "column"],
+  "additionalProperties": false
+}`)
+}
+
+func (t countRowsTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		File   string `json:"file"`
+		Column string `json:"column"`
+		internal.RowFilter
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", fmt.Errorf("argumentos inválidos: %w", err)
+	}
+	f, ok := t.files(ctx).GetFile(in.File)
+	if !ok {
+		return "", fmt.Errorf("archivo no encontrado: %s", in.File)
+	}
+	if f.Parsed == nil {
+		return "", fmt.Errorf("%s no se pudo parsear: %s", f.Name, f.ParseError)
+	}
+	filters, err := tabular.CompileFilters(map[string]internal.RowFilter{in.Column: in.RowFilter})
+	if err != nil {
+		return "", err
+	}
+	matched, ok := filters.Apply(f.Parsed)
+	if !ok {
+		return "", errors.New("columna no encontrada: " + in.Column)
+	}
+	b, err := json.Marshal(map[string]any{
+		"file":    f.Name,
+		"column":  in.Column,
+		"matched": len(matched.Rows),
+		"total":   len(f.Parsed.Rows),
+	})
+	return string(b), err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+func TestCountRowsTool(t *testing.T) {
+	mem := store.NewMemoryStore()
+	kb := store.SessionFiles(mem, "s1")
+	if _, err := kb.AddFiles([]internal.KnowledgeFile{csvFile("nps.csv", "id,canal,nps\n1,App,9\n2,chat,3\n3,app,10\n")}); err != nil {
+		t.Fatal(err)
+	}
+	tool := countRowsTool{mem: mem}
+	ctx := withFiles(context.Background(), kb)
+
+	cases := []struct {
+		args    string
+		matched int
+	}{
+		{`{"file":"nps.csv","column":"canal","eq":"app"}`, 2},
+		{`{"file":"nps.csv","column":"nps","from":"9"}`, 2},
+		{`{"file":"nps.csv","column":"nps","from":"0","to":"5"}`, 1},
+	}
+	for _, tc := range cases {
+		out, err := tool.Call(ctx, json.RawMessage(tc.args))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.args, err)
+		}
+		var res struct{ Matched, Total int }
+		if err := json.Unmarshal([]byte(out), &res); err != nil || res.Matched != tc.matched || res.Total != 3 {
+			t.Errorf("%s: %s", tc.args, out)
+		}
+	}
+
+	for _, args := range []string{
+		`{"file":"nada.csv","column":"canal","eq":"app"}`,
+		`{"file":"nps.csv","column":"region","eq":"sur"}`,
+		`{"file":"nps.csv","column":"canal"}`,
+		`no es json`,
+	} {
+		if out, err := tool.Call(ctx, json.RawMessage(args)); err == nil {
+			t.Errorf("%s: %s, want error", args, out)
+		}
+	}
+	// sin la sesión en ctx solo ve los compartidos
+	if _, err := tool.Call(context.Background(), json.RawMessage(cases[0].args)); err == nil {
+		t.Error("sin sesión se vio un archivo de la sesión")
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+	"github.com/nubank/lola-ia-backend/internal/store"
+	"github.com/nubank/lola-ia-backend/internal/tabular"
+)
+
+// turnService procesa una consulta al chat (un turno) igual para
+// POST /api/messages y /ws: validación, moderación, doble envío, cache de
+// respuestas, tope de llamadas al proveedor, prompt, reintento por largo,
+// formato y guardado. Cada transporte decide cómo manda la respuesta y cómo
+// informa los errores.
+type turnService struct {
+	mem         store.Store
+	box         *outbox
+	chat        provider.ChatProvider
+	templates   promptTemplates
+	models      []string // ALLOWED_MODELS
+	router      modelRouter
+	mod         *moderationGate
+	slots       *llmLimiter
+	pending     *inflight
+	dedupWindow time.Duration
+	answers     *answerCache
+	format      *formatChecker
+	structured  bool // ANALYST_STRUCTURED
+	ctxCfg      filesContextConfig
+
+	history func(ctx context.Context, sid string) []internal.Message
+	// mode decide el modo de la consulta (ver modeHeader).
+	mode func(req internal.SendMessageRequest) string
+	// compose arma el prompt con el presupuesto de archivos cfg y devuelve
+	// el modo y los archivos que entraron en el contexto.
+	compose func(ctx context.Context, kb store.FileScope, req internal.SendMessageRequest, cfg filesContextConfig) (prompt, mode string, sources []string)
+	// count suma el mensaje a lola_messages_total según su modo.
+	count func(mode string)
+}
+
+// turnError es un request rechazado antes de procesarlo: Status es el
+// código HTTP y Extra lo que se agrega al JSON del error.
+type turnError struct {
+	Status int
+	Err    error
+	Extra  map[string]any
+}
+
+func (e *turnError) Error() string { return e.Err.Error() }
+func (e *turnError) Unwrap() error { return e.Err }
+
+// writeTurnError responde el error de validate o moderate como JSON.
+func writeTurnError(c *gin.Context, err error) {
+	var te *turnError
+	if !errors.As(err, &te) {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	body := gin.H{"error": te.Err.Error()}
+	for k, v := range te.Extra {
+		body[k] = v
+	}
+	c.JSON(te.Status, body)
+}
+
+// validate revisa req y devuelve el provider que le toca (ver modelRouter).
+func (s *turnService) validate(req internal.SendMessageRequest) (provider.ChatProvider, error) {
+	if req.Content == "" {
+		return nil, &turnError{Status: 400, Err: errors.New("content requerido")}
+	}
+	if _, ok := s.templates[req.Template]; req.Template != "" && !ok {
+		return nil, &turnError{Status: 400, Err: errors.New("template desconocido"), Extra: map[string]any{"templates": s.templates.names()}}
+	}
+	if _, err := tabular.CompileFilters(req.Filters); err != nil {
+		return nil, &turnError{Status: 400, Err: err}
+	}
+	if _, err := parseLanguage(req.Language); err != nil {
+		return nil, &turnError{Status: 400, Err: err}
+	}
+	chat, err := s.router.pick(s.chat, req.Model, s.mode(req), s.models)
+	if err != nil {
+		return nil, &turnError{Status: 400, Err: err, Extra: map[string]any{"models": s.models}}
+	}
+	return chat, nil
+}
+
+// moderate pasa content por la moderación; va antes de guardar nada, así un
+// mensaje bloqueado no queda en el historial.
+func (s *turnService) moderate(ctx context.Context, content string) error {
+	reason, blocked, err := s.mod.check(ctx, content)
+	if err != nil {
+		return &turnError{Status: 503, Err: err}
+	}
+	if blocked {
+		return &turnError{Status: 422, Err: errors.New("mensaje bloqueado por moderación"), Extra: map[string]any{"reason": reason}}
+	}
+	return nil
+}
+
+// chatTurn es una consulta ya validada y moderada de la sesión sid.
+type chatTurn struct {
+	sid  string
+	req  internal.SendMessageRequest
+	chat provider.ChatProvider // el que devolvió validate
+	kb   store.FileScope
+	// stream, si no es nil, manda la respuesta al cliente a medida que llega
+	// (SSE o WebSocket); sin stream se pide entera y, como todavía no se
+	// mostró, el chequeo de formato puede pedirla de nuevo.
+	stream func(ctx context.Context, chat provider.ChatProvider, history []internal.Message, prompt string) (provider.Result, error)
+	// started, si no es nil, recibe el mensaje del usuario (con su ID
+	// definitivo), el modo y el prompt justo antes de llamar al proveedor.
+	started func(user internal.Message, mode, prompt string)
+}
+
+// turnResult es lo que el transporte le manda al cliente.
+type turnResult struct {
+	Response internal.SendMessageResponse
+	Mode     string
+	// User es el mensaje del usuario guardado; vacío en un duplicado o con
+	// el proveedor caído (Response.Degraded), donde no se guarda nada.
+	User internal.Message
+	// Duplicate: doble envío, Response es la respuesta del primero.
+	Duplicate bool
+	// Cached: la respuesta salió del cache (ANSWER_CACHE) sin llamar al proveedor.
+	Cached bool
+}
+
+// run procesa t hasta guardar el turno. Los errores son los del proveedor
+// (ErrModelNotFound, ErrContextLength si el reintento tampoco entra...),
+// errLLMBusy o el de ctx si el cliente se fue. Con el proveedor caído
+// (errProviderDown) no hay error: Response es la respuesta automática.
+func (s *turnService) run(ctx context.Context, t chatTurn) (turnResult, error) {
+	// Doble envío (p.ej. doble click): devolvemos la respuesta del primero
+	reply, dup, done := duplicateReply(ctx, s.mem, s.pending, t.sid, t.req.Content, s.dedupWindow)
+	if dup {
+		fmt.Printf("[messages] mensaje duplicado en la sesión %s; se reutiliza la respuesta\n", t.sid)
+		return turnResult{Response: internal.SendMessageResponse{Reply: reply, Model: t.chat.Model()}, Duplicate: true}, nil
+	}
+	defer done()
+
+	// El mensaje del usuario se guarda junto con la respuesta (ver
+	// AppendBatchForSession); si el proveedor falla no queda nada a medias.
+	// El ID se fija acá para que coincida con lo que ya se mostró.
+	userMsg := internal.Message{
+		ID:        uuid.NewString(),
+		Role:      internal.RoleUser,
+		Content:   t.req.Content,
+		CreatedAt: time.Now(),
+	}
+
+	// La misma consulta de análisis sobre los mismos archivos se contesta
+	// del cache (ANSWER_CACHE=true), sin llamar al proveedor
+	var cacheKey string
+	if mode := s.mode(t.req); s.answers != nil && mode != "plain" {
+		cacheKey = answerKey(t.req, mode, t.chat.Model(), t.kb.WithKeys(t.kb.ListFilesByTag(t.req.Tags...)))
+		if reply, sources, ok := s.answers.get(cacheKey); ok {
+			s.count(mode)
+			saved := s.mem.AppendBatchForSession(t.sid, userMsg, internal.Message{
+				Role:      internal.RoleAssistant,
+				Content:   reply,
+				CreatedAt: time.Now(),
+			})
+			fmt.Printf("[messages] respuesta de análisis desde el cache (sesión %s)\n", t.sid)
+			return turnResult{
+				Response: internal.SendMessageResponse{
+					Reply:    saved[1],
+					Model:    t.chat.Model(),
+					Sources:  sources,
+					Analysis: structuredAnalysis(s.structured, mode, reply),
+				},
+				Mode:   mode,
+				User:   saved[0],
+				Cached: true,
+			}, nil
+		}
+	}
+
+	// el lugar cubre todo lo que llama al proveedor: embeddings de la
+	// consulta, resumen del historial y la respuesta
+	release, err := s.slots.acquire(ctx)
+	if err != nil {
+		return turnResult{}, err
+	}
+	defer release()
+
+	prompt, mode, sources := s.compose(ctx, t.kb, t.req, s.ctxCfg)
+	s.count(mode)
+	if t.started != nil {
+		t.started(userMsg, mode, prompt)
+	}
+
+	history := s.history(ctx, t.sid)
+	call := func(prompt string) (provider.Result, error) {
+		if t.stream != nil {
+			return t.stream(ctx, t.chat, history, prompt)
+		}
+		return t.chat.Reply(ctx, history, prompt)
+	}
+	res, err := call(prompt)
+	// el rechazo por largo llega antes del primer token
+	if errors.Is(err, provider.ErrContextLength) {
+		if p, src, ok := s.shrink(ctx, t.kb, t.req, prompt); ok {
+			prompt, sources = p, src
+			res, err = call(prompt)
+		}
+	}
+	if errors.Is(err, errProviderDown) {
+		// la respuesta automática no se guarda
+		return turnResult{Response: degradedResponse(t.chat.Model()), Mode: mode}, nil
+	}
+	if err != nil {
+		return turnResult{Mode: mode}, err
+	}
+	var missing []string
+	if t.stream != nil {
+		// ya se streameó: una respuesta incompleta solo se marca
+		missing = s.format.missing(mode, res.Text)
+	} else {
+		res, missing = s.format.check(ctx, t.chat, history, prompt, mode, res)
+	}
+
+	// la respuesta ya está pagada: si la base falla se reintenta (outbox)
+	saved, ok := s.box.append(t.sid, userMsg, internal.Message{
+		Role:      internal.RoleAssistant,
+		Content:   res.Text,
+		CreatedAt: time.Now(),
+	})
+	recordUsage(s.mem, t.sid, res.Usage)
+	if cacheKey != "" && len(missing) == 0 {
+		s.answers.put(cacheKey, res.Text, sources)
+	}
+	return turnResult{
+		Response: internal.SendMessageResponse{
+			Reply:   saved[1],
+			Model:   t.chat.Model(),
+			Usage:   res.Usage,
+			Sources: sources,
+			Unsaved: !ok,
+
+			FormatIncomplete: len(missing) > 0,
+			MissingSections:  missing,
+			Analysis:         structuredAnalysis(s.structured, mode, res.Text),
+		},
+		Mode: mode,
+		User: saved[0],
+	}, nil
+}
+
+// shrink rearma el prompt con la mitad del presupuesto de archivos (menos
+// archivos y cada uno más corto) para reintentar una vez cuando el
+// proveedor lo rechaza por exceder la ventana de contexto del modelo. ok es
+// false en el modo plain, que no lleva archivos.
+func (s *turnService) shrink(ctx context.Context, kb store.FileScope, req internal.SendMessageRequest, rejected string) (prompt string, sources []string, ok bool) {
+	if s.mode(req) == "plain" {
+		return "", nil, false
+	}
+	cfg := s.ctxCfg
+	cfg.MaxContextTokens /= 2
+	cfg.MaxFileTokens /= 2
+	prompt, _, sources = s.compose(ctx, kb, req, cfg)
+	fmt.Printf("[context] el proveedor rechazó el prompt por largo (%d bytes); se reintenta con ~%d tokens de archivos (%d por archivo): %d bytes\n",
+		len(rejected), cfg.MaxContextTokens, cfg.MaxFileTokens, len(prompt))
+	return prompt, sources, true
+}
+
+// providerError es el mensaje para el cliente cuando la consulta falló en
+// el proveedor, y el código HTTP que le corresponde.
+func providerError(err error, model string) (status int, msg string) {
+	switch {
+	case errors.Is(err, provider.ErrModelNotFound):
+		fmt.Printf("[provider] modelo inexistente: %v\n", err)
+		return 400, modelNotFoundMessage(model)
+	case errors.Is(err, provider.ErrContextLength):
+		fmt.Printf("[provider] prompt demasiado largo: %v\n", err)
+		return 400, provider.ErrContextLength.Error()
+	}
+	fmt.Printf("[provider] error: %v\n", err)
+	return 502, err.Error()
+}
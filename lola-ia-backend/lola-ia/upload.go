@@ -0,0 +1,266 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/charset"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+// maxTagsFieldBytes acota el campo "tags" de un upload multipart.
+const maxTagsFieldBytes = 4 << 10
+
+// addFilesFailed responde el error de AddFiles, si lo hubo: 413 si se
+// excede un límite y 500 si el store no pudo guardar (no se guardó ninguno).
+func addFilesFailed(c *gin.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	var limitErr *store.LimitError
+	if errors.As(err, &limitErr) {
+		c.JSON(413, gin.H{"error": limitErr.Error(), "file": limitErr.File, "max": limitErr.Limit})
+		return true
+	}
+	fmt.Printf("[files] error guardando archivos: %v\n", err)
+	c.JSON(500, gin.H{"error": "no se pudieron guardar los archivos"})
+	return true
+}
+
+// readMultipartFiles lee las partes con archivo de un multipart/form-data
+// (de cualquier campo) sin guardarlas en disco. Cada una se corta en
+// maxBytes (0 = sin límite) y se pasa a UTF-8 desde la codificación
+// detectada (ver charset.Decode); las que no se pueden decodificar se
+// rechazan, así no llegan como texto corrupto. El campo de texto "tags" se aplica a todos los
+// archivos. El error es solo para un body inválido.
+func readMultipartFiles(r *http.Request, maxBytes int) ([]internal.KnowledgeFile, []internal.FileRejection, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, errors.New("se esperaba multipart/form-data")
+	}
+	var (
+		files    []internal.KnowledgeFile
+		rejected []internal.FileRejection
+		tags     []string
+	)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("multipart inválido: %w", err)
+		}
+		name := part.FileName()
+		if name == "" {
+			// campo de texto del formulario, no un archivo
+			if part.FormName() == "tags" {
+				b, _ := io.ReadAll(io.LimitReader(part, maxTagsFieldBytes))
+				tags = append(tags, string(b))
+			}
+			part.Close()
+			continue
+		}
+		src := io.Reader(part)
+		if maxBytes > 0 {
+			src = io.LimitReader(part, int64(maxBytes)+1)
+		}
+		b, err := io.ReadAll(src)
+		part.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error leyendo %s: %w", name, err)
+		}
+		if maxBytes > 0 && len(b) > maxBytes {
+			rejected = append(rejected, internal.FileRejection{Name: name, Error: fmt.Sprintf("el máximo por archivo es %d bytes", maxBytes)})
+			continue
+		}
+		text, enc, err := charset.Decode(b)
+		if err != nil {
+			rejected = append(rejected, internal.FileRejection{Name: name, Error: err.Error()})
+			continue
+		}
+		if enc != charset.UTF8 {
+			fmt.Printf("[files] %s convertido de %s a UTF-8\n", name, enc)
+		}
+		files = append(files, internal.KnowledgeFile{Name: name, Size: len(text), Text: text, Encoding: enc})
+	}
+	// el campo puede venir antes o después de los archivos
+	for i := range files {
+		files[i].Tags = tags
+	}
+	return files, rejected, nil
+}
+
+// Topes por defecto de POST /api/files/zip (ZIP_MAX_ENTRIES; ZIP_MAX_BYTES
+// por defecto es MAX_TOTAL_BYTES: más de eso no entra en la knowledge base).
+const defaultZipMaxEntries = 100
+
+// errZipLimit: el zip supera ZIP_MAX_ENTRIES o ZIP_MAX_BYTES (posible zip
+// bomb); se rechaza entero.
+var errZipLimit = errors.New("zip demasiado grande")
+
+// zipLimits acota lo que se extrae de un zip: la cantidad de entradas (de
+// cualquier tipo), el total descomprimido y el tamaño de cada CSV.
+type zipLimits struct {
+	MaxEntries   int
+	MaxBytes     int
+	MaxFileBytes int
+}
+
+// readZipUpload lee un zip de un multipart/form-data (la única parte con
+// archivo; el campo "tags" se aplica a todos) y extrae sus .csv con
+// readZipFiles. El zip se lee entero a memoria: su tamaño ya lo acota
+// MAX_REQUEST_BYTES.
+func readZipUpload(r *http.Request, lim zipLimits) ([]internal.KnowledgeFile, []internal.FileRejection, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, errors.New("se esperaba multipart/form-data")
+	}
+	var (
+		archive []byte
+		zipName string
+		tags    []string
+	)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("multipart inválido: %w", err)
+		}
+		name := part.FileName()
+		if name == "" {
+			if part.FormName() == "tags" {
+				b, _ := io.ReadAll(io.LimitReader(part, maxTagsFieldBytes))
+				tags = append(tags, string(b))
+			}
+			part.Close()
+			continue
+		}
+		if zipName != "" {
+			part.Close()
+			return nil, nil, errors.New("se espera un solo archivo zip")
+		}
+		archive, err = io.ReadAll(part)
+		part.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error leyendo %s: %w", name, err)
+		}
+		zipName = name
+	}
+	if zipName == "" {
+		return nil, nil, errors.New("no se recibió ningún archivo zip")
+	}
+	files, rejected, err := readZipFiles(archive, lim)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", zipName, err)
+	}
+	for i := range files {
+		files[i].Tags = tags
+	}
+	return files, rejected, nil
+}
+
+// readZipFiles extrae los .csv de archive como readMultipartFiles: cada uno
+// se corta en lim.MaxFileBytes y se pasa a UTF-8. Las carpetas y la metadata
+// de macOS (__MACOSX/, archivos ocultos) se saltean sin avisar; las rutas
+// absolutas o con "..", los archivos que no son .csv y los nombres repetidos
+// se rechazan uno por uno. Los archivos se guardan con su nombre sin la
+// carpeta. Falla con errZipLimit si hay más de lim.MaxEntries entradas o si
+// lo descomprimido pasa de lim.MaxBytes; lo que dice el encabezado de cada
+// entrada no se cree, se cuentan los bytes leídos.
+func readZipFiles(archive []byte, lim zipLimits) ([]internal.KnowledgeFile, []internal.FileRejection, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, nil, errors.New("no es un archivo zip válido")
+	}
+	if len(zr.File) > lim.MaxEntries {
+		return nil, nil, fmt.Errorf("%w: tiene %d entradas y el máximo es %d", errZipLimit, len(zr.File), lim.MaxEntries)
+	}
+	var (
+		files    []internal.KnowledgeFile
+		rejected []internal.FileRejection
+		seen     = make(map[string]bool)
+		total    int
+	)
+	for _, f := range zr.File {
+		entry := strings.ReplaceAll(f.Name, `\`, "/")
+		base := path.Base(entry)
+		if f.FileInfo().IsDir() || strings.HasSuffix(entry, "/") ||
+			strings.HasPrefix(entry, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		if !safeZipPath(entry) {
+			rejected = append(rejected, internal.FileRejection{Name: f.Name, Error: "ruta inválida dentro del zip"})
+			continue
+		}
+		if !strings.EqualFold(path.Ext(base), ".csv") {
+			rejected = append(rejected, internal.FileRejection{Name: f.Name, Error: "del zip solo se extraen archivos .csv"})
+			continue
+		}
+		if seen[base] {
+			rejected = append(rejected, internal.FileRejection{Name: f.Name, Error: fmt.Sprintf("hay otro %s en el zip", base)})
+			continue
+		}
+		seen[base] = true
+		tooBig := internal.FileRejection{Name: f.Name, Error: fmt.Sprintf("el máximo por archivo es %d bytes", lim.MaxFileBytes)}
+		if f.UncompressedSize64 > uint64(lim.MaxFileBytes) {
+			rejected = append(rejected, tooBig)
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			rejected = append(rejected, internal.FileRejection{Name: f.Name, Error: fmt.Sprintf("no se pudo extraer: %v", err)})
+			continue
+		}
+		b, err := io.ReadAll(io.LimitReader(rc, int64(lim.MaxFileBytes)+1))
+		rc.Close()
+		total += len(b)
+		if total > lim.MaxBytes {
+			return nil, nil, fmt.Errorf("%w: descomprimido supera el máximo de %d bytes", errZipLimit, lim.MaxBytes)
+		}
+		if err != nil {
+			rejected = append(rejected, internal.FileRejection{Name: f.Name, Error: fmt.Sprintf("no se pudo extraer: %v", err)})
+			continue
+		}
+		if len(b) > lim.MaxFileBytes {
+			rejected = append(rejected, tooBig)
+			continue
+		}
+		text, enc, err := charset.Decode(b)
+		if err != nil {
+			rejected = append(rejected, internal.FileRejection{Name: f.Name, Error: err.Error()})
+			continue
+		}
+		if enc != charset.UTF8 {
+			fmt.Printf("[files] %s convertido de %s a UTF-8\n", f.Name, enc)
+		}
+		files = append(files, internal.KnowledgeFile{Name: base, Size: len(text), Text: text, Encoding: enc})
+	}
+	return files, rejected, nil
+}
+
+// safeZipPath rechaza las rutas que saldrían de la carpeta de extracción:
+// absolutas, con unidad de Windows o con "..". Nada se escribe a disco, pero
+// un zip así no es un paquete de CSVs legítimo.
+func safeZipPath(name string) bool {
+	if path.IsAbs(name) || (len(name) > 1 && name[1] == ':') {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
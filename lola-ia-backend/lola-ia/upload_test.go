@@ -0,0 +1,371 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/charset"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+func TestAddFilesFailed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"sin error", nil, 0},
+		{"límite", &store.LimitError{File: "a.csv", Size: 10, Limit: 5}, 413},
+		{"base", errors.New("guardando a.csv: disco lleno"), 500},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			failed := addFilesFailed(c, tc.err)
+			if failed != (tc.err != nil) {
+				t.Fatalf("addFilesFailed = %v", failed)
+			}
+			if tc.err == nil {
+				return
+			}
+			if w.Code != tc.code {
+				t.Errorf("status %d, want %d", w.Code, tc.code)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] == "" {
+				t.Errorf("body = %s", w.Body)
+			}
+		})
+	}
+}
+
+// uploadFixtures son un CSV válido, una página HTML y un binario (un PNG)
+// subidos con extensión .csv.
+var uploadFixtures = []internal.KnowledgeFile{
+	{Name: "ok.csv", Text: "id,comentario\n1,\"lento, caro\"\n"},
+	{Name: "pagina.csv", Text: "<!DOCTYPE html><html><body><table><tr><td>1</td></tr></table></body></html>"},
+	{Name: "imagen.csv", Text: "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"},
+}
+
+func TestValidateUploads(t *testing.T) {
+	accepted, rejected := validateUploads(uploadFixtures, nil)
+	if len(accepted) != 1 || accepted[0].Name != "ok.csv" || accepted[0].Format != "csv" {
+		t.Errorf("aceptados = %+v", accepted)
+	}
+	reasons := make(map[string]string)
+	for _, r := range rejected {
+		reasons[r.Name] = r.Error
+	}
+	if !strings.Contains(reasons["pagina.csv"], "HTML") {
+		t.Errorf("HTML: motivo %q", reasons["pagina.csv"])
+	}
+	if !strings.Contains(reasons["imagen.csv"], "binario") {
+		t.Errorf("binario: motivo %q", reasons["imagen.csv"])
+	}
+}
+
+func TestUploadFilesRejections(t *testing.T) {
+	r := newTestRouter(t, nil)
+	sid := []string{"X-Session-ID", "s-upload"}
+	body := func(files ...internal.KnowledgeFile) string {
+		b, _ := json.Marshal(internal.UploadFilesRequest{Files: files})
+		return string(b)
+	}
+
+	// todos rechazados: 422 con el motivo de cada uno
+	w := call(r, "POST", "/api/files", body(uploadFixtures[1:]...), sid...)
+	var res internal.UploadFilesResponse
+	decode(t, w, &res)
+	if w.Code != 422 || len(res.Rejected) != 2 || len(res.Accepted) != 0 {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+
+	// con alguno válido: 200 con aceptados y rechazados
+	w = call(r, "POST", "/api/files", body(uploadFixtures...), sid...)
+	res = internal.UploadFilesResponse{}
+	decode(t, w, &res)
+	if w.Code != 200 || len(res.Accepted) != 1 || res.Accepted[0] != "ok.csv" || len(res.Rejected) != 2 {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+}
+
+// multipartBody arma un multipart/form-data con un archivo por cada par
+// nombre, contenido de files y el campo tags si no está vacío.
+func multipartBody(t *testing.T, tags string, files ...string) (body *bytes.Buffer, contentType string) {
+	t.Helper()
+	body = &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for i := 0; i+1 < len(files); i += 2 {
+		fw, err := mw.CreateFormFile("files", files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(files[i+1]))
+	}
+	if tags != "" {
+		mw.WriteField("tags", tags)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return body, mw.FormDataContentType()
+}
+
+func TestUploadMultipart(t *testing.T) {
+	r := newTestRouter(t, nil)
+	body, ct := multipartBody(t, "nps",
+		"enero.csv", "id,comentario\n1,rápido\n",
+		"febrero.csv", "id,comentario\n2,lento\n3,caro\n",
+		"planilla.csv", "PK\x03\x04\x00\x00\x81\x8d\x8f\x90\x9d",
+	)
+	req := httptest.NewRequest("POST", "/api/files/upload", body)
+	req.Header.Set("Content-Type", ct)
+	req.Header.Set("X-Session-ID", "s-multipart")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var res internal.UploadFilesResponse
+	decode(t, w, &res)
+	if w.Code != 200 || !slices.Equal(res.Accepted, []string{"enero.csv", "febrero.csv"}) {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if len(res.Rejected) != 1 || res.Rejected[0].Name != "planilla.csv" {
+		t.Errorf("rejected = %+v, want el binario", res.Rejected)
+	}
+	var info internal.FileInfoResponse
+	decode(t, call(r, "GET", "/api/files/febrero.csv?include_text=true", "", "X-Session-ID", "s-multipart"), &info)
+	if info.Rows != 2 || info.Text != "id,comentario\n2,lento\n3,caro\n" || !slices.Equal(info.Tags, []string{"nps"}) {
+		t.Errorf("febrero.csv = %+v", info)
+	}
+}
+
+func TestUploadMultipartInvalid(t *testing.T) {
+	r := newTestRouter(t, nil)
+	// JSON en vez de multipart
+	if w := call(r, "POST", "/api/files/upload", `{"files":[]}`); w.Code != 400 {
+		t.Errorf("JSON: status %d, want 400", w.Code)
+	}
+	// multipart sin archivos
+	body, ct := multipartBody(t, "nps")
+	req := httptest.NewRequest("POST", "/api/files/upload", body)
+	req.Header.Set("Content-Type", ct)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Errorf("sin archivos: status %d, want 400", w.Code)
+	}
+}
+
+func TestUploadSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schemas.json")
+	if err := os.WriteFile(path, []byte(`{"ventas": {"columns": ["fecha", "region", "monto"]}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(t, map[string]string{"SCHEMA_PATH": path})
+	sid := []string{"X-Session-ID", "s-schema"}
+	upload := func(files ...internal.KnowledgeFile) (int, internal.UploadFilesResponse) {
+		t.Helper()
+		body, _ := json.Marshal(internal.UploadFilesRequest{Files: files})
+		w := call(r, "POST", "/api/files", string(body), sid...)
+		var res internal.UploadFilesResponse
+		decode(t, w, &res)
+		return w.Code, res
+	}
+
+	code, res := upload(
+		internal.KnowledgeFile{Name: "ventas_mayo.csv", Text: "Fecha,Región,Monto,canal\n2024-05-01,Sur,10,app\n"},
+		internal.KnowledgeFile{Name: "otros.csv", Text: "a,b\n1,2\n"}, // sin esquema: pasa
+	)
+	if code != 200 || !slices.Equal(res.Accepted, []string{"ventas_mayo.csv", "otros.csv"}) || len(res.Rejected) != 0 {
+		t.Errorf("archivos válidos: status %d, %+v", code, res)
+	}
+
+	code, res = upload(internal.KnowledgeFile{Name: "ventas_junio.csv", Text: "fecha,total\n2024-06-01,10\n"})
+	if code != 422 || len(res.Rejected) != 1 {
+		t.Fatalf("falta una columna: status %d, %+v", code, res)
+	}
+	rej := res.Rejected[0]
+	if rej.Name != "ventas_junio.csv" || rej.Schema != "ventas" || !slices.Equal(rej.Missing, []string{"region", "monto"}) {
+		t.Errorf("rechazo = %+v", rej)
+	}
+}
+
+func TestUploadMultipartEncodings(t *testing.T) {
+	r := newTestRouter(t, nil)
+	want := "id,comentario\n1,\"Análisis: tardó\"\n"
+	utf16le := []byte{0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(want)) {
+		utf16le = binary.LittleEndian.AppendUint16(utf16le, u)
+	}
+	body, ct := multipartBody(t, "",
+		"utf16.csv", string(utf16le),
+		"latin.csv", "id,comentario\n1,\"An\xe1lisis: tard\xf3\"\n",
+		"utf8.csv", want,
+	)
+	req := httptest.NewRequest("POST", "/api/files/upload", body)
+	req.Header.Set("Content-Type", ct)
+	req.Header.Set("X-Session-ID", "s-charset")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	for name, enc := range map[string]string{"utf16.csv": charset.UTF16LE, "latin.csv": charset.Windows1252, "utf8.csv": charset.UTF8} {
+		var info internal.FileInfoResponse
+		decode(t, call(r, "GET", "/api/files/"+name+"?include_text=true", "", "X-Session-ID", "s-charset"), &info)
+		if info.Text != want || info.Encoding != enc || info.Size != len(want) {
+			t.Errorf("%s: text %q, encoding %q, size %d", name, info.Text, info.Encoding, info.Size)
+		}
+	}
+}
+
+// zipArchive arma un zip con las entradas dadas como pares nombre, contenido;
+// un nombre terminado en "/" es una carpeta.
+func zipArchive(t *testing.T, entries ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(entries); i += 2 {
+		w, err := zw.Create(entries[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entries[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadZipFiles(t *testing.T) {
+	lim := zipLimits{MaxEntries: 10, MaxBytes: 1000, MaxFileBytes: 100}
+	archive := zipArchive(t,
+		"datos/", "",
+		"datos/enero.csv", "id,nps\n1,9\n",
+		"febrero.CSV", "id,nps\n2,3\n",
+		"__MACOSX/datos/._enero.csv", "basura",
+		".DS_Store", "basura",
+		"../fuera.csv", "id\n1\n",
+		"notas.txt", "hola",
+		"otros/enero.csv", "id,nps\n3,5\n",
+		"grande.csv", strings.Repeat("x", 101),
+	)
+	files, rejected, err := readZipFiles(archive, lim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	if !slices.Equal(names, []string{"enero.csv", "febrero.CSV"}) || files[0].Text != "id,nps\n1,9\n" {
+		t.Errorf("extraídos = %v", names)
+	}
+	want := map[string]string{
+		"../fuera.csv":    "ruta inválida",
+		"notas.txt":       "solo se extraen archivos .csv",
+		"otros/enero.csv": "hay otro enero.csv",
+		"grande.csv":      "el máximo por archivo es 100 bytes",
+	}
+	if len(rejected) != len(want) {
+		t.Errorf("rechazados = %+v", rejected)
+	}
+	for _, r := range rejected {
+		if !strings.Contains(r.Error, want[r.Name]) || want[r.Name] == "" {
+			t.Errorf("rechazo de %s: %q", r.Name, r.Error)
+		}
+	}
+
+	if _, _, err := readZipFiles(zipArchive(t, "a.csv", "x", "b.csv", "y", "c.csv", "z"), zipLimits{MaxEntries: 2, MaxBytes: 1000, MaxFileBytes: 100}); !errors.Is(err, errZipLimit) {
+		t.Errorf("demasiadas entradas: err = %v", err)
+	}
+	if _, _, err := readZipFiles([]byte("no soy un zip"), lim); err == nil || errors.Is(err, errZipLimit) {
+		t.Errorf("no zip: err = %v", err)
+	}
+}
+
+func TestUploadZip(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"ZIP_MAX_BYTES": "100000"})
+	upload := func(archive []byte) *httptest.ResponseRecorder {
+		t.Helper()
+		body, ct := multipartBody(t, "nps", "bundle.zip", string(archive))
+		req := httptest.NewRequest("POST", "/api/files/zip", body)
+		req.Header.Set("Content-Type", ct)
+		req.Header.Set("X-Session-ID", "s-zip")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := upload(zipArchive(t, "enero.csv", "id,comentario\n1,rápido\n", "febrero.csv", "id,comentario\n2,lento\n", "leeme.txt", "hola"))
+	var res internal.UploadFilesResponse
+	decode(t, w, &res)
+	if w.Code != 200 || !slices.Equal(res.Accepted, []string{"enero.csv", "febrero.csv"}) || len(res.Rejected) != 1 || res.Rejected[0].Name != "leeme.txt" {
+		t.Errorf("zip válido: %d %+v", w.Code, res)
+	}
+
+	// zip bomb: se comprime a casi nada y descomprimido pasa ZIP_MAX_BYTES
+	bomb := make([]string, 0, 8)
+	for i := range 4 {
+		bomb = append(bomb, fmt.Sprintf("parte%d.csv", i), "id\n"+strings.Repeat("0\n", 20000))
+	}
+	archive := zipArchive(t, bomb...)
+	if len(archive) > 10000 {
+		t.Fatalf("el zip de prueba pesa %d bytes", len(archive))
+	}
+	w = upload(archive)
+	if w.Code != 413 || !strings.Contains(w.Body.String(), "descomprimido supera") {
+		t.Errorf("zip bomb: %d %s", w.Code, w.Body)
+	}
+	// no quedó nada a medias
+	var list struct {
+		Files []internal.KnowledgeFile `json:"files"`
+	}
+	decode(t, call(r, "GET", "/api/files", "", "X-Session-ID", "s-zip"), &list)
+	if len(list.Files) != 2 {
+		t.Errorf("%d archivos después del zip bomb, want 2", len(list.Files))
+	}
+}
+
+func TestUploadNormalizeHeaders(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"NORMALIZE_HEADERS": "true"})
+	sid := []string{"X-Session-ID", "s-headers"}
+	w := call(r, "POST", "/api/files", `{"files":[{"name":"clientes.csv","text":"Customer Name,NPS Score\nAna,9\nBeto,3\n"}]}`, sid...)
+	var res internal.UploadFilesResponse
+	decode(t, w, &res)
+	want := []internal.HeaderRename{{Original: "Customer Name", Name: "customer_name"}, {Original: "NPS Score", Name: "nps_score"}}
+	if !slices.Equal(res.RenamedHeaders["clientes.csv"], want) {
+		t.Errorf("renamed_headers = %+v", res.RenamedHeaders)
+	}
+
+	var p internal.FilePreviewResponse
+	decode(t, call(r, "GET", "/api/files/clientes.csv/preview", "", sid...), &p)
+	if !slices.Equal(p.Headers, []string{"customer_name", "nps_score"}) || !slices.Equal(p.OriginalHeaders, []string{"Customer Name", "NPS Score"}) {
+		t.Errorf("preview: headers %q, originales %q", p.Headers, p.OriginalHeaders)
+	}
+	// las consultas aceptan cualquiera de las dos formas
+	var q internal.FileQueryResponse
+	decode(t, call(r, "POST", "/api/files/clientes.csv/query", `{"group_by":"Customer Name","func":"sum","column":"nps_score"}`, sid...), &q)
+	if len(q.Groups) != 2 {
+		t.Errorf("query = %+v", q)
+	}
+}
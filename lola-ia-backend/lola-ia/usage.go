@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+// recordUsage suma el consumo de una respuesta a la sesión sid; nil (el
+// provider no lo informa) no cuenta.
+func recordUsage(mem store.Store, sid string, u *internal.Usage) {
+	if u != nil {
+		mem.AddUsage(sid, *u)
+	}
+}
+
+// usageReport arma la respuesta de GET /api/usage con las sesiones de ns,
+// mostradas sin el prefijo.
+func usageReport(mem store.Store, ns string) internal.UsageReport {
+	rep := internal.UsageReport{Sessions: mem.UsageBySession(ns)}
+	for i, su := range rep.Sessions {
+		rep.Sessions[i].SessionID = strings.TrimPrefix(su.SessionID, ns)
+		rep.Total.InputTokens += su.InputTokens
+		rep.Total.OutputTokens += su.OutputTokens
+		rep.Total.TotalTokens += su.TotalTokens
+		rep.Replies += su.Replies
+	}
+	return rep
+}
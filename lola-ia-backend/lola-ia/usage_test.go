@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+func TestSendMessageUsage(t *testing.T) {
+	r := newTestRouter(t, nil)
+	w := call(r, "POST", "/api/messages", `{"content":"hola, ¿cómo va?"}`, "X-Session-ID", "s-usage")
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var res internal.SendMessageResponse
+	decode(t, w, &res)
+	u := res.Usage
+	if u == nil || u.InputTokens == 0 || u.OutputTokens == 0 || u.TotalTokens != u.InputTokens+u.OutputTokens {
+		t.Errorf("usage = %+v", u)
+	}
+}
+
+func TestUsageEndpoint(t *testing.T) {
+	r := newTestRouter(t, map[string]string{"API_KEYS": "key-a,key-b"})
+	a := []string{"Authorization", "Bearer key-a", "X-Session-ID", "s1"}
+	var want internal.Usage
+	for _, content := range []string{"hola", "¿qué temas aparecen en los comentarios?"} {
+		var res internal.SendMessageResponse
+		decode(t, call(r, "POST", "/api/messages", `{"content":"`+content+`"}`, a...), &res)
+		want.InputTokens += res.Usage.InputTokens
+		want.OutputTokens += res.Usage.OutputTokens
+		want.TotalTokens += res.Usage.TotalTokens
+	}
+	call(r, "POST", "/api/messages", `{"content":"otra key"}`, "Authorization", "Bearer key-b", "X-Session-ID", "s1")
+
+	usage := func() internal.UsageReport {
+		t.Helper()
+		var rep internal.UsageReport
+		decode(t, call(r, "GET", "/api/usage", "", a...), &rep)
+		return rep
+	}
+	rep := usage()
+	if len(rep.Sessions) != 1 || rep.Sessions[0].SessionID != "s1" || rep.Sessions[0].Usage != want || rep.Total != want || rep.Replies != 2 {
+		t.Errorf("usage = %+v, want %+v en 2 respuestas", rep, want)
+	}
+
+	// el reset archiva la conversación pero no toca el consumo
+	call(r, "POST", "/api/reset", "", a...)
+	call(r, "POST", "/api/reset?hard=true", "", a...)
+	if rep := usage(); rep.Total != want {
+		t.Errorf("después del reset: %+v, want %+v", rep.Total, want)
+	}
+
+	if w := call(r, "DELETE", "/api/usage", "", a...); w.Code != 200 {
+		t.Fatalf("DELETE: status %d", w.Code)
+	}
+	if rep := usage(); len(rep.Sessions) != 0 || rep.Total.TotalTokens != 0 {
+		t.Errorf("después de borrar: %+v", rep)
+	}
+	// el de la otra key sigue
+	var other internal.UsageReport
+	decode(t, call(r, "GET", "/api/usage", "", "Authorization", "Bearer key-b"), &other)
+	if other.Replies != 1 {
+		t.Errorf("key-b = %+v", other)
+	}
+}
+
+// Sin API_KEYS el consumo no se ve ni se borra: el reporte lista los IDs de
+// todas las sesiones.
+func TestUsageEndpointNoAuth(t *testing.T) {
+	r := newTestRouter(t, nil)
+	call(r, "POST", "/api/messages", `{"content":"hola"}`, "X-Session-ID", "s-usage")
+	for _, method := range []string{"GET", "DELETE"} {
+		w := call(r, method, "/api/usage", "", "X-Session-ID", "s-usage")
+		if w.Code != 403 || strings.Contains(w.Body.String(), "s-usage") {
+			t.Errorf("%s sin auth: status %d: %s", method, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/nubank/lola-ia-backend/internal"
+	"github.com/nubank/lola-ia-backend/internal/provider"
+	"github.com/nubank/lola-ia-backend/internal/store"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	// wsPongWait es cuánto se espera un pong (o cualquier frame) antes de
+	// dar la conexión por muerta; los pings salen cada wsPingEvery.
+	wsPongWait    = 60 * time.Second
+	wsPingEvery   = wsPongWait * 9 / 10
+	wsMaxFrame    = 1 << 20
+	wsQueuedFrame = 8
+)
+
+// wsFrame es lo que el servidor envía por el socket. Type es "message"
+// (mensaje nuevo de la sesión, propio o de otro socket), "token" (fragmento
+// de la respuesta en curso, solo a quien preguntó), "done" o "error".
+type wsFrame struct {
+	Type    string                        `json:"type"`
+	Message *internal.Message             `json:"message,omitempty"`
+	Delta   string                        `json:"delta,omitempty"`
+	Reply   *internal.SendMessageResponse `json:"reply,omitempty"`
+	Mode    string                        `json:"mode,omitempty"`
+	Error   string                        `json:"error,omitempty"`
+}
+
+// wsConn serializa las escrituras: gorilla admite un solo escritor a la vez.
+type wsConn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *wsConn) send(f wsFrame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.ws.WriteJSON(f)
+}
+
+// wsHub agrupa los sockets abiertos por sesión para difundirles los
+// mensajes nuevos.
+type wsHub struct {
+	mu    sync.Mutex
+	conns map[string]map[*wsConn]struct{}
+}
+
+func newWSHub() *wsHub {
+	return &wsHub{conns: make(map[string]map[*wsConn]struct{})}
+}
+
+func (h *wsHub) join(sid string, c *wsConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conns[sid] == nil {
+		h.conns[sid] = make(map[*wsConn]struct{})
+	}
+	h.conns[sid][c] = struct{}{}
+}
+
+func (h *wsHub) leave(sid string, c *wsConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns[sid], c)
+	if len(h.conns[sid]) == 0 {
+		delete(h.conns, sid)
+	}
+}
+
+// broadcast envía f a todos los sockets de sid. Un socket que falla se
+// ignora: su propio loop de lectura lo cierra.
+func (h *wsHub) broadcast(sid string, f wsFrame) {
+	h.mu.Lock()
+	conns := make([]*wsConn, 0, len(h.conns[sid]))
+	for c := range h.conns[sid] {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+	for _, c := range conns {
+		_ = c.send(f)
+	}
+}
+
+// wsChat es el chat por WebSocket: recibe SendMessageRequest como frames
+// JSON y responde con wsFrame; cada consulta pasa por el mismo turnService
+// que POST /api/messages.
+type wsChat struct {
+	turns    *turnService
+	files    func(sid string) store.FileScope
+	hub      *wsHub
+	upgrader websocket.Upgrader
+}
+
+func newWSChat(turns *turnService, files func(string) store.FileScope, origins []string) *wsChat {
+	wildcard := false
+	for _, o := range origins {
+		wildcard = wildcard || o == "*"
+	}
+	return &wsChat{
+		turns: turns,
+		files: files,
+		hub:   newWSHub(),
+		upgrader: websocket.Upgrader{
+			// mismos orígenes que CORS; sin Origin es un cliente que no es navegador
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				return wildcard || origin == "" || originAllowed(origin, origins)
+			},
+		},
+	}
+}
+
+func (w *wsChat) handle(c *gin.Context) {
+	sid := sessionID(c, w.turns.mem)
+	// sessionID dejó la cookie/header en c.Writer: van en la respuesta del upgrade
+	ws, err := w.upgrader.Upgrade(c.Writer, c.Request, c.Writer.Header())
+	if err != nil {
+		// Upgrade ya respondió el error al cliente
+		return
+	}
+	conn := &wsConn{ws: ws}
+	w.hub.join(sid, conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		w.hub.leave(sid, conn)
+		ws.Close()
+	}()
+
+	// keepalive: cada pong (o frame) renueva el plazo de lectura
+	ws.SetReadLimit(wsMaxFrame)
+	ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go func() {
+		t := time.NewTicker(wsPingEvery)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	// las consultas se atienden de a una y fuera del loop de lectura, para
+	// que los pongs se sigan leyendo mientras responde el proveedor
+	queue := make(chan wsQuery, wsQueuedFrame)
+	go func() {
+		for q := range queue {
+			w.reply(ctx, sid, conn, q)
+		}
+	}()
+	defer close(queue)
+
+	for {
+		var req internal.SendMessageRequest
+		if err := ws.ReadJSON(&req); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				fmt.Printf("[ws] conexión cerrada (sesión %s): %v\n", sid, err)
+			}
+			return
+		}
+		ws.SetReadDeadline(time.Now().Add(wsPongWait))
+		chat, err := w.turns.validate(req)
+		if err != nil {
+			_ = conn.send(wsFrame{Type: "error", Error: err.Error()})
+			continue
+		}
+		select {
+		case queue <- wsQuery{req: req, chat: chat}:
+		default:
+			_ = conn.send(wsFrame{Type: "error", Error: "demasiadas consultas en curso"})
+		}
+	}
+}
+
+// wsQuery es una consulta ya validada, con el provider que le toca.
+type wsQuery struct {
+	req  internal.SendMessageRequest
+	chat provider.ChatProvider
+}
+
+// reply procesa una consulta: difunde el mensaje del usuario, manda los
+// fragmentos a conn y difunde la respuesta final a toda la sesión.
+func (w *wsChat) reply(ctx context.Context, sid string, conn *wsConn, q wsQuery) {
+	req, chat := q.req, q.chat
+	if err := w.turns.moderate(ctx, req.Content); err != nil {
+		msg := err.Error()
+		var te *turnError
+		if errors.As(err, &te) && te.Extra["reason"] != nil {
+			msg = fmt.Sprintf("%s: %v", msg, te.Extra["reason"])
+		}
+		_ = conn.send(wsFrame{Type: "error", Error: msg})
+		return
+	}
+	kb := w.files(sid)
+	ctx = withFiles(ctx, kb)
+	out, err := w.turns.run(ctx, chatTurn{
+		sid:  sid,
+		req:  req,
+		chat: chat,
+		kb:   kb,
+		stream: func(ctx context.Context, chat provider.ChatProvider, history []internal.Message, prompt string) (provider.Result, error) {
+			tokens := make(chan string)
+			forwarded := make(chan struct{})
+			go func() {
+				defer close(forwarded)
+				for tok := range tokens {
+					_ = conn.send(wsFrame{Type: "token", Delta: tok})
+				}
+			}()
+			res, err := chat.ReplyStream(ctx, history, prompt, tokens)
+			close(tokens)
+			// "done" no debe adelantarse a los últimos fragmentos
+			<-forwarded
+			return res, err
+		},
+		// se difunde ya, pero se guarda junto con la respuesta
+		started: func(user internal.Message, _, _ string) {
+			w.hub.broadcast(sid, wsFrame{Type: "message", Message: &user})
+		},
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Printf("[ws] cliente desconectado; consulta cancelada (sesión %s)\n", sid)
+			return
+		}
+		msg := err.Error()
+		if !errors.Is(err, errLLMBusy) {
+			_, msg = providerError(err, chat.Model())
+		}
+		_ = conn.send(wsFrame{Type: "error", Error: msg})
+		return
+	}
+	if out.Duplicate || out.Response.Degraded {
+		// solo a este cliente: no hay nada nuevo guardado
+		_ = conn.send(wsFrame{Type: "done", Mode: out.Mode, Reply: &out.Response})
+		return
+	}
+	if out.Cached {
+		// sin proveedor no pasó por started
+		w.hub.broadcast(sid, wsFrame{Type: "message", Message: &out.User})
+	}
+	_ = conn.send(wsFrame{Type: "done", Mode: out.Mode, Reply: &out.Response})
+	w.hub.broadcast(sid, wsFrame{Type: "message", Message: &out.Response.Reply})
+}
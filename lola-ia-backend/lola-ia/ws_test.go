@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/nubank/lola-ia-backend/internal"
+)
+
+// dialWS abre un socket contra /ws de srv en la sesión sid.
+func dialWS(t *testing.T, srv *httptest.Server, sid string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	ws, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Session-ID": {sid}})
+	if err != nil {
+		t.Fatalf("dial: %v (%v)", err, resp)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// readFrame lee el próximo frame de ws, con un plazo para que el test no
+// se cuelgue.
+func readFrame(t *testing.T, ws *websocket.Conn) wsFrame {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var f wsFrame
+	if err := ws.ReadJSON(&f); err != nil {
+		t.Fatalf("leyendo frame: %v", err)
+	}
+	return f
+}
+
+func TestWSChat(t *testing.T) {
+	srv := httptest.NewServer(newTestRouter(t, nil))
+	defer srv.Close()
+	ws, other := dialWS(t, srv, "s-ws"), dialWS(t, srv, "s-ws")
+	// con la respuesta a un frame inválido other ya está unido a la sesión
+	other.WriteJSON(internal.SendMessageRequest{})
+	if f := readFrame(t, other); f.Type != "error" {
+		t.Fatalf("frame vacío: %+v", f)
+	}
+
+	if err := ws.WriteJSON(internal.SendMessageRequest{Content: "hola"}); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		user   *internal.Message
+		tokens strings.Builder
+		done   wsFrame
+	)
+	for done.Type == "" {
+		switch f := readFrame(t, ws); f.Type {
+		case "message":
+			user = f.Message
+		case "token":
+			tokens.WriteString(f.Delta)
+		case "done":
+			done = f
+		default:
+			t.Fatalf("frame inesperado: %+v", f)
+		}
+	}
+	if user == nil || user.Role != internal.RoleUser || user.Content != "hola" {
+		t.Errorf("mensaje del usuario = %+v", user)
+	}
+	if done.Reply == nil || done.Reply.Reply.Content == "" || done.Mode != "plain" {
+		t.Fatalf("done = %+v", done)
+	}
+	if tokens.String() != done.Reply.Reply.Content {
+		t.Errorf("tokens = %q, reply = %q", tokens.String(), done.Reply.Reply.Content)
+	}
+
+	// el otro socket de la sesión recibe los dos mensajes, sin los tokens
+	for _, want := range []internal.Role{internal.RoleUser, internal.RoleAssistant} {
+		if f := readFrame(t, other); f.Type != "message" || f.Message.Role != want {
+			t.Errorf("otro socket: frame %+v, want mensaje de %s", f, want)
+		}
+	}
+	// y quedaron guardados como los de POST /api/messages
+	var h internal.ChatHistory
+	decode(t, call(srv.Config.Handler, "GET", "/api/messages", "", "X-Session-ID", "s-ws"), &h)
+	if n := len(h.Messages); n != 3 || h.Messages[2].ID != done.Reply.Reply.ID {
+		t.Errorf("%d mensajes guardados: %+v", n, h.Messages)
+	}
+}
+
+func TestWSChatInvalidFrame(t *testing.T) {
+	srv := httptest.NewServer(newTestRouter(t, nil))
+	defer srv.Close()
+	ws := dialWS(t, srv, "s-ws")
+	for _, req := range []internal.SendMessageRequest{
+		{},
+		{Content: "hola", Template: "nada"},
+		{Content: "hola", Language: "klingon"},
+	} {
+		if err := ws.WriteJSON(req); err != nil {
+			t.Fatal(err)
+		}
+		if f := readFrame(t, ws); f.Type != "error" || f.Error == "" {
+			t.Errorf("%+v: frame %+v, want error", req, f)
+		}
+	}
+	// el socket sigue abierto después de los errores
+	if err := ws.WriteJSON(internal.SendMessageRequest{Content: "hola"}); err != nil {
+		t.Fatal(err)
+	}
+	if f := readFrame(t, ws); f.Type != "message" {
+		t.Errorf("después de los errores: frame %+v", f)
+	}
+}
+
+// El socket procesa la consulta igual que POST /api/messages: un doble
+// envío, por cualquiera de los dos, reutiliza la respuesta del primero.
+func TestWSChatDuplicate(t *testing.T) {
+	srv := httptest.NewServer(newTestRouter(t, map[string]string{"DEDUP_WINDOW": "1m"}))
+	defer srv.Close()
+	ws := dialWS(t, srv, "s-ws")
+	ask := func() *internal.SendMessageResponse {
+		t.Helper()
+		if err := ws.WriteJSON(internal.SendMessageRequest{Content: "¿cuántas ventas hubo?"}); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			if f := readFrame(t, ws); f.Type == "done" {
+				return f.Reply
+			} else if f.Type == "error" {
+				t.Fatalf("frame %+v", f)
+			}
+		}
+	}
+	first := ask()
+	if again := ask(); again == nil || again.Reply.ID != first.Reply.ID {
+		t.Errorf("doble envío por el socket: %+v, want %s", again, first.Reply.ID)
+	}
+	var res internal.SendMessageResponse
+	decode(t, call(srv.Config.Handler, "POST", "/api/messages", `{"content":"¿cuántas ventas hubo?"}`, "X-Session-ID", "s-ws"), &res)
+	if res.Reply.ID != first.Reply.ID {
+		t.Errorf("doble envío por HTTP: %s, want %s", res.Reply.ID, first.Reply.ID)
+	}
+	var h internal.ChatHistory
+	decode(t, call(srv.Config.Handler, "GET", "/api/messages", "", "X-Session-ID", "s-ws"), &h)
+	if len(h.Messages) != 3 {
+		t.Errorf("%d mensajes guardados, want 3 (saludo y un turno)", len(h.Messages))
+	}
+}
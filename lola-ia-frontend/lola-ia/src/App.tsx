@@ -1,6 +1,6 @@
 import { useEffect, useRef, useState } from "react";
 
-type Role = "user" | "assistant";
+type Role = "user" | "assistant" | "system";
 interface Message {
   role: Role;
   content: string;
@@ -11,6 +11,9 @@ interface CsvAttachment { name: string; size: number; text: string }
 interface FilesListResp { files: CsvAttachment[] }
 interface UploadFilesResp { count: number; total: number }
 
+// Los mensajes de sistema (la persona) son para el modelo, no se muestran
+const visible = (msgs: Message[]) => msgs.filter((m) => m.role !== "system");
+
 function formatBytes(b: number) {
   if (b < 1024) return `${b} B`;
   const kb = b / 1024;
@@ -68,7 +71,7 @@ function App() {
       } catch {}
       try {
         const h = await api<{ messages: Message[] }>("/api/messages");
-        if (Array.isArray(h?.messages)) setMessages(h.messages);
+        if (Array.isArray(h?.messages)) setMessages(visible(h.messages));
       } catch (e) {
         console.error(e);
       }
@@ -180,7 +183,7 @@ function App() {
     try {
       await api<{ ok: boolean }>("/api/reset", { method: "POST" });
       const h = await api<{ messages: Message[] }>("/api/messages");
-      setMessages(h.messages || []);
+      setMessages(visible(h.messages || []));
     } catch (e) {
       console.error(e);
     }